@@ -4,21 +4,25 @@ CREATE TABLE IF NOT EXISTS roles (
 );
 CREATE TABLE IF NOT EXISTS groups (
     group_id SERIAL PRIMARY KEY,
-    group_name VARCHAR(100) UNIQUE NOT NULL
+    group_name VARCHAR(100) UNIQUE NOT NULL,
+    join_code VARCHAR(16) UNIQUE
 );
 CREATE TABLE IF NOT EXISTS users (
     user_id SERIAL PRIMARY KEY,
     "name" VARCHAR(255) NOT NULL,
     usermax_id BIGINT UNIQUE,
+    invite_code VARCHAR(16) UNIQUE,
     first_name VARCHAR(100),
     last_name VARCHAR(100),
     role_id INT REFERENCES roles(role_id),
-    group_id INT REFERENCES groups(group_id)
+    group_id INT REFERENCES groups(group_id),
+    is_headman BOOLEAN NOT NULL DEFAULT FALSE
 );
 CREATE TABLE IF NOT EXISTS subjects (
     subject_id SERIAL PRIMARY KEY,
     subject_name VARCHAR(255) NOT NULL,
-    teacher_id INT NOT NULL REFERENCES users(user_id)
+    teacher_id INT NOT NULL REFERENCES users(user_id),
+    grading_scale VARCHAR(20) NOT NULL DEFAULT 'five_point'
 );
 CREATE TABLE IF NOT EXISTS groups_subjects (
     group_id INT NOT NULL REFERENCES groups(group_id),
@@ -40,7 +44,31 @@ CREATE TABLE IF NOT EXISTS schedule (
     subject_id INT NOT NULL REFERENCES subjects(subject_id),
     teacher_id INT NOT NULL REFERENCES users(user_id),
     group_id INT NOT NULL REFERENCES groups(group_id),
-    lesson_type_id INT NOT NULL REFERENCES lesson_types(lesson_type_id)
+    lesson_type_id INT NOT NULL REFERENCES lesson_types(lesson_type_id),
+    archived BOOLEAN NOT NULL DEFAULT FALSE
+);
+CREATE TABLE IF NOT EXISTS assessment_types (
+    assessment_type_id SERIAL PRIMARY KEY,
+    type_code VARCHAR(50) UNIQUE NOT NULL,
+    title VARCHAR(100) NOT NULL,
+    default_weight NUMERIC(5, 2) NOT NULL DEFAULT 1 CHECK (default_weight >= 0)
+);
+CREATE TABLE IF NOT EXISTS subject_assessment_weights (
+    subject_id INT NOT NULL REFERENCES subjects(subject_id),
+    assessment_type_id INT NOT NULL REFERENCES assessment_types(assessment_type_id),
+    weight NUMERIC(5, 2) NOT NULL CHECK (weight >= 0),
+    PRIMARY KEY (subject_id, assessment_type_id)
+);
+CREATE TABLE IF NOT EXISTS rating_rules (
+    subject_id INT PRIMARY KEY REFERENCES subjects(subject_id),
+    grade_weight NUMERIC(5, 2) NOT NULL DEFAULT 0.7 CHECK (grade_weight >= 0),
+    attendance_weight NUMERIC(5, 2) NOT NULL DEFAULT 0.3 CHECK (attendance_weight >= 0),
+    min_attendance_percent NUMERIC(5, 2) NOT NULL DEFAULT 80 CHECK (
+        min_attendance_percent BETWEEN 0 AND 100
+    ),
+    min_rating NUMERIC(5, 2) NOT NULL DEFAULT 0 CHECK (
+        min_rating BETWEEN 0 AND 100
+    )
 );
 CREATE TABLE IF NOT EXISTS grades (
     grade_id SERIAL PRIMARY KEY,
@@ -48,8 +76,9 @@ CREATE TABLE IF NOT EXISTS grades (
     teacher_id INT NOT NULL REFERENCES users(user_id),
     subject_id INT NOT NULL REFERENCES subjects(subject_id),
     schedule_id INT NOT NULL REFERENCES schedule(schedule_id),
+    assessment_type_id INT REFERENCES assessment_types(assessment_type_id),
     grade_value INT NOT NULL CHECK (
-        grade_value BETWEEN 0 AND 5
+        grade_value BETWEEN 0 AND 100
     ),
     grade_date TIMESTAMP DEFAULT NOW()
 );
@@ -58,7 +87,158 @@ CREATE TABLE IF NOT EXISTS attendance (
     student_id INT NOT NULL REFERENCES users(user_id),
     schedule_id INT NOT NULL REFERENCES schedule(schedule_id),
     attended BOOLEAN NOT NULL,
-    mark_time TIMESTAMP DEFAULT NOW()
+    lesson_date DATE NOT NULL DEFAULT CURRENT_DATE,
+    mark_time TIMESTAMP DEFAULT NOW(),
+    marked_by INT REFERENCES users(user_id),
+    confirmed_by INT REFERENCES users(user_id),
+    UNIQUE (student_id, schedule_id, lesson_date)
+);
+CREATE TABLE IF NOT EXISTS user_settings (
+    user_id INT PRIMARY KEY REFERENCES users(user_id),
+    digest_enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    digest_time TIME NOT NULL DEFAULT '07:30',
+    reminders_enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    reminder_minutes INT NOT NULL DEFAULT 15 CHECK (
+        reminder_minutes BETWEEN 1 AND 180
+    ),
+    notify_grades BOOLEAN NOT NULL DEFAULT TRUE,
+    notify_attendance BOOLEAN NOT NULL DEFAULT TRUE,
+    notify_schedule BOOLEAN NOT NULL DEFAULT TRUE,
+    notify_announcements BOOLEAN NOT NULL DEFAULT TRUE,
+    quiet_from TIME,
+    quiet_to TIME,
+    delivery_mode VARCHAR(10) NOT NULL DEFAULT 'instant' CHECK (
+        delivery_mode IN ('instant', 'daily')
+    ),
+    summary_time TIME NOT NULL DEFAULT '20:00'
+);
+CREATE TABLE IF NOT EXISTS notification_batches (
+    batch_id SERIAL PRIMARY KEY,
+    requested_by INT NOT NULL REFERENCES users(user_id),
+    title VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    summary_sent_at TIMESTAMPTZ
+);
+CREATE TABLE IF NOT EXISTS notification_outbox (
+    outbox_id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(user_id),
+    batch_id INT REFERENCES notification_batches(batch_id),
+    category VARCHAR(20) NOT NULL,
+    message_text TEXT NOT NULL,
+    button_text VARCHAR(255) NOT NULL DEFAULT '',
+    button_payload VARCHAR(255) NOT NULL DEFAULT '',
+    attachment_type VARCHAR(10) NOT NULL DEFAULT '',
+    attachment_token TEXT NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (
+        status IN (
+            'pending',
+            'sending',
+            'sent',
+            'daily',
+            'skipped',
+            'dead'
+        )
+    ),
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    sent_at TIMESTAMPTZ
+);
+CREATE TABLE IF NOT EXISTS announcements (
+    announcement_id SERIAL PRIMARY KEY,
+    author_id INT NOT NULL REFERENCES users(user_id),
+    target_type VARCHAR(20) NOT NULL CHECK (
+        target_type IN ('group', 'subject', 'students', 'teachers')
+    ),
+    target_id INT,
+    target_title VARCHAR(255) NOT NULL,
+    message_text TEXT NOT NULL,
+    attachment_type VARCHAR(10) NOT NULL DEFAULT '',
+    attachment_token TEXT NOT NULL DEFAULT '',
+    important BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE TABLE IF NOT EXISTS announcement_receipts (
+    announcement_id INT NOT NULL REFERENCES announcements(announcement_id),
+    user_id INT NOT NULL REFERENCES users(user_id),
+    outbox_id INT NOT NULL REFERENCES notification_outbox(outbox_id),
+    acknowledged_at TIMESTAMPTZ,
+    PRIMARY KEY (announcement_id, user_id)
+);
+CREATE TABLE IF NOT EXISTS parent_students (
+    parent_id INT NOT NULL REFERENCES users(user_id),
+    student_id INT NOT NULL REFERENCES users(user_id),
+    mirror_notifications BOOLEAN NOT NULL DEFAULT FALSE,
+    linked_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (parent_id, student_id)
+);
+CREATE TABLE IF NOT EXISTS parent_invites (
+    code VARCHAR(16) PRIMARY KEY,
+    student_id INT NOT NULL REFERENCES users(user_id),
+    created_by INT NOT NULL REFERENCES users(user_id),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_by INT REFERENCES users(user_id),
+    used_at TIMESTAMPTZ
+);
+CREATE TABLE IF NOT EXISTS registration_requests (
+    request_id SERIAL PRIMARY KEY,
+    usermax_id BIGINT NOT NULL,
+    full_name VARCHAR(255) NOT NULL,
+    group_id INT NOT NULL REFERENCES groups(group_id),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    student_id INT REFERENCES users(user_id),
+    resolved_by INT REFERENCES users(user_id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    resolved_at TIMESTAMPTZ
+);
+CREATE TABLE IF NOT EXISTS attendance_submissions (
+    submission_id SERIAL PRIMARY KEY,
+    schedule_id INT NOT NULL REFERENCES schedule(schedule_id),
+    lesson_date DATE NOT NULL DEFAULT CURRENT_DATE,
+    submitted_by INT NOT NULL REFERENCES users(user_id),
+    status VARCHAR(20) NOT NULL DEFAULT 'draft',
+    submitted_at TIMESTAMPTZ,
+    reviewed_by INT REFERENCES users(user_id),
+    reviewed_at TIMESTAMPTZ,
+    UNIQUE (schedule_id, lesson_date)
+);
+CREATE TABLE IF NOT EXISTS attendance_submission_marks (
+    submission_id INT NOT NULL REFERENCES attendance_submissions(submission_id) ON DELETE CASCADE,
+    student_id INT NOT NULL REFERENCES users(user_id),
+    submitted_attended BOOLEAN NOT NULL DEFAULT TRUE,
+    attended BOOLEAN NOT NULL DEFAULT TRUE,
+    PRIMARY KEY (submission_id, student_id)
+);
+CREATE TABLE IF NOT EXISTS checkin_sessions (
+    session_id SERIAL PRIMARY KEY,
+    schedule_id INT NOT NULL REFERENCES schedule(schedule_id),
+    lesson_date DATE NOT NULL DEFAULT CURRENT_DATE,
+    teacher_id INT NOT NULL REFERENCES users(user_id),
+    started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    closed_at TIMESTAMPTZ
+);
+CREATE TABLE IF NOT EXISTS group_curators (
+    group_id INT PRIMARY KEY REFERENCES groups(group_id),
+    curator_id INT NOT NULL REFERENCES users(user_id)
+);
+CREATE TABLE IF NOT EXISTS student_alerts (
+    alert_id SERIAL PRIMARY KEY,
+    student_id INT NOT NULL REFERENCES users(user_id),
+    subject_id INT NOT NULL REFERENCES subjects(subject_id),
+    rule VARCHAR(32) NOT NULL,
+    details TEXT NOT NULL,
+    triggered_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    resolved_at TIMESTAMPTZ
+);
+CREATE TABLE IF NOT EXISTS holidays (
+    holiday_date DATE PRIMARY KEY,
+    title VARCHAR(255) NOT NULL
+);
+CREATE TABLE IF NOT EXISTS calendar_feeds (
+    user_id INT PRIMARY KEY REFERENCES users(user_id) ON DELETE CASCADE,
+    token VARCHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
 CREATE UNIQUE INDEX IF NOT EXISTS idx_users_teacher_unique ON users(first_name, last_name, role_id)
 WHERE group_id IS NULL;
@@ -73,6 +253,7 @@ CREATE INDEX IF NOT EXISTS idx_schedule_teacher_id ON schedule(teacher_id);
 CREATE INDEX IF NOT EXISTS idx_schedule_group_id ON schedule(group_id);
 CREATE INDEX IF NOT EXISTS idx_schedule_subject_id ON schedule(subject_id);
 CREATE INDEX IF NOT EXISTS idx_schedule_weekday_start_time ON schedule(weekday, start_time);
+CREATE INDEX IF NOT EXISTS idx_schedule_class_room ON schedule(class_room, weekday);
 CREATE INDEX IF NOT EXISTS idx_grades_student_id ON grades(student_id);
 CREATE INDEX IF NOT EXISTS idx_grades_teacher_id ON grades(teacher_id);
 CREATE INDEX IF NOT EXISTS idx_grades_subject_id ON grades(subject_id);
@@ -80,13 +261,32 @@ CREATE INDEX IF NOT EXISTS idx_grades_schedule_id ON grades(schedule_id);
 CREATE INDEX IF NOT EXISTS idx_grades_student_subject ON grades(student_id, subject_id);
 CREATE INDEX IF NOT EXISTS idx_attendance_student_id ON attendance(student_id);
 CREATE INDEX IF NOT EXISTS idx_attendance_schedule_id ON attendance(schedule_id);
-CREATE INDEX IF NOT EXISTS idx_attendance_student_schedule ON attendance(student_id, schedule_id);
+CREATE INDEX IF NOT EXISTS idx_notification_outbox_pending ON notification_outbox(next_attempt_at)
+WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_notification_outbox_batch ON notification_outbox(batch_id)
+WHERE batch_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_notification_outbox_daily ON notification_outbox(user_id)
+WHERE status = 'daily';
+CREATE INDEX IF NOT EXISTS idx_announcements_author ON announcements(author_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_parent_students_student ON parent_students(student_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_registration_requests_pending ON registration_requests(usermax_id)
+WHERE status = 'pending';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_checkin_sessions_open ON checkin_sessions(schedule_id, lesson_date)
+WHERE closed_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_student_alerts_open ON student_alerts(student_id, subject_id, rule)
+WHERE resolved_at IS NULL;
 CREATE INDEX IF NOT EXISTS idx_subjects_teacher_id ON subjects(teacher_id);
 CREATE INDEX IF NOT EXISTS idx_subjects_name ON subjects(subject_name);
 INSERT INTO roles (role_name)
 VALUES ('admin'),
     ('teacher'),
-    ('student') ON CONFLICT (role_name) DO NOTHING;
+    ('student'),
+    ('parent') ON CONFLICT (role_name) DO NOTHING;
+INSERT INTO assessment_types (type_code, title, default_weight)
+VALUES ('homework', 'Домашнее задание', 1),
+    ('test', 'Контрольная работа', 2),
+    ('exam', 'Экзамен', 3),
+    ('lab_defence', 'Защита лабораторной', 1.5) ON CONFLICT (type_code) DO NOTHING;
 INSERT INTO users (
         name,
         usermax_id,
@@ -15,6 +15,12 @@ type Application struct {
 	Bot    *maxAPI.Bot
 	DB     *sqlx.DB
 	logger *logger.Logger
+
+	schedulerCfg *config.SchedulerConfig
+	outboxCfg    *config.OutboxConfig
+	checkinCfg   *config.CheckinConfig
+	alertsCfg    *config.AlertsConfig
+	calendarCfg  *config.CalendarConfig
 }
 
 func NewApplication() *Application {
@@ -37,10 +43,20 @@ func (app *Application) Configure(cfg *config.Config, logger *logger.Logger, ctx
 		return err
 	}
 	app.Bot = b
+	app.schedulerCfg = &cfg.Scheduler
+	app.outboxCfg = &cfg.Outbox
+	app.checkinCfg = &cfg.Checkin
+	app.alertsCfg = &cfg.Alerts
+	app.calendarCfg = &cfg.Calendar
 
 	return nil
 }
 
 func (app *Application) Run(ctx context.Context) {
+	app.Bot.ConfigureAlerts(app.alertsCfg)
+	app.Bot.StartScheduler(ctx, app.schedulerCfg)
+	app.Bot.StartOutbox(ctx, app.outboxCfg)
+	app.Bot.ConfigureCheckin(app.checkinCfg)
+	app.Bot.StartCalendarServer(ctx, app.calendarCfg)
 	app.Bot.Start(ctx)
 }
@@ -0,0 +1,335 @@
+// Package charts renders small PNG charts for chat messages using only the
+// standard library. Labels use a built-in pixel font that covers digits and
+// the letters of grade scales; other characters are skipped.
+package charts
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"time"
+)
+
+const (
+	width  = 640
+	height = 320
+
+	marginLeft   = 48
+	marginRight  = 16
+	marginTop    = 20
+	marginBottom = 36
+
+	fontScale = 2
+)
+
+var (
+	colorBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	colorAxis       = color.RGBA{0x60, 0x60, 0x60, 0xff}
+	colorGrid       = color.RGBA{0xe4, 0xe4, 0xe4, 0xff}
+	colorText       = color.RGBA{0x30, 0x30, 0x30, 0xff}
+	colorLine       = color.RGBA{0x3b, 0x7d, 0xd8, 0xff}
+	colorPass       = color.RGBA{0x2e, 0xa0, 0x43, 0xff}
+	colorFail       = color.RGBA{0xd9, 0x3f, 0x3f, 0xff}
+	colorMixed      = color.RGBA{0xf0, 0xa0, 0x30, 0xff}
+	colorEmpty      = color.RGBA{0xee, 0xee, 0xee, 0xff}
+	colorBar        = color.RGBA{0x3b, 0x7d, 0xd8, 0xff}
+)
+
+// ErrNoData is returned when there is nothing to draw.
+var ErrNoData = errors.New("charts: no data")
+
+// Timeline draws grades in the order they were given, on a scale from lo
+// to hi. Grades below pass are drawn red and the pass level is marked with
+// a dashed line.
+func Timeline(values []float64, lo, hi, pass float64) ([]byte, error) {
+	if len(values) == 0 {
+		return nil, ErrNoData
+	}
+	if hi <= lo {
+		return nil, errors.New("charts: empty value range")
+	}
+
+	c := newCanvas()
+	const pad = 12
+	plotW := width - marginLeft - marginRight - 2*pad
+	plotH := height - marginTop - marginBottom
+
+	y := func(v float64) int {
+		return marginTop + plotH - int(math.Round((v-lo)/(hi-lo)*float64(plotH)))
+	}
+	x := func(i int) int {
+		if len(values) == 1 {
+			return marginLeft + pad + plotW/2
+		}
+		return marginLeft + pad + int(math.Round(float64(i)*float64(plotW)/float64(len(values)-1)))
+	}
+
+	step := gridStep(hi - lo)
+	for v := lo; v <= hi+1e-9; v += step {
+		c.hline(marginLeft, width-marginRight, y(v), colorGrid)
+		label := formatNumber(v)
+		c.text(marginLeft-8-textWidth(label), y(v)-glyphHeight*fontScale/2, label, colorText)
+	}
+	c.axes()
+
+	for px := marginLeft; px < width-marginRight; px += 12 {
+		c.hline(px, min(px+6, width-marginRight), y(pass), colorFail)
+	}
+
+	for i := 1; i < len(values); i++ {
+		c.line(x(i-1), y(values[i-1]), x(i), y(values[i]), colorLine)
+	}
+	for i, v := range values {
+		dot := colorPass
+		if v < pass {
+			dot = colorFail
+		}
+		c.disc(x(i), y(v), 5, dot)
+	}
+
+	return c.png()
+}
+
+// DayMark is the attendance of one day with lessons.
+type DayMark int
+
+const (
+	DayNone DayMark = iota
+	DayPresent
+	DayAbsent
+	DayMixed
+)
+
+// Heatmap draws attendance as a grid of weeks by weekdays, Monday on top.
+// The grid ends with the week of the latest day and goes back as many weeks
+// as fit, but not before the earliest one. Days are keyed by their date at
+// UTC midnight; every other column is labelled with the date of its Monday.
+func Heatmap(days map[time.Time]DayMark) ([]byte, error) {
+	if len(days) == 0 {
+		return nil, ErrNoData
+	}
+
+	const cell, gap = 26, 4
+	var first, last time.Time
+	for day := range days {
+		if first.IsZero() || day.Before(first) {
+			first = day
+		}
+		if day.After(last) {
+			last = day
+		}
+	}
+	end := monday(last)
+	weeks := int(end.Sub(monday(first)).Hours()/24/7) + 1
+	cols := min(weeks, (width-marginLeft-marginRight)/(cell+gap))
+	start := end.AddDate(0, 0, -7*(cols-1))
+
+	c := newCanvas()
+	top := (height - 7*(cell+gap) - marginBottom) / 2
+	for col := 0; col < cols; col++ {
+		weekStart := start.AddDate(0, 0, 7*col)
+		left := marginLeft + col*(cell+gap)
+		for row := 0; row < 7; row++ {
+			fill := colorEmpty
+			switch days[weekStart.AddDate(0, 0, row)] {
+			case DayPresent:
+				fill = colorPass
+			case DayAbsent:
+				fill = colorFail
+			case DayMixed:
+				fill = colorMixed
+			}
+			c.rect(left, top+row*(cell+gap), left+cell, top+row*(cell+gap)+cell, fill)
+		}
+		if col%2 == 0 {
+			c.text(left, top+7*(cell+gap)+6, weekStart.Format("02.01"), colorText)
+		}
+	}
+	for row := 0; row < 7; row++ {
+		label := formatNumber(float64(row + 1))
+		c.text(marginLeft-8-textWidth(label), top+row*(cell+gap)+(cell-glyphHeight*fontScale)/2, label, colorText)
+	}
+
+	return c.png()
+}
+
+// Bar is one column of a histogram.
+type Bar struct {
+	Label string
+	Count int
+}
+
+// Histogram draws the bars left to right with their counts above them.
+func Histogram(bars []Bar) ([]byte, error) {
+	maxCount := 0
+	for _, b := range bars {
+		maxCount = max(maxCount, b.Count)
+	}
+	if len(bars) == 0 || maxCount == 0 {
+		return nil, ErrNoData
+	}
+
+	c := newCanvas()
+	plotW := width - marginLeft - marginRight
+	plotH := height - marginTop - marginBottom - glyphHeight*fontScale - 4
+	slot := plotW / len(bars)
+	barW := max(slot*2/3, 2)
+
+	c.axes()
+	for i, b := range bars {
+		left := marginLeft + i*slot + (slot-barW)/2
+		h := int(math.Round(float64(b.Count) / float64(maxCount) * float64(plotH)))
+		bottom := height - marginBottom
+		c.rect(left, bottom-h, left+barW, bottom, colorBar)
+
+		count := formatNumber(float64(b.Count))
+		c.text(left+(barW-textWidth(count))/2, bottom-h-glyphHeight*fontScale-4, count, colorText)
+		c.text(left+(barW-textWidth(b.Label))/2, bottom+8, b.Label, colorText)
+	}
+
+	return c.png()
+}
+
+// CanRender reports whether every character of s has a glyph.
+func CanRender(s string) bool {
+	for _, r := range s {
+		if _, ok := glyphs[r]; !ok {
+			return false
+		}
+	}
+	return s != ""
+}
+
+type canvas struct {
+	img *image.RGBA
+}
+
+func newCanvas() *canvas {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	c := &canvas{img: img}
+	c.rect(0, 0, width, height, colorBackground)
+	return c
+}
+
+func (c *canvas) png() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, c.img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *canvas) rect(x0, y0, x1, y1 int, col color.RGBA) {
+	for y := max(y0, 0); y < min(y1, height); y++ {
+		for x := max(x0, 0); x < min(x1, width); x++ {
+			c.img.SetRGBA(x, y, col)
+		}
+	}
+}
+
+func (c *canvas) hline(x0, x1, y int, col color.RGBA) {
+	c.rect(x0, y, x1, y+1, col)
+}
+
+func (c *canvas) axes() {
+	c.rect(marginLeft, marginTop, marginLeft+1, height-marginBottom+1, colorAxis)
+	c.hline(marginLeft, width-marginRight, height-marginBottom, colorAxis)
+}
+
+// line draws a two pixel wide segment.
+func (c *canvas) line(x0, y0, x1, y1 int, col color.RGBA) {
+	steps := max(abs(x1-x0), abs(y1-y0))
+	for i := 0; i <= steps; i++ {
+		t := 0.0
+		if steps > 0 {
+			t = float64(i) / float64(steps)
+		}
+		x := x0 + int(math.Round(t*float64(x1-x0)))
+		y := y0 + int(math.Round(t*float64(y1-y0)))
+		c.rect(x, y, x+2, y+2, col)
+	}
+}
+
+func (c *canvas) disc(cx, cy, r int, col color.RGBA) {
+	for y := -r; y <= r; y++ {
+		for x := -r; x <= r; x++ {
+			if x*x+y*y <= r*r {
+				c.rect(cx+x, cy+y, cx+x+1, cy+y+1, col)
+			}
+		}
+	}
+}
+
+func (c *canvas) text(x, y int, s string, col color.RGBA) {
+	for _, r := range s {
+		glyph, ok := glyphs[r]
+		if !ok {
+			continue
+		}
+		for row, bits := range glyph {
+			for bit := 0; bit < glyphWidth; bit++ {
+				if bits&(1<<(glyphWidth-1-bit)) != 0 {
+					px, py := x+bit*fontScale, y+row*fontScale
+					c.rect(px, py, px+fontScale, py+fontScale, col)
+				}
+			}
+		}
+		x += (glyphWidth + 1) * fontScale
+	}
+}
+
+func textWidth(s string) int {
+	n := 0
+	for _, r := range s {
+		if _, ok := glyphs[r]; ok {
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return n*(glyphWidth+1)*fontScale - fontScale
+}
+
+// gridStep picks a round distance between grid lines for the value range.
+func gridStep(span float64) float64 {
+	for _, step := range []float64{1, 2, 5, 10, 20, 25, 50} {
+		if span/step <= 10 {
+			return step
+		}
+	}
+	return span / 10
+}
+
+func formatNumber(v float64) string {
+	v = math.Round(v)
+	if v == 0 {
+		return "0"
+	}
+	neg := v < 0
+	n := int(math.Abs(v))
+	var digits []rune
+	for ; n > 0; n /= 10 {
+		digits = append([]rune{rune('0' + n%10)}, digits...)
+	}
+	if neg {
+		digits = append([]rune{'-'}, digits...)
+	}
+	return string(digits)
+}
+
+func monday(t time.Time) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	offset := (int(day.Weekday()) + 6) % 7
+	return day.AddDate(0, 0, -offset)
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,32 @@
+package charts
+
+const (
+	glyphWidth  = 3
+	glyphHeight = 5
+)
+
+// glyphs is a 3x5 pixel font; each row is three bits, the highest on the
+// left.
+var glyphs = map[rune][glyphHeight]uint8{
+	'0': {0b111, 0b101, 0b101, 0b101, 0b111},
+	'1': {0b010, 0b110, 0b010, 0b010, 0b111},
+	'2': {0b111, 0b001, 0b111, 0b100, 0b111},
+	'3': {0b111, 0b001, 0b111, 0b001, 0b111},
+	'4': {0b101, 0b101, 0b111, 0b001, 0b001},
+	'5': {0b111, 0b100, 0b111, 0b001, 0b111},
+	'6': {0b111, 0b100, 0b111, 0b101, 0b111},
+	'7': {0b111, 0b001, 0b010, 0b010, 0b010},
+	'8': {0b111, 0b101, 0b111, 0b101, 0b111},
+	'9': {0b111, 0b101, 0b111, 0b001, 0b111},
+	'A': {0b010, 0b101, 0b111, 0b101, 0b101},
+	'B': {0b110, 0b101, 0b110, 0b101, 0b110},
+	'C': {0b011, 0b100, 0b100, 0b100, 0b011},
+	'D': {0b110, 0b101, 0b101, 0b101, 0b110},
+	'E': {0b111, 0b100, 0b110, 0b100, 0b111},
+	'F': {0b111, 0b100, 0b110, 0b100, 0b100},
+	'X': {0b101, 0b101, 0b010, 0b101, 0b101},
+	'.': {0b000, 0b000, 0b000, 0b000, 0b010},
+	'%': {0b101, 0b001, 0b010, 0b100, 0b101},
+	'-': {0b000, 0b000, 0b111, 0b000, 0b000},
+	' ': {0b000, 0b000, 0b000, 0b000, 0b000},
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"time"
 
 	"github.com/caarlos0/env/v11"
 	"github.com/joho/godotenv"
@@ -10,16 +11,61 @@ import (
 )
 
 type Config struct {
-	LogLevel logger.LogLevel `env:"LOG_LEVEL" envDefault:"1"`
-	LogDir   string          `env:"LOG_DIR" envDefault:"./logs"`
-	Database DatabaseConfig  `envPrefix:"DATABASE_"`
-	MaxAPI   MaxConfig       `envPrefix:"MAX_"`
+	LogLevel  logger.LogLevel `env:"LOG_LEVEL" envDefault:"1"`
+	LogDir    string          `env:"LOG_DIR" envDefault:"./logs"`
+	Database  DatabaseConfig  `envPrefix:"DATABASE_"`
+	MaxAPI    MaxConfig       `envPrefix:"MAX_"`
+	Scheduler SchedulerConfig `envPrefix:"SCHEDULER_"`
+	Outbox    OutboxConfig    `envPrefix:"OUTBOX_"`
+	Checkin   CheckinConfig   `envPrefix:"CHECKIN_"`
+	Alerts    AlertsConfig    `envPrefix:"ALERTS_"`
+	Calendar  CalendarConfig  `envPrefix:"CALENDAR_"`
 }
 
 type MaxConfig struct {
 	Token string `env:"TOKEN"`
 }
 
+type SchedulerConfig struct {
+	Timezone string        `env:"TIMEZONE" envDefault:"Europe/Moscow"`
+	Interval time.Duration `env:"INTERVAL" envDefault:"1m"`
+}
+
+type OutboxConfig struct {
+	Interval      time.Duration `env:"INTERVAL" envDefault:"2s"`
+	BatchSize     int           `env:"BATCH_SIZE" envDefault:"50"`
+	RatePerSecond int           `env:"RATE_PER_SECOND" envDefault:"20"`
+	MaxAttempts   int           `env:"MAX_ATTEMPTS" envDefault:"6"`
+	RetryBase     time.Duration `env:"RETRY_BASE" envDefault:"30s"`
+	RetryMax      time.Duration `env:"RETRY_MAX" envDefault:"1h"`
+}
+
+// CheckinConfig controls self check-in codes. Without a secret the bot makes
+// a random one at start, so codes shown before a restart stop working.
+type CheckinConfig struct {
+	CodePeriod time.Duration `env:"CODE_PERIOD" envDefault:"30s"`
+	Secret     string        `env:"SECRET"`
+}
+
+// AlertsConfig sets the thresholds of the early-warning rules. A zero
+// threshold turns its rule off.
+type AlertsConfig struct {
+	ConsecutiveAbsences  int     `env:"CONSECUTIVE_ABSENCES" envDefault:"3"`
+	MinAttendancePercent float64 `env:"MIN_ATTENDANCE_PERCENT" envDefault:"70"`
+	MinMarkedLessons     int     `env:"MIN_MARKED_LESSONS" envDefault:"5"`
+	FailingGradesInRow   int     `env:"FAILING_GRADES_IN_ROW" envDefault:"2"`
+	NotifyStudent        bool    `env:"NOTIFY_STUDENT" envDefault:"false"`
+	NightlyTime          string  `env:"NIGHTLY_TIME" envDefault:"21:00"`
+}
+
+// CalendarConfig sets where the calendar feeds are served. BaseURL is the
+// public address of that server used in subscription links; without it the
+// bot sends only the calendar file. An empty Addr turns the server off.
+type CalendarConfig struct {
+	Addr    string `env:"ADDR" envDefault:":8080"`
+	BaseURL string `env:"BASE_URL"`
+}
+
 type DatabaseConfig struct {
 	URI string `env:"URI"`
 }
@@ -15,19 +15,22 @@ type Group struct {
 }
 
 type User struct {
-	UserID    int64  `db:"user_id" json:"user_id"`
-	Name      string `db:"name" json:"name"`
-	UserMaxID int64  `db:"usermax_id" json:"usermax_id"`
-	FirstName string `db:"first_name" json:"first_name"`
-	LastName  string `db:"last_name" json:"last_name"`
-	RoleID    int64  `db:"role_id" json:"role_id"`
-	GroupID   *int64 `db:"group_id" json:"group_id"`
+	UserID     int64   `db:"user_id" json:"user_id"`
+	Name       string  `db:"name" json:"name"`
+	UserMaxID  *int64  `db:"usermax_id" json:"usermax_id"`
+	InviteCode *string `db:"invite_code" json:"invite_code"`
+	FirstName  string  `db:"first_name" json:"first_name"`
+	LastName   string  `db:"last_name" json:"last_name"`
+	RoleID     int64   `db:"role_id" json:"role_id"`
+	GroupID    *int64  `db:"group_id" json:"group_id"`
+	IsHeadman  bool    `db:"is_headman" json:"is_headman"`
 }
 
 type Subject struct {
-	SubjectID   int64  `db:"subject_id" json:"subject_id"`
-	SubjectName string `db:"subject_name" json:"subject_name"`
-	TeacherID   int64  `db:"teacher_id" json:"teacher_id"`
+	SubjectID    int64  `db:"subject_id" json:"subject_id"`
+	SubjectName  string `db:"subject_name" json:"subject_name"`
+	TeacherID    int64  `db:"teacher_id" json:"teacher_id"`
+	GradingScale string `db:"grading_scale" json:"grading_scale"`
 }
 
 type GroupSubject struct {
@@ -50,16 +53,40 @@ type Schedule struct {
 	TeacherID    int64     `db:"teacher_id" json:"teacher_id"`
 	GroupID      int64     `db:"group_id" json:"group_id"`
 	LessonTypeID int64     `db:"lesson_type_id" json:"lesson_type_id"`
+	Archived     bool      `db:"archived" json:"archived"`
+}
+
+// ScheduleLesson is a schedule entry with the names needed to describe it.
+type ScheduleLesson struct {
+	Schedule
+	SubjectName string `db:"subject_name" json:"subject_name"`
+	TypeName    string `db:"type_name" json:"type_name"`
+	GroupName   string `db:"group_name" json:"group_name"`
+	TeacherName string `db:"teacher_name" json:"teacher_name"`
+}
+
+// TimeSlot is the start and end of a lesson.
+type TimeSlot struct {
+	StartTime time.Time `db:"start_time" json:"start_time"`
+	EndTime   time.Time `db:"end_time" json:"end_time"`
+}
+
+type AssessmentType struct {
+	AssessmentTypeID int64   `db:"assessment_type_id" json:"assessment_type_id"`
+	TypeCode         string  `db:"type_code" json:"type_code"`
+	Title            string  `db:"title" json:"title"`
+	Weight           float64 `db:"weight" json:"weight"`
 }
 
 type Grade struct {
-	GradeID    int64     `db:"grade_id" json:"grade_id"`
-	StudentID  int64     `db:"student_id" json:"student_id"`
-	TeacherID  int64     `db:"teacher_id" json:"teacher_id"`
-	SubjectID  int64     `db:"subject_id" json:"subject_id"`
-	ScheduleID int64     `db:"schedule_id" json:"schedule_id"`
-	GradeValue int       `db:"grade_value" json:"grade_value"`
-	GradeDate  time.Time `db:"grade_date" json:"grade_date"`
+	GradeID          int64     `db:"grade_id" json:"grade_id"`
+	StudentID        int64     `db:"student_id" json:"student_id"`
+	TeacherID        int64     `db:"teacher_id" json:"teacher_id"`
+	SubjectID        int64     `db:"subject_id" json:"subject_id"`
+	ScheduleID       int64     `db:"schedule_id" json:"schedule_id"`
+	AssessmentTypeID *int64    `db:"assessment_type_id" json:"assessment_type_id"`
+	GradeValue       int       `db:"grade_value" json:"grade_value"`
+	GradeDate        time.Time `db:"grade_date" json:"grade_date"`
 }
 
 type Attendance struct {
@@ -67,5 +94,285 @@ type Attendance struct {
 	StudentID    int64     `db:"student_id" json:"student_id"`
 	ScheduleID   int64     `db:"schedule_id" json:"schedule_id"`
 	Attended     bool      `db:"attended" json:"attended"`
+	LessonDate   time.Time `db:"lesson_date" json:"lesson_date"`
 	MarkTime     time.Time `db:"mark_time" json:"mark_time"`
+	MarkedBy     *int64    `db:"marked_by" json:"marked_by"`
+	ConfirmedBy  *int64    `db:"confirmed_by" json:"confirmed_by"`
+}
+
+type RatingRule struct {
+	SubjectID            int64   `db:"subject_id" json:"subject_id"`
+	GradeWeight          float64 `db:"grade_weight" json:"grade_weight"`
+	AttendanceWeight     float64 `db:"attendance_weight" json:"attendance_weight"`
+	MinAttendancePercent float64 `db:"min_attendance_percent" json:"min_attendance_percent"`
+	MinRating            float64 `db:"min_rating" json:"min_rating"`
+}
+
+type UserSettings struct {
+	UserID           int64     `db:"user_id" json:"user_id"`
+	DigestEnabled    bool      `db:"digest_enabled" json:"digest_enabled"`
+	DigestTime       time.Time `db:"digest_time" json:"digest_time"`
+	RemindersEnabled bool      `db:"reminders_enabled" json:"reminders_enabled"`
+	ReminderMinutes  int       `db:"reminder_minutes" json:"reminder_minutes"`
+
+	NotifyGrades        bool       `db:"notify_grades" json:"notify_grades"`
+	NotifyAttendance    bool       `db:"notify_attendance" json:"notify_attendance"`
+	NotifySchedule      bool       `db:"notify_schedule" json:"notify_schedule"`
+	NotifyAnnouncements bool       `db:"notify_announcements" json:"notify_announcements"`
+	QuietFrom           *time.Time `db:"quiet_from" json:"quiet_from"`
+	QuietTo             *time.Time `db:"quiet_to" json:"quiet_to"`
+	DeliveryMode        string     `db:"delivery_mode" json:"delivery_mode"`
+	SummaryTime         time.Time  `db:"summary_time" json:"summary_time"`
+}
+
+type OutboxNotification struct {
+	OutboxID        int64      `db:"outbox_id" json:"outbox_id"`
+	UserID          int64      `db:"user_id" json:"user_id"`
+	BatchID         *int64     `db:"batch_id" json:"batch_id"`
+	Category        string     `db:"category" json:"category"`
+	MessageText     string     `db:"message_text" json:"message_text"`
+	ButtonText      string     `db:"button_text" json:"button_text"`
+	ButtonPayload   string     `db:"button_payload" json:"button_payload"`
+	AttachmentType  string     `db:"attachment_type" json:"attachment_type"`
+	AttachmentToken string     `db:"attachment_token" json:"attachment_token"`
+	Status          string     `db:"status" json:"status"`
+	Attempts        int        `db:"attempts" json:"attempts"`
+	NextAttemptAt   time.Time  `db:"next_attempt_at" json:"next_attempt_at"`
+	LastError       string     `db:"last_error" json:"last_error"`
+	CreatedAt       time.Time  `db:"created_at" json:"created_at"`
+	SentAt          *time.Time `db:"sent_at" json:"sent_at"`
+
+	// UserMaxID is filled in when notifications are claimed for delivery.
+	UserMaxID *int64 `db:"usermax_id" json:"usermax_id,omitempty"`
+}
+
+type NotificationBatchSummary struct {
+	BatchID     int64  `db:"batch_id" json:"batch_id"`
+	RequestedBy int64  `db:"requested_by" json:"requested_by"`
+	Title       string `db:"title" json:"title"`
+	Total       int    `db:"total" json:"total"`
+	Sent        int    `db:"sent" json:"sent"`
+	Skipped     int    `db:"skipped" json:"skipped"`
+	Deferred    int    `db:"deferred" json:"deferred"`
+	Failed      int    `db:"failed" json:"failed"`
+}
+
+type LessonReminder struct {
+	UserMaxID       int64     `db:"usermax_id" json:"usermax_id"`
+	ReminderMinutes int       `db:"reminder_minutes" json:"reminder_minutes"`
+	LessonDate      time.Time `db:"lesson_date" json:"lesson_date"`
+	Schedule
+}
+
+type Announcement struct {
+	AnnouncementID  int64     `db:"announcement_id" json:"announcement_id"`
+	AuthorID        int64     `db:"author_id" json:"author_id"`
+	TargetType      string    `db:"target_type" json:"target_type"`
+	TargetID        *int64    `db:"target_id" json:"target_id"`
+	TargetTitle     string    `db:"target_title" json:"target_title"`
+	MessageText     string    `db:"message_text" json:"message_text"`
+	AttachmentType  string    `db:"attachment_type" json:"attachment_type"`
+	AttachmentToken string    `db:"attachment_token" json:"attachment_token"`
+	Important       bool      `db:"important" json:"important"`
+	CreatedAt       time.Time `db:"created_at" json:"created_at"`
+}
+
+type AnnouncementStats struct {
+	Total        int `db:"total" json:"total"`
+	Sent         int `db:"sent" json:"sent"`
+	Pending      int `db:"pending" json:"pending"`
+	Deferred     int `db:"deferred" json:"deferred"`
+	Skipped      int `db:"skipped" json:"skipped"`
+	Failed       int `db:"failed" json:"failed"`
+	Acknowledged int `db:"acknowledged" json:"acknowledged"`
+}
+
+// ParentChild is a student linked to a parent account.
+type ParentChild struct {
+	ParentID            int64   `db:"parent_id" json:"parent_id"`
+	StudentID           int64   `db:"student_id" json:"student_id"`
+	StudentName         string  `db:"student_name" json:"student_name"`
+	GroupID             *int64  `db:"group_id" json:"group_id"`
+	GroupName           *string `db:"group_name" json:"group_name"`
+	MirrorNotifications bool    `db:"mirror_notifications" json:"mirror_notifications"`
+}
+
+const (
+	RegistrationPending  = "pending"
+	RegistrationApproved = "approved"
+	RegistrationRejected = "rejected"
+)
+
+// RegistrationRequest is a student's claim of a roster record that the bot
+// could not match unambiguously and an administrator has to review.
+type RegistrationRequest struct {
+	RequestID  int64      `db:"request_id" json:"request_id"`
+	UserMaxID  int64      `db:"usermax_id" json:"usermax_id"`
+	FullName   string     `db:"full_name" json:"full_name"`
+	GroupID    int64      `db:"group_id" json:"group_id"`
+	GroupName  string     `db:"group_name" json:"group_name"`
+	Status     string     `db:"status" json:"status"`
+	StudentID  *int64     `db:"student_id" json:"student_id"`
+	ResolvedBy *int64     `db:"resolved_by" json:"resolved_by"`
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+	ResolvedAt *time.Time `db:"resolved_at" json:"resolved_at"`
+}
+
+const (
+	SubmissionDraft     = "draft"
+	SubmissionPending   = "pending"
+	SubmissionConfirmed = "confirmed"
+	SubmissionEdited    = "edited"
+)
+
+// AttendanceSubmission is a register taken by a group headman for one lesson.
+// The teacher confirms it as is or after editing some marks.
+type AttendanceSubmission struct {
+	SubmissionID int64      `db:"submission_id" json:"submission_id"`
+	ScheduleID   int64      `db:"schedule_id" json:"schedule_id"`
+	LessonDate   time.Time  `db:"lesson_date" json:"lesson_date"`
+	SubmittedBy  int64      `db:"submitted_by" json:"submitted_by"`
+	Status       string     `db:"status" json:"status"`
+	SubmittedAt  *time.Time `db:"submitted_at" json:"submitted_at"`
+	ReviewedBy   *int64     `db:"reviewed_by" json:"reviewed_by"`
+	ReviewedAt   *time.Time `db:"reviewed_at" json:"reviewed_at"`
+	SubjectID    int64      `db:"subject_id" json:"subject_id"`
+	SubjectName  string     `db:"subject_name" json:"subject_name"`
+	GroupID      int64      `db:"group_id" json:"group_id"`
+	GroupName    string     `db:"group_name" json:"group_name"`
+	TeacherID    int64      `db:"teacher_id" json:"teacher_id"`
+	StartTime    time.Time  `db:"start_time" json:"start_time"`
+	HeadmanName  string     `db:"headman_name" json:"headman_name"`
+}
+
+// AttendanceSubmissionMark is a student's mark in a submission: as the
+// headman sent it and as it stands after the teacher's review.
+type AttendanceSubmissionMark struct {
+	StudentID         int64  `db:"student_id" json:"student_id"`
+	StudentName       string `db:"student_name" json:"student_name"`
+	SubmittedAttended bool   `db:"submitted_attended" json:"submitted_attended"`
+	Attended          bool   `db:"attended" json:"attended"`
+}
+
+// CheckinSession is a teacher's self check-in for a lesson, with the lesson
+// details students see.
+type CheckinSession struct {
+	SessionID   int64      `db:"session_id" json:"session_id"`
+	ScheduleID  int64      `db:"schedule_id" json:"schedule_id"`
+	LessonDate  time.Time  `db:"lesson_date" json:"lesson_date"`
+	TeacherID   int64      `db:"teacher_id" json:"teacher_id"`
+	StartedAt   time.Time  `db:"started_at" json:"started_at"`
+	ClosedAt    *time.Time `db:"closed_at" json:"closed_at"`
+	SubjectID   int64      `db:"subject_id" json:"subject_id"`
+	SubjectName string     `db:"subject_name" json:"subject_name"`
+	GroupID     int64      `db:"group_id" json:"group_id"`
+	GroupName   string     `db:"group_name" json:"group_name"`
+	StartTime   time.Time  `db:"start_time" json:"start_time"`
+	EndTime     time.Time  `db:"end_time" json:"end_time"`
+}
+
+// GradeCount is how many times a grade value was given in a group.
+type GradeCount struct {
+	GradeValue int `db:"grade_value" json:"grade_value"`
+	Count      int `db:"count" json:"count"`
+}
+
+// LessonAttendance is the attendance of a group at one held lesson.
+type LessonAttendance struct {
+	ScheduleID int64     `db:"schedule_id" json:"schedule_id"`
+	LessonDate time.Time `db:"lesson_date" json:"lesson_date"`
+	StartTime  time.Time `db:"start_time" json:"start_time"`
+	Attended   int       `db:"attended" json:"attended"`
+	Total      int       `db:"total" json:"total"`
+}
+
+// StudentRisk is a student's grade average and absences in a subject. The
+// average is nil when the student has no grades yet.
+type StudentRisk struct {
+	StudentID    int64    `db:"student_id" json:"student_id"`
+	StudentName  string   `db:"student_name" json:"student_name"`
+	GradeAverage *float64 `db:"grade_average" json:"grade_average"`
+	GradeCount   int      `db:"grade_count" json:"grade_count"`
+	Absences     int      `db:"absences" json:"absences"`
+	Marked       int      `db:"marked" json:"marked"`
+}
+
+// AlertTarget is a student and one of the subjects of their group, checked
+// by the early-warning rules.
+type AlertTarget struct {
+	StudentID int64 `db:"student_id" json:"student_id"`
+	SubjectID int64 `db:"subject_id" json:"subject_id"`
+}
+
+// AlertRecipients are the staff who hear about a student's alert in a
+// subject: the subject's teacher and the curator of the student's group.
+type AlertRecipients struct {
+	StudentName string `db:"student_name" json:"student_name"`
+	GroupID     *int64 `db:"group_id" json:"group_id"`
+	GroupName   string `db:"group_name" json:"group_name"`
+	SubjectName string `db:"subject_name" json:"subject_name"`
+	TeacherID   int64  `db:"teacher_id" json:"teacher_id"`
+	CuratorID   *int64 `db:"curator_id" json:"curator_id"`
+}
+
+// SubjectProgress is a student's standing in one subject of their group.
+// Averages are nil when there are no grades to average.
+type SubjectProgress struct {
+	SubjectID      int64    `db:"subject_id" json:"subject_id"`
+	SubjectName    string   `db:"subject_name" json:"subject_name"`
+	GradingScale   string   `db:"grading_scale" json:"grading_scale"`
+	GradeAverage   *float64 `db:"grade_average" json:"grade_average"`
+	GradeCount     int      `db:"grade_count" json:"grade_count"`
+	RecentAverage  *float64 `db:"recent_average" json:"recent_average"`
+	EarlierAverage *float64 `db:"earlier_average" json:"earlier_average"`
+	Attended       int      `db:"attended" json:"attended"`
+	Marked         int      `db:"marked" json:"marked"`
+}
+
+// GroupSubjectStats is a group's grade average and attendance in a subject.
+type GroupSubjectStats struct {
+	GroupID      int64    `db:"group_id" json:"group_id"`
+	GroupName    string   `db:"group_name" json:"group_name"`
+	SubjectName  string   `db:"subject_name" json:"subject_name"`
+	GradingScale string   `db:"grading_scale" json:"grading_scale"`
+	Students     int      `db:"students" json:"students"`
+	GradeAverage *float64 `db:"grade_average" json:"grade_average"`
+	GradeCount   int      `db:"grade_count" json:"grade_count"`
+	Attended     int      `db:"attended" json:"attended"`
+	Marked       int      `db:"marked" json:"marked"`
+}
+
+// UnmarkedLesson is a held lesson without any attendance marks.
+type UnmarkedLesson struct {
+	LessonDate  time.Time `db:"lesson_date" json:"lesson_date"`
+	StartTime   time.Time `db:"start_time" json:"start_time"`
+	SubjectName string    `db:"subject_name" json:"subject_name"`
+	GroupName   string    `db:"group_name" json:"group_name"`
+	TeacherName string    `db:"teacher_name" json:"teacher_name"`
+}
+
+// InactiveStudent is a student with no grades and no attended lessons in the
+// report period.
+type InactiveStudent struct {
+	StudentName string  `db:"student_name" json:"student_name"`
+	GroupName   *string `db:"group_name" json:"group_name"`
+	Linked      bool    `db:"linked" json:"linked"`
+}
+
+// TeacherLoad is a teacher's weekly timetable load.
+type TeacherLoad struct {
+	TeacherName string  `db:"teacher_name" json:"teacher_name"`
+	Lessons     int     `db:"lessons" json:"lessons"`
+	Hours       float64 `db:"hours" json:"hours"`
+	Groups      int     `db:"groups" json:"groups"`
+	Subjects    int     `db:"subjects" json:"subjects"`
+}
+
+// CalendarOwner is the user whose timetable a calendar feed shows: the
+// group's lessons for a student, their own lessons for a teacher.
+type CalendarOwner struct {
+	UserID   int64  `db:"user_id" json:"user_id"`
+	Name     string `db:"name" json:"name"`
+	RoleName string `db:"role_name" json:"role_name"`
+	GroupID  *int64 `db:"group_id" json:"group_id"`
 }
@@ -1,7 +1,13 @@
 package database
 
 import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 type RoleRepository struct {
@@ -45,6 +51,56 @@ func (r *GroupRepository) GetGroupIDByName(tx *sqlx.Tx, groupName string) (int64
 	return groupID, err
 }
 
+func (r *GroupRepository) GetAllGroups() ([]Group, error) {
+	var groups []Group
+	err := r.db.Select(&groups, `SELECT group_id, group_name FROM groups ORDER BY group_name`)
+	return groups, err
+}
+
+func (r *GroupRepository) GetGroupsByTeacher(teacherID int64) ([]Group, error) {
+	var groups []Group
+	query := `
+        SELECT DISTINCT g.group_id, g.group_name
+        FROM groups g
+        JOIN groups_subjects gs ON g.group_id = gs.group_id
+        JOIN subjects s ON gs.subject_id = s.subject_id
+        WHERE s.teacher_id = $1
+        ORDER BY g.group_name`
+	err := r.db.Select(&groups, query, teacherID)
+	return groups, err
+}
+
+// EnsureJoinCode stores code as the group's join code unless the group
+// already has one, and returns the code in effect.
+func (r *GroupRepository) EnsureJoinCode(groupID int64, code string) (string, error) {
+	var joinCode string
+	err := r.db.Get(&joinCode, `
+        UPDATE groups SET join_code = COALESCE(join_code, $2)
+        WHERE group_id = $1
+        RETURNING join_code`, groupID, code)
+	return joinCode, err
+}
+
+func (r *GroupRepository) GetGroupByJoinCode(code string) (*Group, error) {
+	group := new(Group)
+	err := r.db.Get(group, `SELECT group_id, group_name FROM groups WHERE join_code = $1`, code)
+	if err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// SetCurator makes the teacher with the given Max ID the curator of the
+// group, replacing the previous curator.
+func (r *GroupRepository) SetCurator(tx *sqlx.Tx, groupID, curatorMaxID int64) error {
+	_, err := tx.Exec(`
+        INSERT INTO group_curators (group_id, curator_id)
+        VALUES ($1, (SELECT user_id FROM users WHERE usermax_id = $2))
+        ON CONFLICT (group_id) DO UPDATE SET curator_id = EXCLUDED.curator_id`,
+		groupID, curatorMaxID)
+	return err
+}
+
 func (r *GroupRepository) GetGroupName(groupID int64) (string, error) {
 	var groupName string
 	err := r.db.Get(&groupName, `SELECT group_name FROM groups WHERE group_id = $1`, groupID)
@@ -70,7 +126,7 @@ func (r *UserRepository) CreateOrUpdateStudent(tx *sqlx.Tx, userMaxID int64, fir
 
 	result, err := tx.Exec(`
 		UPDATE users
-		SET usermax_id = $1, name = $2
+		SET usermax_id = $1, name = $2, invite_code = NULL
 		WHERE first_name = $3 AND last_name = $4 AND role_id = $5 AND group_id = $6`,
 		userMaxID, fullName, firstName, lastName, roleID, groupID)
 	if err != nil {
@@ -155,9 +211,174 @@ func (r *UserRepository) GetTeacherIDByName(tx *sqlx.Tx, lastName, firstName str
 	return teacherID, err
 }
 
+func (r *UserRepository) GetStudentIDInGroupByMaxID(tx *sqlx.Tx, userMaxID, groupID int64) (int64, error) {
+	var studentID int64
+	err := tx.Get(&studentID, `
+        SELECT user_id FROM users
+        WHERE usermax_id = $1 AND group_id = $2
+        AND role_id = (SELECT role_id FROM roles WHERE role_name = 'student')`,
+		userMaxID, groupID)
+	return studentID, err
+}
+
+// GetNotifiableStudentIDs returns students of the group who use the bot.
+func (r *UserRepository) GetNotifiableStudentIDs(tx *sqlx.Tx, groupID int64) ([]int64, error) {
+	var studentIDs []int64
+	err := tx.Select(&studentIDs, `
+        SELECT user_id FROM users
+        WHERE group_id = $1 AND usermax_id IS NOT NULL
+        AND role_id = (SELECT role_id FROM roles WHERE role_name = 'student')
+        ORDER BY user_id`, groupID)
+	return studentIDs, err
+}
+
+// HasMaxID reports whether the user is linked to a Max account.
+func (r *UserRepository) HasMaxID(tx *sqlx.Tx, userID int64) (bool, error) {
+	var linked bool
+	err := tx.Get(&linked, `SELECT usermax_id IS NOT NULL FROM users WHERE user_id = $1`, userID)
+	return linked, err
+}
+
+// CreateOrGetUnclaimedStudent returns the roster record of a student imported
+// without a Max ID, creating it if needed.
+func (r *UserRepository) CreateOrGetUnclaimedStudent(tx *sqlx.Tx, firstName, lastName string, roleID, groupID int64) (int64, error) {
+	var studentID int64
+	err := tx.Get(&studentID, `
+        SELECT user_id FROM users
+        WHERE first_name = $1 AND last_name = $2 AND role_id = $3 AND group_id = $4`,
+		firstName, lastName, roleID, groupID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return studentID, err
+	}
+
+	err = tx.Get(&studentID, `
+        INSERT INTO users (name, first_name, last_name, role_id, group_id)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING user_id`,
+		firstName+" "+lastName, firstName, lastName, roleID, groupID)
+	return studentID, err
+}
+
+// SetInviteCode gives an unclaimed student a personal registration code
+// unless the student already has one.
+func (r *UserRepository) SetInviteCode(tx *sqlx.Tx, userID int64, code string) error {
+	_, err := tx.Exec(`
+        UPDATE users SET invite_code = $2
+        WHERE user_id = $1 AND usermax_id IS NULL AND invite_code IS NULL`, userID, code)
+	return err
+}
+
+// ClaimByInviteCode binds the Max account to the student holding the code and
+// returns the student's name. The code is single-use.
+func (r *UserRepository) ClaimByInviteCode(code string, userMaxID int64) (string, error) {
+	var name string
+	err := r.db.Get(&name, `
+        UPDATE users SET usermax_id = $2, invite_code = NULL
+        WHERE invite_code = $1 AND usermax_id IS NULL
+        RETURNING name`, code, userMaxID)
+	return name, err
+}
+
+// ClaimStudent binds the Max account to an unclaimed student. It reports
+// false if the record has been claimed meanwhile.
+func (r *UserRepository) ClaimStudent(tx *sqlx.Tx, studentID, userMaxID int64) (bool, error) {
+	res, err := tx.Exec(`
+        UPDATE users SET usermax_id = $2, invite_code = NULL
+        WHERE user_id = $1 AND usermax_id IS NULL`, studentID, userMaxID)
+	if err != nil {
+		return false, err
+	}
+	claimed, err := res.RowsAffected()
+	return claimed > 0, err
+}
+
+// userColumns selects users for the User model. Parents are registered
+// without first and last names, which the model keeps as "".
+const userColumns = `
+        SELECT user_id, name, usermax_id, invite_code,
+               COALESCE(first_name, '') AS first_name, COALESCE(last_name, '') AS last_name,
+               role_id, group_id, is_headman
+        FROM users`
+
+// GetUnclaimedStudents returns students of the group who have not connected
+// to the bot yet. Empty names match any name.
+func (r *UserRepository) GetUnclaimedStudents(groupID int64, lastName, firstName string) ([]User, error) {
+	var students []User
+	err := r.db.Select(&students, userColumns+`
+        WHERE group_id = $1 AND usermax_id IS NULL
+        AND ($2 = '' OR LOWER(last_name) = LOWER($2))
+        AND ($3 = '' OR LOWER(first_name) = LOWER($3))
+        AND role_id = (SELECT role_id FROM roles WHERE role_name = 'student')
+        ORDER BY last_name, first_name`,
+		groupID, lastName, firstName)
+	return students, err
+}
+
+// GetAdminIDs returns administrators who use the bot.
+func (r *UserRepository) GetAdminIDs(tx *sqlx.Tx) ([]int64, error) {
+	var adminIDs []int64
+	err := tx.Select(&adminIDs, `
+        SELECT user_id FROM users
+        WHERE usermax_id IS NOT NULL
+        AND role_id = (SELECT role_id FROM roles WHERE role_name = 'admin')
+        ORDER BY user_id`)
+	return adminIDs, err
+}
+
+// GetHeadmanGroupID returns the group of the headman with the Max ID, or
+// sql.ErrNoRows if the user is not a headman.
+func (r *UserRepository) GetHeadmanGroupID(userMaxID int64) (int64, error) {
+	var groupID int64
+	err := r.db.Get(&groupID, `
+        SELECT group_id FROM users
+        WHERE usermax_id = $1 AND is_headman AND group_id IS NOT NULL`, userMaxID)
+	return groupID, err
+}
+
+// SetHeadman makes the student the only headman of their group. Passing a
+// student who already is the headman removes the role.
+func (r *UserRepository) SetHeadman(tx *sqlx.Tx, studentID int64) (bool, error) {
+	var isHeadman bool
+	err := tx.Get(&isHeadman, `
+        UPDATE users SET is_headman = NOT is_headman
+        WHERE user_id = $1 AND group_id IS NOT NULL
+        RETURNING is_headman`, studentID)
+	if err != nil || !isHeadman {
+		return isHeadman, err
+	}
+
+	_, err = tx.Exec(`
+        UPDATE users SET is_headman = FALSE
+        WHERE group_id = (SELECT group_id FROM users WHERE user_id = $1)
+        AND user_id <> $1 AND is_headman`, studentID)
+	return isHeadman, err
+}
+
+// CreateParent registers a Max user as a parent and returns the new user ID.
+// First and last names stay empty, so parents with the same name do not
+// collide with each other in the unique name indexes.
+func (r *UserRepository) CreateParent(tx *sqlx.Tx, userMaxID int64, name string) (int64, error) {
+	var parentID int64
+	err := tx.Get(&parentID, `
+        INSERT INTO users (name, usermax_id, role_id)
+        VALUES ($1, $2, (SELECT role_id FROM roles WHERE role_name = 'parent'))
+        RETURNING user_id`, name, userMaxID)
+	return parentID, err
+}
+
+func (r *UserRepository) GetStudentIDsInGroupByName(tx *sqlx.Tx, groupID int64, lastName, firstName string) ([]int64, error) {
+	var studentIDs []int64
+	err := tx.Select(&studentIDs, `
+        SELECT user_id FROM users
+        WHERE group_id = $1 AND LOWER(last_name) = LOWER($2) AND ($3 = '' OR LOWER(first_name) = LOWER($3))
+        AND role_id = (SELECT role_id FROM roles WHERE role_name = 'student')`,
+		groupID, lastName, firstName)
+	return studentIDs, err
+}
+
 func (r *UserRepository) GetUserByMaxID(userMaxID int64) (*User, error) {
 	user := new(User)
-	err := r.db.Get(user, `SELECT * FROM users WHERE usermax_id = $1`, userMaxID)
+	err := r.db.Get(user, userColumns+` WHERE usermax_id = $1`, userMaxID)
 	if err != nil {
 		return nil, err
 	}
@@ -203,16 +424,24 @@ func NewSubjectRepository(db *sqlx.DB) *SubjectRepository {
 	return &SubjectRepository{db: db}
 }
 
+// CreateOrGetSubject returns the subject with the given name led by the
+// teacher, creating it if needed. Different teachers get separate subjects of
+// the same name. Subjects carry no unique constraint, so the lookup goes first.
 func (r *SubjectRepository) CreateOrGetSubject(tx *sqlx.Tx, subjectName string, teacherID int64) (int64, error) {
 	var subjectID int64
 	err := tx.Get(&subjectID, `
+        SELECT subject_id FROM subjects
+        WHERE subject_name = $1 AND teacher_id = $2
+        ORDER BY subject_id
+        LIMIT 1`, subjectName, teacherID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return subjectID, err
+	}
+
+	err = tx.Get(&subjectID, `
         INSERT INTO subjects (subject_name, teacher_id)
         VALUES ($1, $2)
-        ON CONFLICT DO NOTHING
         RETURNING subject_id`, subjectName, teacherID)
-	if err != nil {
-		err = tx.Get(&subjectID, `SELECT subject_id FROM subjects WHERE subject_name = $1`, subjectName)
-	}
 	return subjectID, err
 }
 
@@ -224,202 +453,1101 @@ func (r *SubjectRepository) LinkGroupToSubject(tx *sqlx.Tx, groupID, subjectID i
 	return err
 }
 
+func (r *SubjectRepository) GetAllSubjects() ([]Subject, error) {
+	var subjects []Subject
+	err := r.db.Select(&subjects, `SELECT * FROM subjects ORDER BY subject_name`)
+	return subjects, err
+}
+
+func (r *SubjectRepository) GetSubject(subjectID int64) (*Subject, error) {
+	subject := new(Subject)
+	if err := r.db.Get(subject, `SELECT * FROM subjects WHERE subject_id = $1`, subjectID); err != nil {
+		return nil, err
+	}
+	return subject, nil
+}
+
 func (r *SubjectRepository) GetSubjectName(subjectID int64) (string, error) {
 	var subjectName string
 	err := r.db.Get(&subjectName, `SELECT subject_name FROM subjects WHERE subject_id = $1`, subjectID)
 	return subjectName, err
 }
 
-type LessonTypeRepository struct {
-	db *sqlx.DB
+// GetSubjectIDsByName returns every subject with the given name; different
+// teachers lead separate subjects of the same name.
+func (r *SubjectRepository) GetSubjectIDsByName(tx *sqlx.Tx, subjectName string) ([]int64, error) {
+	var subjectIDs []int64
+	err := tx.Select(&subjectIDs, `SELECT subject_id FROM subjects WHERE subject_name = $1 ORDER BY subject_id`, subjectName)
+	return subjectIDs, err
 }
 
-func NewLessonTypeRepository(db *sqlx.DB) *LessonTypeRepository {
-	return &LessonTypeRepository{db: db}
+// GetTeacherSubjectIDForGroup finds the subject with the given name that the
+// teacher leads in the group.
+func (r *SubjectRepository) GetTeacherSubjectIDForGroup(tx *sqlx.Tx, subjectName string, teacherID, groupID int64) (int64, error) {
+	var subjectID int64
+	err := tx.Get(&subjectID, `
+        SELECT s.subject_id FROM subjects s
+        JOIN groups_subjects gs ON s.subject_id = gs.subject_id
+        WHERE s.subject_name = $1 AND s.teacher_id = $2 AND gs.group_id = $3
+        LIMIT 1`,
+		subjectName, teacherID, groupID)
+	return subjectID, err
 }
 
-func (r *LessonTypeRepository) CreateOrGetLessonType(tx *sqlx.Tx, typeName string) (int64, error) {
-	var lessonTypeID int64
-	err := tx.Get(&lessonTypeID, `
-        INSERT INTO lesson_types (type_name)
-        VALUES ($1)
-        ON CONFLICT (type_name) DO UPDATE SET type_name = EXCLUDED.type_name
-        RETURNING lesson_type_id`, typeName)
-	return lessonTypeID, err
+func (r *SubjectRepository) GetSubjectGradingScale(subjectID int64) (string, error) {
+	var scale string
+	err := r.db.Get(&scale, `SELECT grading_scale FROM subjects WHERE subject_id = $1`, subjectID)
+	return scale, err
 }
 
-func (r *LessonTypeRepository) GetLessonTypeName(lessonTypeID int64) (string, error) {
-	var lessonTypeName string
-	err := r.db.Get(&lessonTypeName, `SELECT type_name FROM lesson_types WHERE lesson_type_id = $1`, lessonTypeID)
-	return lessonTypeName, err
+func (r *SubjectRepository) SetSubjectGradingScale(tx *sqlx.Tx, subjectID int64, scale string) error {
+	_, err := tx.Exec(`UPDATE subjects SET grading_scale = $1 WHERE subject_id = $2`, scale, subjectID)
+	return err
 }
 
-type ScheduleRepository struct {
+type AssessmentTypeRepository struct {
 	db *sqlx.DB
 }
 
-func NewScheduleRepository(db *sqlx.DB) *ScheduleRepository {
-	return &ScheduleRepository{db: db}
+func NewAssessmentTypeRepository(db *sqlx.DB) *AssessmentTypeRepository {
+	return &AssessmentTypeRepository{db: db}
 }
 
-func (r *ScheduleRepository) CreateSchedule(tx *sqlx.Tx, weekday int, startTime, endTime, classroom string, subjectID, teacherID, groupID, lessonTypeID int64) error {
+func (r *AssessmentTypeRepository) GetAssessmentTypeIDByCode(tx *sqlx.Tx, typeCode string) (int64, error) {
+	var assessmentTypeID int64
+	err := tx.Get(&assessmentTypeID, `SELECT assessment_type_id FROM assessment_types WHERE type_code = $1`, typeCode)
+	return assessmentTypeID, err
+}
+
+// GetAssessmentTypesForSubject returns all assessment types with the weight
+// effective for the subject: the subject override if set, the default otherwise.
+func (r *AssessmentTypeRepository) GetAssessmentTypesForSubject(subjectID int64) ([]AssessmentType, error) {
+	var types []AssessmentType
+	query := `
+        SELECT at.assessment_type_id, at.type_code, at.title,
+               COALESCE(saw.weight, at.default_weight)::float8 AS weight
+        FROM assessment_types at
+        LEFT JOIN subject_assessment_weights saw
+            ON saw.assessment_type_id = at.assessment_type_id AND saw.subject_id = $1
+        ORDER BY at.assessment_type_id`
+	err := r.db.Select(&types, query, subjectID)
+	return types, err
+}
+
+func (r *AssessmentTypeRepository) SetSubjectWeight(tx *sqlx.Tx, subjectID, assessmentTypeID int64, weight float64) error {
 	_, err := tx.Exec(`
-        INSERT INTO schedule (weekday, start_time, end_time, class_room, subject_id, teacher_id, group_id, lesson_type_id)
-        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
-		weekday, startTime, endTime, classroom, subjectID, teacherID, groupID, lessonTypeID)
+        INSERT INTO subject_assessment_weights (subject_id, assessment_type_id, weight)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (subject_id, assessment_type_id) DO UPDATE SET weight = EXCLUDED.weight`,
+		subjectID, assessmentTypeID, weight)
 	return err
 }
 
-func (r *ScheduleRepository) GetScheduleForDate(weekday int16) ([]Schedule, error) {
-	var entries []Schedule
-	query := `SELECT * FROM schedule WHERE weekday = $1 ORDER BY start_time`
-	err := r.db.Select(&entries, query, weekday)
-	return entries, err
+type RatingRuleRepository struct {
+	db *sqlx.DB
 }
 
-func (r *ScheduleRepository) GetScheduleForDateByTeacher(weekday int16, teacherID int64) ([]Schedule, error) {
-	var entries []Schedule
-	query := `SELECT * FROM schedule WHERE weekday = $1 AND teacher_id = $2 ORDER BY start_time`
-	err := r.db.Select(&entries, query, weekday, teacherID)
-	return entries, err
+func NewRatingRuleRepository(db *sqlx.DB) *RatingRuleRepository {
+	return &RatingRuleRepository{db: db}
 }
 
-func (r *ScheduleRepository) GetScheduleForDateByGroup(weekday int16, groupID int64) ([]Schedule, error) {
-	var entries []Schedule
-	query := `SELECT * FROM schedule WHERE weekday = $1 AND group_id = $2 ORDER BY start_time`
-	err := r.db.Select(&entries, query, weekday, groupID)
-	return entries, err
+func (r *RatingRuleRepository) GetRatingRule(subjectID int64) (*RatingRule, error) {
+	rule := new(RatingRule)
+	err := r.db.Get(rule, `
+        SELECT subject_id, grade_weight::float8 AS grade_weight, attendance_weight::float8 AS attendance_weight,
+               min_attendance_percent::float8 AS min_attendance_percent, min_rating::float8 AS min_rating
+        FROM rating_rules WHERE subject_id = $1`, subjectID)
+	if err != nil {
+		return nil, err
+	}
+	return rule, nil
 }
 
-type GradeRepository struct {
-	db *sqlx.DB
+func (r *RatingRuleRepository) SetRatingRule(tx *sqlx.Tx, rule RatingRule) error {
+	_, err := tx.Exec(`
+        INSERT INTO rating_rules (subject_id, grade_weight, attendance_weight, min_attendance_percent, min_rating)
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT (subject_id) DO UPDATE
+        SET grade_weight = EXCLUDED.grade_weight,
+            attendance_weight = EXCLUDED.attendance_weight,
+            min_attendance_percent = EXCLUDED.min_attendance_percent,
+            min_rating = EXCLUDED.min_rating`,
+		rule.SubjectID, rule.GradeWeight, rule.AttendanceWeight, rule.MinAttendancePercent, rule.MinRating)
+	return err
 }
 
-func NewGradeRepository(db *sqlx.DB) *GradeRepository {
-	return &GradeRepository{db: db}
+type UserSettingsRepository struct {
+	db *sqlx.DB
 }
 
-func (r *GradeRepository) GetSubjectsByTeacher(teacherID int64) ([]Subject, error) {
-	var subjects []Subject
-	query := `SELECT * FROM subjects WHERE teacher_id = $1 ORDER BY subject_name`
-	err := r.db.Select(&subjects, query, teacherID)
-	return subjects, err
+func NewUserSettingsRepository(db *sqlx.DB) *UserSettingsRepository {
+	return &UserSettingsRepository{db: db}
 }
 
-func (r *GradeRepository) GetSubjectsByStudentGroup(groupID int64) ([]Subject, error) {
-	var subjects []Subject
-	query := `
-        SELECT DISTINCT s.subject_id, s.subject_name, s.teacher_id
-        FROM subjects s
-        JOIN groups_subjects gs ON s.subject_id = gs.subject_id
-        WHERE gs.group_id = $1
-        ORDER BY s.subject_name`
-	err := r.db.Select(&subjects, query, groupID)
-	return subjects, err
+// GetUserSettings returns the user's notification settings. A user who has
+// never changed them gets the table defaults; the row is written only by
+// SaveUserSettings.
+func (r *UserSettingsRepository) GetUserSettings(userID int64) (*UserSettings, error) {
+	settings := new(UserSettings)
+	err := r.db.Get(settings, `
+        SELECT u.user_id,
+               COALESCE(s.digest_enabled, TRUE) AS digest_enabled,
+               COALESCE(s.digest_time, '07:30') AS digest_time,
+               COALESCE(s.reminders_enabled, TRUE) AS reminders_enabled,
+               COALESCE(s.reminder_minutes, 15) AS reminder_minutes,
+               COALESCE(s.notify_grades, TRUE) AS notify_grades,
+               COALESCE(s.notify_attendance, TRUE) AS notify_attendance,
+               COALESCE(s.notify_schedule, TRUE) AS notify_schedule,
+               COALESCE(s.notify_announcements, TRUE) AS notify_announcements,
+               s.quiet_from, s.quiet_to,
+               COALESCE(s.delivery_mode, 'instant') AS delivery_mode,
+               COALESCE(s.summary_time, '20:00') AS summary_time
+        FROM users u
+        LEFT JOIN user_settings s ON s.user_id = u.user_id
+        WHERE u.user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return settings, nil
 }
 
-func (r *GradeRepository) GetGradesByStudentAndSubject(studentID, subjectID int64) ([]Grade, error) {
-	var grades []Grade
-	query := `SELECT * FROM grades WHERE student_id = $1 AND subject_id = $2 ORDER BY grade_date DESC`
-	err := r.db.Select(&grades, query, studentID, subjectID)
-	return grades, err
+func (r *UserSettingsRepository) SaveUserSettings(settings UserSettings) error {
+	_, err := r.db.Exec(`
+        INSERT INTO user_settings (
+            user_id, digest_enabled, digest_time, reminders_enabled, reminder_minutes,
+            notify_grades, notify_attendance, notify_schedule, notify_announcements,
+            quiet_from, quiet_to, delivery_mode, summary_time
+        )
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+        ON CONFLICT (user_id) DO UPDATE
+        SET digest_enabled = EXCLUDED.digest_enabled,
+            digest_time = EXCLUDED.digest_time,
+            reminders_enabled = EXCLUDED.reminders_enabled,
+            reminder_minutes = EXCLUDED.reminder_minutes,
+            notify_grades = EXCLUDED.notify_grades,
+            notify_attendance = EXCLUDED.notify_attendance,
+            notify_schedule = EXCLUDED.notify_schedule,
+            notify_announcements = EXCLUDED.notify_announcements,
+            quiet_from = EXCLUDED.quiet_from,
+            quiet_to = EXCLUDED.quiet_to,
+            delivery_mode = EXCLUDED.delivery_mode,
+            summary_time = EXCLUDED.summary_time`,
+		settings.UserID, settings.DigestEnabled, settings.DigestTime.Format("15:04"),
+		settings.RemindersEnabled, settings.ReminderMinutes,
+		settings.NotifyGrades, settings.NotifyAttendance, settings.NotifySchedule, settings.NotifyAnnouncements,
+		formatClock(settings.QuietFrom), formatClock(settings.QuietTo),
+		settings.DeliveryMode, settings.SummaryTime.Format("15:04"))
+	return err
 }
 
-func (r *GradeRepository) GetGroupsBySubjectAndTeacher(subjectID, teacherID int64) ([]Group, error) {
-	var groups []Group
+// GetDigestRecipients returns Max IDs of students and teachers who have
+// lessons on the weekday and whose digest time falls into [from, to).
+func (r *UserSettingsRepository) GetDigestRecipients(weekday int16, from, to string) ([]int64, error) {
+	var userMaxIDs []int64
 	query := `
-        SELECT DISTINCT g.group_id, g.group_name
-        FROM groups g
-        JOIN groups_subjects gs ON g.group_id = gs.group_id
-        JOIN subjects s ON gs.subject_id = s.subject_id
-        WHERE s.subject_id = $1 AND s.teacher_id = $2
-        ORDER BY g.group_name`
-	err := r.db.Select(&groups, query, subjectID, teacherID)
-	return groups, err
+        SELECT u.usermax_id FROM users u
+        LEFT JOIN user_settings s ON s.user_id = u.user_id
+        WHERE u.usermax_id IS NOT NULL
+        AND COALESCE(s.digest_enabled, TRUE)
+        AND COALESCE(s.digest_time, '07:30') >= $2::time
+        AND COALESCE(s.digest_time, '07:30') < $3::time
+        AND EXISTS (
+            SELECT 1 FROM schedule sc
+            WHERE sc.weekday = $1 AND NOT sc.archived AND (sc.group_id = u.group_id OR sc.teacher_id = u.user_id)
+        )`
+	err := r.db.Select(&userMaxIDs, query, weekday, from, to)
+	return userMaxIDs, err
 }
 
-func (r *GradeRepository) GetStudentsByGroup(groupID int64) ([]User, error) {
-	var students []User
+// GetLessonReminders returns lessons whose reminder moment, the lesson's
+// start minus the user's lead time, falls into [from, to). The moments are
+// timestamps, so a reminder for a lesson just after midnight falls on the
+// day before. Lessons on holidays are skipped.
+func (r *UserSettingsRepository) GetLessonReminders(from, to time.Time) ([]LessonReminder, error) {
+	var reminders []LessonReminder
 	query := `
-        SELECT * FROM users
-        WHERE group_id = $1 AND role_id = (SELECT role_id FROM roles WHERE role_name = 'student')
-        ORDER BY last_name, first_name`
-	err := r.db.Select(&students, query, groupID)
-	return students, err
+        SELECT u.usermax_id, COALESCE(s.reminder_minutes, 15) AS reminder_minutes,
+               d.day::date AS lesson_date, sc.*
+        FROM generate_series($1::date::timestamp, $2::date::timestamp + interval '1 day', interval '1 day') AS d(day)
+        JOIN schedule sc ON sc.weekday = EXTRACT(ISODOW FROM d.day)
+        JOIN users u ON u.group_id = sc.group_id OR u.user_id = sc.teacher_id
+        LEFT JOIN user_settings s ON s.user_id = u.user_id
+        WHERE NOT sc.archived
+        AND u.usermax_id IS NOT NULL
+        AND COALESCE(s.reminders_enabled, TRUE)
+        AND NOT EXISTS (SELECT 1 FROM holidays h WHERE h.holiday_date = d.day::date)
+        AND d.day + sc.start_time - make_interval(mins => COALESCE(s.reminder_minutes, 15)) >= $1::timestamp
+        AND d.day + sc.start_time - make_interval(mins => COALESCE(s.reminder_minutes, 15)) < $2::timestamp
+        ORDER BY d.day, sc.start_time`
+	err := r.db.Select(&reminders, query, from.Format("2006-01-02 15:04:05"), to.Format("2006-01-02 15:04:05"))
+	return reminders, err
 }
 
-func (r *GradeRepository) GetScheduleBySubjectAndGroup(subjectID, groupID int64) ([]Schedule, error) {
-	var schedules []Schedule
+const (
+	OutboxStatusPending = "pending"
+	OutboxStatusSending = "sending"
+	OutboxStatusSent    = "sent"
+	OutboxStatusDaily   = "daily"
+	OutboxStatusSkipped = "skipped"
+	OutboxStatusDead    = "dead"
+)
+
+type OutboxRepository struct {
+	db *sqlx.DB
+}
+
+func NewOutboxRepository(db *sqlx.DB) *OutboxRepository {
+	return &OutboxRepository{db: db}
+}
+
+// Enqueue adds a notification to the outbox within the transaction that
+// writes the data it is about, so it is sent only if that write commits.
+func (r *OutboxRepository) Enqueue(tx *sqlx.Tx, n OutboxNotification) (int64, error) {
+	var outboxID int64
+	err := tx.Get(&outboxID, `
+        INSERT INTO notification_outbox (
+            user_id, batch_id, category, message_text, button_text, button_payload, attachment_type, attachment_token
+        )
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+        RETURNING outbox_id`,
+		n.UserID, n.BatchID, n.Category, n.MessageText, n.ButtonText, n.ButtonPayload, n.AttachmentType, n.AttachmentToken)
+	return outboxID, err
+}
+
+// CreateBatch groups notifications sent on behalf of one action, e.g. marking
+// a whole lesson, so the requester gets a single delivery summary.
+func (r *OutboxRepository) CreateBatch(tx *sqlx.Tx, requestedBy int64, title string) (int64, error) {
+	var batchID int64
+	err := tx.Get(&batchID, `
+        INSERT INTO notification_batches (requested_by, title)
+        VALUES ($1, $2)
+        RETURNING batch_id`, requestedBy, title)
+	return batchID, err
+}
+
+// ClaimDue marks up to limit due pending notifications as being sent and
+// returns them with the recipients' Max IDs. Rows locked by another worker
+// are skipped.
+func (r *OutboxRepository) ClaimDue(limit int) ([]OutboxNotification, error) {
+	var notifications []OutboxNotification
 	query := `
-        SELECT * FROM schedule
-        WHERE subject_id = $1 AND group_id = $2
-        ORDER BY weekday, start_time`
-	err := r.db.Select(&schedules, query, subjectID, groupID)
-	return schedules, err
+        WITH claimed AS (
+            UPDATE notification_outbox SET status = 'sending'
+            WHERE outbox_id IN (
+                SELECT outbox_id FROM notification_outbox
+                WHERE status = 'pending' AND next_attempt_at <= NOW()
+                ORDER BY next_attempt_at, outbox_id
+                LIMIT $1
+                FOR UPDATE SKIP LOCKED
+            )
+            RETURNING *
+        )
+        SELECT c.*, u.usermax_id FROM claimed c
+        JOIN users u ON u.user_id = c.user_id
+        ORDER BY c.next_attempt_at, c.outbox_id`
+	err := r.db.Select(&notifications, query, limit)
+	return notifications, err
+}
+
+// ReleaseStale returns notifications left in the sending state by a worker
+// that stopped mid-delivery back to the queue.
+func (r *OutboxRepository) ReleaseStale() (int64, error) {
+	res, err := r.db.Exec(`UPDATE notification_outbox SET status = 'pending' WHERE status = 'sending'`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
 }
 
-func (r *GradeRepository) CreateGrade(studentID, teacherID, subjectID, scheduleID int64, gradeValue int) error {
+func (r *OutboxRepository) MarkSent(outboxIDs []int64) error {
 	_, err := r.db.Exec(`
-        INSERT INTO grades (student_id, teacher_id, subject_id, schedule_id, grade_value, grade_date)
-        VALUES ($1, $2, $3, $4, $5, NOW())`,
-		studentID, teacherID, subjectID, scheduleID, gradeValue)
+        UPDATE notification_outbox
+        SET status = 'sent', sent_at = NOW(), last_error = ''
+        WHERE outbox_id = ANY($1)`, pq.Array(outboxIDs))
 	return err
 }
 
-func (r *GradeRepository) GetGradesByStudent(studentID int64) ([]Grade, error) {
-	var grades []Grade
-	query := `SELECT * FROM grades WHERE student_id = $1 ORDER BY grade_date DESC`
-	err := r.db.Select(&grades, query, studentID)
-	return grades, err
+func (r *OutboxRepository) SetStatus(outboxID int64, status string) error {
+	_, err := r.db.Exec(`UPDATE notification_outbox SET status = $2 WHERE outbox_id = $1`, outboxID, status)
+	return err
 }
 
-func (r *GradeRepository) GetStudentNameByID(studentID int64) (string, error) {
-	var studentName string
-	err := r.db.Get(&studentName, `SELECT name FROM users WHERE user_id = $1`, studentID)
-	return studentName, err
+// Postpone puts the notification back to the queue until the given moment
+// without counting it as a failed attempt.
+func (r *OutboxRepository) Postpone(outboxID int64, until time.Time) error {
+	_, err := r.db.Exec(`
+        UPDATE notification_outbox SET status = 'pending', next_attempt_at = $2
+        WHERE outbox_id = $1`, outboxID, until)
+	return err
 }
 
-func (r *GradeRepository) GetSubjectIDByScheduleID(scheduleID int64) (int64, error) {
-	var subjectID int64
-	err := r.db.Get(&subjectID, `SELECT subject_id FROM schedule WHERE schedule_id = $1`, scheduleID)
-	return subjectID, err
+// MarkFailed records a failed attempt and schedules a retry, or moves the
+// notification to the dead letters once maxAttempts is reached.
+func (r *OutboxRepository) MarkFailed(outboxID int64, lastError string, retryAt time.Time, maxAttempts int) error {
+	_, err := r.db.Exec(`
+        UPDATE notification_outbox
+        SET attempts = attempts + 1,
+            last_error = $2,
+            next_attempt_at = $3,
+            status = CASE WHEN attempts + 1 >= $4 THEN 'dead' ELSE 'pending' END
+        WHERE outbox_id = $1`, outboxID, lastError, retryAt, maxAttempts)
+	return err
 }
 
-type AttendanceRepository struct {
+// GetFinishedBatches returns batches without a summary yet whose every
+// notification has been delivered, dropped, dead-lettered or deferred by the
+// recipient's preferences.
+func (r *OutboxRepository) GetFinishedBatches() ([]NotificationBatchSummary, error) {
+	var summaries []NotificationBatchSummary
+	query := `
+        SELECT b.batch_id, b.requested_by, b.title,
+               COUNT(*) AS total,
+               COUNT(*) FILTER (WHERE o.status = 'sent') AS sent,
+               COUNT(*) FILTER (WHERE o.status = 'skipped') AS skipped,
+               COUNT(*) FILTER (
+                   WHERE o.status = 'daily'
+                   OR (o.status = 'pending' AND o.attempts = 0 AND o.next_attempt_at > NOW())
+               ) AS deferred,
+               COUNT(*) FILTER (WHERE o.status = 'dead') AS failed
+        FROM notification_batches b
+        JOIN notification_outbox o ON o.batch_id = b.batch_id
+        WHERE b.summary_sent_at IS NULL
+        GROUP BY b.batch_id
+        HAVING COUNT(*) FILTER (
+            WHERE o.status = 'sending'
+            OR (o.status = 'pending' AND (o.attempts > 0 OR o.next_attempt_at <= NOW()))
+        ) = 0`
+	err := r.db.Select(&summaries, query)
+	return summaries, err
+}
+
+func (r *OutboxRepository) MarkBatchSummarySent(tx *sqlx.Tx, batchID int64) error {
+	_, err := tx.Exec(`UPDATE notification_batches SET summary_sent_at = NOW() WHERE batch_id = $1`, batchID)
+	return err
+}
+
+// GetSummaryUserIDs returns users with notifications waiting for the daily
+// summary whose summary time falls into [from, to).
+func (r *OutboxRepository) GetSummaryUserIDs(from, to string) ([]int64, error) {
+	var userIDs []int64
+	query := `
+        SELECT DISTINCT n.user_id FROM notification_outbox n
+        LEFT JOIN user_settings s ON s.user_id = n.user_id
+        WHERE n.status = 'daily'
+        AND COALESCE(s.summary_time, '20:00') >= $1::time
+        AND COALESCE(s.summary_time, '20:00') < $2::time`
+	err := r.db.Select(&userIDs, query, from, to)
+	return userIDs, err
+}
+
+func (r *OutboxRepository) GetDailyNotifications(userID int64) ([]OutboxNotification, error) {
+	var notifications []OutboxNotification
+	query := `SELECT * FROM notification_outbox WHERE user_id = $1 AND status = 'daily' ORDER BY created_at`
+	err := r.db.Select(&notifications, query, userID)
+	return notifications, err
+}
+
+type AnnouncementRepository struct {
 	db *sqlx.DB
 }
 
-func NewAttendanceRepository(db *sqlx.DB) *AttendanceRepository {
-	return &AttendanceRepository{db: db}
+func NewAnnouncementRepository(db *sqlx.DB) *AnnouncementRepository {
+	return &AnnouncementRepository{db: db}
+}
+
+func (r *AnnouncementRepository) CreateAnnouncement(tx *sqlx.Tx, a Announcement) (int64, error) {
+	var announcementID int64
+	err := tx.Get(&announcementID, `
+        INSERT INTO announcements (
+            author_id, target_type, target_id, target_title, message_text, attachment_type, attachment_token, important
+        )
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+        RETURNING announcement_id`,
+		a.AuthorID, a.TargetType, a.TargetID, a.TargetTitle, a.MessageText, a.AttachmentType, a.AttachmentToken, a.Important)
+	return announcementID, err
 }
 
-func (r *AttendanceRepository) MarkAttendance(studentID, scheduleID int64, attended bool) error {
-	var count int
-	err := r.db.Get(&count, `
-        SELECT COUNT(*) FROM attendance
-        WHERE student_id = $1 AND schedule_id = $2`, studentID, scheduleID)
+func (r *AnnouncementRepository) GetAnnouncement(announcementID int64) (*Announcement, error) {
+	announcement := new(Announcement)
+	err := r.db.Get(announcement, `SELECT * FROM announcements WHERE announcement_id = $1`, announcementID)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return announcement, nil
+}
 
-	if count > 0 {
-		_, err = r.db.Exec(`
-            UPDATE attendance
-            SET attended = $1, mark_time = NOW()
-            WHERE student_id = $2 AND schedule_id = $3`,
-			attended, studentID, scheduleID)
-		return err
-	}
+func (r *AnnouncementRepository) GetAnnouncementsByAuthor(authorID int64, limit int) ([]Announcement, error) {
+	var announcements []Announcement
+	query := `SELECT * FROM announcements WHERE author_id = $1 ORDER BY created_at DESC LIMIT $2`
+	err := r.db.Select(&announcements, query, authorID, limit)
+	return announcements, err
+}
+
+// GetRecipientIDs resolves an announcement target to the users who can
+// receive it through the bot, leaving out the author.
+func (r *AnnouncementRepository) GetRecipientIDs(targetType string, targetID *int64, authorID int64) ([]int64, error) {
+	var userIDs []int64
+	query := `
+        SELECT DISTINCT u.user_id FROM users u
+        JOIN roles r ON r.role_id = u.role_id
+        WHERE u.usermax_id IS NOT NULL AND u.user_id <> $3
+        AND CASE $1
+            WHEN 'group' THEN r.role_name = 'student' AND u.group_id = $2
+            WHEN 'subject' THEN r.role_name = 'student' AND u.group_id IN (
+                SELECT group_id FROM groups_subjects WHERE subject_id = $2
+            )
+            WHEN 'students' THEN r.role_name = 'student'
+            WHEN 'teachers' THEN r.role_name = 'teacher'
+            ELSE FALSE
+        END
+        ORDER BY u.user_id`
+	err := r.db.Select(&userIDs, query, targetType, targetID, authorID)
+	return userIDs, err
+}
 
-	_, err = r.db.Exec(`
-        INSERT INTO attendance (student_id, schedule_id, attended, mark_time)
-        VALUES ($1, $2, $3, NOW())`,
-		studentID, scheduleID, attended)
+func (r *AnnouncementRepository) AddReceipt(tx *sqlx.Tx, announcementID, userID, outboxID int64) error {
+	_, err := tx.Exec(`
+        INSERT INTO announcement_receipts (announcement_id, user_id, outbox_id)
+        VALUES ($1, $2, $3)`, announcementID, userID, outboxID)
 	return err
 }
 
-func (r *AttendanceRepository) GetAttendanceByStudentAndSubject(studentID, subjectID int64) ([]Attendance, error) {
-	var attendance []Attendance
+// Acknowledge records that the user has read the announcement. It reports
+// false if the user was not among its recipients.
+func (r *AnnouncementRepository) Acknowledge(announcementID, userID int64) (bool, error) {
+	res, err := r.db.Exec(`
+        UPDATE announcement_receipts SET acknowledged_at = COALESCE(acknowledged_at, NOW())
+        WHERE announcement_id = $1 AND user_id = $2`, announcementID, userID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+func (r *AnnouncementRepository) GetDeliveryStats(announcementID int64) (*AnnouncementStats, error) {
+	stats := new(AnnouncementStats)
+	err := r.db.Get(stats, `
+        SELECT COUNT(*) AS total,
+               COUNT(*) FILTER (WHERE o.status = 'sent') AS sent,
+               COUNT(*) FILTER (WHERE o.status IN ('pending', 'sending')) AS pending,
+               COUNT(*) FILTER (WHERE o.status = 'daily') AS deferred,
+               COUNT(*) FILTER (WHERE o.status = 'skipped') AS skipped,
+               COUNT(*) FILTER (WHERE o.status = 'dead') AS failed,
+               COUNT(*) FILTER (WHERE ar.acknowledged_at IS NOT NULL) AS acknowledged
+        FROM announcement_receipts ar
+        JOIN notification_outbox o ON o.outbox_id = ar.outbox_id
+        WHERE ar.announcement_id = $1`, announcementID)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func (r *AnnouncementRepository) GetUnacknowledgedNames(announcementID int64, limit int) ([]string, error) {
+	var names []string
+	query := `
+        SELECT u.name FROM announcement_receipts ar
+        JOIN users u ON u.user_id = ar.user_id
+        WHERE ar.announcement_id = $1 AND ar.acknowledged_at IS NULL
+        ORDER BY u.last_name, u.first_name
+        LIMIT $2`
+	err := r.db.Select(&names, query, announcementID, limit)
+	return names, err
+}
+
+type HolidayRepository struct {
+	db *sqlx.DB
+}
+
+func NewHolidayRepository(db *sqlx.DB) *HolidayRepository {
+	return &HolidayRepository{db: db}
+}
+
+func (r *HolidayRepository) IsHoliday(date time.Time) (bool, error) {
+	var exists bool
+	err := r.db.Get(&exists, `SELECT EXISTS (SELECT 1 FROM holidays WHERE holiday_date = $1::date)`, date.Format("2006-01-02"))
+	return exists, err
+}
+
+func (r *HolidayRepository) SetHoliday(tx *sqlx.Tx, date time.Time, title string) error {
+	_, err := tx.Exec(`
+        INSERT INTO holidays (holiday_date, title)
+        VALUES ($1, $2)
+        ON CONFLICT (holiday_date) DO UPDATE SET title = EXCLUDED.title`,
+		date.Format("2006-01-02"), title)
+	return err
+}
+
+// GetHolidays returns the holidays between from and to inclusive.
+func (r *HolidayRepository) GetHolidays(from, to time.Time) ([]time.Time, error) {
+	var dates []time.Time
+	query := `SELECT holiday_date FROM holidays WHERE holiday_date BETWEEN $1::date AND $2::date ORDER BY holiday_date`
+	err := r.db.Select(&dates, query, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	return dates, err
+}
+
+type LessonTypeRepository struct {
+	db *sqlx.DB
+}
+
+func NewLessonTypeRepository(db *sqlx.DB) *LessonTypeRepository {
+	return &LessonTypeRepository{db: db}
+}
+
+func (r *LessonTypeRepository) CreateOrGetLessonType(tx *sqlx.Tx, typeName string) (int64, error) {
+	var lessonTypeID int64
+	err := tx.Get(&lessonTypeID, `
+        INSERT INTO lesson_types (type_name)
+        VALUES ($1)
+        ON CONFLICT (type_name) DO UPDATE SET type_name = EXCLUDED.type_name
+        RETURNING lesson_type_id`, typeName)
+	return lessonTypeID, err
+}
+
+func (r *LessonTypeRepository) GetLessonTypeName(lessonTypeID int64) (string, error) {
+	var lessonTypeName string
+	err := r.db.Get(&lessonTypeName, `SELECT type_name FROM lesson_types WHERE lesson_type_id = $1`, lessonTypeID)
+	return lessonTypeName, err
+}
+
+// GetLessonTypes returns every lesson type ordered by name.
+func (r *LessonTypeRepository) GetLessonTypes() ([]LessonType, error) {
+	var types []LessonType
+	err := r.db.Select(&types, `SELECT * FROM lesson_types ORDER BY type_name`)
+	return types, err
+}
+
+type ScheduleRepository struct {
+	db *sqlx.DB
+}
+
+func NewScheduleRepository(db *sqlx.DB) *ScheduleRepository {
+	return &ScheduleRepository{db: db}
+}
+
+func (r *ScheduleRepository) CreateSchedule(tx *sqlx.Tx, weekday int, startTime, endTime, classroom string, subjectID, teacherID, groupID, lessonTypeID int64) error {
+	_, err := tx.Exec(`
+        INSERT INTO schedule (weekday, start_time, end_time, class_room, subject_id, teacher_id, group_id, lesson_type_id)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		weekday, startTime, endTime, classroom, subjectID, teacherID, groupID, lessonTypeID)
+	return err
+}
+
+// GetGroupLessons returns the group's current timetable ordered by weekday
+// and start time.
+func (r *ScheduleRepository) GetGroupLessons(tx *sqlx.Tx, groupID int64) ([]ScheduleLesson, error) {
+	var lessons []ScheduleLesson
+	query := `
+        SELECT sc.*, s.subject_name, lt.type_name, g.group_name, u.name AS teacher_name
+        FROM schedule sc
+        JOIN subjects s ON s.subject_id = sc.subject_id
+        JOIN lesson_types lt ON lt.lesson_type_id = sc.lesson_type_id
+        JOIN groups g ON g.group_id = sc.group_id
+        JOIN users u ON u.user_id = sc.teacher_id
+        WHERE sc.group_id = $1 AND NOT sc.archived
+        ORDER BY sc.weekday, sc.start_time`
+	err := tx.Select(&lessons, query, groupID)
+	return lessons, err
+}
+
+// GetCurrentLessons returns every lesson of the current schedule ordered by
+// weekday and start time, as seen by the transaction.
+func (r *ScheduleRepository) GetCurrentLessons(tx *sqlx.Tx) ([]ScheduleLesson, error) {
+	return selectCalendarLessons(tx, 0, 0)
+}
+
+// LockSchedule blocks other schedule changes until the transaction ends, so
+// a conflict check and the change it allows see the same schedule.
+func (r *ScheduleRepository) LockSchedule(tx *sqlx.Tx) error {
+	_, err := tx.Exec(`LOCK TABLE schedule IN SHARE ROW EXCLUSIVE MODE`)
+	return err
+}
+
+// GetCalendarLessons returns the current lessons of a group or a teacher
+// ordered by weekday and start time. A zero ID matches any group or teacher.
+func (r *ScheduleRepository) GetCalendarLessons(groupID, teacherID int64) ([]ScheduleLesson, error) {
+	return selectCalendarLessons(r.db, groupID, teacherID)
+}
+
+func selectCalendarLessons(q sqlx.Queryer, groupID, teacherID int64) ([]ScheduleLesson, error) {
+	var lessons []ScheduleLesson
+	query := `
+        SELECT sc.*, s.subject_name, lt.type_name, g.group_name, u.name AS teacher_name
+        FROM schedule sc
+        JOIN subjects s ON s.subject_id = sc.subject_id
+        JOIN lesson_types lt ON lt.lesson_type_id = sc.lesson_type_id
+        JOIN groups g ON g.group_id = sc.group_id
+        JOIN users u ON u.user_id = sc.teacher_id
+        WHERE NOT sc.archived
+        AND ($1 = 0 OR sc.group_id = $1)
+        AND ($2 = 0 OR sc.teacher_id = $2)
+        ORDER BY sc.weekday, sc.start_time`
+	err := sqlx.Select(q, &lessons, query, groupID, teacherID)
+	return lessons, err
+}
+
+// UpdateLesson moves a lesson to another time, room or teacher while keeping
+// its ID, so grades and attendance stay attached to it.
+func (r *ScheduleRepository) UpdateLesson(tx *sqlx.Tx, scheduleID int64, weekday int16, startTime, endTime, classroom string, teacherID int64) error {
+	_, err := tx.Exec(`
+        UPDATE schedule
+        SET weekday = $2, start_time = $3, end_time = $4, class_room = $5, teacher_id = $6
+        WHERE schedule_id = $1`,
+		scheduleID, weekday, startTime, endTime, classroom, teacherID)
+	return err
+}
+
+// SetLessonType changes the lesson type of a lesson.
+func (r *ScheduleRepository) SetLessonType(tx *sqlx.Tx, scheduleID, lessonTypeID int64) error {
+	_, err := tx.Exec(`UPDATE schedule SET lesson_type_id = $2 WHERE schedule_id = $1`, scheduleID, lessonTypeID)
+	return err
+}
+
+// SetLessonSubject moves a lesson to another subject, e.g. the same subject
+// taught by another teacher.
+func (r *ScheduleRepository) SetLessonSubject(tx *sqlx.Tx, scheduleID, subjectID int64) error {
+	_, err := tx.Exec(`UPDATE schedule SET subject_id = $2 WHERE schedule_id = $1`, scheduleID, subjectID)
+	return err
+}
+
+// RemoveLesson deletes a lesson that has no grades or attendance and archives
+// it otherwise, so recorded marks keep their lesson.
+func (r *ScheduleRepository) RemoveLesson(tx *sqlx.Tx, scheduleID int64) error {
+	res, err := tx.Exec(`
+        DELETE FROM schedule
+        WHERE schedule_id = $1
+        AND NOT EXISTS (SELECT 1 FROM grades WHERE schedule_id = $1)
+        AND NOT EXISTS (SELECT 1 FROM attendance WHERE schedule_id = $1)`, scheduleID)
+	if err != nil {
+		return err
+	}
+	if deleted, err := res.RowsAffected(); err != nil || deleted > 0 {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE schedule SET archived = TRUE WHERE schedule_id = $1`, scheduleID)
+	return err
+}
+
+func (r *ScheduleRepository) GetScheduleByID(scheduleID int64) (*Schedule, error) {
+	entry := new(Schedule)
+	err := r.db.Get(entry, `SELECT * FROM schedule WHERE schedule_id = $1`, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// GetLesson returns a current lesson with the names needed to describe it.
+func (r *ScheduleRepository) GetLesson(scheduleID int64) (*ScheduleLesson, error) {
+	lesson := new(ScheduleLesson)
+	query := `
+        SELECT sc.*, s.subject_name, lt.type_name, g.group_name, u.name AS teacher_name
+        FROM schedule sc
+        JOIN subjects s ON s.subject_id = sc.subject_id
+        JOIN lesson_types lt ON lt.lesson_type_id = sc.lesson_type_id
+        JOIN groups g ON g.group_id = sc.group_id
+        JOIN users u ON u.user_id = sc.teacher_id
+        WHERE sc.schedule_id = $1 AND NOT sc.archived`
+	if err := r.db.Get(lesson, query, scheduleID); err != nil {
+		return nil, err
+	}
+	return lesson, nil
+}
+
+// FindLessons returns lessons of the subject for the group on the weekday.
+// An empty startTime matches lessons at any time.
+func (r *ScheduleRepository) FindLessons(tx *sqlx.Tx, subjectID, groupID int64, weekday int16, startTime string) ([]Schedule, error) {
+	var entries []Schedule
+	query := `
+        SELECT * FROM schedule
+        WHERE subject_id = $1 AND group_id = $2 AND weekday = $3 AND NOT archived
+        AND ($4 = '' OR start_time = $4::time)
+        ORDER BY start_time`
+	err := tx.Select(&entries, query, subjectID, groupID, weekday, startTime)
+	return entries, err
+}
+
+func (r *ScheduleRepository) GetScheduleForDate(weekday int16) ([]Schedule, error) {
+	var entries []Schedule
+	query := `SELECT * FROM schedule WHERE weekday = $1 AND NOT archived ORDER BY start_time`
+	err := r.db.Select(&entries, query, weekday)
+	return entries, err
+}
+
+func (r *ScheduleRepository) GetScheduleForDateByTeacher(weekday int16, teacherID int64) ([]Schedule, error) {
+	var entries []Schedule
+	query := `SELECT * FROM schedule WHERE weekday = $1 AND teacher_id = $2 AND NOT archived ORDER BY start_time`
+	err := r.db.Select(&entries, query, weekday, teacherID)
+	return entries, err
+}
+
+func (r *ScheduleRepository) GetScheduleForDateByGroup(weekday int16, groupID int64) ([]Schedule, error) {
+	var entries []Schedule
+	query := `SELECT * FROM schedule WHERE weekday = $1 AND group_id = $2 AND NOT archived ORDER BY start_time`
+	err := r.db.Select(&entries, query, weekday, groupID)
+	return entries, err
+}
+
+// likePattern matches values containing the query, with the LIKE wildcards
+// in it taken literally.
+func likePattern(query string) string {
+	return "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(query) + "%"
+}
+
+// SearchTeachers returns teachers whose name contains the query, ignoring case.
+func (r *ScheduleRepository) SearchTeachers(query string, limit int) ([]User, error) {
+	var teachers []User
+	err := r.db.Select(&teachers, userColumns+`
+        WHERE role_id = (SELECT role_id FROM roles WHERE role_name = 'teacher')
+        AND name ILIKE $1
+        ORDER BY name
+        LIMIT $2`, likePattern(query), limit)
+	return teachers, err
+}
+
+// SearchGroups returns groups whose name contains the query, ignoring case.
+func (r *ScheduleRepository) SearchGroups(query string, limit int) ([]Group, error) {
+	var groups []Group
+	err := r.db.Select(&groups, `
+        SELECT group_id, group_name FROM groups
+        WHERE group_name ILIKE $1
+        ORDER BY group_name
+        LIMIT $2`, likePattern(query), limit)
+	return groups, err
+}
+
+// SearchRooms returns the rooms of the current schedule whose name contains
+// the query, ignoring case.
+func (r *ScheduleRepository) SearchRooms(query string, limit int) ([]string, error) {
+	var rooms []string
+	err := r.db.Select(&rooms, `
+        SELECT DISTINCT class_room FROM schedule
+        WHERE NOT archived AND class_room ILIKE $1
+        ORDER BY class_room
+        LIMIT $2`, likePattern(query), limit)
+	return rooms, err
+}
+
+// GetRoomLessons returns the lessons held in the room on the weekday.
+func (r *ScheduleRepository) GetRoomLessons(room string, weekday int16) ([]ScheduleLesson, error) {
+	var lessons []ScheduleLesson
+	query := `
+        SELECT sc.*, s.subject_name, lt.type_name, g.group_name, u.name AS teacher_name
+        FROM schedule sc
+        JOIN subjects s ON s.subject_id = sc.subject_id
+        JOIN lesson_types lt ON lt.lesson_type_id = sc.lesson_type_id
+        JOIN groups g ON g.group_id = sc.group_id
+        JOIN users u ON u.user_id = sc.teacher_id
+        WHERE NOT sc.archived AND sc.class_room = $1 AND sc.weekday = $2
+        ORDER BY sc.start_time`
+	err := r.db.Select(&lessons, query, room, weekday)
+	return lessons, err
+}
+
+// GetTimeSlots returns the distinct lesson times of the weekday.
+func (r *ScheduleRepository) GetTimeSlots(weekday int16) ([]TimeSlot, error) {
+	var slots []TimeSlot
+	err := r.db.Select(&slots, `
+        SELECT DISTINCT start_time, end_time FROM schedule
+        WHERE weekday = $1 AND NOT archived
+        ORDER BY start_time, end_time`, weekday)
+	return slots, err
+}
+
+// GetFreeRooms returns the rooms of the current schedule that have no lesson
+// overlapping the time span on the weekday.
+func (r *ScheduleRepository) GetFreeRooms(weekday int16, startTime, endTime string) ([]string, error) {
+	var rooms []string
+	err := r.db.Select(&rooms, `
+        SELECT DISTINCT class_room FROM schedule sc
+        WHERE NOT archived AND class_room <> ''
+        AND NOT EXISTS (
+            SELECT 1 FROM schedule busy
+            WHERE NOT busy.archived AND busy.class_room = sc.class_room AND busy.weekday = $1
+            AND busy.start_time < $3::time AND busy.end_time > $2::time
+        )
+        ORDER BY class_room`, weekday, startTime, endTime)
+	return rooms, err
+}
+
+type GradeRepository struct {
+	db *sqlx.DB
+}
+
+func NewGradeRepository(db *sqlx.DB) *GradeRepository {
+	return &GradeRepository{db: db}
+}
+
+func (r *GradeRepository) GetSubjectsByTeacher(teacherID int64) ([]Subject, error) {
+	var subjects []Subject
+	query := `SELECT * FROM subjects WHERE teacher_id = $1 ORDER BY subject_name`
+	err := r.db.Select(&subjects, query, teacherID)
+	return subjects, err
+}
+
+func (r *GradeRepository) GetSubjectsByStudentGroup(groupID int64) ([]Subject, error) {
+	var subjects []Subject
+	query := `
+        SELECT DISTINCT s.subject_id, s.subject_name, s.teacher_id, s.grading_scale
+        FROM subjects s
+        JOIN groups_subjects gs ON s.subject_id = gs.subject_id
+        WHERE gs.group_id = $1
+        ORDER BY s.subject_name`
+	err := r.db.Select(&subjects, query, groupID)
+	return subjects, err
+}
+
+func (r *GradeRepository) GetGradesByStudentAndSubject(studentID, subjectID int64) ([]Grade, error) {
+	var grades []Grade
+	query := `SELECT * FROM grades WHERE student_id = $1 AND subject_id = $2 ORDER BY grade_date DESC`
+	err := r.db.Select(&grades, query, studentID, subjectID)
+	return grades, err
+}
+
+func (r *GradeRepository) GetGroupsBySubjectAndTeacher(subjectID, teacherID int64) ([]Group, error) {
+	var groups []Group
+	query := `
+        SELECT DISTINCT g.group_id, g.group_name
+        FROM groups g
+        JOIN groups_subjects gs ON g.group_id = gs.group_id
+        JOIN subjects s ON gs.subject_id = s.subject_id
+        WHERE s.subject_id = $1 AND s.teacher_id = $2
+        ORDER BY g.group_name`
+	err := r.db.Select(&groups, query, subjectID, teacherID)
+	return groups, err
+}
+
+func (r *GradeRepository) GetStudentsByGroup(groupID int64) ([]User, error) {
+	var students []User
+	query := userColumns + `
+        WHERE group_id = $1 AND role_id = (SELECT role_id FROM roles WHERE role_name = 'student')
+        ORDER BY last_name, first_name`
+	err := r.db.Select(&students, query, groupID)
+	return students, err
+}
+
+func (r *GradeRepository) GetScheduleBySubjectAndGroup(subjectID, groupID int64) ([]Schedule, error) {
+	var schedules []Schedule
+	query := `
+        SELECT * FROM schedule
+        WHERE subject_id = $1 AND group_id = $2 AND NOT archived
+        ORDER BY weekday, start_time`
+	err := r.db.Select(&schedules, query, subjectID, groupID)
+	return schedules, err
+}
+
+func (r *GradeRepository) CreateGrade(tx *sqlx.Tx, studentID, teacherID, subjectID, scheduleID, assessmentTypeID int64, gradeValue int) error {
+	_, err := tx.Exec(`
+        INSERT INTO grades (student_id, teacher_id, subject_id, schedule_id, assessment_type_id, grade_value, grade_date)
+        VALUES ($1, $2, $3, $4, $5, $6, NOW())`,
+		studentID, teacherID, subjectID, scheduleID, assessmentTypeID, gradeValue)
+	return err
+}
+
+func (r *GradeRepository) GetGradesBySubjectAndGroup(subjectID, groupID int64) ([]Grade, error) {
+	var grades []Grade
+	query := `
+        SELECT g.* FROM grades g
+        JOIN users u ON g.student_id = u.user_id
+        WHERE g.subject_id = $1 AND u.group_id = $2
+        ORDER BY g.grade_date DESC`
+	err := r.db.Select(&grades, query, subjectID, groupID)
+	return grades, err
+}
+
+// UpsertGradeForDate stores a grade for a lesson date. A grade of the same
+// student, lesson, date and assessment type is replaced, so importing a
+// journal twice doesn't duplicate grades.
+func (r *GradeRepository) UpsertGradeForDate(tx *sqlx.Tx, grade Grade) error {
+	res, err := tx.Exec(`
+        UPDATE grades SET teacher_id = $2, grade_value = $6, grade_date = $7
+        WHERE student_id = $1 AND schedule_id = $4
+          AND assessment_type_id IS NOT DISTINCT FROM $5
+          AND grade_date::date = $7::date
+          AND subject_id = $3`,
+		grade.StudentID, grade.TeacherID, grade.SubjectID, grade.ScheduleID, grade.AssessmentTypeID, grade.GradeValue, grade.GradeDate)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+
+	_, err = tx.Exec(`
+        INSERT INTO grades (student_id, teacher_id, subject_id, schedule_id, assessment_type_id, grade_value, grade_date)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		grade.StudentID, grade.TeacherID, grade.SubjectID, grade.ScheduleID, grade.AssessmentTypeID, grade.GradeValue, grade.GradeDate)
+	return err
+}
+
+// CreateGrades stores a batch of grades within the caller's transaction, so
+// either all of them are saved or none.
+func (r *GradeRepository) CreateGrades(tx *sqlx.Tx, grades []Grade) error {
+	for _, grade := range grades {
+		_, err := tx.Exec(`
+            INSERT INTO grades (student_id, teacher_id, subject_id, schedule_id, assessment_type_id, grade_value, grade_date)
+            VALUES ($1, $2, $3, $4, $5, $6, NOW())`,
+			grade.StudentID, grade.TeacherID, grade.SubjectID, grade.ScheduleID, grade.AssessmentTypeID, grade.GradeValue)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *GradeRepository) GetGradesByStudent(studentID int64) ([]Grade, error) {
+	var grades []Grade
+	query := `SELECT * FROM grades WHERE student_id = $1 ORDER BY grade_date DESC`
+	err := r.db.Select(&grades, query, studentID)
+	return grades, err
+}
+
+func (r *GradeRepository) GetStudentNameByID(studentID int64) (string, error) {
+	var studentName string
+	err := r.db.Get(&studentName, `SELECT name FROM users WHERE user_id = $1`, studentID)
+	return studentName, err
+}
+
+func (r *GradeRepository) GetSubjectIDByScheduleID(scheduleID int64) (int64, error) {
+	var subjectID int64
+	err := r.db.Get(&subjectID, `SELECT subject_id FROM schedule WHERE schedule_id = $1`, scheduleID)
+	return subjectID, err
+}
+
+// GetStudentProgress summarizes every subject of the student's group in one
+// query: the weighted grade average, the averages of the recentGrades latest
+// grades and of the earlier ones, and attendance.
+func (r *GradeRepository) GetStudentProgress(studentID, groupID int64, recentGrades int) ([]SubjectProgress, error) {
+	var progress []SubjectProgress
+	query := `
+        WITH ranked AS (
+            SELECT g.subject_id, g.grade_value,
+                   GREATEST(COALESCE(saw.weight, at.default_weight, 1), 0) AS weight,
+                   ROW_NUMBER() OVER (PARTITION BY g.subject_id ORDER BY g.grade_date DESC, g.grade_id DESC) AS rn
+            FROM grades g
+            LEFT JOIN assessment_types at ON at.assessment_type_id = g.assessment_type_id
+            LEFT JOIN subject_assessment_weights saw
+                ON saw.subject_id = g.subject_id AND saw.assessment_type_id = g.assessment_type_id
+            WHERE g.student_id = $1
+        ), grade_stats AS (
+            SELECT subject_id,
+                   (SUM(grade_value * weight) / NULLIF(SUM(weight), 0))::float8 AS grade_average,
+                   COUNT(*) AS grade_count,
+                   (AVG(grade_value) FILTER (WHERE rn <= $3))::float8 AS recent_average,
+                   (AVG(grade_value) FILTER (WHERE rn > $3))::float8 AS earlier_average
+            FROM ranked
+            GROUP BY subject_id
+        ), attendance_stats AS (
+            SELECT s.subject_id,
+                   COUNT(*) FILTER (WHERE a.attended) AS attended,
+                   COUNT(*) AS marked
+            FROM attendance a
+            JOIN schedule s ON a.schedule_id = s.schedule_id
+            WHERE a.student_id = $1
+            GROUP BY s.subject_id
+        )
+        SELECT s.subject_id, s.subject_name, s.grading_scale,
+               gs.grade_average, COALESCE(gs.grade_count, 0) AS grade_count,
+               gs.recent_average, gs.earlier_average,
+               COALESCE(ast.attended, 0) AS attended, COALESCE(ast.marked, 0) AS marked
+        FROM subjects s
+        JOIN groups_subjects grs ON grs.subject_id = s.subject_id
+        LEFT JOIN grade_stats gs ON gs.subject_id = s.subject_id
+        LEFT JOIN attendance_stats ast ON ast.subject_id = s.subject_id
+        WHERE grs.group_id = $2
+        ORDER BY s.subject_name`
+	err := r.db.Select(&progress, query, studentID, groupID, recentGrades)
+	return progress, err
+}
+
+// GetGradeDistribution counts the grades of each value given in the group
+// for the subject.
+func (r *GradeRepository) GetGradeDistribution(subjectID, groupID int64) ([]GradeCount, error) {
+	var counts []GradeCount
+	query := `
+        SELECT g.grade_value, COUNT(*) AS count
+        FROM grades g
+        JOIN users u ON g.student_id = u.user_id
+        WHERE g.subject_id = $1 AND u.group_id = $2
+        GROUP BY g.grade_value
+        ORDER BY g.grade_value DESC`
+	err := r.db.Select(&counts, query, subjectID, groupID)
+	return counts, err
+}
+
+// GetStudentsAtRisk returns the students of the group whose grade average is
+// below passValue or whose attendance is below minAttendancePercent, most
+// absent first.
+func (r *GradeRepository) GetStudentsAtRisk(subjectID, groupID int64, passValue int, minAttendancePercent float64) ([]StudentRisk, error) {
+	var students []StudentRisk
+	query := `
+        WITH grade_stats AS (
+            SELECT student_id, AVG(grade_value)::float8 AS grade_average, COUNT(*) AS grade_count
+            FROM grades
+            WHERE subject_id = $1
+            GROUP BY student_id
+        ), attendance_stats AS (
+            SELECT a.student_id,
+                   COUNT(*) FILTER (WHERE NOT a.attended) AS absences,
+                   COUNT(*) AS marked
+            FROM attendance a
+            JOIN schedule s ON a.schedule_id = s.schedule_id
+            WHERE s.subject_id = $1
+            GROUP BY a.student_id
+        )
+        SELECT u.user_id AS student_id, u.name AS student_name,
+               gs.grade_average, COALESCE(gs.grade_count, 0) AS grade_count,
+               COALESCE(ast.absences, 0) AS absences, COALESCE(ast.marked, 0) AS marked
+        FROM users u
+        LEFT JOIN grade_stats gs ON gs.student_id = u.user_id
+        LEFT JOIN attendance_stats ast ON ast.student_id = u.user_id
+        WHERE u.group_id = $2
+          AND u.role_id = (SELECT role_id FROM roles WHERE role_name = 'student')
+          AND (gs.grade_average < $3
+               OR (ast.marked > 0 AND (ast.marked - ast.absences) * 100.0 / ast.marked < $4))
+        ORDER BY COALESCE(ast.absences, 0)::float8 / GREATEST(COALESCE(ast.marked, 0), 1) DESC,
+                 gs.grade_average ASC NULLS LAST,
+                 u.last_name, u.first_name`
+	err := r.db.Select(&students, query, subjectID, groupID, passValue, minAttendancePercent)
+	return students, err
+}
+
+type AttendanceRepository struct {
+	db *sqlx.DB
+}
+
+func NewAttendanceRepository(db *sqlx.DB) *AttendanceRepository {
+	return &AttendanceRepository{db: db}
+}
+
+// MarkAttendance records attendance for today's occurrence of the lesson,
+// overwriting an earlier mark for the same day.
+func (r *AttendanceRepository) MarkAttendance(tx *sqlx.Tx, studentID, scheduleID int64, attended bool, markedBy int64) error {
+	_, err := tx.Exec(`
+        INSERT INTO attendance (student_id, schedule_id, attended, lesson_date, mark_time, marked_by)
+        VALUES ($1, $2, $3, CURRENT_DATE, NOW(), $4)
+        ON CONFLICT (student_id, schedule_id, lesson_date) DO UPDATE
+        SET attended = EXCLUDED.attended, mark_time = EXCLUDED.mark_time,
+            marked_by = EXCLUDED.marked_by, confirmed_by = NULL`,
+		studentID, scheduleID, attended, markedBy)
+	return err
+}
+
+func (r *AttendanceRepository) MarkAttendanceForDate(tx *sqlx.Tx, studentID, scheduleID int64, attended bool, lessonDate time.Time) error {
+	_, err := tx.Exec(`
+        INSERT INTO attendance (student_id, schedule_id, attended, lesson_date, mark_time)
+        VALUES ($1, $2, $3, $4::date, $4::timestamp)
+        ON CONFLICT (student_id, schedule_id, lesson_date) DO UPDATE
+        SET attended = EXCLUDED.attended, mark_time = EXCLUDED.mark_time`,
+		studentID, scheduleID, attended, lessonDate)
+	return err
+}
+
+func (r *AttendanceRepository) GetAttendanceByStudentAndSubject(studentID, subjectID int64) ([]Attendance, error) {
+	var attendance []Attendance
 	query := `
         SELECT a.* FROM attendance a
         JOIN schedule s ON a.schedule_id = s.schedule_id
@@ -429,16 +1557,670 @@ func (r *AttendanceRepository) GetAttendanceByStudentAndSubject(studentID, subje
 	return attendance, err
 }
 
+func (r *AttendanceRepository) GetAttendanceBySubjectAndGroup(subjectID, groupID int64) ([]Attendance, error) {
+	var attendance []Attendance
+	query := `
+        SELECT a.* FROM attendance a
+        JOIN schedule s ON a.schedule_id = s.schedule_id
+        WHERE s.subject_id = $1 AND s.group_id = $2
+        ORDER BY a.mark_time DESC`
+	err := r.db.Select(&attendance, query, subjectID, groupID)
+	return attendance, err
+}
+
+// GetLessonAttendance returns how many students of the group attended each
+// held lesson of the subject, the most recent lessons first.
+func (r *AttendanceRepository) GetLessonAttendance(subjectID, groupID int64, limit int) ([]LessonAttendance, error) {
+	var lessons []LessonAttendance
+	query := `
+        SELECT a.schedule_id, a.lesson_date, s.start_time,
+               COUNT(*) FILTER (WHERE a.attended) AS attended,
+               COUNT(*) AS total
+        FROM attendance a
+        JOIN schedule s ON a.schedule_id = s.schedule_id
+        WHERE s.subject_id = $1 AND s.group_id = $2
+        GROUP BY a.schedule_id, a.lesson_date, s.start_time
+        ORDER BY a.lesson_date DESC, s.start_time DESC
+        LIMIT $3`
+	err := r.db.Select(&lessons, query, subjectID, groupID, limit)
+	return lessons, err
+}
+
 func (r *AttendanceRepository) GetMarkedStudentIDsBySchedule(scheduleID int64) ([]int64, error) {
 	var studentIDs []int64
-	query := `SELECT student_id FROM attendance WHERE schedule_id = $1`
+	query := `SELECT student_id FROM attendance WHERE schedule_id = $1 AND lesson_date = CURRENT_DATE`
+	err := r.db.Select(&studentIDs, query, scheduleID)
+	return studentIDs, err
+}
+
+// GetPresentStudentIDsBySchedule returns the students marked present at
+// today's lesson.
+func (r *AttendanceRepository) GetPresentStudentIDsBySchedule(scheduleID int64) ([]int64, error) {
+	var studentIDs []int64
+	query := `SELECT student_id FROM attendance WHERE schedule_id = $1 AND lesson_date = CURRENT_DATE AND attended`
 	err := r.db.Select(&studentIDs, query, scheduleID)
 	return studentIDs, err
 }
 
 func (r *AttendanceRepository) GetAttendanceRecordsBySchedule(scheduleID int64) ([]Attendance, error) {
 	var records []Attendance
-	query := `SELECT * FROM attendance WHERE schedule_id = $1`
+	query := `SELECT * FROM attendance WHERE schedule_id = $1 AND lesson_date = CURRENT_DATE`
 	err := r.db.Select(&records, query, scheduleID)
 	return records, err
 }
+
+// OpenSubmission returns today's headman submission for the lesson, creating
+// it with every student present. Students who joined the group later are
+// added to an existing draft.
+func (r *AttendanceRepository) OpenSubmission(tx *sqlx.Tx, scheduleID, headmanID int64, studentIDs []int64) (int64, string, error) {
+	var submission struct {
+		SubmissionID int64  `db:"submission_id"`
+		Status       string `db:"status"`
+	}
+	err := tx.Get(&submission, `
+        INSERT INTO attendance_submissions (schedule_id, submitted_by)
+        VALUES ($1, $2)
+        ON CONFLICT (schedule_id, lesson_date) DO UPDATE
+        SET schedule_id = EXCLUDED.schedule_id
+        RETURNING submission_id, status`, scheduleID, headmanID)
+	if err != nil || submission.Status != SubmissionDraft {
+		return submission.SubmissionID, submission.Status, err
+	}
+
+	_, err = tx.Exec(`
+        INSERT INTO attendance_submission_marks (submission_id, student_id)
+        SELECT $1, UNNEST($2::int[])
+        ON CONFLICT (submission_id, student_id) DO NOTHING`,
+		submission.SubmissionID, pq.Array(studentIDs))
+	return submission.SubmissionID, submission.Status, err
+}
+
+const attendanceSubmissionColumns = `
+        SELECT ats.*, sc.subject_id, s.subject_name, sc.group_id, g.group_name,
+               sc.teacher_id, sc.start_time, u.name AS headman_name
+        FROM attendance_submissions ats
+        JOIN schedule sc ON sc.schedule_id = ats.schedule_id
+        JOIN subjects s ON s.subject_id = sc.subject_id
+        JOIN groups g ON g.group_id = sc.group_id
+        JOIN users u ON u.user_id = ats.submitted_by`
+
+func (r *AttendanceRepository) GetSubmission(submissionID int64) (*AttendanceSubmission, error) {
+	submission := new(AttendanceSubmission)
+	err := r.db.Get(submission, attendanceSubmissionColumns+` WHERE ats.submission_id = $1`, submissionID)
+	if err != nil {
+		return nil, err
+	}
+	return submission, nil
+}
+
+// GetPendingSubmissionsByTeacher returns the submissions of the last days
+// that wait for the teacher's review, oldest first.
+func (r *AttendanceRepository) GetPendingSubmissionsByTeacher(teacherID int64, days int) ([]AttendanceSubmission, error) {
+	var submissions []AttendanceSubmission
+	err := r.db.Select(&submissions, attendanceSubmissionColumns+`
+        WHERE sc.teacher_id = $1 AND ats.status = 'pending'
+        AND ats.lesson_date > CURRENT_DATE - $2::int
+        ORDER BY ats.lesson_date, sc.start_time`, teacherID, days)
+	return submissions, err
+}
+
+func (r *AttendanceRepository) GetSubmissionMarks(submissionID int64) ([]AttendanceSubmissionMark, error) {
+	var marks []AttendanceSubmissionMark
+	err := r.db.Select(&marks, `
+        SELECT m.student_id, u.name AS student_name, m.submitted_attended, m.attended
+        FROM attendance_submission_marks m
+        JOIN users u ON u.user_id = m.student_id
+        WHERE m.submission_id = $1
+        ORDER BY u.last_name, u.first_name`, submissionID)
+	return marks, err
+}
+
+// ToggleDraftMark flips a student's mark while the headman is still taking
+// the register. It reports false once the submission has been sent or if the
+// student is not in the lesson's group.
+func (r *AttendanceRepository) ToggleDraftMark(submissionID, studentID int64) (bool, error) {
+	res, err := r.db.Exec(`
+        UPDATE attendance_submission_marks
+        SET submitted_attended = NOT submitted_attended, attended = NOT submitted_attended
+        WHERE submission_id = $1 AND student_id = $2
+        AND EXISTS (
+            SELECT 1 FROM attendance_submissions ats
+            JOIN schedule sc ON sc.schedule_id = ats.schedule_id
+            JOIN users u ON u.user_id = $2 AND u.group_id = sc.group_id
+            WHERE ats.submission_id = $1 AND ats.status = 'draft'
+        )`, submissionID, studentID)
+	if err != nil {
+		return false, err
+	}
+	toggled, err := res.RowsAffected()
+	return toggled > 0, err
+}
+
+// ToggleReviewMark flips a student's mark during the teacher's review. The
+// headman's original mark is kept.
+func (r *AttendanceRepository) ToggleReviewMark(submissionID, studentID int64) (bool, error) {
+	res, err := r.db.Exec(`
+        UPDATE attendance_submission_marks
+        SET attended = NOT attended
+        WHERE submission_id = $1 AND student_id = $2
+        AND EXISTS (
+            SELECT 1 FROM attendance_submissions
+            WHERE submission_id = $1 AND status = 'pending'
+        )`, submissionID, studentID)
+	if err != nil {
+		return false, err
+	}
+	toggled, err := res.RowsAffected()
+	return toggled > 0, err
+}
+
+// SendSubmission hands the draft over to the teacher. It reports false if
+// the submission is not a draft any more.
+func (r *AttendanceRepository) SendSubmission(tx *sqlx.Tx, submissionID int64) (bool, error) {
+	res, err := tx.Exec(`
+        UPDATE attendance_submissions
+        SET status = 'pending', submitted_at = NOW()
+        WHERE submission_id = $1 AND status = 'draft'`, submissionID)
+	if err != nil {
+		return false, err
+	}
+	sent, err := res.RowsAffected()
+	return sent > 0, err
+}
+
+// ConfirmSubmission closes the review and writes the marks to attendance on
+// behalf of the headman, confirmed by the teacher. The status tells whether
+// the teacher changed any mark. It returns an empty status if the submission
+// is not pending.
+func (r *AttendanceRepository) ConfirmSubmission(tx *sqlx.Tx, submissionID, teacherID int64) (string, error) {
+	var status string
+	err := tx.Get(&status, `
+        UPDATE attendance_submissions
+        SET status = CASE
+                WHEN EXISTS (
+                    SELECT 1 FROM attendance_submission_marks
+                    WHERE submission_id = $1 AND attended <> submitted_attended
+                ) THEN 'edited'
+                ELSE 'confirmed'
+            END,
+            reviewed_by = $2, reviewed_at = NOW()
+        WHERE submission_id = $1 AND status = 'pending'
+        RETURNING status`, submissionID, teacherID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec(`
+        INSERT INTO attendance (student_id, schedule_id, attended, lesson_date, mark_time, marked_by, confirmed_by)
+        SELECT m.student_id, ats.schedule_id, m.attended, ats.lesson_date, NOW(), ats.submitted_by, $2
+        FROM attendance_submission_marks m
+        JOIN attendance_submissions ats ON ats.submission_id = m.submission_id
+        WHERE m.submission_id = $1
+        ON CONFLICT (student_id, schedule_id, lesson_date) DO UPDATE
+        SET attended = EXCLUDED.attended, mark_time = EXCLUDED.mark_time,
+            marked_by = EXCLUDED.marked_by, confirmed_by = EXCLUDED.confirmed_by`,
+		submissionID, teacherID)
+	return status, err
+}
+
+// OpenCheckinSession starts today's check-in for the lesson or returns the
+// one already open.
+func (r *AttendanceRepository) OpenCheckinSession(scheduleID, teacherID int64) (int64, error) {
+	var sessionID int64
+	err := r.db.Get(&sessionID, `
+        INSERT INTO checkin_sessions (schedule_id, teacher_id)
+        VALUES ($1, $2)
+        ON CONFLICT (schedule_id, lesson_date) WHERE closed_at IS NULL DO UPDATE
+        SET teacher_id = EXCLUDED.teacher_id
+        RETURNING session_id`, scheduleID, teacherID)
+	return sessionID, err
+}
+
+const checkinSessionColumns = `
+        SELECT cs.*, sc.subject_id, s.subject_name, sc.group_id, g.group_name,
+               sc.start_time, sc.end_time
+        FROM checkin_sessions cs
+        JOIN schedule sc ON sc.schedule_id = cs.schedule_id
+        JOIN subjects s ON s.subject_id = sc.subject_id
+        JOIN groups g ON g.group_id = sc.group_id`
+
+func (r *AttendanceRepository) GetCheckinSession(sessionID int64) (*CheckinSession, error) {
+	session := new(CheckinSession)
+	err := r.db.Get(session, checkinSessionColumns+` WHERE cs.session_id = $1`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// GetOpenCheckinSessionsByGroup returns today's open check-ins for lessons
+// of the group.
+func (r *AttendanceRepository) GetOpenCheckinSessionsByGroup(groupID int64) ([]CheckinSession, error) {
+	var sessions []CheckinSession
+	err := r.db.Select(&sessions, checkinSessionColumns+`
+        WHERE sc.group_id = $1 AND cs.closed_at IS NULL AND cs.lesson_date = CURRENT_DATE
+        ORDER BY sc.start_time`, groupID)
+	return sessions, err
+}
+
+// CloseCheckinSession stops accepting codes. It reports false if the session
+// has already been closed.
+func (r *AttendanceRepository) CloseCheckinSession(tx *sqlx.Tx, sessionID int64) (bool, error) {
+	res, err := tx.Exec(`
+        UPDATE checkin_sessions SET closed_at = NOW()
+        WHERE session_id = $1 AND closed_at IS NULL`, sessionID)
+	if err != nil {
+		return false, err
+	}
+	closed, err := res.RowsAffected()
+	return closed > 0, err
+}
+
+type RegistrationRepository struct {
+	db *sqlx.DB
+}
+
+func NewRegistrationRepository(db *sqlx.DB) *RegistrationRepository {
+	return &RegistrationRepository{db: db}
+}
+
+// CreateRequest files a registration request, replacing the user's earlier
+// pending one.
+func (r *RegistrationRepository) CreateRequest(tx *sqlx.Tx, userMaxID int64, fullName string, groupID int64) (int64, error) {
+	var requestID int64
+	err := tx.Get(&requestID, `
+        INSERT INTO registration_requests (usermax_id, full_name, group_id)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (usermax_id) WHERE status = 'pending' DO UPDATE
+        SET full_name = EXCLUDED.full_name, group_id = EXCLUDED.group_id, created_at = NOW()
+        RETURNING request_id`, userMaxID, fullName, groupID)
+	return requestID, err
+}
+
+const registrationRequestColumns = `
+        SELECT rr.*, g.group_name
+        FROM registration_requests rr
+        JOIN groups g ON g.group_id = rr.group_id`
+
+func (r *RegistrationRepository) GetRequest(requestID int64) (*RegistrationRequest, error) {
+	request := new(RegistrationRequest)
+	err := r.db.Get(request, registrationRequestColumns+` WHERE rr.request_id = $1`, requestID)
+	if err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func (r *RegistrationRepository) GetPendingRequests(limit int) ([]RegistrationRequest, error) {
+	var requests []RegistrationRequest
+	err := r.db.Select(&requests, registrationRequestColumns+`
+        WHERE rr.status = 'pending'
+        ORDER BY rr.created_at
+        LIMIT $1`, limit)
+	return requests, err
+}
+
+// Resolve closes a pending request. It reports false if the request has
+// already been resolved by someone else.
+func (r *RegistrationRepository) Resolve(tx *sqlx.Tx, requestID int64, status string, studentID *int64, resolvedBy int64) (bool, error) {
+	res, err := tx.Exec(`
+        UPDATE registration_requests
+        SET status = $2, student_id = $3, resolved_by = $4, resolved_at = NOW()
+        WHERE request_id = $1 AND status = 'pending'`,
+		requestID, status, studentID, resolvedBy)
+	if err != nil {
+		return false, err
+	}
+	resolved, err := res.RowsAffected()
+	return resolved > 0, err
+}
+
+type ParentRepository struct {
+	db *sqlx.DB
+}
+
+func NewParentRepository(db *sqlx.DB) *ParentRepository {
+	return &ParentRepository{db: db}
+}
+
+func (r *ParentRepository) CreateInvite(code string, studentID, createdBy int64, expiresAt time.Time) error {
+	_, err := r.db.Exec(`
+        INSERT INTO parent_invites (code, student_id, created_by, expires_at)
+        VALUES ($1, $2, $3, $4)`, code, studentID, createdBy, expiresAt)
+	return err
+}
+
+// RedeemInvite marks an unused, unexpired invitation as used by the parent
+// and links the parent to its student. It returns sql.ErrNoRows if the code
+// is unknown, used or expired.
+func (r *ParentRepository) RedeemInvite(tx *sqlx.Tx, code string, parentID int64) (int64, error) {
+	var studentID int64
+	err := tx.Get(&studentID, `
+        UPDATE parent_invites SET used_by = $2, used_at = NOW()
+        WHERE code = $1 AND used_by IS NULL AND expires_at > NOW()
+        RETURNING student_id`, code, parentID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`
+        INSERT INTO parent_students (parent_id, student_id)
+        VALUES ($1, $2)
+        ON CONFLICT DO NOTHING`, parentID, studentID)
+	return studentID, err
+}
+
+const parentChildColumns = `
+        SELECT ps.parent_id, ps.student_id, u.name AS student_name, u.group_id, g.group_name, ps.mirror_notifications
+        FROM parent_students ps
+        JOIN users u ON u.user_id = ps.student_id
+        LEFT JOIN groups g ON g.group_id = u.group_id`
+
+func (r *ParentRepository) GetChildren(parentID int64) ([]ParentChild, error) {
+	var children []ParentChild
+	err := r.db.Select(&children, parentChildColumns+`
+        WHERE ps.parent_id = $1
+        ORDER BY u.name`, parentID)
+	return children, err
+}
+
+// GetChild returns the parent's link to the student, or sql.ErrNoRows if the
+// student is not the parent's child.
+func (r *ParentRepository) GetChild(parentID, studentID int64) (*ParentChild, error) {
+	child := new(ParentChild)
+	err := r.db.Get(child, parentChildColumns+`
+        WHERE ps.parent_id = $1 AND ps.student_id = $2`, parentID, studentID)
+	if err != nil {
+		return nil, err
+	}
+	return child, nil
+}
+
+func (r *ParentRepository) SetMirrorNotifications(parentID, studentID int64, enabled bool) error {
+	_, err := r.db.Exec(`
+        UPDATE parent_students SET mirror_notifications = $3
+        WHERE parent_id = $1 AND student_id = $2`, parentID, studentID, enabled)
+	return err
+}
+
+// GetMirroringParents returns the links of parents who receive copies of the
+// student's notifications.
+func (r *ParentRepository) GetMirroringParents(tx *sqlx.Tx, studentID int64) ([]ParentChild, error) {
+	var parents []ParentChild
+	err := tx.Select(&parents, parentChildColumns+`
+        JOIN users p ON p.user_id = ps.parent_id
+        WHERE ps.student_id = $1 AND ps.mirror_notifications AND p.usermax_id IS NOT NULL`, studentID)
+	return parents, err
+}
+
+func formatClock(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	clock := t.Format("15:04")
+	return &clock
+}
+
+type AlertRepository struct {
+	db *sqlx.DB
+}
+
+func NewAlertRepository(db *sqlx.DB) *AlertRepository {
+	return &AlertRepository{db: db}
+}
+
+// GetAlertTargets returns every student with each subject of their group.
+// A non-zero teacherID limits the result to that teacher's subjects.
+func (r *AlertRepository) GetAlertTargets(teacherID int64) ([]AlertTarget, error) {
+	var targets []AlertTarget
+	query := `
+        SELECT u.user_id AS student_id, gs.subject_id
+        FROM users u
+        JOIN groups_subjects gs ON gs.group_id = u.group_id
+        JOIN subjects s ON s.subject_id = gs.subject_id
+        WHERE u.role_id = (SELECT role_id FROM roles WHERE role_name = 'student')
+          AND ($1 = 0 OR s.teacher_id = $1)
+        ORDER BY gs.subject_id, u.user_id`
+	err := r.db.Select(&targets, query, teacherID)
+	return targets, err
+}
+
+// GetRecentAttendance returns the student's attendance in the subject, the
+// latest lesson first.
+func (r *AlertRepository) GetRecentAttendance(studentID, subjectID int64) ([]bool, error) {
+	var attended []bool
+	query := `
+        SELECT a.attended FROM attendance a
+        JOIN schedule s ON a.schedule_id = s.schedule_id
+        WHERE a.student_id = $1 AND s.subject_id = $2
+        ORDER BY a.lesson_date DESC, s.start_time DESC`
+	err := r.db.Select(&attended, query, studentID, subjectID)
+	return attended, err
+}
+
+// GetRecentGrades returns the student's grade values in the subject, the
+// latest first.
+func (r *AlertRepository) GetRecentGrades(studentID, subjectID int64) ([]int, error) {
+	var grades []int
+	query := `
+        SELECT grade_value FROM grades
+        WHERE student_id = $1 AND subject_id = $2
+        ORDER BY grade_date DESC, grade_id DESC`
+	err := r.db.Select(&grades, query, studentID, subjectID)
+	return grades, err
+}
+
+// OpenAlert records that the student broke the rule in the subject. It
+// reports false when the same alert is still open, so it is not repeated.
+func (r *AlertRepository) OpenAlert(tx *sqlx.Tx, studentID, subjectID int64, rule, details string) (bool, error) {
+	result, err := tx.Exec(`
+        INSERT INTO student_alerts (student_id, subject_id, rule, details)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (student_id, subject_id, rule) WHERE resolved_at IS NULL DO NOTHING`,
+		studentID, subjectID, rule, details)
+	if err != nil {
+		return false, err
+	}
+
+	inserted, err := result.RowsAffected()
+	return inserted > 0, err
+}
+
+// ResolveAlerts closes the student's open alerts in the subject for rules
+// that no longer apply, so they are sent again if the rule is broken later.
+func (r *AlertRepository) ResolveAlerts(tx *sqlx.Tx, studentID, subjectID int64, activeRules []string) error {
+	_, err := tx.Exec(`
+        UPDATE student_alerts SET resolved_at = NOW()
+        WHERE student_id = $1 AND subject_id = $2 AND resolved_at IS NULL
+          AND NOT (rule = ANY($3))`,
+		studentID, subjectID, pq.Array(activeRules))
+	return err
+}
+
+func (r *AlertRepository) GetAlertRecipients(studentID, subjectID int64) (*AlertRecipients, error) {
+	recipients := new(AlertRecipients)
+	err := r.db.Get(recipients, `
+        SELECT u.name AS student_name, u.group_id, COALESCE(g.group_name, '') AS group_name,
+               s.subject_name, s.teacher_id, gc.curator_id
+        FROM users u
+        CROSS JOIN subjects s
+        LEFT JOIN groups g ON g.group_id = u.group_id
+        LEFT JOIN group_curators gc ON gc.group_id = u.group_id
+        WHERE u.user_id = $1 AND s.subject_id = $2`, studentID, subjectID)
+	if err != nil {
+		return nil, err
+	}
+	return recipients, nil
+}
+
+type ReportRepository struct {
+	db *sqlx.DB
+}
+
+func NewReportRepository(db *sqlx.DB) *ReportRepository {
+	return &ReportRepository{db: db}
+}
+
+// GetGroupSubjectStats returns grade averages and attendance for every subject
+// of every group.
+func (r *ReportRepository) GetGroupSubjectStats() ([]GroupSubjectStats, error) {
+	var stats []GroupSubjectStats
+	query := `
+        WITH students AS (
+            SELECT group_id, COUNT(*) AS students
+            FROM users
+            WHERE role_id = (SELECT role_id FROM roles WHERE role_name = 'student')
+            GROUP BY group_id
+        ), grade_stats AS (
+            SELECT u.group_id, g.subject_id,
+                   AVG(g.grade_value)::float8 AS grade_average, COUNT(*) AS grade_count
+            FROM grades g
+            JOIN users u ON g.student_id = u.user_id
+            GROUP BY u.group_id, g.subject_id
+        ), attendance_stats AS (
+            SELECT s.group_id, s.subject_id,
+                   COUNT(*) FILTER (WHERE a.attended) AS attended, COUNT(*) AS marked
+            FROM attendance a
+            JOIN schedule s ON a.schedule_id = s.schedule_id
+            GROUP BY s.group_id, s.subject_id
+        )
+        SELECT g.group_id, g.group_name, s.subject_name, s.grading_scale,
+               COALESCE(st.students, 0) AS students,
+               gs.grade_average, COALESCE(gs.grade_count, 0) AS grade_count,
+               COALESCE(ast.attended, 0) AS attended, COALESCE(ast.marked, 0) AS marked
+        FROM groups_subjects grs
+        JOIN groups g ON g.group_id = grs.group_id
+        JOIN subjects s ON s.subject_id = grs.subject_id
+        LEFT JOIN students st ON st.group_id = grs.group_id
+        LEFT JOIN grade_stats gs ON gs.group_id = grs.group_id AND gs.subject_id = grs.subject_id
+        LEFT JOIN attendance_stats ast ON ast.group_id = grs.group_id AND ast.subject_id = grs.subject_id
+        ORDER BY g.group_name, s.subject_name`
+	err := r.db.Select(&stats, query)
+	return stats, err
+}
+
+// GetUnmarkedLessons returns the lessons of the last days, up to yesterday,
+// that took place by the timetable but have no attendance marks. Holidays
+// are skipped.
+func (r *ReportRepository) GetUnmarkedLessons(days int) ([]UnmarkedLesson, error) {
+	var lessons []UnmarkedLesson
+	query := `
+        SELECT d::date AS lesson_date, s.start_time, sub.subject_name, g.group_name, t.name AS teacher_name
+        FROM generate_series(CURRENT_DATE - $1::int, CURRENT_DATE - 1, INTERVAL '1 day') AS d
+        JOIN schedule s ON s.weekday = EXTRACT(ISODOW FROM d) AND NOT s.archived
+        JOIN subjects sub ON sub.subject_id = s.subject_id
+        JOIN groups g ON g.group_id = s.group_id
+        JOIN users t ON t.user_id = s.teacher_id
+        WHERE NOT EXISTS (SELECT 1 FROM holidays h WHERE h.holiday_date = d::date)
+          AND NOT EXISTS (
+              SELECT 1 FROM attendance a
+              WHERE a.schedule_id = s.schedule_id AND a.lesson_date = d::date
+          )
+        ORDER BY t.name, d, s.start_time`
+	err := r.db.Select(&lessons, query, days)
+	return lessons, err
+}
+
+// GetInactiveStudents returns students who got no grades and attended no
+// lessons in the last days.
+func (r *ReportRepository) GetInactiveStudents(days int) ([]InactiveStudent, error) {
+	var students []InactiveStudent
+	query := `
+        SELECT u.name AS student_name, g.group_name, u.usermax_id IS NOT NULL AS linked
+        FROM users u
+        LEFT JOIN groups g ON g.group_id = u.group_id
+        WHERE u.role_id = (SELECT role_id FROM roles WHERE role_name = 'student')
+          AND NOT EXISTS (
+              SELECT 1 FROM grades gr
+              WHERE gr.student_id = u.user_id AND gr.grade_date >= CURRENT_DATE - $1::int
+          )
+          AND NOT EXISTS (
+              SELECT 1 FROM attendance a
+              WHERE a.student_id = u.user_id AND a.attended AND a.lesson_date >= CURRENT_DATE - $1::int
+          )
+        ORDER BY g.group_name, u.last_name, u.first_name`
+	err := r.db.Select(&students, query, days)
+	return students, err
+}
+
+// GetTeacherLoad returns the weekly number of lessons and hours of
+// every teacher by the current timetable.
+func (r *ReportRepository) GetTeacherLoad() ([]TeacherLoad, error) {
+	var load []TeacherLoad
+	query := `
+        SELECT t.name AS teacher_name,
+               COUNT(*) AS lessons,
+               (SUM(EXTRACT(EPOCH FROM (s.end_time - s.start_time))) / 3600)::float8 AS hours,
+               COUNT(DISTINCT s.group_id) AS groups,
+               COUNT(DISTINCT s.subject_id) AS subjects
+        FROM schedule s
+        JOIN users t ON t.user_id = s.teacher_id
+        WHERE NOT s.archived
+        GROUP BY t.user_id, t.name
+        ORDER BY lessons DESC, t.name`
+	err := r.db.Select(&load, query)
+	return load, err
+}
+
+type CalendarRepository struct {
+	db *sqlx.DB
+}
+
+func NewCalendarRepository(db *sqlx.DB) *CalendarRepository {
+	return &CalendarRepository{db: db}
+}
+
+// EnsureFeedToken returns the user's feed token, saving token as the new one
+// if the user has none yet.
+func (r *CalendarRepository) EnsureFeedToken(userID int64, token string) (string, error) {
+	var current string
+	err := r.db.Get(&current, `
+        INSERT INTO calendar_feeds (user_id, token)
+        VALUES ($1, $2)
+        ON CONFLICT (user_id) DO UPDATE SET token = calendar_feeds.token
+        RETURNING token`, userID, token)
+	return current, err
+}
+
+// ResetFeedToken replaces the user's feed token, so the old link stops
+// working.
+func (r *CalendarRepository) ResetFeedToken(userID int64, token string) error {
+	_, err := r.db.Exec(`
+        INSERT INTO calendar_feeds (user_id, token)
+        VALUES ($1, $2)
+        ON CONFLICT (user_id) DO UPDATE SET token = EXCLUDED.token, created_at = NOW()`,
+		userID, token)
+	return err
+}
+
+// GetOwner returns the calendar owner by the user's Max ID.
+func (r *CalendarRepository) GetOwner(userMaxID int64) (*CalendarOwner, error) {
+	owner := new(CalendarOwner)
+	err := r.db.Get(owner, `
+        SELECT u.user_id, u.name, r.role_name, u.group_id
+        FROM users u
+        JOIN roles r ON r.role_id = u.role_id
+        WHERE u.usermax_id = $1`, userMaxID)
+	if err != nil {
+		return nil, err
+	}
+	return owner, nil
+}
+
+// GetOwnerByToken returns the owner of a feed token or sql.ErrNoRows.
+func (r *CalendarRepository) GetOwnerByToken(token string) (*CalendarOwner, error) {
+	owner := new(CalendarOwner)
+	err := r.db.Get(owner, `
+        SELECT u.user_id, u.name, r.role_name, u.group_id
+        FROM calendar_feeds f
+        JOIN users u ON u.user_id = f.user_id
+        JOIN roles r ON r.role_id = u.role_id
+        WHERE f.token = $1`, token)
+	if err != nil {
+		return nil, err
+	}
+	return owner, nil
+}
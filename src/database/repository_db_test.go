@@ -0,0 +1,130 @@
+package database
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+// openTestDB connects to the database in TEST_DATABASE_URL and applies the
+// schema. The tests skip without it; each works in a transaction that is
+// rolled back, so the database may be reused.
+func openTestDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+
+	uri := os.Getenv("TEST_DATABASE_URL")
+	if uri == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := sqlx.Connect("postgres", uri)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	schema, err := os.ReadFile("../../db/initdb.sql")
+	if err != nil {
+		t.Fatalf("read schema: %v", err)
+	}
+	if _, err := db.Exec(string(schema)); err != nil {
+		t.Fatalf("apply schema: %v", err)
+	}
+	return db
+}
+
+func beginTestTx(t *testing.T, db *sqlx.DB) *sqlx.Tx {
+	t.Helper()
+
+	tx, err := db.Beginx()
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	t.Cleanup(func() { tx.Rollback() })
+	return tx
+}
+
+type testLesson struct {
+	groupID    int64
+	teacherID  int64
+	subjectID  int64
+	scheduleID int64
+	studentID  int64
+}
+
+// createTestLesson adds a group with one student and a lesson of a new
+// subject for it.
+func createTestLesson(t *testing.T, db *sqlx.DB, tx *sqlx.Tx) testLesson {
+	t.Helper()
+
+	roles := NewRoleRepository(db)
+	teacherRoleID, err := roles.GetRoleIDByName(tx, "teacher")
+	if err != nil {
+		t.Fatalf("teacher role: %v", err)
+	}
+	studentRoleID, err := roles.GetRoleIDByName(tx, "student")
+	if err != nil {
+		t.Fatalf("student role: %v", err)
+	}
+
+	var l testLesson
+	if l.groupID, err = NewGroupRepository(db).CreateOrGetGroup(tx, "TEST-"+t.Name()); err != nil {
+		t.Fatalf("group: %v", err)
+	}
+	users := NewUserRepository(db)
+	if l.teacherID, err = users.CreateOrGetTeacher(tx, "Тест", t.Name(), teacherRoleID); err != nil {
+		t.Fatalf("teacher: %v", err)
+	}
+	if l.studentID, err = users.CreateOrGetUnclaimedStudent(tx, "Студент", t.Name(), studentRoleID, l.groupID); err != nil {
+		t.Fatalf("student: %v", err)
+	}
+	if l.subjectID, err = NewSubjectRepository(db).CreateOrGetSubject(tx, "Предмет "+t.Name(), l.teacherID); err != nil {
+		t.Fatalf("subject: %v", err)
+	}
+	lessonTypeID, err := NewLessonTypeRepository(db).CreateOrGetLessonType(tx, "Лекция")
+	if err != nil {
+		t.Fatalf("lesson type: %v", err)
+	}
+
+	err = NewScheduleRepository(db).CreateSchedule(tx, 1, "09:00", "10:30", "А-101", l.subjectID, l.teacherID, l.groupID, lessonTypeID)
+	if err != nil {
+		t.Fatalf("schedule: %v", err)
+	}
+	if err := tx.Get(&l.scheduleID, `SELECT schedule_id FROM schedule WHERE group_id = $1`, l.groupID); err != nil {
+		t.Fatalf("schedule id: %v", err)
+	}
+	return l
+}
+
+func TestMarkAttendanceForDateUpserts(t *testing.T) {
+	db := openTestDB(t)
+	tx := beginTestTx(t, db)
+	l := createTestLesson(t, db, tx)
+	repo := NewAttendanceRepository(db)
+
+	date := time.Date(2025, time.March, 3, 0, 0, 0, 0, time.UTC)
+	if err := repo.MarkAttendanceForDate(tx, l.studentID, l.scheduleID, true, date); err != nil {
+		t.Fatalf("first mark: %v", err)
+	}
+	if err := repo.MarkAttendanceForDate(tx, l.studentID, l.scheduleID, false, date); err != nil {
+		t.Fatalf("second mark: %v", err)
+	}
+
+	var records []Attendance
+	err := tx.Select(&records, `SELECT * FROM attendance WHERE student_id = $1 AND schedule_id = $2`, l.studentID, l.scheduleID)
+	if err != nil {
+		t.Fatalf("select: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	if records[0].Attended {
+		t.Errorf("attended = true, want the second mark")
+	}
+	if got := records[0].LessonDate.Format("2006-01-02"); got != "2025-03-03" {
+		t.Errorf("lesson_date = %s, want 2025-03-03", got)
+	}
+}
@@ -0,0 +1,84 @@
+package grading
+
+import "fmt"
+
+type RatingRules struct {
+	GradeWeight           float64
+	AttendanceWeight      float64
+	MinAttendancePercent  float64
+	MinRatingForAdmission float64
+}
+
+func DefaultRatingRules() RatingRules {
+	return RatingRules{
+		GradeWeight:           0.7,
+		AttendanceWeight:      0.3,
+		MinAttendancePercent:  80,
+		MinRatingForAdmission: 0,
+	}
+}
+
+type RatingInput struct {
+	Grades          []WeightedValue
+	AttendedLessons int
+	TotalLessons    int
+}
+
+type Rating struct {
+	Rated             bool
+	Score             float64
+	HasGrades         bool
+	GradeAverage      float64
+	HasAttendance     bool
+	AttendancePercent float64
+	ProjectedMark     int
+	Admitted          bool
+	Reasons           []string
+}
+
+// CalculateRating combines the weighted grade average and the attendance
+// percentage into a 0..100 score and derives the projected final mark and the
+// exam admission status. Components without data are left out of the score;
+// when none is left the rating is not Rated and carries neither a projected
+// mark nor an admission verdict.
+func CalculateRating(scale Scale, rules RatingRules, input RatingInput) Rating {
+	var rating Rating
+
+	var score, totalWeight float64
+
+	if avg, ok := WeightedAverage(input.Grades); ok {
+		rating.HasGrades = true
+		rating.GradeAverage = avg
+		score += rules.GradeWeight * scale.Normalize(avg) * 100
+		totalWeight += rules.GradeWeight
+	}
+
+	if input.TotalLessons > 0 {
+		rating.HasAttendance = true
+		rating.AttendancePercent = float64(input.AttendedLessons) * 100 / float64(input.TotalLessons)
+		score += rules.AttendanceWeight * rating.AttendancePercent
+		totalWeight += rules.AttendanceWeight
+	}
+
+	if totalWeight <= 0 {
+		return rating
+	}
+
+	rating.Rated = true
+	rating.Score = score / totalWeight
+	rating.ProjectedMark = scale.Round(scale.Denormalize(rating.Score / 100))
+
+	if rating.HasAttendance && rating.AttendancePercent < rules.MinAttendancePercent {
+		rating.Reasons = append(rating.Reasons,
+			fmt.Sprintf("посещаемость %.0f%% ниже требуемых %.0f%%", rating.AttendancePercent, rules.MinAttendancePercent))
+	}
+
+	if rating.Score < rules.MinRatingForAdmission {
+		rating.Reasons = append(rating.Reasons,
+			fmt.Sprintf("рейтинг %.1f ниже требуемого %.1f", rating.Score, rules.MinRatingForAdmission))
+	}
+
+	rating.Admitted = len(rating.Reasons) == 0
+
+	return rating
+}
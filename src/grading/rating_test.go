@@ -0,0 +1,155 @@
+package grading
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCalculateRating(t *testing.T) {
+	fivePoint := GetScale(ScaleFivePoint)
+	rules := DefaultRatingRules()
+
+	tests := []struct {
+		name         string
+		rules        RatingRules
+		input        RatingInput
+		wantRated    bool
+		wantScore    float64
+		wantMark     int
+		wantAdmitted bool
+		wantReasons  int
+	}{
+		{
+			name:      "no data",
+			rules:     rules,
+			input:     RatingInput{},
+			wantRated: false,
+		},
+		{
+			name:      "grades with zero weights only",
+			rules:     rules,
+			input:     RatingInput{Grades: []WeightedValue{{Value: 5, Weight: 0}}},
+			wantRated: false,
+		},
+		{
+			name:         "grades only",
+			rules:        rules,
+			input:        RatingInput{Grades: []WeightedValue{{Value: 5, Weight: 1}, {Value: 4, Weight: 1}}},
+			wantRated:    true,
+			wantScore:    90,
+			wantMark:     5,
+			wantAdmitted: true,
+		},
+		{
+			name:         "attendance only below minimum",
+			rules:        rules,
+			input:        RatingInput{AttendedLessons: 1, TotalLessons: 2},
+			wantRated:    true,
+			wantScore:    50,
+			wantMark:     3,
+			wantAdmitted: false,
+			wantReasons:  1,
+		},
+		{
+			name:  "grades and attendance",
+			rules: rules,
+			input: RatingInput{
+				Grades:          []WeightedValue{{Value: 5, Weight: 1}},
+				AttendedLessons: 4,
+				TotalLessons:    5,
+			},
+			wantRated:    true,
+			wantScore:    0.7*100 + 0.3*80,
+			wantMark:     5,
+			wantAdmitted: true,
+		},
+		{
+			name:  "rating below admission threshold",
+			rules: RatingRules{GradeWeight: 1, MinRatingForAdmission: 60},
+			input: RatingInput{
+				Grades: []WeightedValue{{Value: 2, Weight: 1}},
+			},
+			wantRated:    true,
+			wantScore:    40,
+			wantMark:     2,
+			wantAdmitted: false,
+			wantReasons:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rating := CalculateRating(fivePoint, tt.rules, tt.input)
+			if rating.Rated != tt.wantRated {
+				t.Fatalf("Rated = %v, want %v", rating.Rated, tt.wantRated)
+			}
+			if !tt.wantRated {
+				if rating.Admitted || rating.ProjectedMark != 0 || rating.Score != 0 {
+					t.Errorf("unrated rating has a verdict: %+v", rating)
+				}
+				return
+			}
+			if math.Abs(rating.Score-tt.wantScore) > 1e-9 {
+				t.Errorf("Score = %v, want %v", rating.Score, tt.wantScore)
+			}
+			if rating.ProjectedMark != tt.wantMark {
+				t.Errorf("ProjectedMark = %d, want %d", rating.ProjectedMark, tt.wantMark)
+			}
+			if rating.Admitted != tt.wantAdmitted {
+				t.Errorf("Admitted = %v, want %v", rating.Admitted, tt.wantAdmitted)
+			}
+			if len(rating.Reasons) != tt.wantReasons {
+				t.Errorf("Reasons = %q, want %d", rating.Reasons, tt.wantReasons)
+			}
+		})
+	}
+}
+
+func TestWeightedAverage(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []WeightedValue
+		want   float64
+		wantOK bool
+	}{
+		{name: "empty"},
+		{name: "zero weights", values: []WeightedValue{{Value: 5, Weight: 0}}},
+		{name: "equal weights", values: []WeightedValue{{Value: 5, Weight: 1}, {Value: 3, Weight: 1}}, want: 4, wantOK: true},
+		{name: "exam weighs more", values: []WeightedValue{{Value: 5, Weight: 1}, {Value: 2, Weight: 2}}, want: 3, wantOK: true},
+		{name: "negative weight ignored", values: []WeightedValue{{Value: 4, Weight: 1}, {Value: 1, Weight: -1}}, want: 4, wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := WeightedAverage(tt.values)
+			if ok != tt.wantOK || math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("WeightedAverage() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestScale(t *testing.T) {
+	letter := GetScale(ScaleLetter)
+	if v, ok := letter.ParseValue("B"); !ok || v != 5 {
+		t.Errorf(`ParseValue("B") = %d, %v, want 5, true`, v, ok)
+	}
+	if _, ok := letter.ParseValue("7"); ok {
+		t.Error(`ParseValue("7") accepted a value above the scale`)
+	}
+	if _, ok := GetScale(ScaleFivePoint).ParseValue("04"); ok {
+		t.Error(`ParseValue("04") accepted a non-canonical number`)
+	}
+
+	hundred := GetScale(ScaleHundredPoint)
+	if got := hundred.Round(hundred.Denormalize(hundred.Normalize(73))); got != 73 {
+		t.Errorf("Normalize/Denormalize round trip = %d, want 73", got)
+	}
+	if got := hundred.Round(120); got != 100 {
+		t.Errorf("Round(120) = %d, want 100", got)
+	}
+
+	if got := GetScale("unknown").Name; got != DefaultScale {
+		t.Errorf("GetScale(unknown) = %s, want %s", got, DefaultScale)
+	}
+}
@@ -0,0 +1,153 @@
+package grading
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	ScaleFivePoint    = "five_point"
+	ScaleHundredPoint = "hundred_point"
+	ScalePassFail     = "pass_fail"
+	ScaleLetter       = "letter"
+
+	DefaultScale = ScaleFivePoint
+)
+
+type Scale struct {
+	Name      string
+	Title     string
+	Min       int
+	Max       int
+	Step      int
+	PassValue int
+	labels    map[int]string
+}
+
+var scales = map[string]Scale{
+	ScaleFivePoint: {
+		Name:      ScaleFivePoint,
+		Title:     "Пятибалльная",
+		Min:       0,
+		Max:       5,
+		Step:      1,
+		PassValue: 3,
+	},
+	ScaleHundredPoint: {
+		Name:      ScaleHundredPoint,
+		Title:     "Стобалльная",
+		Min:       0,
+		Max:       100,
+		Step:      5,
+		PassValue: 60,
+	},
+	ScalePassFail: {
+		Name:      ScalePassFail,
+		Title:     "Зачёт/незачёт",
+		Min:       0,
+		Max:       1,
+		Step:      1,
+		PassValue: 1,
+		labels:    map[int]string{0: "незачёт", 1: "зачёт"},
+	},
+	ScaleLetter: {
+		Name:      ScaleLetter,
+		Title:     "Буквенная (ECTS)",
+		Min:       0,
+		Max:       6,
+		Step:      1,
+		PassValue: 2,
+		labels:    map[int]string{0: "F", 1: "FX", 2: "E", 3: "D", 4: "C", 5: "B", 6: "A"},
+	},
+}
+
+func IsKnownScale(name string) bool {
+	_, ok := scales[name]
+	return ok
+}
+
+// GetScale returns the scale registered under name, falling back to the
+// five-point scale for unknown or empty names.
+func GetScale(name string) Scale {
+	if scale, ok := scales[name]; ok {
+		return scale
+	}
+	return scales[DefaultScale]
+}
+
+func (s Scale) Values() []int {
+	values := make([]int, 0, (s.Max-s.Min)/s.Step+1)
+	for v := s.Min; v <= s.Max; v += s.Step {
+		values = append(values, v)
+	}
+	return values
+}
+
+// Contains reports whether v can be stored as a grade on this scale. Values
+// between the keyboard steps are allowed so that imported journals keep
+// their precision.
+func (s Scale) Contains(v int) bool {
+	return v >= s.Min && v <= s.Max
+}
+
+func (s Scale) Label(v int) string {
+	if label, ok := s.labels[v]; ok {
+		return label
+	}
+	return fmt.Sprintf("%d", v)
+}
+
+// ParseValue accepts either a numeric value or one of the scale labels
+// (e.g. "зачёт" or "B").
+func (s Scale) ParseValue(text string) (int, bool) {
+	for v, label := range s.labels {
+		if label == text {
+			return v, true
+		}
+	}
+
+	var v int
+	if _, err := fmt.Sscanf(text, "%d", &v); err != nil || fmt.Sprintf("%d", v) != text {
+		return 0, false
+	}
+	return v, s.Contains(v)
+}
+
+func (s Scale) IsPassing(v int) bool {
+	return v >= s.PassValue
+}
+
+// Normalize maps a value on the scale to the 0..1 range.
+func (s Scale) Normalize(v float64) float64 {
+	if s.Max == s.Min {
+		return 0
+	}
+	return (v - float64(s.Min)) / float64(s.Max-s.Min)
+}
+
+// Denormalize maps a 0..1 value back onto the scale.
+func (s Scale) Denormalize(n float64) float64 {
+	return float64(s.Min) + n*float64(s.Max-s.Min)
+}
+
+func (s Scale) Round(v float64) int {
+	rounded := int(math.Round(v))
+	if rounded < s.Min {
+		return s.Min
+	}
+	if rounded > s.Max {
+		return s.Max
+	}
+	return rounded
+}
+
+func (s Scale) FormatAverage(avg float64) string {
+	if len(s.labels) == 0 {
+		return fmt.Sprintf("%.2f", avg)
+	}
+	return fmt.Sprintf("%.2f (%s)", avg, s.Label(s.Round(avg)))
+}
+
+func ScaleNames() []string {
+	return []string{ScaleFivePoint, ScaleHundredPoint, ScalePassFail, ScaleLetter}
+}
@@ -0,0 +1,24 @@
+package grading
+
+type WeightedValue struct {
+	Value  int
+	Weight float64
+}
+
+// WeightedAverage returns the weighted mean of values. The second result is
+// false when there is nothing to average (no values or all weights are zero).
+func WeightedAverage(values []WeightedValue) (float64, bool) {
+	var sum, totalWeight float64
+	for _, v := range values {
+		if v.Weight <= 0 {
+			continue
+		}
+		sum += float64(v.Value) * v.Weight
+		totalWeight += v.Weight
+	}
+
+	if totalWeight == 0 {
+		return 0, false
+	}
+	return sum / totalWeight, true
+}
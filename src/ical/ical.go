@@ -0,0 +1,201 @@
+// Package ical writes iCalendar (RFC 5545) files with weekly recurring
+// events, enough for calendar apps to import or subscribe to a timetable.
+package ical
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	localFormat = "20060102T150405"
+	utcFormat   = "20060102T150405Z"
+	// maxLineOctets is the longest content line allowed before folding.
+	maxLineOctets = 75
+	// timezoneYears is how far past the first event the offset changes of
+	// the time zone are written out.
+	timezoneYears = 10
+)
+
+// Calendar is a named set of events. Event times are written as local times
+// of Location, identified by its IANA name and described by a VTIMEZONE; a
+// location without one, such as a fixed offset, is written in UTC.
+type Calendar struct {
+	Name     string
+	Location *time.Location
+	Events   []Event
+}
+
+// Event is a lesson. A weekly event repeats every week from Start, except on
+// the ExDates, which are the start times of the skipped occurrences.
+type Event struct {
+	UID         string
+	Summary     string
+	Location    string
+	Description string
+	Start       time.Time
+	End         time.Time
+	Weekly      bool
+	ExDates     []time.Time
+}
+
+// Write encodes the calendar.
+func Write(w io.Writer, cal Calendar) error {
+	loc := cal.Location
+	if loc == nil || loc == time.Local {
+		loc = time.UTC
+	} else if _, err := time.LoadLocation(loc.String()); err != nil {
+		loc = time.UTC
+	}
+
+	cw := &contentWriter{w: w}
+	cw.line("BEGIN:VCALENDAR")
+	cw.line("VERSION:2.0")
+	cw.line("PRODID:-//digitalUniversity//Schedule//RU")
+	cw.line("CALSCALE:GREGORIAN")
+	cw.line("METHOD:PUBLISH")
+	cw.line("X-WR-CALNAME:" + escape(cal.Name))
+	cw.line("X-WR-TIMEZONE:" + loc.String())
+	if loc != time.UTC {
+		writeTimezone(cw, loc, firstStart(cal.Events))
+	}
+
+	stamp := time.Now().UTC().Format(utcFormat)
+	for _, e := range cal.Events {
+		cw.line("BEGIN:VEVENT")
+		cw.line("UID:" + escape(e.UID))
+		cw.line("DTSTAMP:" + stamp)
+		cw.line(dateTime("DTSTART", e.Start, loc))
+		cw.line(dateTime("DTEND", e.End, loc))
+		if e.Weekly {
+			cw.line("RRULE:FREQ=WEEKLY")
+		}
+		for _, ex := range e.ExDates {
+			cw.line(dateTime("EXDATE", ex, loc))
+		}
+		cw.line("SUMMARY:" + escape(e.Summary))
+		if e.Location != "" {
+			cw.line("LOCATION:" + escape(e.Location))
+		}
+		if e.Description != "" {
+			cw.line("DESCRIPTION:" + escape(e.Description))
+		}
+		cw.line("END:VEVENT")
+	}
+	cw.line("END:VCALENDAR")
+
+	return cw.err
+}
+
+// Bytes returns the calendar as a byte slice.
+func Bytes(cal Calendar) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := Write(&buf, cal); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeTimezone describes loc from the offset in effect at from through its
+// changes over the following timezoneYears, so apps need no zone database.
+func writeTimezone(cw *contentWriter, loc *time.Location, from time.Time) {
+	t := from.In(loc)
+	name, offset := t.Zone()
+
+	cw.line("BEGIN:VTIMEZONE")
+	cw.line("TZID:" + loc.String())
+	writeObservance(cw, t.IsDST(), "19700101T000000", name, offset, offset)
+
+	limit := t.AddDate(timezoneYears, 0, 0)
+	for {
+		_, end := t.ZoneBounds()
+		if end.IsZero() || end.After(limit) {
+			break
+		}
+		t = end
+		start := t.UTC().Add(time.Duration(offset) * time.Second).Format(localFormat)
+		nextName, nextOffset := t.Zone()
+		writeObservance(cw, t.IsDST(), start, nextName, offset, nextOffset)
+		offset = nextOffset
+	}
+	cw.line("END:VTIMEZONE")
+}
+
+func writeObservance(cw *contentWriter, dst bool, start, name string, offsetFrom, offsetTo int) {
+	kind := "STANDARD"
+	if dst {
+		kind = "DAYLIGHT"
+	}
+	cw.line("BEGIN:" + kind)
+	cw.line("DTSTART:" + start)
+	cw.line("TZOFFSETFROM:" + utcOffset(offsetFrom))
+	cw.line("TZOFFSETTO:" + utcOffset(offsetTo))
+	cw.line("TZNAME:" + escape(name))
+	cw.line("END:" + kind)
+}
+
+// utcOffset formats an offset in seconds east of UTC as ±HHMM.
+func utcOffset(seconds int) string {
+	sign := '+'
+	if seconds < 0 {
+		sign, seconds = '-', -seconds
+	}
+	return fmt.Sprintf("%c%02d%02d", sign, seconds/3600, seconds/60%60)
+}
+
+// firstStart returns the earliest event start, or now without events.
+func firstStart(events []Event) time.Time {
+	if len(events) == 0 {
+		return time.Now()
+	}
+	first := events[0].Start
+	for _, e := range events[1:] {
+		if e.Start.Before(first) {
+			first = e.Start
+		}
+	}
+	return first
+}
+
+func dateTime(name string, t time.Time, loc *time.Location) string {
+	if loc == time.UTC {
+		return name + ":" + t.UTC().Format(utcFormat)
+	}
+	return fmt.Sprintf("%s;TZID=%s:%s", name, loc.String(), t.In(loc).Format(localFormat))
+}
+
+// escape quotes the characters that have a meaning in text values.
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// contentWriter writes CRLF-terminated lines, folding the long ones without
+// splitting UTF-8 characters, and keeps the first error.
+type contentWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (cw *contentWriter) line(s string) {
+	if cw.err != nil {
+		return
+	}
+
+	var sb strings.Builder
+	octets := 0
+	for _, r := range s {
+		size := len(string(r))
+		if octets+size > maxLineOctets {
+			sb.WriteString("\r\n ")
+			octets = 1
+		}
+		sb.WriteRune(r)
+		octets += size
+	}
+	sb.WriteString("\r\n")
+
+	_, cw.err = io.WriteString(cw.w, sb.String())
+}
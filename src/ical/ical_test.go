@@ -0,0 +1,136 @@
+package ical
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+var dtstamp = regexp.MustCompile(`DTSTAMP:\d{8}T\d{6}Z`)
+
+func testCalendar(t *testing.T, loc *time.Location) Calendar {
+	t.Helper()
+
+	start := time.Date(2025, time.September, 1, 9, 0, 0, 0, loc)
+	return Calendar{
+		Name:     "Расписание группы ИВТ-21",
+		Location: loc,
+		Events: []Event{
+			{
+				UID:         "lesson-1@digitalUniversity",
+				Summary:     "Математический анализ (Лекция)",
+				Location:    "ауд. 101; корпус А, 2 этаж",
+				Description: "Преподаватель: Иванов И. И.\nГруппа: ИВТ-21\nПодготовьте конспект предыдущей лекции и вопросы по домашнему заданию",
+				Start:       start,
+				End:         start.Add(90 * time.Minute),
+				Weekly:      true,
+				ExDates:     []time.Time{start.AddDate(0, 0, 56)},
+			},
+			{
+				UID:     "lesson-2@digitalUniversity",
+				Summary: `Физика\Лабораторная`,
+				Start:   start.AddDate(0, 0, 2).Add(100 * time.Minute),
+				End:     start.AddDate(0, 0, 2).Add(190 * time.Minute),
+			},
+		},
+	}
+}
+
+func TestWriteGolden(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Skipf("time zone database: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		loc  *time.Location
+	}{
+		{name: "utc", loc: time.UTC},
+		{name: "fixed_offset", loc: time.FixedZone("UTC+3", 3*60*60)},
+		{name: "moscow", loc: moscow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := Bytes(testCalendar(t, tt.loc))
+			if err != nil {
+				t.Fatalf("Bytes: %v", err)
+			}
+			got := dtstamp.ReplaceAllString(string(data), "DTSTAMP:20250101T000000Z")
+
+			golden := filepath.Join("testdata", tt.name+".ics")
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("output differs from %s:\n%s", golden, got)
+			}
+		})
+	}
+}
+
+func TestWriteFoldsLongLines(t *testing.T) {
+	data, err := Bytes(testCalendar(t, time.UTC))
+	if err != nil {
+		t.Fatalf("Bytes: %v", err)
+	}
+
+	text := string(data)
+	if !strings.HasSuffix(text, "\r\n") {
+		t.Error("output does not end with CRLF")
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\r\n"), "\r\n") {
+		if len(line) > maxLineOctets {
+			t.Errorf("line of %d octets: %q", len(line), line)
+		}
+		if strings.Contains(line, "\n") {
+			t.Errorf("bare LF in line %q", line)
+		}
+	}
+
+	unfolded := strings.ReplaceAll(text, "\r\n ", "")
+	want := `DESCRIPTION:Преподаватель: Иванов И. И.\nГруппа: ИВТ-21\nПодготовьте конспект предыдущей лекции и вопросы по домашнему заданию`
+	if !strings.Contains(unfolded, want+"\r\n") {
+		t.Errorf("unfolded output lacks %q", want)
+	}
+}
+
+func TestWriteTimezoneTransitions(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone database: %v", err)
+	}
+
+	start := time.Date(2025, time.March, 3, 9, 0, 0, 0, berlin)
+	data, err := Bytes(Calendar{Name: "Test", Location: berlin, Events: []Event{
+		{UID: "1", Summary: "Lesson", Start: start, End: start.Add(time.Hour), Weekly: true},
+	}})
+	if err != nil {
+		t.Fatalf("Bytes: %v", err)
+	}
+	text := string(data)
+
+	for _, want := range []string{
+		"TZID:Europe/Berlin\r\nBEGIN:STANDARD\r\nDTSTART:19700101T000000\r\nTZOFFSETFROM:+0100\r\nTZOFFSETTO:+0100\r\nTZNAME:CET\r\n",
+		"BEGIN:DAYLIGHT\r\nDTSTART:20250330T020000\r\nTZOFFSETFROM:+0100\r\nTZOFFSETTO:+0200\r\nTZNAME:CEST\r\n",
+		"BEGIN:STANDARD\r\nDTSTART:20251026T030000\r\nTZOFFSETFROM:+0200\r\nTZOFFSETTO:+0100\r\nTZNAME:CET\r\n",
+		"DTSTART;TZID=Europe/Berlin:20250303T090000\r\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("output lacks %q", want)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package maxAPI
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"digitalUniversity/config"
+	"digitalUniversity/database"
+	"digitalUniversity/grading"
+)
+
+const (
+	alertConsecutiveAbsences = "consecutive_absences"
+	alertLowAttendance       = "low_attendance"
+	alertFailingGrades       = "failing_grades"
+
+	alertStaffMsg   = "⚠️ **Студент в зоне риска**\n%s, группа %s\nПредмет: %s\n\n%s"
+	alertStudentMsg = "⚠️ **Обратите внимание**\nПредмет: %s\n\n%s"
+
+	alertConsecutiveAbsencesText = "Пропущено занятий подряд: **%d**"
+	alertLowAttendanceText       = "Посещаемость **%.0f%%** ниже %.0f%%"
+	alertFailingGradesText       = "Неудовлетворительных оценок подряд: **%d**"
+
+	btnAlertAnalytics = "📈 Аналитика группы"
+
+	alertsClockFormat = "15:04"
+)
+
+// alertRules are the early-warning thresholds. A zero threshold turns its
+// rule off.
+type alertRules struct {
+	consecutiveAbsences  int
+	minAttendancePercent float64
+	minMarkedLessons     int
+	failingGradesInRow   int
+	notifyStudent        bool
+	nightlyTime          string
+}
+
+type studentAlert struct {
+	rule    string
+	details string
+}
+
+// ConfigureAlerts sets the early-warning thresholds and the time of the
+// nightly check of all students. It must be called before StartScheduler.
+func (b *Bot) ConfigureAlerts(cfg *config.AlertsConfig) {
+	b.alertRules = alertRules{
+		consecutiveAbsences:  cfg.ConsecutiveAbsences,
+		minAttendancePercent: cfg.MinAttendancePercent,
+		minMarkedLessons:     max(cfg.MinMarkedLessons, 1),
+		failingGradesInRow:   cfg.FailingGradesInRow,
+		notifyStudent:        cfg.NotifyStudent,
+	}
+
+	nightly, err := time.Parse(alertsClockFormat, cfg.NightlyTime)
+	if err != nil {
+		b.logger.Warnf("Invalid ALERTS_NIGHTLY_TIME %q, nightly alert check is disabled: %v", cfg.NightlyTime, err)
+		return
+	}
+	b.alertRules.nightlyTime = nightly.Format(schedulerClockFormat)
+}
+
+// evaluate returns the rules the student breaks given their attendance and
+// grades in a subject, both ordered from the latest.
+func (r alertRules) evaluate(attendance []bool, grades []int, scale grading.Scale) []studentAlert {
+	var alerts []studentAlert
+
+	absences := 0
+	for absences < len(attendance) && !attendance[absences] {
+		absences++
+	}
+	if r.consecutiveAbsences > 0 && absences >= r.consecutiveAbsences {
+		alerts = append(alerts, studentAlert{alertConsecutiveAbsences, fmt.Sprintf(alertConsecutiveAbsencesText, absences)})
+	}
+
+	if r.minAttendancePercent > 0 && len(attendance) >= r.minMarkedLessons {
+		attended := 0
+		for _, a := range attendance {
+			if a {
+				attended++
+			}
+		}
+		percent := float64(attended) * 100 / float64(len(attendance))
+		if percent < r.minAttendancePercent {
+			alerts = append(alerts, studentAlert{alertLowAttendance, fmt.Sprintf(alertLowAttendanceText, percent, r.minAttendancePercent)})
+		}
+	}
+
+	failing := 0
+	for failing < len(grades) && !scale.IsPassing(grades[failing]) {
+		failing++
+	}
+	if r.failingGradesInRow > 0 && failing >= r.failingGradesInRow {
+		alerts = append(alerts, studentAlert{alertFailingGrades, fmt.Sprintf(alertFailingGradesText, failing)})
+	}
+
+	return alerts
+}
+
+// checkAlerts evaluates the early-warning rules for the students after their
+// marks in the subject changed. Errors are logged: the marks are already
+// saved and the nightly check will retry.
+func (b *Bot) checkAlerts(subjectID int64, studentIDs ...int64) {
+	for _, studentID := range studentIDs {
+		if err := b.evaluateStudentAlerts(studentID, subjectID); err != nil {
+			b.logger.Errorf("Failed to evaluate alerts for student %d in subject %d: %v", studentID, subjectID, err)
+		}
+	}
+}
+
+// checkTeacherAlerts evaluates the rules for every student of the teacher's
+// subjects, e.g. after a journal import. A zero teacherID checks everyone.
+func (b *Bot) checkTeacherAlerts(teacherID int64) {
+	targets, err := b.alertRepo.GetAlertTargets(teacherID)
+	if err != nil {
+		b.logger.Errorf("Failed to get students for alert check: %v", err)
+		return
+	}
+
+	for _, target := range targets {
+		b.checkAlerts(target.SubjectID, target.StudentID)
+	}
+	b.logger.Infof("Checked alerts for %d student subjects", len(targets))
+}
+
+// runNightlyAlerts checks every student once a day, catching changes made
+// outside the bot and rules that depend on time passing.
+func (b *Bot) runNightlyAlerts(from, to string) {
+	if b.alertRules.nightlyTime == "" || b.alertRules.nightlyTime < from || b.alertRules.nightlyTime >= to {
+		return
+	}
+	go b.checkTeacherAlerts(0)
+}
+
+// evaluateStudentAlerts opens alerts for broken rules and resolves the ones
+// that no longer apply. Only newly opened alerts are sent, so a student is
+// reported once until they recover and break the rule again.
+func (b *Bot) evaluateStudentAlerts(studentID, subjectID int64) error {
+	attendance, err := b.alertRepo.GetRecentAttendance(studentID, subjectID)
+	if err != nil {
+		return err
+	}
+	grades, err := b.alertRepo.GetRecentGrades(studentID, subjectID)
+	if err != nil {
+		return err
+	}
+
+	alerts := b.alertRules.evaluate(attendance, grades, b.getSubjectScale(subjectID))
+	active := make([]string, 0, len(alerts))
+	for _, alert := range alerts {
+		active = append(active, alert.rule)
+	}
+
+	return b.inTx(func(tx *sqlx.Tx) error {
+		if err := b.alertRepo.ResolveAlerts(tx, studentID, subjectID, active); err != nil {
+			return err
+		}
+
+		var opened []string
+		for _, alert := range alerts {
+			ok, err := b.alertRepo.OpenAlert(tx, studentID, subjectID, alert.rule, alert.details)
+			if err != nil {
+				return err
+			}
+			if ok {
+				opened = append(opened, alert.details)
+			}
+		}
+		if len(opened) == 0 {
+			return nil
+		}
+
+		b.logger.Infof("Student %d is at risk in subject %d: %s", studentID, subjectID, strings.Join(active, ", "))
+		return b.enqueueAlert(tx, studentID, subjectID, strings.Join(opened, "\n"))
+	})
+}
+
+// enqueueAlert notifies the subject's teacher, the group's curator and, if
+// configured, the student. Users without a Max account are skipped.
+func (b *Bot) enqueueAlert(tx *sqlx.Tx, studentID, subjectID int64, details string) error {
+	recipients, err := b.alertRepo.GetAlertRecipients(studentID, subjectID)
+	if err != nil {
+		return err
+	}
+
+	staff := fmt.Sprintf(alertStaffMsg, recipients.StudentName, recipients.GroupName, recipients.SubjectName, details)
+	teacherNotification := database.OutboxNotification{
+		UserID:      recipients.TeacherID,
+		Category:    categoryAlerts,
+		MessageText: staff,
+	}
+	if recipients.GroupID != nil {
+		teacherNotification.ButtonText = btnAlertAnalytics
+		teacherNotification.ButtonPayload = fmt.Sprintf("stat_grp_%d_%d", subjectID, *recipients.GroupID)
+	}
+
+	notifications := []database.OutboxNotification{teacherNotification}
+	if recipients.CuratorID != nil && *recipients.CuratorID != recipients.TeacherID {
+		notifications = append(notifications, database.OutboxNotification{
+			UserID:      *recipients.CuratorID,
+			Category:    categoryAlerts,
+			MessageText: staff,
+		})
+	}
+
+	for _, n := range notifications {
+		linked, err := b.userRepo.HasMaxID(tx, n.UserID)
+		if err != nil {
+			return err
+		}
+		if !linked {
+			continue
+		}
+		if _, err := b.outboxRepo.Enqueue(tx, n); err != nil {
+			return err
+		}
+	}
+
+	if !b.alertRules.notifyStudent {
+		return nil
+	}
+
+	_, err = b.enqueueStudentNotification(tx, database.OutboxNotification{
+		UserID:      studentID,
+		Category:    categoryAlerts,
+		MessageText: fmt.Sprintf(alertStudentMsg, recipients.SubjectName, details),
+	})
+	return err
+}
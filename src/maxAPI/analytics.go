@@ -0,0 +1,215 @@
+package maxAPI
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/max-messenger/max-bot-api-client-go/schemes"
+
+	"digitalUniversity/database"
+	"digitalUniversity/grading"
+)
+
+const (
+	analyticsSelectSubjectMsg = "Выберите предмет для аналитики:"
+	analyticsSelectGroupMsg   = "Выберите группу:"
+	analyticsForbiddenMsg     = "Аналитика доступна только по вашим предметам."
+
+	analyticsHeader          = "📈 **Аналитика**: %s, группа %s\n\n"
+	analyticsAverage         = "Средний балл: **%s** (оценок: %d)\n"
+	analyticsNoGrades        = "Оценок пока нет.\n"
+	analyticsDistribution    = "\n**Распределение оценок:**\n"
+	analyticsDistributionRow = "• %s — %d %s\n"
+	analyticsLessonsHeader   = "\n**Посещаемость по занятиям** (последние %d):\n"
+	analyticsLessonRow       = "• %s %s — %d из %d (%.0f%%)\n"
+	analyticsNoLessons       = "\nПосещаемость ещё не отмечалась.\n"
+	analyticsRiskHeader      = "\n**Студенты в зоне риска:**\n"
+	analyticsRiskRow         = "%d. %s — %s\n"
+	analyticsRiskAverage     = "средний балл %s"
+	analyticsRiskAbsences    = "пропуски %d из %d"
+	analyticsNoRisk          = "\n✅ Студентов в зоне риска нет."
+	analyticsRiskMore        = "…и ещё %d\n"
+
+	analyticsLessonsLimit = 10
+	analyticsRiskLimit    = 15
+	analyticsBarWidth     = 10
+)
+
+func (b *Bot) handleAnalyticsStart(ctx context.Context, userID int64, callbackID string) error {
+	teacherID, err := b.userRepo.GetUserIDByMaxID(userID)
+	if err != nil {
+		return err
+	}
+
+	subjects, err := b.gradeRepo.GetSubjectsByTeacher(teacherID)
+	if err != nil {
+		return err
+	}
+	if len(subjects) == 0 {
+		return b.answerCallbackWithNotification(ctx, callbackID, noSubjectsForRatingMsg)
+	}
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	for _, subject := range subjects {
+		keyboard.AddRow().AddCallback(subject.SubjectName, schemes.DEFAULT, fmt.Sprintf("stat_subj_%d", subject.SubjectID))
+	}
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+
+	return b.answerWithKeyboard(ctx, callbackID, analyticsSelectSubjectMsg, keyboard)
+}
+
+func (b *Bot) handleAnalyticsCallback(ctx context.Context, userID int64, callbackID, payload string) error {
+	userRole, err := b.getUserRole(userID)
+	if err != nil {
+		return err
+	}
+	if userRole != "teacher" {
+		return b.answerCallbackWithNotification(ctx, callbackID, analyticsForbiddenMsg)
+	}
+
+	if payload == payloadAnalytics {
+		return b.handleAnalyticsStart(ctx, userID, callbackID)
+	}
+
+	teacherID, err := b.userRepo.GetUserIDByMaxID(userID)
+	if err != nil {
+		return err
+	}
+
+	var subjectID, groupID int64
+	switch {
+	case strings.HasPrefix(payload, "stat_subj_"):
+		fmt.Sscanf(payload, "stat_subj_%d", &subjectID)
+	case strings.HasPrefix(payload, "stat_grp_"):
+		fmt.Sscanf(payload, "stat_grp_%d_%d", &subjectID, &groupID)
+	default:
+		return fmt.Errorf("unknown analytics callback: %s", payload)
+	}
+
+	groups, err := b.gradeRepo.GetGroupsBySubjectAndTeacher(subjectID, teacherID)
+	if err != nil {
+		return err
+	}
+	if len(groups) == 0 {
+		return b.answerCallbackWithNotification(ctx, callbackID, analyticsForbiddenMsg)
+	}
+
+	if groupID == 0 {
+		keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+		for _, group := range groups {
+			keyboard.AddRow().AddCallback(group.GroupName, schemes.DEFAULT, fmt.Sprintf("stat_grp_%d_%d", subjectID, group.GroupID))
+		}
+		keyboard.AddRow().AddCallback(btnPrev, schemes.DEFAULT, payloadAnalytics)
+		keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+		return b.answerWithKeyboard(ctx, callbackID, analyticsSelectGroupMsg, keyboard)
+	}
+
+	var groupName string
+	for _, group := range groups {
+		if group.GroupID == groupID {
+			groupName = group.GroupName
+		}
+	}
+	if groupName == "" {
+		return b.answerCallbackWithNotification(ctx, callbackID, analyticsForbiddenMsg)
+	}
+
+	text, err := b.buildGroupAnalytics(subjectID, groupID, groupName)
+	if err != nil {
+		return err
+	}
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	keyboard.AddRow().AddCallback(btnPrev, schemes.DEFAULT, fmt.Sprintf("stat_subj_%d", subjectID))
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+	return b.answerWithPhotoMarkdown(ctx, callbackID, text, b.gradeDistributionChart(ctx, subjectID, groupID), keyboard)
+}
+
+// buildGroupAnalytics reports the group's grades, per-lesson attendance and
+// the students at risk of failing the subject. A student is at risk when
+// their average is below the scale's passing grade or their attendance is
+// below the subject's admission minimum.
+func (b *Bot) buildGroupAnalytics(subjectID, groupID int64, groupName string) (string, error) {
+	scale := b.getSubjectScale(subjectID)
+	rules := b.getRatingRules(subjectID)
+
+	distribution, err := b.gradeRepo.GetGradeDistribution(subjectID, groupID)
+	if err != nil {
+		return "", err
+	}
+	lessons, err := b.attendanceRepo.GetLessonAttendance(subjectID, groupID, analyticsLessonsLimit)
+	if err != nil {
+		return "", err
+	}
+	atRisk, err := b.gradeRepo.GetStudentsAtRisk(subjectID, groupID, scale.PassValue, rules.MinAttendancePercent)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, analyticsHeader, b.getSubjectName(subjectID), groupName)
+	formatGradeDistribution(&sb, scale, distribution)
+	formatLessonAttendance(&sb, lessons)
+	formatStudentsAtRisk(&sb, scale, atRisk)
+
+	return sb.String(), nil
+}
+
+func formatGradeDistribution(sb *strings.Builder, scale grading.Scale, distribution []database.GradeCount) {
+	var total, sum, maxCount int
+	for _, c := range distribution {
+		total += c.Count
+		sum += c.GradeValue * c.Count
+		maxCount = max(maxCount, c.Count)
+	}
+	if total == 0 {
+		sb.WriteString(analyticsNoGrades)
+		return
+	}
+
+	fmt.Fprintf(sb, analyticsAverage, scale.FormatAverage(float64(sum)/float64(total)), total)
+	sb.WriteString(analyticsDistribution)
+	for _, c := range distribution {
+		bar := strings.Repeat("▇", max(1, c.Count*analyticsBarWidth/maxCount))
+		fmt.Fprintf(sb, analyticsDistributionRow, scale.Label(c.GradeValue), c.Count, bar)
+	}
+}
+
+func formatLessonAttendance(sb *strings.Builder, lessons []database.LessonAttendance) {
+	if len(lessons) == 0 {
+		sb.WriteString(analyticsNoLessons)
+		return
+	}
+
+	fmt.Fprintf(sb, analyticsLessonsHeader, len(lessons))
+	for _, lesson := range lessons {
+		percent := float64(lesson.Attended) * 100 / float64(lesson.Total)
+		fmt.Fprintf(sb, analyticsLessonRow, lesson.LessonDate.Format("02.01"), lesson.StartTime.Format(timeFormat),
+			lesson.Attended, lesson.Total, percent)
+	}
+}
+
+func formatStudentsAtRisk(sb *strings.Builder, scale grading.Scale, students []database.StudentRisk) {
+	if len(students) == 0 {
+		sb.WriteString(analyticsNoRisk)
+		return
+	}
+
+	sb.WriteString(analyticsRiskHeader)
+	for i, student := range students {
+		if i == analyticsRiskLimit {
+			fmt.Fprintf(sb, analyticsRiskMore, len(students)-analyticsRiskLimit)
+			break
+		}
+
+		var details []string
+		if student.GradeAverage != nil {
+			details = append(details, fmt.Sprintf(analyticsRiskAverage, scale.FormatAverage(*student.GradeAverage)))
+		}
+		if student.Marked > 0 {
+			details = append(details, fmt.Sprintf(analyticsRiskAbsences, student.Absences, student.Marked))
+		}
+		fmt.Fprintf(sb, analyticsRiskRow, i+1, student.StudentName, strings.Join(details, ", "))
+	}
+}
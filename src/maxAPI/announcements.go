@@ -0,0 +1,619 @@
+package maxAPI
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	maxbot "github.com/max-messenger/max-bot-api-client-go"
+	"github.com/max-messenger/max-bot-api-client-go/schemes"
+
+	"digitalUniversity/database"
+)
+
+const (
+	inputAnnouncement = "announcement"
+
+	targetGroup    = "group"
+	targetSubject  = "subject"
+	targetStudents = "students"
+	targetTeachers = "teachers"
+
+	attachmentFile = "file"
+
+	announceSelectTargetMsg  = "📢 Кому отправить объявление?"
+	announceSelectGroupMsg   = "Выберите группу:"
+	announceSelectSubjectMsg = "Выберите предмет — объявление получат все его группы:"
+	announceNoTargetsMsg     = "Нет доступных получателей."
+	announceNoRecipientsMsg  = "В выбранной аудитории нет пользователей, подключённых к боту."
+	announceComposeMsg       = "Получатели: **%s** (%d чел.)\n\nОтправьте текст объявления. К сообщению можно приложить файл."
+	announceEditMsg          = "Отправьте новый текст объявления. К сообщению можно приложить файл."
+	announceEmptyTextMsg     = "Добавьте к объявлению текст."
+	announceOnlyFilesMsg     = "К объявлению можно приложить только файл."
+	announcePreviewHeader    = "👀 **Предпросмотр объявления**\nПолучатели: **%s** (%d чел.)\n\n"
+	announceAttachmentLine   = "\n\n📎 Вложение: %s"
+	announceImportantLine    = "\n\n❗ Важное объявление — подтвердите прочтение."
+	announceQueuedMsg        = "✅ Объявление поставлено в очередь: %d получателей.\n\nИтог доставки придёт отдельным сообщением."
+	announceCancelledMsg     = "Объявление отменено."
+	announceExpiredMsg       = "Черновик объявления не найден, начните заново."
+	announceForbiddenMsg     = "Объявления доступны только преподавателям и администраторам."
+	announceNotFoundMsg      = "Объявление не найдено."
+	announceAckMsg           = "Спасибо! Прочтение подтверждено."
+	announceListMsg          = "📋 Ваши последние объявления:"
+	announceListEmptyMsg     = "Вы ещё не отправляли объявлений."
+	announceMessage          = "📢 **Объявление** от %s\n\n%s"
+	announceBatchTitle       = "Объявление для: **%s**"
+
+	announceStatsHeader      = "📊 **Объявление от %s**\nПолучатели: %s\n\n%s\n\n"
+	announceStatsDelivery    = "Доставлено: **%d** из **%d**\nВ очереди: %d\nОтложено до вечерней сводки: %d\nОтключено получателями: %d\nНе доставлено: %d"
+	announceStatsAcks        = "\n\nПрочитали: **%d** из **%d**"
+	announceStatsUnreadTitle = "\n\nЕщё не подтвердили:\n"
+	announceStatsMore        = "…и ещё %d"
+
+	btnAnnounceGroup     = "Группе"
+	btnAnnounceSubject   = "Всем группам предмета"
+	btnAnnounceStudents  = "Всем студентам"
+	btnAnnounceTeachers  = "Всем преподавателям"
+	btnAnnounceList      = "📋 Мои объявления"
+	btnAnnounceSend      = "✅ Отправить"
+	btnAnnounceEdit      = "✏️ Изменить текст"
+	btnAnnounceCancel    = "❌ Отмена"
+	btnAnnounceImportant = "Подтверждение прочтения: %s"
+	btnAnnounceRefresh   = "🔄 Обновить"
+	btnAnnounceAck       = "✅ Прочитано"
+
+	announceListLimit   = 10
+	announceUnreadLimit = 20
+	announcePreviewLen  = 30
+)
+
+// announcementDraft holds an announcement while the author composes and
+// previews it.
+type announcementDraft struct {
+	targetType  string
+	targetID    *int64
+	targetTitle string
+	recipients  int
+
+	text           string
+	attachmentName string
+	attachmentTok  string
+	important      bool
+}
+
+func (b *Bot) handleAnnounceStart(ctx context.Context, userID int64, callbackID string) error {
+	userRole, err := b.getUserRole(userID)
+	if err != nil {
+		return err
+	}
+	if userRole != "teacher" && userRole != "admin" {
+		return b.answerCallbackWithNotification(ctx, callbackID, announceForbiddenMsg)
+	}
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	keyboard.AddRow().AddCallback(btnAnnounceGroup, schemes.DEFAULT, "ann_tgt_group")
+	keyboard.AddRow().AddCallback(btnAnnounceSubject, schemes.DEFAULT, "ann_tgt_subject")
+	if userRole == "admin" {
+		keyboard.AddRow().AddCallback(btnAnnounceStudents, schemes.DEFAULT, "ann_tgt_students")
+		keyboard.AddRow().AddCallback(btnAnnounceTeachers, schemes.DEFAULT, "ann_tgt_teachers")
+	}
+	keyboard.AddRow().AddCallback(btnAnnounceList, schemes.DEFAULT, "ann_list")
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+
+	return b.answerWithKeyboard(ctx, callbackID, announceSelectTargetMsg, keyboard)
+}
+
+func (b *Bot) handleAnnounceCallback(ctx context.Context, userID int64, callbackID, payload string) error {
+	parts := strings.Split(payload, "_")
+	if len(parts) < 2 {
+		return fmt.Errorf("invalid announcement callback payload: %s", payload)
+	}
+
+	if parts[1] == "ack" {
+		return b.handleAnnounceAck(ctx, userID, callbackID, payload)
+	}
+
+	userRole, err := b.getUserRole(userID)
+	if err != nil {
+		return err
+	}
+	if userRole != "teacher" && userRole != "admin" {
+		return b.answerCallbackWithNotification(ctx, callbackID, announceForbiddenMsg)
+	}
+
+	switch parts[1] {
+	case "tgt":
+		return b.handleAnnounceTarget(ctx, userID, userRole, callbackID, payload)
+	case "grp", "subj":
+		return b.handleAnnounceTargetSelected(ctx, userID, userRole, callbackID, payload)
+	case "imp":
+		return b.handleAnnounceToggleImportant(ctx, userID, callbackID)
+	case "edit":
+		b.setPendingInput(userID, inputAnnouncement)
+		return b.answerCallbackWithNotification(ctx, callbackID, announceEditMsg)
+	case "send":
+		return b.handleAnnounceSend(ctx, userID, callbackID)
+	case "cancel":
+		b.clearAnnouncementDraft(userID)
+		keyboard, _ := b.getMenuByRole(userRole)
+		return b.answerWithKeyboard(ctx, callbackID, announceCancelledMsg, keyboard)
+	case "list":
+		return b.handleAnnounceList(ctx, userID, callbackID)
+	case "stat":
+		return b.handleAnnounceStats(ctx, userID, userRole, callbackID, payload)
+	default:
+		return fmt.Errorf("unknown announcement callback type: %s", parts[1])
+	}
+}
+
+func (b *Bot) handleAnnounceTarget(ctx context.Context, userID int64, userRole, callbackID, payload string) error {
+	targetType := strings.TrimPrefix(payload, "ann_tgt_")
+
+	switch targetType {
+	case targetGroup:
+		groups, err := b.getAnnounceGroups(userID, userRole)
+		if err != nil {
+			return err
+		}
+		if len(groups) == 0 {
+			return b.answerCallbackWithNotification(ctx, callbackID, announceNoTargetsMsg)
+		}
+
+		keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+		for _, group := range groups {
+			keyboard.AddRow().AddCallback(group.GroupName, schemes.DEFAULT, fmt.Sprintf("ann_grp_%d", group.GroupID))
+		}
+		keyboard.AddRow().AddCallback(btnAnnounceCancel, schemes.DEFAULT, "ann_cancel")
+		return b.answerWithKeyboard(ctx, callbackID, announceSelectGroupMsg, keyboard)
+
+	case targetSubject:
+		subjects, err := b.getAnnounceSubjects(userID, userRole)
+		if err != nil {
+			return err
+		}
+		if len(subjects) == 0 {
+			return b.answerCallbackWithNotification(ctx, callbackID, announceNoTargetsMsg)
+		}
+
+		keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+		for _, subject := range subjects {
+			keyboard.AddRow().AddCallback(subject.SubjectName, schemes.DEFAULT, fmt.Sprintf("ann_subj_%d", subject.SubjectID))
+		}
+		keyboard.AddRow().AddCallback(btnAnnounceCancel, schemes.DEFAULT, "ann_cancel")
+		return b.answerWithKeyboard(ctx, callbackID, announceSelectSubjectMsg, keyboard)
+
+	case targetStudents, targetTeachers:
+		if userRole != "admin" {
+			return b.answerCallbackWithNotification(ctx, callbackID, announceForbiddenMsg)
+		}
+		title := "все студенты"
+		if targetType == targetTeachers {
+			title = "все преподаватели"
+		}
+		return b.startAnnouncementDraft(ctx, userID, callbackID, targetType, nil, title)
+
+	default:
+		return fmt.Errorf("unknown announcement target: %s", targetType)
+	}
+}
+
+// handleAnnounceTargetSelected resolves a chosen group or subject among the
+// ones available to the author, so a forged payload cannot reach others.
+func (b *Bot) handleAnnounceTargetSelected(ctx context.Context, userID int64, userRole, callbackID, payload string) error {
+	var targetID int64
+
+	if strings.HasPrefix(payload, "ann_grp_") {
+		fmt.Sscanf(payload, "ann_grp_%d", &targetID)
+
+		groups, err := b.getAnnounceGroups(userID, userRole)
+		if err != nil {
+			return err
+		}
+		for _, group := range groups {
+			if group.GroupID == targetID {
+				return b.startAnnouncementDraft(ctx, userID, callbackID, targetGroup, &targetID, "группа "+group.GroupName)
+			}
+		}
+		return b.answerCallbackWithNotification(ctx, callbackID, announceForbiddenMsg)
+	}
+
+	fmt.Sscanf(payload, "ann_subj_%d", &targetID)
+
+	subjects, err := b.getAnnounceSubjects(userID, userRole)
+	if err != nil {
+		return err
+	}
+	for _, subject := range subjects {
+		if subject.SubjectID == targetID {
+			title := fmt.Sprintf("группы предмета «%s»", subject.SubjectName)
+			return b.startAnnouncementDraft(ctx, userID, callbackID, targetSubject, &targetID, title)
+		}
+	}
+	return b.answerCallbackWithNotification(ctx, callbackID, announceForbiddenMsg)
+}
+
+func (b *Bot) getAnnounceGroups(userID int64, userRole string) ([]database.Group, error) {
+	if userRole == "admin" {
+		return b.groupRepo.GetAllGroups()
+	}
+
+	teacherID, err := b.userRepo.GetUserIDByMaxID(userID)
+	if err != nil {
+		return nil, err
+	}
+	return b.groupRepo.GetGroupsByTeacher(teacherID)
+}
+
+func (b *Bot) getAnnounceSubjects(userID int64, userRole string) ([]database.Subject, error) {
+	if userRole == "admin" {
+		return b.subjectRepo.GetAllSubjects()
+	}
+
+	teacherID, err := b.userRepo.GetUserIDByMaxID(userID)
+	if err != nil {
+		return nil, err
+	}
+	return b.gradeRepo.GetSubjectsByTeacher(teacherID)
+}
+
+func (b *Bot) startAnnouncementDraft(ctx context.Context, userID int64, callbackID, targetType string, targetID *int64, title string) error {
+	authorID, err := b.userRepo.GetUserIDByMaxID(userID)
+	if err != nil {
+		return err
+	}
+
+	recipients, err := b.announcementRepo.GetRecipientIDs(targetType, targetID, authorID)
+	if err != nil {
+		b.logger.Errorf("Failed to resolve announcement recipients: %v", err)
+		return err
+	}
+	if len(recipients) == 0 {
+		return b.answerCallbackWithNotification(ctx, callbackID, announceNoRecipientsMsg)
+	}
+
+	b.mu.Lock()
+	b.announceDrafts[userID] = &announcementDraft{
+		targetType:  targetType,
+		targetID:    targetID,
+		targetTitle: title,
+		recipients:  len(recipients),
+	}
+	b.pendingInputs[userID] = inputAnnouncement
+	b.mu.Unlock()
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	keyboard.AddRow().AddCallback(btnAnnounceCancel, schemes.DEFAULT, "ann_cancel")
+
+	text := fmt.Sprintf(announceComposeMsg, title, len(recipients))
+	return b.answerWithKeyboardMarkdown(ctx, callbackID, text, keyboard)
+}
+
+// handleAnnouncementMessage stores the composed text and optional file in
+// the draft and shows the preview.
+func (b *Bot) handleAnnouncementMessage(ctx context.Context, userID int64, text string, file *schemes.FileAttachment) error {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		b.setPendingInput(userID, inputAnnouncement)
+		return b.sendMessage(ctx, userID, announceEmptyTextMsg)
+	}
+
+	var snapshot announcementDraft
+	b.mu.Lock()
+	draft := b.announceDrafts[userID]
+	if draft != nil {
+		draft.text = text
+		draft.attachmentName, draft.attachmentTok = "", ""
+		if file != nil {
+			draft.attachmentName = file.Filename
+			draft.attachmentTok = file.Payload.Token
+		}
+		snapshot = *draft
+	}
+	b.mu.Unlock()
+
+	if draft == nil {
+		return b.sendMessage(ctx, userID, announceExpiredMsg)
+	}
+
+	preview, keyboard := b.announcementPreview(userID, snapshot)
+	b.sendKeyboard(ctx, keyboard, userID, preview)
+	return nil
+}
+
+func (b *Bot) handleAnnounceToggleImportant(ctx context.Context, userID int64, callbackID string) error {
+	var snapshot announcementDraft
+	b.mu.Lock()
+	draft := b.announceDrafts[userID]
+	if draft != nil {
+		draft.important = !draft.important
+		snapshot = *draft
+	}
+	b.mu.Unlock()
+
+	if draft == nil {
+		return b.answerCallbackWithNotification(ctx, callbackID, announceExpiredMsg)
+	}
+
+	preview, keyboard := b.announcementPreview(userID, snapshot)
+	return b.answerWithKeyboardMarkdown(ctx, callbackID, preview, keyboard)
+}
+
+// announcementPreview renders a copy of the draft taken under b.mu, so the
+// draft may expire or change while the preview is built.
+func (b *Bot) announcementPreview(userID int64, draft announcementDraft) (string, *maxbot.Keyboard) {
+	authorName := b.getTeacherName(b.getUserIDOrZero(userID))
+
+	text := fmt.Sprintf(announcePreviewHeader, draft.targetTitle, draft.recipients) +
+		formatAnnouncementText(authorName, draft.text, draft.important)
+	if draft.attachmentName != "" {
+		text += fmt.Sprintf(announceAttachmentLine, draft.attachmentName)
+	}
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	keyboard.AddRow().AddCallback(fmt.Sprintf(btnAnnounceImportant, yesNo(draft.important)), schemes.DEFAULT, "ann_imp")
+	keyboard.AddRow().AddCallback(btnAnnounceSend, schemes.POSITIVE, "ann_send")
+	keyboard.AddRow().
+		AddCallback(btnAnnounceEdit, schemes.DEFAULT, "ann_edit").
+		AddCallback(btnAnnounceCancel, schemes.NEGATIVE, "ann_cancel")
+
+	return text, keyboard
+}
+
+// handleAnnounceSend stores the announcement and queues a notification with a
+// receipt for every recipient in one transaction. The recipients are grouped
+// into a batch so the author receives a delivery summary. The draft is taken
+// out before sending, so a repeated press of the button doesn't send twice;
+// it is put back if the announcement couldn't be queued.
+func (b *Bot) handleAnnounceSend(ctx context.Context, userID int64, callbackID string) error {
+	b.mu.Lock()
+	draftPtr := b.announceDrafts[userID]
+	if draftPtr != nil && draftPtr.text != "" {
+		delete(b.announceDrafts, userID)
+	}
+	b.mu.Unlock()
+
+	if draftPtr == nil || draftPtr.text == "" {
+		return b.answerCallbackWithNotification(ctx, callbackID, announceExpiredMsg)
+	}
+	draft := *draftPtr
+
+	authorID, err := b.userRepo.GetUserIDByMaxID(userID)
+	if err != nil {
+		b.restoreAnnouncementDraft(userID, draftPtr)
+		return err
+	}
+
+	recipients, err := b.announcementRepo.GetRecipientIDs(draft.targetType, draft.targetID, authorID)
+	if err != nil {
+		b.restoreAnnouncementDraft(userID, draftPtr)
+		b.logger.Errorf("Failed to resolve announcement recipients: %v", err)
+		return err
+	}
+	if len(recipients) == 0 {
+		b.restoreAnnouncementDraft(userID, draftPtr)
+		return b.answerCallbackWithNotification(ctx, callbackID, announceNoRecipientsMsg)
+	}
+
+	announcement := database.Announcement{
+		AuthorID:    authorID,
+		TargetType:  draft.targetType,
+		TargetID:    draft.targetID,
+		TargetTitle: draft.targetTitle,
+		MessageText: draft.text,
+		Important:   draft.important,
+	}
+	if draft.attachmentTok != "" {
+		announcement.AttachmentType = attachmentFile
+		announcement.AttachmentToken = draft.attachmentTok
+	}
+
+	messageText := formatAnnouncementText(b.getTeacherName(authorID), draft.text, draft.important)
+
+	var announcementID int64
+	err = b.inTx(func(tx *sqlx.Tx) error {
+		id, err := b.announcementRepo.CreateAnnouncement(tx, announcement)
+		if err != nil {
+			return err
+		}
+		announcementID = id
+
+		batchID, err := b.outboxRepo.CreateBatch(tx, authorID, fmt.Sprintf(announceBatchTitle, draft.targetTitle))
+		if err != nil {
+			return err
+		}
+
+		for _, recipientID := range recipients {
+			notification := database.OutboxNotification{
+				UserID:          recipientID,
+				BatchID:         &batchID,
+				Category:        categoryAnnouncements,
+				MessageText:     messageText,
+				AttachmentType:  announcement.AttachmentType,
+				AttachmentToken: announcement.AttachmentToken,
+			}
+			if draft.important {
+				notification.ButtonText = btnAnnounceAck
+				notification.ButtonPayload = fmt.Sprintf("ann_ack_%d", announcementID)
+			}
+
+			outboxID, err := b.outboxRepo.Enqueue(tx, notification)
+			if err != nil {
+				return err
+			}
+			if err := b.announcementRepo.AddReceipt(tx, announcementID, recipientID, outboxID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		b.restoreAnnouncementDraft(userID, draftPtr)
+		b.logger.Errorf("Failed to queue announcement from user %d: %v", authorID, err)
+		return err
+	}
+
+	b.clearAnnouncementDraft(userID)
+	b.logger.Infof("User %d queued announcement %d for %d recipients", authorID, announcementID, len(recipients))
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	keyboard.AddRow().AddCallback(btnAnnounceRefresh, schemes.DEFAULT, fmt.Sprintf("ann_stat_%d", announcementID))
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+
+	return b.answerWithKeyboard(ctx, callbackID, fmt.Sprintf(announceQueuedMsg, len(recipients)), keyboard)
+}
+
+func (b *Bot) handleAnnounceList(ctx context.Context, userID int64, callbackID string) error {
+	authorID, err := b.userRepo.GetUserIDByMaxID(userID)
+	if err != nil {
+		return err
+	}
+
+	announcements, err := b.announcementRepo.GetAnnouncementsByAuthor(authorID, announceListLimit)
+	if err != nil {
+		b.logger.Errorf("Failed to get announcements of user %d: %v", authorID, err)
+		return err
+	}
+	if len(announcements) == 0 {
+		return b.answerCallbackWithNotification(ctx, callbackID, announceListEmptyMsg)
+	}
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	for _, a := range announcements {
+		label := a.CreatedAt.In(b.location).Format("02.01 15:04") + " — " + truncateRunes(a.MessageText, announcePreviewLen)
+		keyboard.AddRow().AddCallback(label, schemes.DEFAULT, fmt.Sprintf("ann_stat_%d", a.AnnouncementID))
+	}
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+
+	return b.answerWithKeyboard(ctx, callbackID, announceListMsg, keyboard)
+}
+
+// handleAnnounceStats shows per-recipient delivery and read status. Only the
+// author and administrators may see it.
+func (b *Bot) handleAnnounceStats(ctx context.Context, userID int64, userRole, callbackID, payload string) error {
+	var announcementID int64
+	fmt.Sscanf(payload, "ann_stat_%d", &announcementID)
+
+	announcement, err := b.announcementRepo.GetAnnouncement(announcementID)
+	if err != nil {
+		return b.answerCallbackWithNotification(ctx, callbackID, announceNotFoundMsg)
+	}
+
+	viewerID, err := b.userRepo.GetUserIDByMaxID(userID)
+	if err != nil {
+		return err
+	}
+	if announcement.AuthorID != viewerID && userRole != "admin" {
+		return b.answerCallbackWithNotification(ctx, callbackID, announceForbiddenMsg)
+	}
+
+	stats, err := b.announcementRepo.GetDeliveryStats(announcementID)
+	if err != nil {
+		b.logger.Errorf("Failed to get stats of announcement %d: %v", announcementID, err)
+		return err
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, announceStatsHeader,
+		announcement.CreatedAt.In(b.location).Format("02.01.2006 15:04"),
+		announcement.TargetTitle,
+		truncateRunes(announcement.MessageText, 200))
+	fmt.Fprintf(&sb, announceStatsDelivery,
+		stats.Sent, stats.Total, stats.Pending, stats.Deferred, stats.Skipped, stats.Failed)
+
+	if announcement.Important {
+		fmt.Fprintf(&sb, announceStatsAcks, stats.Acknowledged, stats.Total)
+
+		unread, err := b.announcementRepo.GetUnacknowledgedNames(announcementID, announceUnreadLimit)
+		if err != nil {
+			b.logger.Warnf("Failed to get unread recipients of announcement %d: %v", announcementID, err)
+		} else if len(unread) > 0 {
+			sb.WriteString(announceStatsUnreadTitle)
+			for _, name := range unread {
+				sb.WriteString("• " + name + "\n")
+			}
+			if rest := stats.Total - stats.Acknowledged - len(unread); rest > 0 {
+				fmt.Fprintf(&sb, announceStatsMore, rest)
+			}
+		}
+	}
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	keyboard.AddRow().AddCallback(btnAnnounceRefresh, schemes.DEFAULT, payload)
+	keyboard.AddRow().AddCallback(btnAnnounceList, schemes.DEFAULT, "ann_list")
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+
+	return b.answerWithKeyboardMarkdown(ctx, callbackID, strings.TrimSpace(sb.String()), keyboard)
+}
+
+func (b *Bot) handleAnnounceAck(ctx context.Context, userID int64, callbackID, payload string) error {
+	var announcementID int64
+	fmt.Sscanf(payload, "ann_ack_%d", &announcementID)
+
+	recipientID, err := b.userRepo.GetUserIDByMaxID(userID)
+	if err != nil {
+		return err
+	}
+
+	ok, err := b.announcementRepo.Acknowledge(announcementID, recipientID)
+	if err != nil {
+		b.logger.Errorf("Failed to acknowledge announcement %d by user %d: %v", announcementID, recipientID, err)
+		return err
+	}
+	if !ok {
+		return b.answerCallbackWithNotification(ctx, callbackID, announceNotFoundMsg)
+	}
+
+	return b.answerCallbackWithNotification(ctx, callbackID, announceAckMsg)
+}
+
+// restoreAnnouncementDraft puts back a draft taken out for sending unless the
+// user has started a new one meanwhile.
+func (b *Bot) restoreAnnouncementDraft(userID int64, draft *announcementDraft) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.announceDrafts[userID]; !ok {
+		b.announceDrafts[userID] = draft
+	}
+}
+
+func (b *Bot) clearAnnouncementDraft(userID int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.announceDrafts, userID)
+	if b.pendingInputs[userID] == inputAnnouncement {
+		delete(b.pendingInputs, userID)
+	}
+}
+
+func (b *Bot) getUserIDOrZero(maxUserID int64) int64 {
+	userID, err := b.userRepo.GetUserIDByMaxID(maxUserID)
+	if err != nil {
+		b.logger.Warnf("Failed to get user ID for %d: %v", maxUserID, err)
+		return 0
+	}
+	return userID
+}
+
+func formatAnnouncementText(authorName, text string, important bool) string {
+	message := fmt.Sprintf(announceMessage, authorName, text)
+	if important {
+		message += announceImportantLine
+	}
+	return message
+}
+
+func yesNo(value bool) string {
+	if value {
+		return "да"
+	}
+	return "нет"
+}
+
+func truncateRunes(text string, limit int) string {
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	if len(runes) <= limit {
+		return string(runes)
+	}
+	return string(runes[:limit]) + "…"
+}
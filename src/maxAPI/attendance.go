@@ -6,6 +6,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/jmoiron/sqlx"
 	"github.com/max-messenger/max-bot-api-client-go/schemes"
 
 	"digitalUniversity/database"
@@ -17,6 +18,9 @@ const (
 	selectScheduleForAttendanceMsg = "Выберите занятие:"
 	selectAbsentStudentsMsg        = "Отметьте посещаемость на занятии:\n**%s %s**\n\nВыберите отсутствующих:"
 	allMarkedPresentMsg            = "✅ Студенты отмечены как присутствующие!"
+	batchNotificationsNote         = "\n\nУведомления студентам (%d) отправляются, итог придёт отдельным сообщением."
+	attendanceBatchTitle           = "Посещаемость: **%s**, %s"
+	selectSubjectForAttendMsg      = "Выберите предмет для просмотра посещаемости:"
 
 	attendanceStatsHeaderMsg = "📊 Посещаемость по предмету **%s**:\n\n"
 	attendanceEntryFormat    = "`%s %s` — %s\n"
@@ -46,6 +50,7 @@ func (b *Bot) handleMarkAttendanceStart(ctx context.Context, userID int64, callb
 	}
 
 	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	b.addPendingSubmissions(keyboard, teacherID)
 	for _, subject := range subjects {
 		payload := fmt.Sprintf("attend_subj_%d", subject.SubjectID)
 		keyboard.AddRow().AddCallback(subject.SubjectName, schemes.DEFAULT, payload)
@@ -211,7 +216,7 @@ func (b *Bot) showAttendanceStudentsList(ctx context.Context, callbackID string,
 	return b.answerWithKeyboardMarkdown(ctx, callbackID, text, keyboard)
 }
 
-func (b *Bot) handleAttendanceMarkAll(ctx context.Context, _ int64, callbackID, payload string) error {
+func (b *Bot) handleAttendanceMarkAll(ctx context.Context, userID int64, callbackID, payload string) error {
 	var subjectID, groupID, scheduleID int64
 	fmt.Sscanf(payload, "attend_all_%d_%d_%d", &subjectID, &groupID, &scheduleID)
 
@@ -232,28 +237,67 @@ func (b *Bot) handleAttendanceMarkAll(ctx context.Context, _ int64, callbackID,
 		attendanceMap[record.StudentID] = record.Attended
 	}
 
+	teacherID, err := b.userRepo.GetUserIDByMaxID(userID)
+	if err != nil {
+		b.logger.Errorf("Failed to get teacher ID: %v", err)
+		return err
+	}
+
 	subjectName, _ := b.subjectRepo.GetSubjectName(subjectID)
 	now := time.Now()
+	batchTitle := fmt.Sprintf(attendanceBatchTitle, subjectName, now.Add(3*time.Hour).Format("02.01.2006 15:04"))
+
+	// Notifications for the whole lesson form one batch: the outbox worker
+	// delivers them at its rate limit and reports the result to the teacher.
+	var markedIDs []int64
+	notified := 0
+	err = b.inTx(func(tx *sqlx.Tx) error {
+		var batchID *int64
+		for _, student := range students {
+			if _, exists := attendanceMap[student.UserID]; exists {
+				continue
+			}
+			if err := b.attendanceRepo.MarkAttendance(tx, student.UserID, scheduleID, true, teacherID); err != nil {
+				return err
+			}
 
-	for _, student := range students {
-		attended, exists := attendanceMap[student.UserID]
-		if !exists {
-			err := b.attendanceRepo.MarkAttendance(student.UserID, scheduleID, true)
+			if batchID == nil {
+				id, err := b.outboxRepo.CreateBatch(tx, teacherID, batchTitle)
+				if err != nil {
+					return err
+				}
+				batchID = &id
+			}
+
+			notification := attendanceNotification(student.UserID, subjectID, subjectName, true, now)
+			notification.BatchID = batchID
+			queued, err := b.enqueueStudentNotification(tx, notification)
 			if err != nil {
-				b.logger.Errorf("Failed to mark attendance for student %d: %v", student.UserID, err)
-			} else {
-				go b.notifyStudentAttendance(context.Background(), student.UserID, subjectID, subjectName, true, now)
+				return err
 			}
-		} else if !attended {
-			continue
+			if queued {
+				notified++
+			}
+			markedIDs = append(markedIDs, student.UserID)
 		}
+		return nil
+	})
+	if err != nil {
+		b.logger.Errorf("Failed to mark attendance for schedule %d: %v", scheduleID, err)
+		return b.answerCallbackWithNotification(ctx, callbackID, "Ошибка при отметке посещаемости.")
+	}
+	go b.checkAlerts(subjectID, markedIDs...)
+
+	text := allMarkedPresentMsg
+	if notified > 0 {
+		text += fmt.Sprintf(batchNotificationsNote, notified)
 	}
 
 	keyboard := GetTeacherKeyboard(b.MaxAPI)
-	return b.answerWithKeyboardAndNotification(ctx, callbackID, allMarkedPresentMsg, keyboard, "Все отмечены!")
+	return b.answerWithKeyboardAndNotification(ctx, callbackID, text, keyboard, "Все отмечены!")
 }
 
-func (b *Bot) handleAttendanceMarkAbsent(ctx context.Context, _ int64, callbackID, payload string) error {
+func (b *Bot) handleAttendanceMarkAbsent(ctx context.Context, userID int64, callbackID, payload string) error {
 	var subjectID, groupID, scheduleID, studentID int64
 	var markedIDsStr string
 
@@ -271,14 +315,28 @@ func (b *Bot) handleAttendanceMarkAbsent(ctx context.Context, _ int64, callbackI
 		}
 	}
 
-	err := b.attendanceRepo.MarkAttendance(studentID, scheduleID, false)
+	teacherID, err := b.userRepo.GetUserIDByMaxID(userID)
+	if err != nil {
+		b.logger.Errorf("Failed to get teacher ID: %v", err)
+		return err
+	}
+
+	subjectName, _ := b.subjectRepo.GetSubjectName(subjectID)
+	notification := attendanceNotification(studentID, subjectID, subjectName, false, time.Now())
+
+	err = b.inTx(func(tx *sqlx.Tx) error {
+		if err := b.attendanceRepo.MarkAttendance(tx, studentID, scheduleID, false, teacherID); err != nil {
+			return err
+		}
+		_, err := b.enqueueStudentNotification(tx, notification)
+		return err
+	})
 	if err != nil {
 		b.logger.Errorf("Failed to mark attendance: %v", err)
 		b.answerCallbackWithNotification(ctx, callbackID, "Ошибка при отметке посещаемости.")
 		return err
 	}
-	subjectName, _ := b.subjectRepo.GetSubjectName(subjectID)
-	go b.notifyStudentAttendance(context.Background(), studentID, subjectID, subjectName, false, time.Now())
+	go b.checkAlerts(subjectID, studentID)
 
 	markedAbsentIDs = append(markedAbsentIDs, studentID)
 
@@ -300,37 +358,17 @@ func (b *Bot) handleAttendanceMarkAbsent(ctx context.Context, _ int64, callbackI
 }
 
 func (b *Bot) handleShowAttendanceStart(ctx context.Context, userID int64, callbackID string) error {
-	studentID, err := b.userRepo.GetUserIDByMaxID(userID)
-	if err != nil {
-		b.logger.Errorf("Failed to get student ID: %v", err)
-		return err
-	}
-
-	groupID, err := b.userRepo.GetStudentGroupID(studentID)
-	if err != nil {
-		b.logger.Errorf("Failed to get student group ID: %v", err)
-		return err
-	}
-
-	subjects, err := b.gradeRepo.GetSubjectsByStudentGroup(groupID)
+	_, subjects, err := b.getStudentSubjects(userID)
 	if err != nil {
-		b.logger.Errorf("Failed to get subjects for group %d: %v", groupID, err)
 		return err
 	}
 
 	if len(subjects) == 0 {
-		return b.answerCallbackWithNotification(ctx, callbackID, "У вашей группы пока нет предметов.")
+		return b.answerCallbackWithNotification(ctx, callbackID, noSubjectsMsgStudent)
 	}
 
-	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
-	for _, subject := range subjects {
-		buttonText := subject.SubjectName
-		payload := fmt.Sprintf("show_attend_subj_%d", subject.SubjectID)
-		keyboard.AddRow().AddCallback(buttonText, schemes.DEFAULT, payload)
-	}
-	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
-
-	return b.answerWithKeyboard(ctx, callbackID, "Выберите предмет для просмотра посещаемости:", keyboard)
+	keyboard := b.studentSubjectsKeyboard(subjects, "show_attend_subj_%d")
+	return b.answerWithKeyboard(ctx, callbackID, selectSubjectForAttendMsg, keyboard)
 }
 
 func (b *Bot) handleShowAttendanceCallback(ctx context.Context, userID int64, callbackID, payload string) error {
@@ -360,6 +398,17 @@ func (b *Bot) handleShowAttendanceSubjectSelected(ctx context.Context, userID in
 		return err
 	}
 
+	text, err := b.buildStudentAttendanceText(studentID, subjectID)
+	if err != nil {
+		return err
+	}
+
+	keyboard := GetStudentKeyboard(b.MaxAPI)
+
+	return b.answerWithPhotoMarkdown(ctx, callbackID, text, b.attendanceHeatmapChart(ctx, studentID, subjectID), keyboard)
+}
+
+func (b *Bot) buildStudentAttendanceText(studentID, subjectID int64) (string, error) {
 	subjectName, err := b.subjectRepo.GetSubjectName(subjectID)
 	if err != nil {
 		b.logger.Errorf("Failed to get subject name: %v", err)
@@ -369,14 +418,10 @@ func (b *Bot) handleShowAttendanceSubjectSelected(ctx context.Context, userID in
 	attendance, err := b.attendanceRepo.GetAttendanceByStudentAndSubject(studentID, subjectID)
 	if err != nil {
 		b.logger.Errorf("Failed to get attendance: %v", err)
-		return err
+		return "", err
 	}
 
-	text := b.formatAttendanceList(attendance, subjectName)
-
-	keyboard := GetStudentKeyboard(b.MaxAPI)
-
-	return b.answerWithKeyboardMarkdown(ctx, callbackID, text, keyboard)
+	return b.formatAttendanceList(attendance, subjectName), nil
 }
 
 func (b *Bot) formatAttendanceList(attendance []database.Attendance, subjectName string) string {
@@ -415,7 +460,7 @@ func (b *Bot) formatAttendanceList(attendance []database.Attendance, subjectName
 	return sb.String()
 }
 
-func (b *Bot) notifyStudentAttendance(ctx context.Context, studentID, subjectID int64, subjectName string, attended bool, markTime time.Time) {
+func attendanceNotification(studentID, subjectID int64, subjectName string, attended bool, markTime time.Time) database.OutboxNotification {
 	dateStr := markTime.Add(3 * time.Hour).Format("02.01.2006 15:04")
 	statusEmoji := "✅ Был"
 	if !attended {
@@ -430,15 +475,11 @@ func (b *Bot) notifyStudentAttendance(ctx context.Context, studentID, subjectID
 		subjectName, dateStr, statusEmoji,
 	)
 
-	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
-	payload := fmt.Sprintf("show_attend_subj_%d", subjectID)
-	keyboard.AddRow().AddCallback("📊 Посмотреть статистику посещаемости", schemes.POSITIVE, payload)
-
-	studentMaxID, err := b.userRepo.GetUserMaxIDByID(studentID)
-	if err != nil {
-		b.logger.Warnf("Failed to get student max_id for attendance notification: %v", err)
-		return
+	return database.OutboxNotification{
+		UserID:        studentID,
+		Category:      categoryAttendance,
+		MessageText:   notificationText,
+		ButtonText:    "📊 Посмотреть статистику посещаемости",
+		ButtonPayload: fmt.Sprintf("show_attend_subj_%d", subjectID),
 	}
-
-	b.sendKeyboard(ctx, keyboard, studentMaxID, notificationText)
 }
@@ -3,6 +3,7 @@ package maxAPI
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	maxbot "github.com/max-messenger/max-bot-api-client-go"
@@ -22,6 +23,13 @@ type Bot struct {
 	processedMessages map[string]bool
 	uploadCounter     map[int64]int
 	lastMessageID     map[int64]string
+	pendingInputs     map[int64]string
+	bulkDrafts        map[int64]*bulkGradeDraft
+	announceDrafts    map[int64]*announcementDraft
+	scheduleDrafts    map[int64]*scheduleDraft
+	registrations     map[int64]int64
+	checkinFailures   map[checkinAttempt]int
+	checkinRotations  map[int64]bool
 	mu                sync.Mutex
 
 	userRepo       *database.UserRepository
@@ -31,6 +39,26 @@ type Bot struct {
 	scheduleRepo   *database.ScheduleRepository
 	gradeRepo      *database.GradeRepository
 	attendanceRepo *database.AttendanceRepository
+	assessmentRepo *database.AssessmentTypeRepository
+	ratingRuleRepo *database.RatingRuleRepository
+	settingsRepo   *database.UserSettingsRepository
+	holidayRepo    *database.HolidayRepository
+
+	outboxRepo       *database.OutboxRepository
+	announcementRepo *database.AnnouncementRepository
+	parentRepo       *database.ParentRepository
+	registrationRepo *database.RegistrationRepository
+	alertRepo        *database.AlertRepository
+	reportRepo       *database.ReportRepository
+	calendarRepo     *database.CalendarRepository
+	location         *time.Location
+
+	checkinPeriod time.Duration
+	checkinSecret []byte
+	alertRules    alertRules
+
+	calendarBaseURL string
+	apiToken        string
 }
 
 func NewBot(cfg *config.MaxConfig, log *logger.Logger, db *sqlx.DB, ctx context.Context) (*Bot, error) {
@@ -55,6 +83,13 @@ func NewBot(cfg *config.MaxConfig, log *logger.Logger, db *sqlx.DB, ctx context.
 		processedMessages: make(map[string]bool),
 		uploadCounter:     make(map[int64]int),
 		lastMessageID:     make(map[int64]string),
+		pendingInputs:     make(map[int64]string),
+		bulkDrafts:        make(map[int64]*bulkGradeDraft),
+		announceDrafts:    make(map[int64]*announcementDraft),
+		scheduleDrafts:    make(map[int64]*scheduleDraft),
+		registrations:     make(map[int64]int64),
+		checkinFailures:   make(map[checkinAttempt]int),
+		checkinRotations:  make(map[int64]bool),
 
 		userRepo:       database.NewUserRepository(db),
 		groupRepo:      database.NewGroupRepository(db),
@@ -63,6 +98,20 @@ func NewBot(cfg *config.MaxConfig, log *logger.Logger, db *sqlx.DB, ctx context.
 		scheduleRepo:   database.NewScheduleRepository(db),
 		gradeRepo:      database.NewGradeRepository(db),
 		attendanceRepo: database.NewAttendanceRepository(db),
+		assessmentRepo: database.NewAssessmentTypeRepository(db),
+		ratingRuleRepo: database.NewRatingRuleRepository(db),
+		settingsRepo:   database.NewUserSettingsRepository(db),
+		holidayRepo:    database.NewHolidayRepository(db),
+
+		outboxRepo:       database.NewOutboxRepository(db),
+		announcementRepo: database.NewAnnouncementRepository(db),
+		parentRepo:       database.NewParentRepository(db),
+		registrationRepo: database.NewRegistrationRepository(db),
+		alertRepo:        database.NewAlertRepository(db),
+		reportRepo:       database.NewReportRepository(db),
+		calendarRepo:     database.NewCalendarRepository(db),
+		location:         time.Local,
+		apiToken:         cfg.Token,
 	}, nil
 }
 
@@ -0,0 +1,553 @@
+package maxAPI
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	maxbot "github.com/max-messenger/max-bot-api-client-go"
+	"github.com/max-messenger/max-bot-api-client-go/schemes"
+
+	"digitalUniversity/database"
+	"digitalUniversity/grading"
+)
+
+const (
+	inputBulkGrades = "bulk_grades"
+
+	selectSubjectForBulkMsg = "Выберите предмет для выставления оценок группе:"
+	selectGroupForBulkMsg   = "Выберите группу:"
+	selectLessonForBulkMsg  = "Выберите занятие:"
+	selectAssessForBulkMsg  = "Выберите тип работы:"
+	selectBulkModeMsg       = "Занятие: **%s**, тип работы: **%s**, шкала: %s.\n\nКак выставить оценки?"
+	bulkStepMsg             = "Студент %d из %d: **%s**\n%s\nВыберите оценку:"
+	bulkStepCurrentMsg      = "Текущая оценка: **%s**\n"
+	bulkTextPromptMsg       = "Отправьте список в формате «Фамилия оценка» — по одному студенту в строке.\n" +
+		"Если в группе есть однофамильцы, укажите и имя: «Фамилия Имя оценка».\n\nДопустимые оценки: %s"
+	bulkSummaryHeader    = "📋 **Проверьте оценки перед сохранением**\n%s, %s\n\n"
+	bulkSummaryEntry     = "%d. %s — **%s**\n"
+	bulkSummaryNoGrades  = "Оценки пока не выбраны.\n"
+	bulkSummarySkipped   = "\nБез оценки: %d студент(ов)\n"
+	bulkSummaryUnmatched = "\n⚠️ Не распознаны строки:\n%s"
+	bulkSavedMsg         = "✅ Сохранено оценок: **%d**."
+	bulkCancelledMsg     = "Выставление оценок отменено."
+	bulkExpiredMsg       = "Сеанс выставления оценок устарел. Начните заново."
+	bulkNothingToSaveMsg = "Нет оценок для сохранения."
+
+	btnBulkStepMode = "По списку группы"
+	btnBulkTextMode = "Вставить списком"
+	btnBulkSkip     = "Пропустить →"
+	btnBulkPrev     = "← Предыдущий"
+	btnBulkFinish   = "Завершить"
+	btnBulkSave     = "💾 Сохранить"
+	btnBulkEdit     = "✏️ Пройти по списку"
+	btnBulkCancel   = "❌ Отменить"
+)
+
+type bulkGradeDraft struct {
+	subjectID        int64
+	groupID          int64
+	scheduleID       int64
+	assessmentTypeID int64
+	students         []database.User
+	values           map[int64]int
+	unmatched        []string
+}
+
+func (b *Bot) handleBulkGradeStart(ctx context.Context, userID int64, callbackID string) error {
+	teacherID, err := b.userRepo.GetUserIDByMaxID(userID)
+	if err != nil {
+		b.logger.Errorf("Failed to get teacher ID: %v", err)
+		return err
+	}
+
+	subjects, err := b.gradeRepo.GetSubjectsByTeacher(teacherID)
+	if err != nil {
+		b.logger.Errorf("Failed to get subjects for teacher %d: %v", teacherID, err)
+		return err
+	}
+
+	if len(subjects) == 0 {
+		return b.answerCallbackWithNotification(ctx, callbackID, noSubjectsMsg)
+	}
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	for _, subject := range subjects {
+		payload := fmt.Sprintf("bulk_subj_%d", subject.SubjectID)
+		keyboard.AddRow().AddCallback(subject.SubjectName, schemes.DEFAULT, payload)
+	}
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+
+	return b.answerWithKeyboard(ctx, callbackID, selectSubjectForBulkMsg, keyboard)
+}
+
+func (b *Bot) handleBulkGradeCallback(ctx context.Context, userID int64, callbackID, payload string) error {
+	parts := strings.Split(payload, "_")
+	if len(parts) < 2 {
+		return fmt.Errorf("invalid bulk grade callback payload: %s", payload)
+	}
+
+	switch parts[1] {
+	case "subj":
+		return b.handleBulkSubjectSelected(ctx, userID, callbackID, payload)
+	case "grp":
+		return b.handleBulkGroupSelected(ctx, userID, callbackID, payload)
+	case "sch":
+		return b.handleBulkLessonSelected(ctx, userID, callbackID, payload)
+	case "asm":
+		return b.handleBulkAssessmentSelected(ctx, userID, callbackID, payload)
+	case "step":
+		return b.handleBulkStep(ctx, userID, callbackID, payload)
+	case "set":
+		return b.handleBulkValueSet(ctx, userID, callbackID, payload)
+	case "text":
+		return b.handleBulkTextMode(ctx, userID, callbackID)
+	case "sum":
+		return b.handleBulkSummary(ctx, userID, callbackID)
+	case "save":
+		return b.handleBulkSave(ctx, userID, callbackID)
+	case "cancel":
+		return b.handleBulkCancel(ctx, userID, callbackID)
+	default:
+		return fmt.Errorf("unknown bulk grade callback type: %s", parts[1])
+	}
+}
+
+func (b *Bot) handleBulkSubjectSelected(ctx context.Context, userID int64, callbackID, payload string) error {
+	var subjectID int64
+	fmt.Sscanf(payload, "bulk_subj_%d", &subjectID)
+
+	teacherID, err := b.userRepo.GetUserIDByMaxID(userID)
+	if err != nil {
+		return err
+	}
+
+	groups, err := b.gradeRepo.GetGroupsBySubjectAndTeacher(subjectID, teacherID)
+	if err != nil {
+		b.logger.Errorf("Failed to get groups: %v", err)
+		return err
+	}
+
+	if len(groups) == 0 {
+		return b.answerCallbackWithNotification(ctx, callbackID, noGroupsMsg)
+	}
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	for _, group := range groups {
+		payload := fmt.Sprintf("bulk_grp_%d_%d", subjectID, group.GroupID)
+		keyboard.AddRow().AddCallback(group.GroupName, schemes.DEFAULT, payload)
+	}
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+
+	return b.answerWithKeyboard(ctx, callbackID, selectGroupForBulkMsg, keyboard)
+}
+
+func (b *Bot) handleBulkGroupSelected(ctx context.Context, _ int64, callbackID, payload string) error {
+	var subjectID, groupID int64
+	fmt.Sscanf(payload, "bulk_grp_%d_%d", &subjectID, &groupID)
+
+	schedules, err := b.gradeRepo.GetScheduleBySubjectAndGroup(subjectID, groupID)
+	if err != nil {
+		b.logger.Errorf("Failed to get schedules: %v", err)
+		return err
+	}
+
+	if len(schedules) == 0 {
+		return b.answerCallbackWithNotification(ctx, callbackID, noScheduleMsg)
+	}
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	for _, schedule := range schedules {
+		btnText := fmt.Sprintf("%s %s", b.getWeekdayName(schedule.Weekday), schedule.StartTime.Format(timeFormat))
+		payload := fmt.Sprintf("bulk_sch_%d_%d", schedule.ScheduleID, groupID)
+		keyboard.AddRow().AddCallback(btnText, schemes.DEFAULT, payload)
+	}
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+
+	return b.answerWithKeyboard(ctx, callbackID, selectLessonForBulkMsg, keyboard)
+}
+
+func (b *Bot) handleBulkLessonSelected(ctx context.Context, _ int64, callbackID, payload string) error {
+	var scheduleID, groupID int64
+	fmt.Sscanf(payload, "bulk_sch_%d_%d", &scheduleID, &groupID)
+
+	subjectID, err := b.gradeRepo.GetSubjectIDByScheduleID(scheduleID)
+	if err != nil {
+		b.logger.Errorf("Failed to get subject_id: %v", err)
+		return err
+	}
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	for _, assessmentType := range b.getAssessmentTypes(subjectID) {
+		payload := fmt.Sprintf("bulk_asm_%d_%d_%d", scheduleID, groupID, assessmentType.AssessmentTypeID)
+		keyboard.AddRow().AddCallback(assessmentType.Title, schemes.DEFAULT, payload)
+	}
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+
+	return b.answerWithKeyboard(ctx, callbackID, selectAssessForBulkMsg, keyboard)
+}
+
+func (b *Bot) handleBulkAssessmentSelected(ctx context.Context, userID int64, callbackID, payload string) error {
+	var scheduleID, groupID, assessmentTypeID int64
+	fmt.Sscanf(payload, "bulk_asm_%d_%d_%d", &scheduleID, &groupID, &assessmentTypeID)
+
+	subjectID, err := b.gradeRepo.GetSubjectIDByScheduleID(scheduleID)
+	if err != nil {
+		b.logger.Errorf("Failed to get subject_id: %v", err)
+		return err
+	}
+
+	students, err := b.gradeRepo.GetStudentsByGroup(groupID)
+	if err != nil {
+		b.logger.Errorf("Failed to get students: %v", err)
+		return err
+	}
+
+	if len(students) == 0 {
+		return b.answerCallbackWithNotification(ctx, callbackID, noStudentsMsg)
+	}
+
+	draft := &bulkGradeDraft{
+		subjectID:        subjectID,
+		groupID:          groupID,
+		scheduleID:       scheduleID,
+		assessmentTypeID: assessmentTypeID,
+		students:         students,
+		values:           make(map[int64]int),
+	}
+
+	b.mu.Lock()
+	b.bulkDrafts[userID] = draft
+	b.mu.Unlock()
+
+	text := fmt.Sprintf(selectBulkModeMsg, b.describeBulkLesson(draft), b.getAssessmentTitle(subjectID, assessmentTypeID), b.getSubjectScale(subjectID).Title)
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	keyboard.AddRow().AddCallback(btnBulkStepMode, schemes.POSITIVE, "bulk_step_0")
+	keyboard.AddRow().AddCallback(btnBulkTextMode, schemes.DEFAULT, "bulk_text")
+	keyboard.AddRow().AddCallback(btnBulkCancel, schemes.NEGATIVE, "bulk_cancel")
+
+	return b.answerWithKeyboardMarkdown(ctx, callbackID, text, keyboard)
+}
+
+func (b *Bot) handleBulkStep(ctx context.Context, userID int64, callbackID, payload string) error {
+	var index int
+	fmt.Sscanf(payload, "bulk_step_%d", &index)
+
+	draft := b.getBulkDraft(userID)
+	if draft == nil {
+		return b.answerCallbackWithNotification(ctx, callbackID, bulkExpiredMsg)
+	}
+
+	return b.showBulkStep(ctx, callbackID, draft, index)
+}
+
+func (b *Bot) showBulkStep(ctx context.Context, callbackID string, draft *bulkGradeDraft, index int) error {
+	if index < 0 {
+		index = 0
+	}
+	if index >= len(draft.students) {
+		return b.answerWithKeyboardMarkdown(ctx, callbackID, b.formatBulkSummary(draft), b.bulkSummaryKeyboard())
+	}
+
+	student := draft.students[index]
+	scale := b.getSubjectScale(draft.subjectID)
+
+	b.mu.Lock()
+	value, graded := draft.values[student.UserID]
+	b.mu.Unlock()
+
+	current := ""
+	if graded {
+		current = fmt.Sprintf(bulkStepCurrentMsg, scale.Label(value))
+	}
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	addGradeValueRows(keyboard, scale, func(value int) string {
+		return fmt.Sprintf("bulk_set_%d_%d", index, value)
+	})
+
+	nav := keyboard.AddRow()
+	if index > 0 {
+		nav.AddCallback(btnBulkPrev, schemes.NEGATIVE, fmt.Sprintf("bulk_step_%d", index-1))
+	}
+	nav.AddCallback(btnBulkSkip, schemes.NEGATIVE, fmt.Sprintf("bulk_step_%d", index+1))
+	keyboard.AddRow().AddCallback(btnBulkFinish, schemes.POSITIVE, "bulk_sum")
+	keyboard.AddRow().AddCallback(btnBulkCancel, schemes.NEGATIVE, "bulk_cancel")
+
+	text := fmt.Sprintf(bulkStepMsg, index+1, len(draft.students), student.Name, current)
+	return b.answerWithKeyboardMarkdown(ctx, callbackID, text, keyboard)
+}
+
+func (b *Bot) handleBulkValueSet(ctx context.Context, userID int64, callbackID, payload string) error {
+	var index, value int
+	fmt.Sscanf(payload, "bulk_set_%d_%d", &index, &value)
+
+	draft := b.getBulkDraft(userID)
+	if draft == nil || index < 0 || index >= len(draft.students) {
+		return b.answerCallbackWithNotification(ctx, callbackID, bulkExpiredMsg)
+	}
+
+	if !b.getSubjectScale(draft.subjectID).Contains(value) {
+		return b.answerCallbackWithNotification(ctx, callbackID, invalidGradeMsg)
+	}
+
+	b.mu.Lock()
+	draft.values[draft.students[index].UserID] = value
+	b.mu.Unlock()
+
+	return b.showBulkStep(ctx, callbackID, draft, index+1)
+}
+
+func (b *Bot) handleBulkTextMode(ctx context.Context, userID int64, callbackID string) error {
+	draft := b.getBulkDraft(userID)
+	if draft == nil {
+		return b.answerCallbackWithNotification(ctx, callbackID, bulkExpiredMsg)
+	}
+
+	b.setPendingInput(userID, inputBulkGrades)
+
+	scale := b.getSubjectScale(draft.subjectID)
+	labels := make([]string, 0, len(scale.Values()))
+	for _, value := range scale.Values() {
+		labels = append(labels, scale.Label(value))
+	}
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	keyboard.AddRow().AddCallback(btnBulkCancel, schemes.NEGATIVE, "bulk_cancel")
+
+	return b.answerWithKeyboard(ctx, callbackID, fmt.Sprintf(bulkTextPromptMsg, strings.Join(labels, ", ")), keyboard)
+}
+
+func (b *Bot) handleBulkGradesText(ctx context.Context, userID int64, text string) error {
+	draft := b.getBulkDraft(userID)
+	if draft == nil {
+		return b.sendMessage(ctx, userID, bulkExpiredMsg)
+	}
+
+	values, unmatched := parseBulkGrades(text, draft.students, b.getSubjectScale(draft.subjectID))
+
+	b.mu.Lock()
+	for studentID, value := range values {
+		draft.values[studentID] = value
+	}
+	draft.unmatched = unmatched
+	b.mu.Unlock()
+
+	b.sendKeyboard(ctx, b.bulkSummaryKeyboard(), userID, b.formatBulkSummary(draft))
+	return nil
+}
+
+func (b *Bot) handleBulkSummary(ctx context.Context, userID int64, callbackID string) error {
+	draft := b.getBulkDraft(userID)
+	if draft == nil {
+		return b.answerCallbackWithNotification(ctx, callbackID, bulkExpiredMsg)
+	}
+
+	return b.answerWithKeyboardMarkdown(ctx, callbackID, b.formatBulkSummary(draft), b.bulkSummaryKeyboard())
+}
+
+func (b *Bot) handleBulkSave(ctx context.Context, userID int64, callbackID string) error {
+	draft := b.getBulkDraft(userID)
+	if draft == nil {
+		return b.answerCallbackWithNotification(ctx, callbackID, bulkExpiredMsg)
+	}
+
+	b.mu.Lock()
+	values := make(map[int64]int, len(draft.values))
+	for studentID, value := range draft.values {
+		values[studentID] = value
+	}
+	b.mu.Unlock()
+
+	if len(values) == 0 {
+		return b.answerCallbackWithNotification(ctx, callbackID, bulkNothingToSaveMsg)
+	}
+
+	teacherID, err := b.userRepo.GetUserIDByMaxID(userID)
+	if err != nil {
+		return err
+	}
+
+	assessmentTypeID := draft.assessmentTypeID
+	grades := make([]database.Grade, 0, len(values))
+	for _, student := range draft.students {
+		value, ok := values[student.UserID]
+		if !ok {
+			continue
+		}
+		grades = append(grades, database.Grade{
+			StudentID:        student.UserID,
+			TeacherID:        teacherID,
+			SubjectID:        draft.subjectID,
+			ScheduleID:       draft.scheduleID,
+			AssessmentTypeID: &assessmentTypeID,
+			GradeValue:       value,
+		})
+	}
+
+	scale := b.getSubjectScale(draft.subjectID)
+	subjectName := b.getSubjectName(draft.subjectID)
+	assessmentTitle := b.getAssessmentTitle(draft.subjectID, draft.assessmentTypeID)
+
+	err = b.inTx(func(tx *sqlx.Tx) error {
+		if err := b.gradeRepo.CreateGrades(tx, grades); err != nil {
+			return err
+		}
+		for _, grade := range grades {
+			notification := gradeNotification(grade.StudentID, draft.subjectID, subjectName, assessmentTitle, scale.Label(grade.GradeValue))
+			if _, err := b.enqueueStudentNotification(tx, notification); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		b.logger.Errorf("Failed to save bulk grades: %v", err)
+		return b.answerCallbackWithNotification(ctx, callbackID, gradeSaveErrorMsg)
+	}
+
+	b.clearBulkDraft(userID)
+
+	studentIDs := make([]int64, 0, len(grades))
+	for _, grade := range grades {
+		studentIDs = append(studentIDs, grade.StudentID)
+	}
+	go b.checkAlerts(draft.subjectID, studentIDs...)
+
+	b.logger.Infof("Teacher %d saved %d grades for schedule %d", teacherID, len(grades), draft.scheduleID)
+
+	text := fmt.Sprintf(bulkSavedMsg, len(grades))
+	return b.answerWithKeyboardAndNotification(ctx, callbackID, text, GetTeacherKeyboard(b.MaxAPI), "Оценки сохранены!")
+}
+
+func (b *Bot) handleBulkCancel(ctx context.Context, userID int64, callbackID string) error {
+	b.clearBulkDraft(userID)
+	return b.answerWithKeyboard(ctx, callbackID, bulkCancelledMsg, GetTeacherKeyboard(b.MaxAPI))
+}
+
+func (b *Bot) getBulkDraft(userID int64) *bulkGradeDraft {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.bulkDrafts[userID]
+}
+
+func (b *Bot) clearBulkDraft(userID int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.bulkDrafts, userID)
+	if b.pendingInputs[userID] == inputBulkGrades {
+		delete(b.pendingInputs, userID)
+	}
+}
+
+func (b *Bot) bulkSummaryKeyboard() *maxbot.Keyboard {
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	keyboard.AddRow().AddCallback(btnBulkSave, schemes.POSITIVE, "bulk_save")
+	keyboard.AddRow().AddCallback(btnBulkEdit, schemes.DEFAULT, "bulk_step_0")
+	keyboard.AddRow().AddCallback(btnBulkCancel, schemes.NEGATIVE, "bulk_cancel")
+	return keyboard
+}
+
+func (b *Bot) describeBulkLesson(draft *bulkGradeDraft) string {
+	groupName := b.getGroupName(draft.groupID)
+
+	schedule, err := b.scheduleRepo.GetScheduleByID(draft.scheduleID)
+	if err != nil {
+		b.logger.Errorf("Failed to get schedule %d: %v", draft.scheduleID, err)
+		return groupName
+	}
+
+	return fmt.Sprintf("%s, %s %s", groupName, b.getWeekdayName(schedule.Weekday), schedule.StartTime.Format(timeFormat))
+}
+
+func (b *Bot) formatBulkSummary(draft *bulkGradeDraft) string {
+	b.mu.Lock()
+	values := make(map[int64]int, len(draft.values))
+	for studentID, value := range draft.values {
+		values[studentID] = value
+	}
+	unmatched := append([]string(nil), draft.unmatched...)
+	b.mu.Unlock()
+
+	scale := b.getSubjectScale(draft.subjectID)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, bulkSummaryHeader, b.getSubjectName(draft.subjectID), b.describeBulkLesson(draft))
+
+	n := 0
+	for _, student := range draft.students {
+		value, ok := values[student.UserID]
+		if !ok {
+			continue
+		}
+		n++
+		fmt.Fprintf(&sb, bulkSummaryEntry, n, student.Name, scale.Label(value))
+	}
+
+	if n == 0 {
+		sb.WriteString(bulkSummaryNoGrades)
+	}
+
+	if skipped := len(draft.students) - n; skipped > 0 && n > 0 {
+		fmt.Fprintf(&sb, bulkSummarySkipped, skipped)
+	}
+
+	if len(unmatched) > 0 {
+		fmt.Fprintf(&sb, bulkSummaryUnmatched, "• "+strings.Join(unmatched, "\n• "))
+	}
+
+	return sb.String()
+}
+
+// parseBulkGrades reads lines of the form "Фамилия [Имя] оценка" and matches
+// them against the group roster. Lines that cannot be matched unambiguously or
+// carry a value outside the scale are returned as unmatched.
+func parseBulkGrades(text string, students []database.User, scale grading.Scale) (map[int64]int, []string) {
+	values := make(map[int64]int)
+	var unmatched []string
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			unmatched = append(unmatched, line)
+			continue
+		}
+
+		value, ok := scale.ParseValue(strings.ToLower(fields[len(fields)-1]))
+		if !ok {
+			value, ok = scale.ParseValue(strings.ToUpper(fields[len(fields)-1]))
+		}
+		if !ok {
+			unmatched = append(unmatched, line)
+			continue
+		}
+
+		names := fields[:len(fields)-1]
+		var candidates []database.User
+		for _, student := range students {
+			if !strings.EqualFold(student.LastName, names[0]) {
+				continue
+			}
+			if len(names) > 1 && !strings.EqualFold(student.FirstName, names[1]) {
+				continue
+			}
+			candidates = append(candidates, student)
+		}
+
+		if len(candidates) != 1 {
+			unmatched = append(unmatched, line)
+			continue
+		}
+
+		values[candidates[0].UserID] = value
+	}
+
+	return values, unmatched
+}
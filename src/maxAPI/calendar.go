@@ -0,0 +1,248 @@
+package maxAPI
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/max-messenger/max-bot-api-client-go/schemes"
+
+	"digitalUniversity/config"
+	"digitalUniversity/database"
+	"digitalUniversity/ical"
+	"digitalUniversity/services"
+)
+
+const (
+	calendarForbiddenMsg = "Календарь доступен студентам и преподавателям."
+	calendarNoGroupMsg   = "Вы не привязаны к группе."
+	calendarFailedMsg    = "Не удалось подготовить календарь. Попробуйте позже."
+	calendarFileMsg      = "📅 **Расписание для календаря**\n\n" +
+		"Откройте файл в приложении календаря, чтобы импортировать занятия."
+	calendarFeedMsg = "\n\n🔗 Ссылка для подписки:\n%s\n\n" +
+		"Добавьте её в календарь как подписку по URL — изменения расписания появятся сами. " +
+		"Не пересылайте ссылку: по ней видно ваше расписание."
+	calendarResetMsg = "Старая ссылка больше не работает."
+
+	btnCalendarReset = "🔄 Новая ссылка"
+
+	payloadCalendarReset = "ics_reset"
+
+	calendarPath     = "/calendar/"
+	calendarFileName = "schedule.ics"
+	// calendarHolidayHorizon is how far ahead holidays are excluded from the
+	// weekly lessons.
+	calendarHolidayHorizon = 1
+	calendarShutdownDelay  = 5 * time.Second
+)
+
+// StartCalendarServer serves the calendar feeds over HTTP so calendar apps
+// can subscribe to a timetable. The server stops with ctx.
+func (b *Bot) StartCalendarServer(ctx context.Context, cfg *config.CalendarConfig) {
+	b.calendarBaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	if cfg.Addr == "" {
+		b.logger.Infof("Calendar server is disabled")
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+calendarPath+"{token}", b.serveCalendarFeed)
+	server := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), calendarShutdownDelay)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	go func() {
+		b.logger.Infof("Calendar server listening on %s", cfg.Addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			b.logger.Errorf("Calendar server stopped: %v", err)
+		}
+	}()
+}
+
+func (b *Bot) serveCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimSuffix(r.PathValue("token"), ".ics")
+
+	owner, err := b.calendarRepo.GetOwnerByToken(token)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		b.logger.Errorf("Failed to get calendar feed owner: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	calendar, err := b.buildCalendar(owner)
+	if err != nil {
+		b.logger.Errorf("Failed to build calendar for user %d: %v", owner.UserID, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="schedule.ics"`)
+	_, _ = w.Write(calendar)
+}
+
+func (b *Bot) handleCalendarCallback(ctx context.Context, userID int64, callbackID, payload string) error {
+	owner, err := b.calendarRepo.GetOwner(userID)
+	if err != nil {
+		return err
+	}
+	if owner.RoleName != "student" && owner.RoleName != "teacher" {
+		return b.answerCallbackWithNotification(ctx, callbackID, calendarForbiddenMsg)
+	}
+	if owner.RoleName == "student" && owner.GroupID == nil {
+		return b.answerCallbackWithNotification(ctx, callbackID, calendarNoGroupMsg)
+	}
+
+	switch payload {
+	case payloadCalendar:
+		return b.sendCalendar(ctx, callbackID, owner, false)
+	case payloadCalendarReset:
+		return b.sendCalendar(ctx, callbackID, owner, true)
+	default:
+		return fmt.Errorf("unknown calendar callback: %s", payload)
+	}
+}
+
+// sendCalendar answers with the calendar file and, when the feed server has a
+// public address, the subscription link. reset replaces the link first.
+func (b *Bot) sendCalendar(ctx context.Context, callbackID string, owner *database.CalendarOwner, reset bool) error {
+	calendar, err := b.buildCalendar(owner)
+	if err != nil {
+		b.logger.Errorf("Failed to build calendar for user %d: %v", owner.UserID, err)
+		return b.answerCallbackWithNotification(ctx, callbackID, calendarFailedMsg)
+	}
+
+	file, err := b.uploadNamedFile(ctx, calendarFileName, calendar)
+	if err != nil {
+		b.logger.Errorf("Failed to upload calendar: %v", err)
+		return b.answerCallbackWithNotification(ctx, callbackID, calendarFailedMsg)
+	}
+
+	text := calendarFileMsg
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	if b.calendarBaseURL != "" {
+		link, err := b.calendarFeedURL(owner.UserID, reset)
+		if err != nil {
+			return err
+		}
+		if reset {
+			text = calendarResetMsg + "\n\n" + text
+		}
+		text += fmt.Sprintf(calendarFeedMsg, link)
+		keyboard.AddRow().AddCallback(btnCalendarReset, schemes.DEFAULT, payloadCalendarReset)
+	}
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+
+	return b.answerWithFileMarkdown(ctx, callbackID, text, file, keyboard)
+}
+
+func (b *Bot) calendarFeedURL(userID int64, reset bool) (string, error) {
+	token, err := services.GenerateFeedToken()
+	if err != nil {
+		return "", err
+	}
+
+	if reset {
+		err = b.calendarRepo.ResetFeedToken(userID, token)
+	} else {
+		token, err = b.calendarRepo.EnsureFeedToken(userID, token)
+	}
+	if err != nil {
+		return "", err
+	}
+	return b.calendarBaseURL + calendarPath + token + ".ics", nil
+}
+
+// buildCalendar renders the owner's timetable as weekly events starting this
+// week. Holidays within a year are excluded, so a feed refreshed by the
+// calendar app keeps up with the holidays file.
+func (b *Bot) buildCalendar(owner *database.CalendarOwner) ([]byte, error) {
+	var groupID, teacherID int64
+	name := owner.Name
+	if owner.RoleName == "teacher" {
+		teacherID = owner.UserID
+	} else if owner.GroupID != nil {
+		groupID = *owner.GroupID
+		name = b.getGroupName(groupID)
+	} else {
+		return nil, errors.New("calendar owner has no group")
+	}
+
+	lessons, err := b.scheduleRepo.GetCalendarLessons(groupID, teacherID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().In(b.location)
+	monday := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, b.location).AddDate(0, 0, 1-int(isoWeekday(now)))
+	holidays, err := b.holidayRepo.GetHolidays(monday, monday.AddDate(calendarHolidayHorizon, 0, 0))
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]ical.Event, 0, len(lessons))
+	for _, lesson := range lessons {
+		summary := lesson.SubjectName
+		if teacherID != 0 {
+			summary += ", " + lesson.GroupName
+		}
+
+		day := monday.AddDate(0, 0, int(lesson.Weekday)-1)
+		event := ical.Event{
+			UID:         fmt.Sprintf("lesson-%d@digitalUniversity", lesson.ScheduleID),
+			Summary:     summary,
+			Location:    lesson.ClassRoom,
+			Description: calendarDescription(lesson, teacherID != 0),
+			Start:       atClock(day, lesson.StartTime),
+			End:         atClock(day, lesson.EndTime),
+			Weekly:      true,
+		}
+		for _, holiday := range holidays {
+			if isoWeekday(holiday) == lesson.Weekday {
+				date := time.Date(holiday.Year(), holiday.Month(), holiday.Day(), 0, 0, 0, 0, b.location)
+				event.ExDates = append(event.ExDates, atClock(date, lesson.StartTime))
+			}
+		}
+		events = append(events, event)
+	}
+
+	return ical.Bytes(ical.Calendar{
+		Name:     "Расписание: " + name,
+		Location: b.location,
+		Events:   events,
+	})
+}
+
+// calendarDescription names the lesson type and, depending on whose
+// calendar it is, the teacher or the group.
+func calendarDescription(lesson database.ScheduleLesson, forTeacher bool) string {
+	lines := []string{"Тип занятия: " + lesson.TypeName}
+	if forTeacher {
+		lines = append(lines, "Группа: "+lesson.GroupName)
+	} else {
+		lines = append(lines, "Преподаватель: "+lesson.TeacherName)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// atClock returns the day at the hour and minute of clock.
+func atClock(day, clock time.Time) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, day.Location())
+}
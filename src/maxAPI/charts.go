@@ -0,0 +1,137 @@
+package maxAPI
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/max-messenger/max-bot-api-client-go/schemes"
+
+	"digitalUniversity/charts"
+	"digitalUniversity/database"
+	"digitalUniversity/grading"
+)
+
+const (
+	// chartTimelineGrades is how many latest grades the timeline shows.
+	chartTimelineGrades = 40
+	// chartHistogramBuckets is the most bars a histogram gets before values
+	// are grouped into ranges of chartHistogramBucketSize.
+	chartHistogramBuckets    = 11
+	chartHistogramBucketSize = 10
+)
+
+// uploadChart renders a chart and uploads it as a photo. It returns nil when
+// there is nothing to draw or the upload fails, so the caller can fall back
+// to sending the text alone.
+func (b *Bot) uploadChart(ctx context.Context, name string, image []byte, err error) *schemes.PhotoTokens {
+	if errors.Is(err, charts.ErrNoData) {
+		return nil
+	}
+	if err != nil {
+		b.logger.Warnf("Failed to render %s chart: %v", name, err)
+		return nil
+	}
+
+	photo, err := b.MaxAPI.Uploads.UploadPhotoFromReader(ctx, bytes.NewReader(image))
+	if err != nil {
+		b.logger.Warnf("Failed to upload %s chart: %v", name, err)
+		return nil
+	}
+	return photo
+}
+
+// gradeTimelineChart draws the student's grades in a subject from the oldest
+// to the latest.
+func (b *Bot) gradeTimelineChart(ctx context.Context, studentID, subjectID int64) *schemes.PhotoTokens {
+	grades, err := b.gradeRepo.GetGradesByStudentAndSubject(studentID, subjectID)
+	if err != nil {
+		b.logger.Warnf("Failed to get grades for chart: %v", err)
+		return nil
+	}
+
+	grades = grades[:min(len(grades), chartTimelineGrades)]
+	values := make([]float64, len(grades))
+	for i, grade := range grades {
+		values[len(grades)-1-i] = float64(grade.GradeValue)
+	}
+
+	scale := b.getSubjectScale(subjectID)
+	image, err := charts.Timeline(values, float64(scale.Min), float64(scale.Max), float64(scale.PassValue))
+	return b.uploadChart(ctx, "grade timeline", image, err)
+}
+
+// attendanceHeatmapChart draws the student's attendance in a subject by
+// weeks. A day with both attended and missed lessons is shown as mixed.
+func (b *Bot) attendanceHeatmapChart(ctx context.Context, studentID, subjectID int64) *schemes.PhotoTokens {
+	attendance, err := b.attendanceRepo.GetAttendanceByStudentAndSubject(studentID, subjectID)
+	if err != nil {
+		b.logger.Warnf("Failed to get attendance for chart: %v", err)
+		return nil
+	}
+
+	days := make(map[time.Time]charts.DayMark)
+	for _, att := range attendance {
+		day := time.Date(att.LessonDate.Year(), att.LessonDate.Month(), att.LessonDate.Day(), 0, 0, 0, 0, time.UTC)
+		mark := charts.DayAbsent
+		if att.Attended {
+			mark = charts.DayPresent
+		}
+		if prev, ok := days[day]; ok && prev != mark {
+			mark = charts.DayMixed
+		}
+		days[day] = mark
+	}
+
+	image, err := charts.Heatmap(days)
+	return b.uploadChart(ctx, "attendance heatmap", image, err)
+}
+
+// gradeDistributionChart draws how many grades of each value the group got
+// in a subject.
+func (b *Bot) gradeDistributionChart(ctx context.Context, subjectID, groupID int64) *schemes.PhotoTokens {
+	distribution, err := b.gradeRepo.GetGradeDistribution(subjectID, groupID)
+	if err != nil {
+		b.logger.Warnf("Failed to get grade distribution for chart: %v", err)
+		return nil
+	}
+
+	image, err := charts.Histogram(histogramBars(b.getSubjectScale(subjectID), distribution))
+	return b.uploadChart(ctx, "grade distribution", image, err)
+}
+
+// histogramBars has a bar for every value of a short scale, labelled the
+// way the scale shows it where the chart font allows. Long scales such as
+// the hundred-point one are grouped into ranges labelled by their lower
+// bound, the top value joining the last range.
+func histogramBars(scale grading.Scale, distribution []database.GradeCount) []charts.Bar {
+	counts := make(map[int]int)
+	for _, c := range distribution {
+		counts[c.GradeValue] += c.Count
+	}
+
+	if scale.Max-scale.Min < chartHistogramBuckets {
+		bars := make([]charts.Bar, 0, scale.Max-scale.Min+1)
+		for v := scale.Min; v <= scale.Max; v++ {
+			label := scale.Label(v)
+			if !charts.CanRender(label) {
+				label = fmt.Sprintf("%d", v)
+			}
+			bars = append(bars, charts.Bar{Label: label, Count: counts[v]})
+		}
+		return bars
+	}
+
+	buckets := max((scale.Max-scale.Min)/chartHistogramBucketSize, 1)
+	bars := make([]charts.Bar, buckets)
+	for i := range bars {
+		bars[i].Label = fmt.Sprintf("%d", scale.Min+i*chartHistogramBucketSize)
+	}
+	for v, count := range counts {
+		i := min(max(v-scale.Min, 0)/chartHistogramBucketSize, buckets-1)
+		bars[i].Count += count
+	}
+	return bars
+}
@@ -0,0 +1,503 @@
+package maxAPI
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	maxbot "github.com/max-messenger/max-bot-api-client-go"
+	"github.com/max-messenger/max-bot-api-client-go/schemes"
+
+	"digitalUniversity/config"
+	"digitalUniversity/database"
+	"digitalUniversity/qrcode"
+)
+
+const (
+	checkinSelectLessonMsg = "Выберите сегодняшнее занятие для отметки по коду:"
+	checkinNoLessonsMsg    = "Сегодня у вас нет занятий."
+	checkinWrongLessonMsg  = "Отметку по коду можно начать только для своего сегодняшнего занятия."
+	checkinSessionMsg      = "📲 **Отметка по коду**\n%s, группа %s, %s–%s\n\nКод: **%s**\n\nСтуденты отправляют код боту сообщением во время занятия. Код меняется каждые %s, бот присылает новый код автоматически.\n\nОтметились: **%d** из **%d**"
+	checkinClosedMsg       = "⏹ Отметка по коду завершена.\n\nПрисутствовали: **%d**\nОтмечены отсутствующими: **%d**"
+	checkinAlreadyClosed   = "Отметка по коду уже завершена."
+	checkinForbiddenMsg    = "Эта отметка принадлежит другому преподавателю."
+
+	checkinMarkedMsg      = "✅ Вы отмечены на занятии **%s**."
+	checkinAlreadyMsg     = "Вы уже отмечены на занятии %s."
+	checkinInvalidMsg     = "❌ Код неверный или устарел. Попросите преподавателя показать актуальный код."
+	checkinNoSessionMsg   = "Сейчас для вашей группы нет открытой отметки по коду."
+	checkinOutOfWindowMsg = "Отметиться по коду можно только во время занятия."
+	checkinBlockedMsg     = "Слишком много неверных кодов. Обратитесь к преподавателю."
+	checkinErrorMsg       = "Не удалось отметить посещаемость. Попробуйте ещё раз."
+
+	btnCheckinRefresh = "🔄 Обновить код"
+	btnCheckinClose   = "⏹ Завершить и отметить остальных"
+
+	checkinCodeDigits  = 6
+	checkinEarlyStart  = 10 * time.Minute
+	checkinMaxFailures = 5
+	checkinQRScale     = 10
+)
+
+type checkinAttempt struct {
+	sessionID int64
+	userID    int64
+}
+
+// ConfigureCheckin sets how often check-in codes change and the secret they
+// are derived from.
+func (b *Bot) ConfigureCheckin(cfg *config.CheckinConfig) {
+	b.checkinPeriod = cfg.CodePeriod
+	if b.checkinPeriod < time.Second {
+		b.checkinPeriod = 30 * time.Second
+	}
+
+	b.checkinSecret = []byte(cfg.Secret)
+	if len(b.checkinSecret) == 0 {
+		b.checkinSecret = make([]byte, 32)
+		if _, err := rand.Read(b.checkinSecret); err != nil {
+			b.logger.Errorf("Failed to generate check-in secret: %v", err)
+		}
+		b.logger.Warnf("CHECKIN_SECRET is not set, check-in codes will change after restart")
+	}
+
+	b.logger.Infof("Check-in codes rotate every %s", b.checkinPeriod)
+}
+
+// checkinCode derives the session's code for the period. Codes are not
+// stored: the bot recomputes them when a student sends one.
+func (b *Bot) checkinCode(sessionID, period int64) string {
+	mac := hmac.New(sha256.New, b.checkinSecret)
+	fmt.Fprintf(mac, "%d:%d", sessionID, period)
+	sum := binary.BigEndian.Uint32(mac.Sum(nil))
+	return fmt.Sprintf("%0*d", checkinCodeDigits, sum%1_000_000)
+}
+
+func (b *Bot) checkinPeriodAt(t time.Time) int64 {
+	return t.Unix() / int64(b.checkinPeriod/time.Second)
+}
+
+// validCheckinCode accepts only the current code: the previous one expires
+// as soon as the teacher is sent a new one.
+func (b *Bot) validCheckinCode(sessionID int64, code string, now time.Time) bool {
+	current := b.checkinCode(sessionID, b.checkinPeriodAt(now))
+	return hmac.Equal([]byte(current), []byte(code))
+}
+
+// rotateCheckinCode sends the teacher a new code at the start of every
+// period until the session is closed or the lesson is over. The client
+// cannot edit a message by its ID, so each code comes as a new message.
+func (b *Bot) rotateCheckinCode(ctx context.Context, userID, sessionID int64) {
+	b.mu.Lock()
+	if b.checkinRotations[sessionID] {
+		b.mu.Unlock()
+		return
+	}
+	b.checkinRotations[sessionID] = true
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		delete(b.checkinRotations, sessionID)
+		b.mu.Unlock()
+	}()
+
+	next := time.Unix((b.checkinPeriodAt(time.Now())+1)*int64(b.checkinPeriod/time.Second), 0)
+	timer := time.NewTimer(time.Until(next))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		timer.Reset(b.checkinPeriod)
+
+		session, err := b.attendanceRepo.GetCheckinSession(sessionID)
+		if err != nil {
+			b.logger.Errorf("Failed to get check-in %d: %v", sessionID, err)
+			return
+		}
+		if session.ClosedAt != nil || minutesOfDay(time.Now().In(b.location)) > minutesOfDay(session.EndTime) {
+			return
+		}
+
+		text, photo, keyboard, err := b.checkinSessionMessage(ctx, session)
+		if err != nil {
+			b.logger.Errorf("Failed to prepare check-in %d code: %v", sessionID, err)
+			continue
+		}
+
+		message := maxbot.NewMessage().SetUser(userID).SetText(text).SetFormat("markdown")
+		if photo != nil {
+			message.AddPhoto(photo)
+		}
+		if _, err := b.MaxAPI.Messages.Send(ctx, message.AddKeyboard(keyboard)); err != nil && err.Error() != "" {
+			b.logger.Errorf("Failed to send check-in %d code: %v", sessionID, err)
+		}
+	}
+}
+
+func (b *Bot) handleCheckinStart(ctx context.Context, userID int64, callbackID string) error {
+	teacherID, err := b.userRepo.GetUserIDByMaxID(userID)
+	if err != nil {
+		return err
+	}
+
+	lessons, err := b.scheduleRepo.GetScheduleForDateByTeacher(isoWeekday(time.Now().In(b.location)), teacherID)
+	if err != nil {
+		return err
+	}
+	if len(lessons) == 0 {
+		return b.answerCallbackWithNotification(ctx, callbackID, checkinNoLessonsMsg)
+	}
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	for _, lesson := range lessons {
+		subjectName, err := b.subjectRepo.GetSubjectName(lesson.SubjectID)
+		if err != nil {
+			b.logger.Warnf("Failed to get subject name: %v", err)
+		}
+		groupName, err := b.groupRepo.GetGroupName(lesson.GroupID)
+		if err != nil {
+			b.logger.Warnf("Failed to get group name: %v", err)
+		}
+		btnText := fmt.Sprintf("%s %s, %s", lesson.StartTime.Format(timeFormat), subjectName, groupName)
+		keyboard.AddRow().AddCallback(btnText, schemes.DEFAULT, fmt.Sprintf("chk_les_%d", lesson.ScheduleID))
+	}
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+	return b.answerWithKeyboard(ctx, callbackID, checkinSelectLessonMsg, keyboard)
+}
+
+func (b *Bot) handleCheckinCallback(ctx context.Context, userID int64, callbackID, payload string) error {
+	userRole, err := b.getUserRole(userID)
+	if err != nil {
+		return err
+	}
+	if userRole != "teacher" {
+		return b.answerCallbackWithNotification(ctx, callbackID, checkinForbiddenMsg)
+	}
+
+	if payload == payloadCheckin {
+		return b.handleCheckinStart(ctx, userID, callbackID)
+	}
+
+	teacherID, err := b.userRepo.GetUserIDByMaxID(userID)
+	if err != nil {
+		return err
+	}
+
+	var id int64
+	switch {
+	case strings.HasPrefix(payload, "chk_les_"):
+		fmt.Sscanf(payload, "chk_les_%d", &id)
+		return b.openCheckinSession(ctx, userID, callbackID, teacherID, id)
+	case strings.HasPrefix(payload, "chk_code_"):
+		fmt.Sscanf(payload, "chk_code_%d", &id)
+	case strings.HasPrefix(payload, "chk_end_"):
+		fmt.Sscanf(payload, "chk_end_%d", &id)
+	default:
+		return fmt.Errorf("unknown check-in callback: %s", payload)
+	}
+
+	session, err := b.attendanceRepo.GetCheckinSession(id)
+	if err != nil {
+		return err
+	}
+	if session.TeacherID != teacherID {
+		return b.answerCallbackWithNotification(ctx, callbackID, checkinForbiddenMsg)
+	}
+	if session.ClosedAt != nil {
+		return b.answerCallbackWithNotification(ctx, callbackID, checkinAlreadyClosed)
+	}
+
+	if strings.HasPrefix(payload, "chk_end_") {
+		return b.closeCheckinSession(ctx, callbackID, teacherID, session)
+	}
+	go b.rotateCheckinCode(ctx, userID, session.SessionID)
+	return b.answerCheckinSession(ctx, callbackID, session)
+}
+
+func (b *Bot) openCheckinSession(ctx context.Context, userID int64, callbackID string, teacherID, scheduleID int64) error {
+	lesson, err := b.scheduleRepo.GetScheduleByID(scheduleID)
+	if err != nil {
+		return err
+	}
+	if lesson.TeacherID != teacherID || lesson.Archived || lesson.Weekday != isoWeekday(time.Now().In(b.location)) {
+		return b.answerCallbackWithNotification(ctx, callbackID, checkinWrongLessonMsg)
+	}
+
+	sessionID, err := b.attendanceRepo.OpenCheckinSession(scheduleID, teacherID)
+	if err != nil {
+		return err
+	}
+
+	session, err := b.attendanceRepo.GetCheckinSession(sessionID)
+	if err != nil {
+		return err
+	}
+
+	b.logger.Infof("Teacher %d opened check-in %d for schedule %d", teacherID, sessionID, scheduleID)
+	go b.rotateCheckinCode(ctx, userID, sessionID)
+	return b.answerCheckinSession(ctx, callbackID, session)
+}
+
+// answerCheckinSession shows the current code as text and as a QR image,
+// with the number of students already marked.
+func (b *Bot) answerCheckinSession(ctx context.Context, callbackID string, session *database.CheckinSession) error {
+	text, photo, keyboard, err := b.checkinSessionMessage(ctx, session)
+	if err != nil {
+		return err
+	}
+	return b.answerWithPhotoMarkdown(ctx, callbackID, text, photo, keyboard)
+}
+
+// checkinSessionMessage renders the current code of the session. The QR
+// image is left out if it could not be made.
+func (b *Bot) checkinSessionMessage(ctx context.Context, session *database.CheckinSession) (string, *schemes.PhotoTokens, *maxbot.Keyboard, error) {
+	code := b.checkinCode(session.SessionID, b.checkinPeriodAt(time.Now()))
+
+	students, err := b.gradeRepo.GetStudentsByGroup(session.GroupID)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	present, err := b.attendanceRepo.GetPresentStudentIDsBySchedule(session.ScheduleID)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	var photo *schemes.PhotoTokens
+	if image, err := qrcode.PNG(code, checkinQRScale); err != nil {
+		b.logger.Warnf("Failed to render check-in QR code: %v", err)
+	} else if photo, err = b.MaxAPI.Uploads.UploadPhotoFromReader(ctx, bytes.NewReader(image)); err != nil {
+		b.logger.Warnf("Failed to upload check-in QR code: %v", err)
+		photo = nil
+	}
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	keyboard.AddRow().AddCallback(btnCheckinRefresh, schemes.POSITIVE, fmt.Sprintf("chk_code_%d", session.SessionID))
+	keyboard.AddRow().AddCallback(btnCheckinClose, schemes.NEGATIVE, fmt.Sprintf("chk_end_%d", session.SessionID))
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+
+	text := fmt.Sprintf(checkinSessionMsg, session.SubjectName, session.GroupName,
+		session.StartTime.Format(timeFormat), session.EndTime.Format(timeFormat),
+		code, b.checkinPeriod, len(present), len(students))
+	return text, photo, keyboard, nil
+}
+
+// closeCheckinSession stops the check-in and marks everyone who has not
+// checked in as absent. Students already marked absent keep their mark and
+// are not notified again. The absence notifications form one batch.
+func (b *Bot) closeCheckinSession(ctx context.Context, callbackID string, teacherID int64, session *database.CheckinSession) error {
+	students, err := b.gradeRepo.GetStudentsByGroup(session.GroupID)
+	if err != nil {
+		return err
+	}
+
+	records, err := b.attendanceRepo.GetAttendanceRecordsBySchedule(session.ScheduleID)
+	if err != nil {
+		return err
+	}
+	present := 0
+	markedSet := make(map[int64]bool, len(records))
+	for _, record := range records {
+		markedSet[record.StudentID] = true
+		if record.Attended {
+			present++
+		}
+	}
+
+	now := time.Now()
+	batchTitle := fmt.Sprintf(attendanceBatchTitle, session.SubjectName, now.In(b.location).Format("02.01.2006 15:04"))
+
+	var closed bool
+	var absentIDs []int64
+	notified := 0
+	err = b.inTx(func(tx *sqlx.Tx) error {
+		var err error
+		closed, err = b.attendanceRepo.CloseCheckinSession(tx, session.SessionID)
+		if err != nil || !closed {
+			return err
+		}
+
+		var batchID *int64
+		for _, student := range students {
+			if markedSet[student.UserID] {
+				continue
+			}
+			if err := b.attendanceRepo.MarkAttendance(tx, student.UserID, session.ScheduleID, false, teacherID); err != nil {
+				return err
+			}
+
+			if batchID == nil {
+				id, err := b.outboxRepo.CreateBatch(tx, teacherID, batchTitle)
+				if err != nil {
+					return err
+				}
+				batchID = &id
+			}
+
+			notification := attendanceNotification(student.UserID, session.SubjectID, session.SubjectName, false, now)
+			notification.BatchID = batchID
+			queued, err := b.enqueueStudentNotification(tx, notification)
+			if err != nil {
+				return err
+			}
+			if queued {
+				notified++
+			}
+			absentIDs = append(absentIDs, student.UserID)
+		}
+		return nil
+	})
+	if err != nil {
+		b.logger.Errorf("Failed to close check-in %d: %v", session.SessionID, err)
+		return b.answerCallbackWithNotification(ctx, callbackID, "Ошибка при отметке посещаемости.")
+	}
+	if !closed {
+		return b.answerCallbackWithNotification(ctx, callbackID, checkinAlreadyClosed)
+	}
+	go b.checkAlerts(session.SubjectID, absentIDs...)
+
+	b.mu.Lock()
+	for attempt := range b.checkinFailures {
+		if attempt.sessionID == session.SessionID {
+			delete(b.checkinFailures, attempt)
+		}
+	}
+	b.mu.Unlock()
+
+	b.logger.Infof("Teacher %d closed check-in %d: %d present, %d absent", teacherID, session.SessionID, present, len(absentIDs))
+
+	text := fmt.Sprintf(checkinClosedMsg, present, len(absentIDs))
+	if notified > 0 {
+		text += fmt.Sprintf(batchNotificationsNote, notified)
+	}
+	return b.answerWithKeyboardMarkdown(ctx, callbackID, text, GetTeacherKeyboard(b.MaxAPI))
+}
+
+// handleCheckinCode handles a check-in code sent by a student. It reports
+// whether the message was consumed.
+func (b *Bot) handleCheckinCode(ctx context.Context, userID int64, text string) bool {
+	code := strings.TrimSpace(text)
+	if len(code) != checkinCodeDigits || strings.Trim(code, "0123456789") != "" {
+		return false
+	}
+
+	user, err := b.userRepo.GetUserByMaxID(userID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			b.logger.Errorf("Failed to get user %d: %v", userID, err)
+		}
+		return false
+	}
+	if user.GroupID == nil {
+		return false
+	}
+
+	sessions, err := b.attendanceRepo.GetOpenCheckinSessionsByGroup(*user.GroupID)
+	if err != nil {
+		b.logger.Errorf("Failed to get open check-ins for group %d: %v", *user.GroupID, err)
+		b.sendMessage(ctx, userID, checkinErrorMsg)
+		return true
+	}
+	if len(sessions) == 0 {
+		b.sendMessage(ctx, userID, checkinNoSessionMsg)
+		return true
+	}
+
+	now := time.Now()
+	nowMinutes := minutesOfDay(now.In(b.location))
+
+	var session *database.CheckinSession
+	inWindow := false
+	for i := range sessions {
+		start := minutesOfDay(sessions[i].StartTime) - int(checkinEarlyStart/time.Minute)
+		if nowMinutes < start || nowMinutes > minutesOfDay(sessions[i].EndTime) {
+			continue
+		}
+		inWindow = true
+		if b.validCheckinCode(sessions[i].SessionID, code, now) {
+			session = &sessions[i]
+			break
+		}
+	}
+
+	if !inWindow {
+		b.sendMessage(ctx, userID, checkinOutOfWindowMsg)
+		return true
+	}
+
+	if session == nil {
+		b.recordCheckinFailure(ctx, userID, sessions)
+		return true
+	}
+
+	attempt := checkinAttempt{sessionID: session.SessionID, userID: userID}
+	b.mu.Lock()
+	blocked := b.checkinFailures[attempt] >= checkinMaxFailures
+	b.mu.Unlock()
+	if blocked {
+		b.sendMessage(ctx, userID, checkinBlockedMsg)
+		return true
+	}
+
+	present, err := b.attendanceRepo.GetPresentStudentIDsBySchedule(session.ScheduleID)
+	if err != nil {
+		b.logger.Errorf("Failed to get attendance of schedule %d: %v", session.ScheduleID, err)
+		b.sendMessage(ctx, userID, checkinErrorMsg)
+		return true
+	}
+	for _, id := range present {
+		if id == user.UserID {
+			b.sendMessage(ctx, userID, fmt.Sprintf(checkinAlreadyMsg, session.SubjectName))
+			return true
+		}
+	}
+
+	err = b.inTx(func(tx *sqlx.Tx) error {
+		return b.attendanceRepo.MarkAttendance(tx, user.UserID, session.ScheduleID, true, user.UserID)
+	})
+	if err != nil {
+		b.logger.Errorf("Failed to record check-in of student %d: %v", user.UserID, err)
+		b.sendMessage(ctx, userID, checkinErrorMsg)
+		return true
+	}
+
+	b.logger.Infof("Student %d checked in to schedule %d (session %d)", user.UserID, session.ScheduleID, session.SessionID)
+	go b.checkAlerts(session.SubjectID, user.UserID)
+	b.sendKeyboard(ctx, b.studentMenuKeyboard(userID), userID, fmt.Sprintf(checkinMarkedMsg, session.SubjectName))
+	return true
+}
+
+// recordCheckinFailure counts a wrong code against every open session of
+// the group, so codes cannot be guessed by brute force.
+func (b *Bot) recordCheckinFailure(ctx context.Context, userID int64, sessions []database.CheckinSession) {
+	blocked := false
+	b.mu.Lock()
+	for _, session := range sessions {
+		attempt := checkinAttempt{sessionID: session.SessionID, userID: userID}
+		b.checkinFailures[attempt]++
+		if b.checkinFailures[attempt] >= checkinMaxFailures {
+			blocked = true
+		}
+	}
+	b.mu.Unlock()
+
+	b.logger.Warnf("User %d sent a wrong check-in code", userID)
+	if blocked {
+		b.sendMessage(ctx, userID, checkinBlockedMsg)
+		return
+	}
+	b.sendMessage(ctx, userID, checkinInvalidMsg)
+}
@@ -0,0 +1,421 @@
+package maxAPI
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	cmdStart      = "start"
+	cmdMenu       = "menu"
+	cmdSchedule   = "schedule"
+	cmdGrades     = "grades"
+	cmdAttendance = "attendance"
+	cmdFind       = "find"
+	cmdHelp       = "help"
+
+	helpStudentMsg = "🤖 **Команды бота**\n\n" +
+		"/menu — главное меню\n" +
+		"/schedule [сегодня|завтра|пн|ДД.ММ] — расписание на день\n" +
+		"/grades [предмет] — оценки и рейтинг\n" +
+		"/attendance [предмет] — посещаемость\n" +
+		"/find [фамилия|группа|аудитория] — расписание преподавателя, группы или аудитории; «/find свободные» — свободные аудитории\n" +
+		"/help — эта справка\n\n" +
+		"Можно писать и обычным текстом, например: «расписание на завтра», «оценки по физике»."
+	helpTeacherMsg = "🤖 **Команды бота**\n\n" +
+		"/menu — главное меню\n" +
+		"/schedule [сегодня|завтра|пн|ДД.ММ] — расписание на день\n" +
+		"/find [фамилия|группа|аудитория] — расписание преподавателя, группы или аудитории; «/find свободные» — свободные аудитории\n" +
+		"/help — эта справка\n\n" +
+		"Можно писать и обычным текстом, например: «расписание на пятницу», «где Иванов»."
+	helpAdminMsg = "🤖 **Команды бота**\n\n" +
+		"/menu — главное меню\n" +
+		"/find [фамилия|группа|аудитория] — расписание преподавателя, группы или аудитории; «/find свободные» — свободные аудитории\n" +
+		"/help — эта справка"
+
+	unknownDayMsg         = "Не удалось распознать день «%s». Примеры: сегодня, завтра, пн, 25.10."
+	unknownSubjectCmdMsg  = "Предмет «%s» не найден. Выберите из списка:"
+	commandStudentOnlyMsg = "Эта команда доступна только студентам."
+)
+
+// commandAliases maps words that may start or appear in a free-text request to
+// a command. Matching is fuzzy, so small typos are tolerated.
+var commandAliases = map[string]string{
+	"start":        cmdStart,
+	"старт":        cmdStart,
+	"начать":       cmdStart,
+	"menu":         cmdMenu,
+	"меню":         cmdMenu,
+	"schedule":     cmdSchedule,
+	"расписание":   cmdSchedule,
+	"пары":         cmdSchedule,
+	"занятия":      cmdSchedule,
+	"grades":       cmdGrades,
+	"оценки":       cmdGrades,
+	"оценка":       cmdGrades,
+	"успеваемость": cmdGrades,
+	"attendance":   cmdAttendance,
+	"посещаемость": cmdAttendance,
+	"пропуски":     cmdAttendance,
+	"find":         cmdFind,
+	"найти":        cmdFind,
+	"поиск":        cmdFind,
+	"где":          cmdFind,
+	"help":         cmdHelp,
+	"помощь":       cmdHelp,
+	"справка":      cmdHelp,
+	"команды":      cmdHelp,
+}
+
+var commandStopWords = map[string]bool{
+	"на": true, "по": true, "в": true, "во": true, "мои": true, "мое": true, "моё": true, "мой": true,
+	"покажи": true, "показать": true, "какое": true, "какие": true, "мне": true, "пожалуйста": true,
+	"что": true, "у": true, "меня": true, "за": true,
+}
+
+var weekdayAliases = map[string]int16{
+	"пн": 1, "понедельник": 1,
+	"вт": 2, "вторник": 2,
+	"ср": 3, "среда": 3, "среду": 3,
+	"чт": 4, "четверг": 4,
+	"пт": 5, "пятница": 5, "пятницу": 5,
+	"сб": 6, "суббота": 6, "субботу": 6,
+	"вс": 7, "воскресенье": 7,
+}
+
+var relativeDayAliases = map[string]int{
+	"вчера":       -1,
+	"сегодня":     0,
+	"завтра":      1,
+	"послезавтра": 2,
+}
+
+type textCommand struct {
+	name string
+	args []string
+}
+
+// handleTextCommand executes a slash command or a recognised free-text
+// request. It reports whether the text was understood.
+func (b *Bot) handleTextCommand(ctx context.Context, userID int64, text string) bool {
+	cmd, ok := parseTextCommand(text)
+	if !ok {
+		return false
+	}
+
+	b.logger.Debugf("User %d text command: %s %v", userID, cmd.name, cmd.args)
+
+	var err error
+	switch cmd.name {
+	case cmdStart:
+		err = b.runStartCommand(ctx, userID)
+	case cmdMenu:
+		err = b.runMenuCommand(ctx, userID)
+	case cmdSchedule:
+		err = b.runScheduleCommand(ctx, userID, cmd.args)
+	case cmdGrades:
+		err = b.runStudentSubjectCommand(ctx, userID, cmd.args, "show_grades_subj_%d", selectSubjectForGradesMsg, b.buildStudentGradesText)
+	case cmdAttendance:
+		err = b.runStudentSubjectCommand(ctx, userID, cmd.args, "show_attend_subj_%d", selectSubjectForAttendMsg, b.buildStudentAttendanceText)
+	case cmdFind:
+		b.handleLookupInput(ctx, userID, strings.Join(cmd.args, " "))
+	case cmdHelp:
+		err = b.runHelpCommand(ctx, userID)
+	default:
+		return false
+	}
+
+	if err != nil {
+		b.logger.Errorf("Failed to run command %s for user %d: %v", cmd.name, userID, err)
+		b.sendKeyboardAfterError(ctx, userID)
+	}
+	return true
+}
+
+func (b *Bot) runStartCommand(ctx context.Context, userID int64) error {
+	userRole, err := b.getUserRole(userID)
+	if err != nil {
+		return err
+	}
+	b.sendWelcomeWithKeyboard(ctx, userID, userRole)
+	return nil
+}
+
+func (b *Bot) runMenuCommand(ctx context.Context, userID int64) error {
+	userRole, err := b.getUserRole(userID)
+	if err != nil {
+		return err
+	}
+
+	keyboard, menuText := b.getMenuByRole(userRole)
+	if keyboard == nil {
+		return fmt.Errorf("unknown role: %s", userRole)
+	}
+
+	b.sendKeyboard(ctx, keyboard, userID, menuText)
+	return nil
+}
+
+func (b *Bot) runScheduleCommand(ctx context.Context, userID int64, args []string) error {
+	date, ok := parseDayArgument(strings.Join(args, " "), b.today())
+	if !ok && hasLookupKindWord(args) {
+		b.handleLookupInput(ctx, userID, strings.Join(args, " "))
+		return nil
+	}
+	if !ok {
+		return b.sendMessage(ctx, userID, fmt.Sprintf(unknownDayMsg, strings.Join(args, " ")))
+	}
+	return b.sendScheduleMessage(ctx, userID, date)
+}
+
+func (b *Bot) runStudentSubjectCommand(ctx context.Context, userID int64, args []string, payloadFormat, selectMsg string, build func(studentID, subjectID int64) (string, error)) error {
+	userRole, err := b.getUserRole(userID)
+	if err != nil {
+		return err
+	}
+	if userRole != "student" {
+		return b.sendMessage(ctx, userID, commandStudentOnlyMsg)
+	}
+
+	studentID, subjects, err := b.getStudentSubjects(userID)
+	if err != nil {
+		return err
+	}
+
+	if len(subjects) == 0 {
+		return b.sendMessage(ctx, userID, noSubjectsMsgStudent)
+	}
+
+	keyboard := b.studentSubjectsKeyboard(subjects, payloadFormat)
+
+	query := strings.Join(args, " ")
+	if query == "" {
+		b.sendKeyboard(ctx, keyboard, userID, selectMsg)
+		return nil
+	}
+
+	names := make([]string, len(subjects))
+	for i, subject := range subjects {
+		names[i] = subject.SubjectName
+	}
+
+	idx := matchName(query, names)
+	if idx < 0 {
+		b.sendKeyboard(ctx, keyboard, userID, fmt.Sprintf(unknownSubjectCmdMsg, query))
+		return nil
+	}
+
+	text, err := build(studentID, subjects[idx].SubjectID)
+	if err != nil {
+		return err
+	}
+
+	b.sendKeyboard(ctx, GetStudentKeyboard(b.MaxAPI), userID, text)
+	return nil
+}
+
+func (b *Bot) runHelpCommand(ctx context.Context, userID int64) error {
+	userRole, err := b.getUserRole(userID)
+	if err != nil {
+		return err
+	}
+
+	text := helpStudentMsg
+	switch userRole {
+	case "teacher":
+		text = helpTeacherMsg
+	case "admin":
+		text = helpAdminMsg
+	}
+
+	keyboard, _ := b.getMenuByRole(userRole)
+	if keyboard == nil {
+		return b.sendMessage(ctx, userID, text)
+	}
+
+	b.sendKeyboard(ctx, keyboard, userID, text)
+	return nil
+}
+
+// parseTextCommand recognises "/command args" as well as free-text requests
+// such as "расписание на завтра" or "покажи оценки по физике".
+func parseTextCommand(text string) (textCommand, bool) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return textCommand{}, false
+	}
+
+	if strings.HasPrefix(text, "/") {
+		fields := strings.Fields(text[1:])
+		if len(fields) == 0 {
+			return textCommand{}, false
+		}
+		name := strings.ToLower(fields[0])
+		if at := strings.Index(name, "@"); at >= 0 {
+			name = name[:at]
+		}
+		cmd, ok := commandAliases[name]
+		if !ok {
+			return textCommand{}, false
+		}
+		return textCommand{name: cmd, args: fields[1:]}, true
+	}
+
+	tokens := tokenize(text)
+	for i, token := range tokens {
+		if commandStopWords[token] {
+			continue
+		}
+		if cmd, ok := matchAlias(token, commandAliases); ok {
+			var args []string
+			for j, t := range tokens {
+				if j != i && !commandStopWords[t] {
+					args = append(args, t)
+				}
+			}
+			return textCommand{name: cmd, args: args}, true
+		}
+	}
+
+	return textCommand{}, false
+}
+
+// parseDayArgument resolves "сегодня", "завтра", a weekday name or a date
+// (ДД.ММ, ДД.ММ.ГГГГ, ГГГГ-ММ-ДД) to a date relative to today. A weekday
+// name means its nearest date, today included.
+func parseDayArgument(arg string, today time.Time) (time.Time, bool) {
+	arg = strings.ToLower(strings.TrimSpace(arg))
+	if arg == "" {
+		return today, true
+	}
+
+	for _, layout := range []string{"02.01.2006", "2.1.2006", "2006-01-02"} {
+		if date, err := time.ParseInLocation(layout, arg, today.Location()); err == nil {
+			return date, true
+		}
+	}
+	for _, layout := range []string{"02.01", "2.1"} {
+		if date, err := time.Parse(layout, arg); err == nil {
+			return time.Date(today.Year(), date.Month(), date.Day(), 0, 0, 0, 0, today.Location()), true
+		}
+	}
+
+	for _, token := range tokenize(arg) {
+		if commandStopWords[token] {
+			continue
+		}
+		if offset, ok := matchAlias(token, relativeDayAliases); ok {
+			return today.AddDate(0, 0, offset), true
+		}
+		if weekday, ok := matchAlias(token, weekdayAliases); ok {
+			return today.AddDate(0, 0, (int(weekday)-int(isoWeekday(today))+7)%7), true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func isoWeekday(t time.Time) int16 {
+	weekday := int16(t.Weekday())
+	if weekday == 0 {
+		return 7
+	}
+	return weekday
+}
+
+func tokenize(text string) []string {
+	text = strings.ReplaceAll(strings.ToLower(text), "ё", "е")
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '.' && r != '-'
+	})
+}
+
+// minFuzzyAliasLen is the shortest alias and token length that tolerates
+// typos.
+const minFuzzyAliasLen = 5
+
+// matchAlias looks the token up exactly first and then tolerates a small
+// edit distance proportional to the word length. Short aliases must match
+// exactly: one typo away from "меню" is a plain word like "меня".
+func matchAlias[T any](token string, aliases map[string]T) (T, bool) {
+	if value, ok := aliases[token]; ok {
+		return value, true
+	}
+
+	var zero T
+	tokenLen := len([]rune(token))
+	if tokenLen < minFuzzyAliasLen {
+		return zero, false
+	}
+
+	maxDistance := 1
+	if tokenLen >= 8 {
+		maxDistance = 2
+	}
+
+	best, bestDistance := "", maxDistance+1
+	for alias := range aliases {
+		if len([]rune(alias)) < minFuzzyAliasLen {
+			continue
+		}
+		if d := levenshtein(token, alias); d < bestDistance {
+			best, bestDistance = alias, d
+		}
+	}
+
+	if best == "" {
+		return zero, false
+	}
+	return aliases[best], true
+}
+
+// matchName finds the name that best matches the query: a case-insensitive
+// substring match wins, otherwise a word with a small edit distance.
+func matchName(query string, names []string) int {
+	query = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(query)), "ё", "е")
+
+	for i, name := range names {
+		if strings.Contains(strings.ReplaceAll(strings.ToLower(name), "ё", "е"), query) {
+			return i
+		}
+	}
+
+	best, bestDistance := -1, 3
+	for i, name := range names {
+		for _, word := range tokenize(name) {
+			for _, q := range tokenize(query) {
+				if d := levenshtein(q, word); d < bestDistance {
+					best, bestDistance = i, d
+				}
+			}
+		}
+	}
+	return best
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
@@ -0,0 +1,114 @@
+package maxAPI
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTextCommand(t *testing.T) {
+	tests := []struct {
+		text     string
+		wantName string
+		wantArgs []string
+		wantOK   bool
+	}{
+		{text: "/schedule завтра", wantName: cmdSchedule, wantArgs: []string{"завтра"}, wantOK: true},
+		{text: "/grades@digital_bot физика", wantName: cmdGrades, wantArgs: []string{"физика"}, wantOK: true},
+		{text: "расписание на завтра", wantName: cmdSchedule, wantArgs: []string{"завтра"}, wantOK: true},
+		{text: "покажи оценки по физике", wantName: cmdGrades, wantArgs: []string{"физике"}, wantOK: true},
+		{text: "расписане на пятницу", wantName: cmdSchedule, wantArgs: []string{"пятницу"}, wantOK: true},
+		{text: "где Иванов", wantName: cmdFind, wantArgs: []string{"иванов"}, wantOK: true},
+		{text: "у меня вопрос", wantOK: false},
+		{text: "/unknown", wantOK: false},
+		{text: "   ", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			cmd, ok := parseTextCommand(tt.text)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if cmd.name != tt.wantName || strings.Join(cmd.args, " ") != strings.Join(tt.wantArgs, " ") {
+				t.Errorf("got %s %q, want %s %q", cmd.name, cmd.args, tt.wantName, tt.wantArgs)
+			}
+		})
+	}
+}
+
+var helpExample = regexp.MustCompile(`«([^»]+)»`)
+
+// TestHelpExamples checks that every example quoted in the help texts is
+// understood by the free-text parser.
+func TestHelpExamples(t *testing.T) {
+	today := time.Date(2025, time.March, 5, 0, 0, 0, 0, time.UTC)
+	subjects := []string{"Математический анализ", "Физика", "История России"}
+
+	for _, help := range []string{helpStudentMsg, helpTeacherMsg, helpAdminMsg} {
+		for _, match := range helpExample.FindAllStringSubmatch(help, -1) {
+			example := match[1]
+			t.Run(example, func(t *testing.T) {
+				cmd, ok := parseTextCommand(example)
+				if !ok {
+					t.Fatal("not recognised as a command")
+				}
+
+				query := strings.Join(cmd.args, " ")
+				switch cmd.name {
+				case cmdSchedule:
+					if _, ok := parseDayArgument(query, today); !ok {
+						t.Errorf("day %q not recognised", query)
+					}
+				case cmdGrades, cmdAttendance:
+					if matchName(query, subjects) < 0 {
+						t.Errorf("subject %q matches none of %q", query, subjects)
+					}
+				case cmdFind:
+					if query == "" {
+						t.Error("find example has no query")
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestParseDayArgument(t *testing.T) {
+	// Wednesday.
+	today := time.Date(2025, time.March, 5, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		arg  string
+		want string
+	}{
+		{arg: "", want: "2025-03-05"},
+		{arg: "завтра", want: "2025-03-06"},
+		{arg: "на послезавтра", want: "2025-03-07"},
+		{arg: "пн", want: "2025-03-10"},
+		{arg: "среду", want: "2025-03-05"},
+		{arg: "пятницу", want: "2025-03-07"},
+		{arg: "25.10", want: "2025-10-25"},
+		{arg: "01.09.2025", want: "2025-09-01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			date, ok := parseDayArgument(tt.arg, today)
+			if !ok {
+				t.Fatal("not recognised")
+			}
+			if got := date.Format("2006-01-02"); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if _, ok := parseDayArgument("когда-нибудь", today); ok {
+		t.Error("unknown day recognised")
+	}
+}
@@ -2,6 +2,8 @@ package maxAPI
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -14,10 +16,13 @@ const (
 	welcomeTeacherMsg = "Добро пожаловать, преподаватель! 👨‍🏫"
 	welcomeStudentMsg = "Добро пожаловать, студент! 🎓"
 	welcomeAdminMsg   = "Добро пожаловать, администратор! 👨‍💼"
+	welcomeParentMsg  = "Добро пожаловать! 👪 Здесь можно посмотреть расписание, оценки и посещаемость вашего ребёнка."
+	welcomeGuestMsg   = "Добро пожаловать! 👋\n\nЧтобы начать, отправьте код регистрации:\n• студенту — личный код или код группы, их выдаёт администратор;\n• родителю — код приглашения, его можно получить у студента в боте или у администратора."
 
 	mainMenuAdminMsg   = "Главное меню администратора:"
 	mainMenuTeacherMsg = "Главное меню преподавателя:"
 	mainMenuStudentMsg = "Главное меню студента:"
+	mainMenuParentMsg  = "Главное меню родителя:"
 
 	unknownMessage        = "❓ Я не понимаю это сообщение."
 	unknownMessageDefault = "❓ Я не понимаю это сообщение.\n\nОбратитесь к администратору для получения доступа."
@@ -25,13 +30,23 @@ const (
 
 	fileNotFoundMessage     = "Файл не найден. Отправьте CSV файл."
 	multipleFilesMessage    = "Отправлено %d файла(ов). Пожалуйста, отправьте только один CSV файл за раз."
-	sendStudentsFileMessage = "Отправьте файл со списком студентов (с расширением .csv)."
+	sendStudentsFileMessage = "Отправьте файл со списком студентов (с расширением .csv). Если User_id студента неизвестен, оставьте столбец пустым — студент получит код регистрации."
 	sendTeachersFileMessage = "Отправьте файл с преподавателями (с расширением .csv)."
 	sendScheduleFileMessage = "Отправьте файл с расписанием (с расширением .csv)."
+	sendGradingFileMessage  = "Отправьте файл с настройками оценивания (с расширением .csv). Шкалы: five_point, hundred_point, pass_fail, letter."
+	sendRatingFileMessage   = "Отправьте файл с правилами рейтинга (с расширением .csv)."
+	sendHolidaysFileMessage = "Отправьте файл с праздничными днями (с расширением .csv). Столбцы: date, title."
+	sendGradeJournalMessage = "Отправьте журнал оценок (с расширением .csv). Столбцы: student, group_name, subject_name, date, start_time, assessment_type, value."
+	sendAttendJournalMsg    = "Отправьте журнал посещаемости (с расширением .csv). Столбцы: student, group_name, subject_name, date, start_time, status."
 	errorMessage            = "❌ Ошибка:\n\n%s\n\n"
 	studentsSuccessMessage  = "✅ Студенты успешно загружены!"
 	teachersSuccessMessage  = "✅ Преподаватели успешно загружены!"
 	scheduleSuccessMessage  = "✅ Расписание успешно загружено!"
+	gradingSuccessMessage   = "✅ Настройки оценивания успешно загружены!"
+	ratingSuccessMessage    = "✅ Правила рейтинга успешно загружены!"
+	holidaysSuccessMessage  = "✅ Праздничные дни успешно загружены!"
+	gradeJournalSuccessMsg  = "✅ Журнал оценок успешно загружен!"
+	attendJournalSuccessMsg = "✅ Журнал посещаемости успешно загружен!"
 	defaultSuccessMessage   = "✅ Данные успешно загружены!"
 	nextActionMessage       = "Выберите следующее действие:"
 )
@@ -40,6 +55,10 @@ func (b *Bot) handleBotStarted(ctx context.Context, u *schemes.BotStartedUpdate)
 	sender := u.User
 
 	userRole, err := b.getUserRole(sender.UserId)
+	if errors.Is(err, sql.ErrNoRows) {
+		b.sendMessage(ctx, sender.UserId, welcomeGuestMsg)
+		return
+	}
 	if err != nil {
 		b.logger.Errorf("Failed to get role from db: %v", err)
 		b.sendMessage(ctx, sender.UserId, unknownMessageDefault)
@@ -65,6 +84,18 @@ func (b *Bot) handleMessageCreated(ctx context.Context, u *schemes.MessageCreate
 	messageText := u.Message.Body.Text
 
 	if len(attachments) == 0 && messageText != "" {
+		if b.handlePendingInput(ctx, userID, messageText) {
+			return
+		}
+		if b.handleGuestInviteCode(ctx, u.Message.Sender, messageText) {
+			return
+		}
+		if b.handleCheckinCode(ctx, userID, messageText) {
+			return
+		}
+		if b.handleTextCommand(ctx, userID, messageText) {
+			return
+		}
 		b.handleUnexpectedMessage(ctx, userID)
 		return
 	}
@@ -73,6 +104,10 @@ func (b *Bot) handleMessageCreated(ctx context.Context, u *schemes.MessageCreate
 		return
 	}
 
+	if b.handlePendingAttachment(ctx, userID, messageText, attachments) {
+		return
+	}
+
 	uploadType := b.pendingUploads[userID]
 	if uploadType == "" {
 		b.logger.Warnf("No pending upload for user %d", userID)
@@ -107,7 +142,7 @@ func (b *Bot) handleMessageCreated(ctx context.Context, u *schemes.MessageCreate
 				return
 			}
 
-			if err := b.downloadAndProcessFile(ctx, fileAttachments[0], uploadType); err != nil {
+			if err := b.downloadAndProcessFile(ctx, userID, fileAttachments[0], uploadType); err != nil {
 				b.logger.Errorf("Failed to process file %s: %v", fileAttachments[0].Filename, err)
 				b.sendMessage(ctx, userID, fmt.Sprintf(errorMessage, err.Error()))
 				b.sendKeyboardAfterError(ctx, userID)
@@ -156,11 +191,67 @@ func (b *Bot) handleCallback(ctx context.Context, u *schemes.MessageCallbackUpda
 		b.handleMarkAttendance(ctx, userID, callbackID)
 	case payload == payloadShowScore:
 		b.handleShowScore(ctx, userID, callbackID)
+	case payload == payloadShowProgress:
+		if err := b.handleShowProgress(ctx, userID, callbackID); err != nil {
+			b.logger.Errorf("Failed to show progress: %v", err)
+		}
 	case payload == payloadShowAttendance:
 		b.handleShowAttendance(ctx, userID, callbackID)
+	case payload == payloadShowRating:
+		b.handleShowRating(ctx, userID, callbackID)
+	case payload == payloadBulkGrade:
+		b.handleBulkGrade(ctx, userID, callbackID)
+	case payload == payloadSettings:
+		b.handleShowSettings(ctx, userID, callbackID)
+	case payload == payloadAnnounce:
+		b.handleAnnounce(ctx, userID, callbackID)
+	case payload == payloadParentInvite:
+		b.handleParentInvite(ctx, userID, callbackID)
+	case strings.HasPrefix(payload, "par_"):
+		if err := b.handleParentCallback(ctx, userID, callbackID, payload); err != nil {
+			b.logger.Errorf("Failed to handle parent callback: %v", err)
+		}
+	case strings.HasPrefix(payload, "ics_"):
+		if err := b.handleCalendarCallback(ctx, userID, callbackID, payload); err != nil {
+			b.logger.Errorf("Failed to handle calendar callback: %v", err)
+		}
+	case strings.HasPrefix(payload, "look_"):
+		if err := b.handleLookupCallback(ctx, userID, callbackID, payload); err != nil {
+			b.logger.Errorf("Failed to handle lookup callback: %v", err)
+		}
+	case strings.HasPrefix(payload, "sed_"):
+		if err := b.handleScheduleEditCallback(ctx, userID, callbackID, payload); err != nil {
+			b.logger.Errorf("Failed to handle schedule edit callback: %v", err)
+		}
+	case strings.HasPrefix(payload, "rep_"):
+		if err := b.handleReportsCallback(ctx, userID, callbackID, payload); err != nil {
+			b.logger.Errorf("Failed to handle reports callback: %v", err)
+		}
+	case strings.HasPrefix(payload, "stat_"):
+		if err := b.handleAnalyticsCallback(ctx, userID, callbackID, payload); err != nil {
+			b.logger.Errorf("Failed to handle analytics callback: %v", err)
+		}
+	case strings.HasPrefix(payload, "chk_"):
+		if err := b.handleCheckinCallback(ctx, userID, callbackID, payload); err != nil {
+			b.logger.Errorf("Failed to handle check-in callback: %v", err)
+		}
+	case strings.HasPrefix(payload, "hm_"):
+		if err := b.handleHeadmanCallback(ctx, userID, callbackID, payload); err != nil {
+			b.logger.Errorf("Failed to handle headman callback: %v", err)
+		}
+	case strings.HasPrefix(payload, "reg_"):
+		if err := b.handleRegistrationCallback(ctx, userID, callbackID, payload); err != nil {
+			b.logger.Errorf("Failed to handle registration callback: %v", err)
+		}
+	case strings.HasPrefix(payload, "ann_"):
+		if err := b.handleAnnounceCallback(ctx, userID, callbackID, payload); err != nil {
+			b.logger.Errorf("Failed to handle announcement callback: %v", err)
+		}
+	case strings.HasPrefix(payload, "settings_"):
+		b.handleSettingsCallback(ctx, userID, callbackID, payload)
 	case payload == payloadBackToMenu:
 		b.handleBackToMenu(ctx, userID, callbackID)
-	case strings.HasPrefix(payload, "sch_day_"):
+	case strings.HasPrefix(payload, "sch_"):
 		b.handleScheduleNavigation(ctx, userID, callbackID, payload)
 	case strings.HasPrefix(payload, "grade_"):
 		b.handleGradeCallback(ctx, userID, callbackID, payload)
@@ -170,6 +261,12 @@ func (b *Bot) handleCallback(ctx context.Context, u *schemes.MessageCallbackUpda
 		b.handleAttendanceCallback(ctx, userID, callbackID, payload)
 	case strings.HasPrefix(payload, "show_attend_"):
 		b.handleShowAttendanceCallback(ctx, userID, callbackID, payload)
+	case strings.HasPrefix(payload, "rating_"):
+		if err := b.handleRatingCallback(ctx, userID, callbackID, payload); err != nil {
+			b.logger.Errorf("Failed to handle rating callback: %v", err)
+		}
+	case strings.HasPrefix(payload, "bulk_"):
+		b.handleBulkGradeCallback(ctx, userID, callbackID, payload)
 	default:
 		b.logger.Warnf("Unknown callback: %s", payload)
 	}
@@ -187,6 +284,36 @@ func (b *Bot) handleShowAttendance(ctx context.Context, userID int64, callbackID
 	}
 }
 
+func (b *Bot) handleShowRating(ctx context.Context, userID int64, callbackID string) {
+	if err := b.handleShowRatingStart(ctx, userID, callbackID); err != nil {
+		b.logger.Errorf("Failed to start rating view: %v", err)
+	}
+}
+
+func (b *Bot) handleBulkGrade(ctx context.Context, userID int64, callbackID string) {
+	if err := b.handleBulkGradeStart(ctx, userID, callbackID); err != nil {
+		b.logger.Errorf("Failed to start bulk grading: %v", err)
+	}
+}
+
+func (b *Bot) handleShowSettings(ctx context.Context, userID int64, callbackID string) {
+	if err := b.handleShowSettingsStart(ctx, userID, callbackID); err != nil {
+		b.logger.Errorf("Failed to show settings: %v", err)
+	}
+}
+
+func (b *Bot) handleAnnounce(ctx context.Context, userID int64, callbackID string) {
+	if err := b.handleAnnounceStart(ctx, userID, callbackID); err != nil {
+		b.logger.Errorf("Failed to start announcement: %v", err)
+	}
+}
+
+func (b *Bot) handleParentInvite(ctx context.Context, userID int64, callbackID string) {
+	if err := b.handleParentInviteStart(ctx, userID, callbackID); err != nil {
+		b.logger.Errorf("Failed to create parent invite: %v", err)
+	}
+}
+
 func (b *Bot) getUploadMessage(payload string) (string, string) {
 	switch payload {
 	case "uploadStudents":
@@ -195,17 +322,23 @@ func (b *Bot) getUploadMessage(payload string) (string, string) {
 		return sendTeachersFileMessage, "teachers"
 	case "uploadSchedule":
 		return sendScheduleFileMessage, "schedule"
+	case "uploadGrading":
+		return sendGradingFileMessage, "grading"
+	case "uploadRating":
+		return sendRatingFileMessage, "rating"
+	case "uploadHolidays":
+		return sendHolidaysFileMessage, "holidays"
+	case "uploadGradeJournal":
+		return sendGradeJournalMessage, "grade_journal"
+	case "uploadAttendanceJournal":
+		return sendAttendJournalMsg, "attendance_journal"
 	default:
 		return "", ""
 	}
 }
 
 func (b *Bot) handleShowSchedule(ctx context.Context, userID int64, callbackID string) {
-	currentWeekday := int16(time.Now().Weekday())
-	if currentWeekday == 0 {
-		currentWeekday = 7
-	}
-	if err := b.sendScheduleForDay(ctx, userID, callbackID, currentWeekday); err != nil {
+	if err := b.answerScheduleCallback(ctx, userID, callbackID, b.today()); err != nil {
 		b.logger.Errorf("Failed to send schedule: %v", err)
 	}
 }
@@ -222,17 +355,43 @@ func (b *Bot) handleShowScore(ctx context.Context, userID int64, callbackID stri
 	}
 }
 
+// handleScheduleNavigation opens the day, week or month picker named by the
+// payload. Weekday payloads of messages sent before dates were added open the
+// nearest such day.
 func (b *Bot) handleScheduleNavigation(ctx context.Context, userID int64, callbackID, payload string) {
-	var day int16
-	fmt.Sscanf(payload, "sch_day_%d", &day)
-
-	b.logger.Debugf("Processing schedule navigation: day=%d, callbackID=%s", day, callbackID)
+	b.logger.Debugf("Processing schedule navigation: payload=%s, callbackID=%s", payload, callbackID)
 
-	if err := b.answerScheduleCallback(ctx, userID, callbackID, day); err != nil {
+	var err error
+	switch {
+	case strings.HasPrefix(payload, "sch_day_"):
+		var day int16
+		fmt.Sscanf(payload, "sch_day_%d", &day)
+		err = b.answerScheduleCallback(ctx, userID, callbackID, b.getNearestDateForWeekday(day))
+	case strings.HasPrefix(payload, "sch_date_"):
+		err = b.answerScheduleCallback(ctx, userID, callbackID, b.parsePayloadDate(strings.TrimPrefix(payload, "sch_date_"), schedulePayloadDate))
+	case strings.HasPrefix(payload, "sch_week_"):
+		err = b.answerScheduleWeek(ctx, userID, callbackID, b.parsePayloadDate(strings.TrimPrefix(payload, "sch_week_"), schedulePayloadDate))
+	case strings.HasPrefix(payload, "sch_pick_"):
+		err = b.answerDatePicker(ctx, callbackID, b.parsePayloadDate(strings.TrimPrefix(payload, "sch_pick_"), schedulePayloadMonth))
+	default:
+		err = fmt.Errorf("unknown schedule callback: %s", payload)
+	}
+	if err != nil {
 		b.logger.Errorf("Failed to answer callback: %v", err)
 	}
 }
 
+// parsePayloadDate reads a date from a callback payload in the bot's
+// timezone, falling back to today.
+func (b *Bot) parsePayloadDate(value, layout string) time.Time {
+	date, err := time.ParseInLocation(layout, value, b.location)
+	if err != nil {
+		b.logger.Warnf("Invalid date %q in schedule payload: %v", value, err)
+		return b.today()
+	}
+	return date
+}
+
 func (b *Bot) handleBackToMenu(ctx context.Context, userID int64, callbackID string) error {
 	userRole, err := b.getUserRole(userID)
 	if err != nil {
@@ -245,6 +404,9 @@ func (b *Bot) handleBackToMenu(ctx context.Context, userID int64, callbackID str
 		b.logger.Warnf("Unknown role: %s", userRole)
 		return fmt.Errorf("unknown role: %s", userRole)
 	}
+	if userRole == "student" {
+		keyboard = b.studentMenuKeyboard(userID)
+	}
 
 	b.logger.Infof("User %d returned to main menu (role: %s)", userID, userRole)
 	return b.answerWithKeyboard(ctx, callbackID, menuText, keyboard)
@@ -258,6 +420,8 @@ func (b *Bot) getMenuByRole(role string) (*maxbot.Keyboard, string) {
 		return GetTeacherKeyboard(b.MaxAPI), mainMenuTeacherMsg
 	case "student":
 		return GetStudentKeyboard(b.MaxAPI), mainMenuStudentMsg
+	case "parent":
+		return GetParentKeyboard(b.MaxAPI), mainMenuParentMsg
 	default:
 		return nil, ""
 	}
@@ -280,3 +444,70 @@ func (b *Bot) handleUnexpectedMessage(ctx context.Context, userID int64) {
 
 	delete(b.pendingUploads, userID)
 }
+
+// handlePendingInput routes a text message to the flow that asked the user
+// to type something. It reports whether the message was consumed.
+func (b *Bot) handlePendingInput(ctx context.Context, userID int64, text string) bool {
+	b.mu.Lock()
+	inputType := b.pendingInputs[userID]
+	delete(b.pendingInputs, userID)
+	b.mu.Unlock()
+
+	switch inputType {
+	case inputBulkGrades:
+		if err := b.handleBulkGradesText(ctx, userID, text); err != nil {
+			b.logger.Errorf("Failed to process bulk grades text: %v", err)
+		}
+		return true
+	case inputParentCode:
+		b.handleParentCodeInput(ctx, userID, text)
+		return true
+	case inputRegistrationName:
+		b.handleRegistrationNameInput(ctx, userID, text)
+		return true
+	case inputAnnouncement:
+		if err := b.handleAnnouncementMessage(ctx, userID, text, nil); err != nil {
+			b.logger.Errorf("Failed to process announcement text: %v", err)
+		}
+		return true
+	case inputScheduleLookup:
+		b.handleLookupInput(ctx, userID, text)
+		return true
+	case inputScheduleEdit:
+		b.handleScheduleEditInput(ctx, userID, text)
+		return true
+	default:
+		return false
+	}
+}
+
+// handlePendingAttachment handles a message with attachments sent in reply to
+// a text prompt. Only announcements accept attachments this way.
+func (b *Bot) handlePendingAttachment(ctx context.Context, userID int64, text string, attachments []any) bool {
+	b.mu.Lock()
+	inputType := b.pendingInputs[userID]
+	if inputType != inputAnnouncement {
+		b.mu.Unlock()
+		return false
+	}
+	delete(b.pendingInputs, userID)
+	b.mu.Unlock()
+
+	fileAttachments := b.extractFileAttachments(attachments)
+	if len(fileAttachments) != 1 || len(attachments) != 1 {
+		b.setPendingInput(userID, inputAnnouncement)
+		b.sendMessage(ctx, userID, announceOnlyFilesMsg)
+		return true
+	}
+
+	if err := b.handleAnnouncementMessage(ctx, userID, text, fileAttachments[0]); err != nil {
+		b.logger.Errorf("Failed to process announcement with attachment: %v", err)
+	}
+	return true
+}
+
+func (b *Bot) setPendingInput(userID int64, inputType string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pendingInputs[userID] = inputType
+}
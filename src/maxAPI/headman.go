@@ -0,0 +1,526 @@
+package maxAPI
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	maxbot "github.com/max-messenger/max-bot-api-client-go"
+	"github.com/max-messenger/max-bot-api-client-go/schemes"
+
+	"digitalUniversity/database"
+)
+
+const (
+	headmanSelectGroupMsg   = "Выберите группу, чтобы назначить старосту:"
+	headmanSelectStudentMsg = "Выберите старосту группы **%s**. Повторное нажатие на текущего старосту снимает назначение."
+	headmanAssignedMsg      = "⭐ %s назначен(а) старостой группы."
+	headmanRemovedMsg       = "%s больше не староста."
+	headmanAssignedNotice   = "⭐ Вы назначены старостой группы. Теперь вы можете отмечать посещаемость группы на сегодняшних занятиях — отметку подтверждает преподаватель."
+	headmanForbiddenMsg     = "Раздел доступен только старостам групп."
+	headmanNoLessonsMsg     = "Сегодня у группы нет занятий."
+	headmanSelectLessonMsg  = "Выберите сегодняшнее занятие:"
+	headmanLessonMarkedMsg  = "Преподаватель уже отметил посещаемость на этом занятии."
+	headmanWrongLessonMsg   = "Отметить посещаемость можно только на сегодняшних занятиях своей группы."
+	headmanRegisterMsg      = "📋 **%s**, %s, %s\n\nНажмите на отсутствующих, затем отправьте отметку преподавателю."
+	headmanSentMsg          = "📨 Отметка отправлена преподавателю. Студенты получат уведомления после подтверждения."
+	headmanPendingMsg       = "Отметка уже отправлена и ждёт подтверждения преподавателя."
+	headmanReviewedMsg      = "Преподаватель уже подтвердил посещаемость на этом занятии."
+	headmanSubmissionNotice = "📋 **Посещаемость от старосты**\n\n%s, группа %s, %s\nОтметил(а): %s\nОтсутствуют: %d из %d"
+	headmanConfirmedNotice  = "✅ Преподаватель подтвердил посещаемость: **%s**, %s."
+	headmanEditedNotice     = "✏️ Преподаватель подтвердил посещаемость с исправлениями (%d): **%s**, %s."
+
+	reviewSubmissionMsg  = "📋 **Посещаемость от старосты**\n%s, группа %s, %s %s\nОтметил(а): %s\n\nНажмите на студента, чтобы исправить отметку. ✏️ — исправлено вами."
+	reviewForbiddenMsg   = "Эту отметку может подтвердить только преподаватель занятия."
+	reviewNotPendingMsg  = "Отметка уже подтверждена."
+	reviewConfirmedMsg   = "✅ Посещаемость подтверждена."
+	reviewEditedMsg      = "✅ Посещаемость подтверждена с исправлениями: %d."
+	headmanSubmissionBtn = "📋 От старосты: %s, %s, %s %s"
+	headmanMarkPresent   = "✅ %s"
+	headmanMarkAbsent    = "❌ %s"
+	headmanMarkEdited    = "✏️ "
+	headmanCurrentPrefix = "⭐ "
+
+	// pendingSubmissionDays is how far back submissions awaiting review are
+	// offered to the teacher.
+	pendingSubmissionDays = 14
+
+	btnHeadmanSend    = "📨 Отправить преподавателю"
+	btnHeadmanReview  = "Проверить"
+	btnReviewConfirm  = "✅ Подтвердить"
+	btnHeadmanLessons = "← К занятиям"
+)
+
+// studentMenuKeyboard returns the student menu, with the register button for
+// group headmen.
+func (b *Bot) studentMenuKeyboard(userID int64) *maxbot.Keyboard {
+	if _, err := b.userRepo.GetHeadmanGroupID(userID); err == nil {
+		return GetHeadmanKeyboard(b.MaxAPI)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		b.logger.Warnf("Failed to check headman status of user %d: %v", userID, err)
+	}
+	return GetStudentKeyboard(b.MaxAPI)
+}
+
+func (b *Bot) handleHeadmanCallback(ctx context.Context, userID int64, callbackID, payload string) error {
+	userRole, err := b.getUserRole(userID)
+	if err != nil {
+		return err
+	}
+
+	var id, studentID int64
+	parts := strings.Split(payload, "_")
+	if len(parts) < 2 {
+		return fmt.Errorf("invalid headman callback payload: %s", payload)
+	}
+	action := parts[1]
+	if len(parts) > 2 {
+		fmt.Sscanf(parts[2], "%d", &id)
+	}
+	if len(parts) > 3 {
+		fmt.Sscanf(parts[3], "%d", &studentID)
+	}
+
+	switch action {
+	case "adm", "grp", "set":
+		if userRole != "admin" {
+			return b.answerCallbackWithNotification(ctx, callbackID, registrationForbiddenMsg)
+		}
+		return b.handleHeadmanAssignment(ctx, callbackID, action, id)
+	case "rev", "edt", "ok":
+		if userRole != "teacher" {
+			return b.answerCallbackWithNotification(ctx, callbackID, reviewForbiddenMsg)
+		}
+		return b.handleSubmissionReview(ctx, userID, callbackID, action, id, studentID)
+	}
+
+	groupID, err := b.userRepo.GetHeadmanGroupID(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return b.answerCallbackWithNotification(ctx, callbackID, headmanForbiddenMsg)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "start":
+		return b.answerHeadmanLessons(ctx, callbackID, groupID)
+	case "les":
+		return b.openHeadmanRegister(ctx, userID, callbackID, groupID, id)
+	case "tgl":
+		submission, err := b.attendanceRepo.GetSubmission(id)
+		if err != nil {
+			return err
+		}
+		if submission.GroupID != groupID {
+			return b.answerCallbackWithNotification(ctx, callbackID, headmanWrongLessonMsg)
+		}
+		toggled, err := b.attendanceRepo.ToggleDraftMark(id, studentID)
+		if err != nil {
+			return err
+		}
+		if !toggled {
+			return b.answerCallbackWithNotification(ctx, callbackID, headmanPendingMsg)
+		}
+		return b.answerHeadmanRegister(ctx, callbackID, groupID, id)
+	case "snd":
+		return b.sendHeadmanSubmission(ctx, callbackID, groupID, id)
+	default:
+		return fmt.Errorf("unknown headman callback type: %s", action)
+	}
+}
+
+func (b *Bot) handleHeadmanAssignment(ctx context.Context, callbackID, action string, id int64) error {
+	switch action {
+	case "adm":
+		groups, err := b.groupRepo.GetAllGroups()
+		if err != nil {
+			return err
+		}
+
+		keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+		for _, group := range groups {
+			keyboard.AddRow().AddCallback(group.GroupName, schemes.DEFAULT, fmt.Sprintf("hm_grp_%d", group.GroupID))
+		}
+		keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+		return b.answerWithKeyboard(ctx, callbackID, headmanSelectGroupMsg, keyboard)
+
+	case "grp":
+		return b.answerHeadmanCandidates(ctx, callbackID, id)
+	}
+
+	var isHeadman bool
+	err := b.inTx(func(tx *sqlx.Tx) error {
+		var err error
+		isHeadman, err = b.userRepo.SetHeadman(tx, id)
+		if err != nil || !isHeadman {
+			return err
+		}
+
+		linked, err := b.userRepo.HasMaxID(tx, id)
+		if err != nil || !linked {
+			return err
+		}
+
+		_, err = b.outboxRepo.Enqueue(tx, database.OutboxNotification{
+			UserID:      id,
+			Category:    categorySystem,
+			MessageText: headmanAssignedNotice,
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	studentName, err := b.gradeRepo.GetStudentNameByID(id)
+	if err != nil {
+		b.logger.Warnf("Failed to get student name: %v", err)
+	}
+	b.logger.Infof("Headman status of student %d set to %t", id, isHeadman)
+
+	text := fmt.Sprintf(headmanRemovedMsg, studentName)
+	if isHeadman {
+		text = fmt.Sprintf(headmanAssignedMsg, studentName)
+	}
+	return b.answerWithKeyboard(ctx, callbackID, text, GetAdminKeyboard(b.MaxAPI))
+}
+
+func (b *Bot) answerHeadmanCandidates(ctx context.Context, callbackID string, groupID int64) error {
+	groupName, err := b.groupRepo.GetGroupName(groupID)
+	if err != nil {
+		return err
+	}
+
+	students, err := b.gradeRepo.GetStudentsByGroup(groupID)
+	if err != nil {
+		return err
+	}
+	if len(students) == 0 {
+		return b.answerCallbackWithNotification(ctx, callbackID, noStudentsMsg)
+	}
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	for _, student := range students {
+		name := student.Name
+		if student.IsHeadman {
+			name = headmanCurrentPrefix + name
+		}
+		keyboard.AddRow().AddCallback(name, schemes.DEFAULT, fmt.Sprintf("hm_set_%d", student.UserID))
+	}
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+	return b.answerWithKeyboardMarkdown(ctx, callbackID, fmt.Sprintf(headmanSelectStudentMsg, groupName), keyboard)
+}
+
+func (b *Bot) answerHeadmanLessons(ctx context.Context, callbackID string, groupID int64) error {
+	lessons, err := b.scheduleRepo.GetScheduleForDateByGroup(isoWeekday(time.Now().In(b.location)), groupID)
+	if err != nil {
+		return err
+	}
+	if len(lessons) == 0 {
+		return b.answerCallbackWithNotification(ctx, callbackID, headmanNoLessonsMsg)
+	}
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	for _, lesson := range lessons {
+		subjectName, err := b.subjectRepo.GetSubjectName(lesson.SubjectID)
+		if err != nil {
+			b.logger.Warnf("Failed to get subject name: %v", err)
+		}
+		btnText := fmt.Sprintf("%s %s", lesson.StartTime.Format(timeFormat), subjectName)
+		keyboard.AddRow().AddCallback(btnText, schemes.DEFAULT, fmt.Sprintf("hm_les_%d", lesson.ScheduleID))
+	}
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+	return b.answerWithKeyboard(ctx, callbackID, headmanSelectLessonMsg, keyboard)
+}
+
+// openHeadmanRegister starts or resumes the headman's register for one of
+// today's lessons of their group.
+func (b *Bot) openHeadmanRegister(ctx context.Context, userID int64, callbackID string, groupID, scheduleID int64) error {
+	lesson, err := b.scheduleRepo.GetScheduleByID(scheduleID)
+	if err != nil {
+		return err
+	}
+	if lesson.GroupID != groupID || lesson.Archived || lesson.Weekday != isoWeekday(time.Now().In(b.location)) {
+		return b.answerCallbackWithNotification(ctx, callbackID, headmanWrongLessonMsg)
+	}
+
+	headmanID, err := b.userRepo.GetUserIDByMaxID(userID)
+	if err != nil {
+		return err
+	}
+
+	students, err := b.gradeRepo.GetStudentsByGroup(groupID)
+	if err != nil {
+		return err
+	}
+	studentIDs := make([]int64, len(students))
+	for i, student := range students {
+		studentIDs[i] = student.UserID
+	}
+
+	marked, err := b.attendanceRepo.GetMarkedStudentIDsBySchedule(scheduleID)
+	if err != nil {
+		return err
+	}
+	if len(marked) > 0 {
+		return b.answerCallbackWithNotification(ctx, callbackID, headmanLessonMarkedMsg)
+	}
+
+	var submissionID int64
+	var status string
+	err = b.inTx(func(tx *sqlx.Tx) error {
+		var err error
+		submissionID, status, err = b.attendanceRepo.OpenSubmission(tx, scheduleID, headmanID, studentIDs)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	switch status {
+	case database.SubmissionDraft:
+		return b.answerHeadmanRegister(ctx, callbackID, groupID, submissionID)
+	case database.SubmissionPending:
+		return b.answerCallbackWithNotification(ctx, callbackID, headmanPendingMsg)
+	default:
+		return b.answerCallbackWithNotification(ctx, callbackID, headmanReviewedMsg)
+	}
+}
+
+func (b *Bot) answerHeadmanRegister(ctx context.Context, callbackID string, groupID, submissionID int64) error {
+	submission, err := b.attendanceRepo.GetSubmission(submissionID)
+	if err != nil {
+		return err
+	}
+	if submission.GroupID != groupID {
+		return b.answerCallbackWithNotification(ctx, callbackID, headmanWrongLessonMsg)
+	}
+
+	marks, err := b.attendanceRepo.GetSubmissionMarks(submissionID)
+	if err != nil {
+		return err
+	}
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	for _, mark := range marks {
+		text := fmt.Sprintf(headmanMarkPresent, mark.StudentName)
+		if !mark.SubmittedAttended {
+			text = fmt.Sprintf(headmanMarkAbsent, mark.StudentName)
+		}
+		keyboard.AddRow().AddCallback(text, schemes.DEFAULT, fmt.Sprintf("hm_tgl_%d_%d", submissionID, mark.StudentID))
+	}
+	keyboard.AddRow().AddCallback(btnHeadmanSend, schemes.POSITIVE, fmt.Sprintf("hm_snd_%d", submissionID))
+	keyboard.AddRow().AddCallback(btnHeadmanLessons, schemes.DEFAULT, payloadHeadmanAttendance)
+
+	text := fmt.Sprintf(headmanRegisterMsg, submission.SubjectName, submission.GroupName, submission.StartTime.Format(timeFormat))
+	return b.answerWithKeyboardMarkdown(ctx, callbackID, text, keyboard)
+}
+
+// sendHeadmanSubmission hands the register to the lesson's teacher. Students
+// are not notified until the teacher confirms it.
+func (b *Bot) sendHeadmanSubmission(ctx context.Context, callbackID string, groupID, submissionID int64) error {
+	submission, err := b.attendanceRepo.GetSubmission(submissionID)
+	if err != nil {
+		return err
+	}
+	if submission.GroupID != groupID {
+		return b.answerCallbackWithNotification(ctx, callbackID, headmanWrongLessonMsg)
+	}
+
+	marks, err := b.attendanceRepo.GetSubmissionMarks(submissionID)
+	if err != nil {
+		return err
+	}
+	absent := 0
+	for _, mark := range marks {
+		if !mark.SubmittedAttended {
+			absent++
+		}
+	}
+
+	var sent bool
+	err = b.inTx(func(tx *sqlx.Tx) error {
+		var err error
+		sent, err = b.attendanceRepo.SendSubmission(tx, submissionID)
+		if err != nil || !sent {
+			return err
+		}
+
+		linked, err := b.userRepo.HasMaxID(tx, submission.TeacherID)
+		if err != nil || !linked {
+			return err
+		}
+
+		_, err = b.outboxRepo.Enqueue(tx, database.OutboxNotification{
+			UserID:   submission.TeacherID,
+			Category: categorySystem,
+			MessageText: fmt.Sprintf(headmanSubmissionNotice, submission.SubjectName, submission.GroupName,
+				submission.StartTime.Format(timeFormat), submission.HeadmanName, absent, len(marks)),
+			ButtonText:    btnHeadmanReview,
+			ButtonPayload: fmt.Sprintf("hm_rev_%d", submissionID),
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if !sent {
+		return b.answerCallbackWithNotification(ctx, callbackID, headmanPendingMsg)
+	}
+
+	b.logger.Infof("Headman %d submitted attendance %d for schedule %d", submission.SubmittedBy, submissionID, submission.ScheduleID)
+	return b.answerWithKeyboard(ctx, callbackID, headmanSentMsg, GetHeadmanKeyboard(b.MaxAPI))
+}
+
+func (b *Bot) handleSubmissionReview(ctx context.Context, userID int64, callbackID, action string, submissionID, studentID int64) error {
+	teacherID, err := b.userRepo.GetUserIDByMaxID(userID)
+	if err != nil {
+		return err
+	}
+
+	submission, err := b.attendanceRepo.GetSubmission(submissionID)
+	if err != nil {
+		return err
+	}
+	if submission.TeacherID != teacherID {
+		return b.answerCallbackWithNotification(ctx, callbackID, reviewForbiddenMsg)
+	}
+	if submission.Status != database.SubmissionPending {
+		return b.answerCallbackWithNotification(ctx, callbackID, reviewNotPendingMsg)
+	}
+
+	switch action {
+	case "edt":
+		if _, err := b.attendanceRepo.ToggleReviewMark(submissionID, studentID); err != nil {
+			return err
+		}
+	case "ok":
+		return b.confirmSubmission(ctx, callbackID, teacherID, submission)
+	}
+
+	return b.answerSubmissionReview(ctx, callbackID, submission)
+}
+
+func (b *Bot) answerSubmissionReview(ctx context.Context, callbackID string, submission *database.AttendanceSubmission) error {
+	marks, err := b.attendanceRepo.GetSubmissionMarks(submission.SubmissionID)
+	if err != nil {
+		return err
+	}
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	for _, mark := range marks {
+		text := fmt.Sprintf(headmanMarkPresent, mark.StudentName)
+		if !mark.Attended {
+			text = fmt.Sprintf(headmanMarkAbsent, mark.StudentName)
+		}
+		if mark.Attended != mark.SubmittedAttended {
+			text = headmanMarkEdited + text
+		}
+		keyboard.AddRow().AddCallback(text, schemes.DEFAULT, fmt.Sprintf("hm_edt_%d_%d", submission.SubmissionID, mark.StudentID))
+	}
+	keyboard.AddRow().AddCallback(btnReviewConfirm, schemes.POSITIVE, fmt.Sprintf("hm_ok_%d", submission.SubmissionID))
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+
+	text := fmt.Sprintf(reviewSubmissionMsg, submission.SubjectName, submission.GroupName,
+		submission.LessonDate.Format("02.01"), submission.StartTime.Format(timeFormat), submission.HeadmanName)
+	return b.answerWithKeyboardMarkdown(ctx, callbackID, text, keyboard)
+}
+
+// confirmSubmission writes the reviewed register to attendance, notifies the
+// students as one batch and tells the headman how the review went.
+func (b *Bot) confirmSubmission(ctx context.Context, callbackID string, teacherID int64, submission *database.AttendanceSubmission) error {
+	marks, err := b.attendanceRepo.GetSubmissionMarks(submission.SubmissionID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	lessonTime := submission.StartTime.Format(timeFormat)
+	batchTitle := fmt.Sprintf(attendanceBatchTitle, submission.SubjectName, now.In(b.location).Format("02.01.2006 15:04"))
+
+	var status string
+	edited, notified := 0, 0
+	err = b.inTx(func(tx *sqlx.Tx) error {
+		var err error
+		status, err = b.attendanceRepo.ConfirmSubmission(tx, submission.SubmissionID, teacherID)
+		if err != nil || status == "" {
+			return err
+		}
+
+		batchID, err := b.outboxRepo.CreateBatch(tx, teacherID, batchTitle)
+		if err != nil {
+			return err
+		}
+
+		for _, mark := range marks {
+			if mark.Attended != mark.SubmittedAttended {
+				edited++
+			}
+			notification := attendanceNotification(mark.StudentID, submission.SubjectID, submission.SubjectName, mark.Attended, now)
+			notification.BatchID = &batchID
+			queued, err := b.enqueueStudentNotification(tx, notification)
+			if err != nil {
+				return err
+			}
+			if queued {
+				notified++
+			}
+		}
+
+		headmanText := fmt.Sprintf(headmanConfirmedNotice, submission.SubjectName, lessonTime)
+		if edited > 0 {
+			headmanText = fmt.Sprintf(headmanEditedNotice, edited, submission.SubjectName, lessonTime)
+		}
+		_, err = b.outboxRepo.Enqueue(tx, database.OutboxNotification{
+			UserID:      submission.SubmittedBy,
+			Category:    categorySystem,
+			MessageText: headmanText,
+		})
+		return err
+	})
+	if err != nil {
+		b.logger.Errorf("Failed to confirm attendance submission %d: %v", submission.SubmissionID, err)
+		return b.answerCallbackWithNotification(ctx, callbackID, "Ошибка при отметке посещаемости.")
+	}
+	if status == "" {
+		return b.answerCallbackWithNotification(ctx, callbackID, reviewNotPendingMsg)
+	}
+
+	b.logger.Infof("Teacher %d confirmed attendance submission %d (%s)", teacherID, submission.SubmissionID, status)
+
+	studentIDs := make([]int64, 0, len(marks))
+	for _, mark := range marks {
+		studentIDs = append(studentIDs, mark.StudentID)
+	}
+	go b.checkAlerts(submission.SubjectID, studentIDs...)
+
+	text := reviewConfirmedMsg
+	if edited > 0 {
+		text = fmt.Sprintf(reviewEditedMsg, edited)
+	}
+	if notified > 0 {
+		text += fmt.Sprintf(batchNotificationsNote, notified)
+	}
+	return b.answerWithKeyboard(ctx, callbackID, text, GetTeacherKeyboard(b.MaxAPI))
+}
+
+// addPendingSubmissions puts the recent headman submissions awaiting the
+// teacher's review on top of the attendance menu.
+func (b *Bot) addPendingSubmissions(keyboard *maxbot.Keyboard, teacherID int64) {
+	submissions, err := b.attendanceRepo.GetPendingSubmissionsByTeacher(teacherID, pendingSubmissionDays)
+	if err != nil {
+		b.logger.Warnf("Failed to get pending attendance submissions of teacher %d: %v", teacherID, err)
+		return
+	}
+
+	for _, submission := range submissions {
+		text := fmt.Sprintf(headmanSubmissionBtn, submission.SubjectName, submission.GroupName,
+			submission.LessonDate.Format("02.01"), submission.StartTime.Format(timeFormat))
+		keyboard.AddRow().AddCallback(text, schemes.POSITIVE, fmt.Sprintf("hm_rev_%d", submission.SubmissionID))
+	}
+}
@@ -2,38 +2,96 @@ package maxAPI
 
 import (
 	"fmt"
+	"time"
 
 	maxbot "github.com/max-messenger/max-bot-api-client-go"
 	"github.com/max-messenger/max-bot-api-client-go/schemes"
 
 	"digitalUniversity/database"
+	"digitalUniversity/grading"
 )
 
 const (
 	btnUploadStudents = "Загрузить файл со студентами"
 	btnUploadTeachers = "Загрузить файл с преподавателями"
 	btnUploadSchedule = "Загрузить файл с расписанием"
+	btnUploadGrading  = "Загрузить настройки оценивания"
+	btnUploadRating   = "Загрузить правила рейтинга"
+	btnUploadHolidays = "Загрузить праздничные дни"
 
 	btnShowSchedule   = "Показать расписание"
 	btnMarkScore      = "Поставить оценку"
 	btnMarkAttendance = "Отметить посещаемость"
+	btnShowRating     = "Рейтинг студентов"
+	btnBulkGrade      = "Оценить группу"
+	btnSettings       = "⚙️ Настройки"
+	btnAnnounce       = "📢 Объявление"
+	btnParentInvite   = "👪 Код для родителей"
+	btnParentChildren = "👪 Мои дети"
+	btnParentAdd      = "➕ Добавить ребёнка"
+	btnRegCodes       = "🔑 Коды регистрации"
+	btnRegRequests    = "📝 Заявки на регистрацию"
+	btnHeadmen        = "⭐ Старосты групп"
+	btnHeadmanAttend  = "📋 Отметить посещаемость группы"
+	btnCheckin        = "📲 Отметка по коду"
+	btnAnalytics      = "📈 Аналитика"
+	btnReports        = "📑 Отчёты"
+	btnCalendar       = "📅 Расписание в календарь"
+	btnLookup         = "🔍 Найти расписание"
+	btnScheduleEditor = "✏️ Редактировать расписание"
+
+	btnUploadGradeJournal      = "Загрузить журнал оценок"
+	btnUploadAttendanceJournal = "Загрузить журнал посещаемости"
+
+	btnToday    = "Сегодня"
+	btnTomorrow = "Завтра"
+	btnWeek     = "🗓 Неделя"
+	btnPickDate = "📆 Выбрать дату"
 
 	btnPrev           = "← Назад"
 	btnNext           = "Вперёд →"
 	btnBackToMenu     = "Главное меню"
 	btnShowScore      = "Посмотреть оценки"
 	btnShowAttendance = "Посмотреть посещаемость"
-
-	payloadUploadStudents = "uploadStudents"
-	payloadUploadTeachers = "uploadTeachers"
-	payloadUploadSchedule = "uploadSchedule"
-	payloadShowSchedule   = "showSchedule"
-	payloadShowScore      = "showScore"
-	payloadMarkGrade      = "markGrade"
-	payloadMarkAttendance = "markAttendance"
-	payloadShowAttendance = "showAttendance"
-	payloadScheduleDay    = "sch_day_%d"
-	payloadBackToMenu     = "backToMenu"
+	btnShowProgress   = "🎓 Моя успеваемость"
+
+	payloadUploadStudents    = "uploadStudents"
+	payloadUploadTeachers    = "uploadTeachers"
+	payloadUploadSchedule    = "uploadSchedule"
+	payloadUploadGrading     = "uploadGrading"
+	payloadUploadRating      = "uploadRating"
+	payloadUploadHolidays    = "uploadHolidays"
+	payloadShowSchedule      = "showSchedule"
+	payloadShowScore         = "showScore"
+	payloadShowProgress      = "showProgress"
+	payloadMarkGrade         = "markGrade"
+	payloadMarkAttendance    = "markAttendance"
+	payloadShowAttendance    = "showAttendance"
+	payloadShowRating        = "showRating"
+	payloadBulkGrade         = "bulkGrade"
+	payloadSettings          = "settings"
+	payloadAnnounce          = "announce"
+	payloadParentInvite      = "parentInvite"
+	payloadParentChildren    = "par_kids"
+	payloadParentAdd         = "par_add"
+	payloadRegCodes          = "reg_codes"
+	payloadRegRequests       = "reg_list"
+	payloadHeadmen           = "hm_adm"
+	payloadHeadmanAttendance = "hm_start"
+	payloadCheckin           = "chk_start"
+	payloadAnalytics         = "stat_start"
+	payloadReports           = "rep_start"
+	payloadCalendar          = "ics_start"
+	payloadLookup            = "look_start"
+	payloadScheduleEditor    = "sed_start"
+
+	payloadUploadGradeJournal      = "uploadGradeJournal"
+	payloadUploadAttendanceJournal = "uploadAttendanceJournal"
+	payloadScheduleDay             = "sch_day_%d"
+	payloadScheduleDate            = "sch_date_%s"
+	payloadScheduleWeek            = "sch_week_%s"
+	payloadSchedulePick            = "sch_pick_%s"
+	payloadBackToMenu              = "backToMenu"
 )
 
 func GetAdminKeyboard(api *maxbot.Api) *maxbot.Keyboard {
@@ -41,34 +99,89 @@ func GetAdminKeyboard(api *maxbot.Api) *maxbot.Keyboard {
 	keyboard.AddRow().AddCallback(btnUploadStudents, schemes.NEGATIVE, payloadUploadStudents)
 	keyboard.AddRow().AddCallback(btnUploadTeachers, schemes.NEGATIVE, payloadUploadTeachers)
 	keyboard.AddRow().AddCallback(btnUploadSchedule, schemes.NEGATIVE, payloadUploadSchedule)
+	keyboard.AddRow().AddCallback(btnScheduleEditor, schemes.NEGATIVE, payloadScheduleEditor)
+	keyboard.AddRow().AddCallback(btnUploadGrading, schemes.NEGATIVE, payloadUploadGrading)
+	keyboard.AddRow().AddCallback(btnUploadRating, schemes.NEGATIVE, payloadUploadRating)
+	keyboard.AddRow().AddCallback(btnUploadHolidays, schemes.NEGATIVE, payloadUploadHolidays)
+	keyboard.AddRow().AddCallback(btnReports, schemes.POSITIVE, payloadReports)
+	keyboard.AddRow().AddCallback(btnLookup, schemes.DEFAULT, payloadLookup)
+	keyboard.AddRow().AddCallback(btnAnnounce, schemes.DEFAULT, payloadAnnounce)
+	keyboard.AddRow().AddCallback(btnParentInvite, schemes.DEFAULT, payloadParentInvite)
+	keyboard.AddRow().AddCallback(btnRegCodes, schemes.DEFAULT, payloadRegCodes)
+	keyboard.AddRow().AddCallback(btnRegRequests, schemes.DEFAULT, payloadRegRequests)
+	keyboard.AddRow().AddCallback(btnHeadmen, schemes.DEFAULT, payloadHeadmen)
 	return keyboard
 }
 
 func GetTeacherKeyboard(api *maxbot.Api) *maxbot.Keyboard {
 	keyboard := api.Messages.NewKeyboardBuilder()
 	keyboard.AddRow().AddCallback(btnShowSchedule, schemes.NEGATIVE, payloadShowSchedule)
+	keyboard.AddRow().AddCallback(btnCalendar, schemes.DEFAULT, payloadCalendar)
+	keyboard.AddRow().AddCallback(btnLookup, schemes.DEFAULT, payloadLookup)
 	keyboard.AddRow().AddCallback(btnMarkScore, schemes.NEGATIVE, payloadMarkGrade)
+	keyboard.AddRow().AddCallback(btnBulkGrade, schemes.NEGATIVE, payloadBulkGrade)
 	keyboard.AddRow().AddCallback(btnMarkAttendance, schemes.NEGATIVE, payloadMarkAttendance)
+	keyboard.AddRow().AddCallback(btnCheckin, schemes.NEGATIVE, payloadCheckin)
+	keyboard.AddRow().AddCallback(btnShowRating, schemes.NEGATIVE, payloadShowRating)
+	keyboard.AddRow().AddCallback(btnAnalytics, schemes.NEGATIVE, payloadAnalytics)
+	keyboard.AddRow().AddCallback(btnUploadGradeJournal, schemes.NEGATIVE, payloadUploadGradeJournal)
+	keyboard.AddRow().AddCallback(btnUploadAttendanceJournal, schemes.NEGATIVE, payloadUploadAttendanceJournal)
+	keyboard.AddRow().AddCallback(btnAnnounce, schemes.DEFAULT, payloadAnnounce)
+	keyboard.AddRow().AddCallback(btnSettings, schemes.DEFAULT, payloadSettings)
 	return keyboard
 }
 
 func GetStudentKeyboard(api *maxbot.Api) *maxbot.Keyboard {
 	keyboard := api.Messages.NewKeyboardBuilder()
 	keyboard.AddRow().AddCallback(btnShowSchedule, schemes.NEGATIVE, payloadShowSchedule)
+	keyboard.AddRow().AddCallback(btnShowProgress, schemes.NEGATIVE, payloadShowProgress)
 	keyboard.AddRow().AddCallback(btnShowScore, schemes.NEGATIVE, payloadShowScore)
 	keyboard.AddRow().AddCallback(btnShowAttendance, schemes.NEGATIVE, payloadShowAttendance)
+	keyboard.AddRow().AddCallback(btnCalendar, schemes.DEFAULT, payloadCalendar)
+	keyboard.AddRow().AddCallback(btnLookup, schemes.DEFAULT, payloadLookup)
+	keyboard.AddRow().AddCallback(btnParentInvite, schemes.DEFAULT, payloadParentInvite)
+	keyboard.AddRow().AddCallback(btnSettings, schemes.DEFAULT, payloadSettings)
+	return keyboard
+}
+
+// GetHeadmanKeyboard is the student menu of a group headman.
+func GetHeadmanKeyboard(api *maxbot.Api) *maxbot.Keyboard {
+	keyboard := GetStudentKeyboard(api)
+	keyboard.AddRow().AddCallback(btnHeadmanAttend, schemes.POSITIVE, payloadHeadmanAttendance)
 	return keyboard
 }
 
-func GetScheduleKeyboard(api *maxbot.Api, prev, next int16) *maxbot.Keyboard {
+func GetParentKeyboard(api *maxbot.Api) *maxbot.Keyboard {
 	keyboard := api.Messages.NewKeyboardBuilder()
+	keyboard.AddRow().AddCallback(btnParentChildren, schemes.NEGATIVE, payloadParentChildren)
+	keyboard.AddRow().AddCallback(btnParentAdd, schemes.DEFAULT, payloadParentAdd)
+	keyboard.AddRow().AddCallback(btnLookup, schemes.DEFAULT, payloadLookup)
+	keyboard.AddRow().AddCallback(btnSettings, schemes.DEFAULT, payloadSettings)
+	return keyboard
+}
+
+// GetScheduleKeyboard navigates from the schedule of the date to the
+// neighbouring days, today and tomorrow relative to now, the week of the date
+// and the date picker.
+func GetScheduleKeyboard(api *maxbot.Api, date, now time.Time) *maxbot.Keyboard {
+	keyboard := api.Messages.NewKeyboardBuilder()
+	keyboard.AddRow().
+		AddCallback(btnPrev, schemes.NEGATIVE, scheduleDatePayload(date.AddDate(0, 0, -1))).
+		AddCallback(btnNext, schemes.NEGATIVE, scheduleDatePayload(date.AddDate(0, 0, 1)))
 	keyboard.AddRow().
-		AddCallback(btnPrev, schemes.NEGATIVE, fmt.Sprintf(payloadScheduleDay, prev)).
-		AddCallback(btnNext, schemes.NEGATIVE, fmt.Sprintf(payloadScheduleDay, next))
+		AddCallback(btnToday, schemes.DEFAULT, scheduleDatePayload(now)).
+		AddCallback(btnTomorrow, schemes.DEFAULT, scheduleDatePayload(now.AddDate(0, 0, 1)))
+	keyboard.AddRow().
+		AddCallback(btnWeek, schemes.DEFAULT, fmt.Sprintf(payloadScheduleWeek, date.Format(schedulePayloadDate))).
+		AddCallback(btnPickDate, schemes.DEFAULT, fmt.Sprintf(payloadSchedulePick, date.Format(schedulePayloadMonth)))
 	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
 	return keyboard
 }
 
+func scheduleDatePayload(date time.Time) string {
+	return fmt.Sprintf(payloadScheduleDate, date.Format(schedulePayloadDate))
+}
+
 func GetStudentsPaginationKeyboard(api *maxbot.Api, subjectID, groupID int64, currentPage, totalPages int, students []database.User) *maxbot.Keyboard {
 	keyboard := api.Messages.NewKeyboardBuilder()
 
@@ -96,3 +209,20 @@ func GetStudentsPaginationKeyboard(api *maxbot.Api, subjectID, groupID int64, cu
 	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
 	return keyboard
 }
+
+func GetGradeValuesKeyboard(api *maxbot.Api, scale grading.Scale, payloadFor func(value int) string) *maxbot.Keyboard {
+	keyboard := api.Messages.NewKeyboardBuilder()
+	addGradeValueRows(keyboard, scale, payloadFor)
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+	return keyboard
+}
+
+func addGradeValueRows(keyboard *maxbot.Keyboard, scale grading.Scale, payloadFor func(value int) string) {
+	var row *maxbot.KeyboardRow
+	for i, value := range scale.Values() {
+		if i%gradeButtonsPerRow == 0 {
+			row = keyboard.AddRow()
+		}
+		row.AddCallback(scale.Label(value), schemes.DEFAULT, payloadFor(value))
+	}
+}
@@ -0,0 +1,503 @@
+package maxAPI
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	maxbot "github.com/max-messenger/max-bot-api-client-go"
+	"github.com/max-messenger/max-bot-api-client-go/schemes"
+
+	"digitalUniversity/database"
+)
+
+const (
+	inputScheduleLookup = "schedule_lookup"
+
+	lookupPromptMsg = "🔍 **Поиск по расписанию**\n\n" +
+		"Отправьте фамилию преподавателя, название группы или аудиторию, например: «Иванов», «ИТ-102», «А-101».\n\n" +
+		"Чтобы найти свободную аудиторию, нажмите кнопку ниже."
+	lookupNotFoundMsg    = "Ничего не найдено по запросу «%s». Попробуйте ещё раз или уточните запрос."
+	lookupChooseMsg      = "🔍 Найдено по запросу «%s»:"
+	lookupTeacherHeader  = "👨‍🏫 **%s**\n%s\n\n"
+	lookupGroupHeader    = "👥 **Группа %s**\n\n"
+	lookupRoomHeader     = "🏫 **Аудитория %s**\n🗓️ %s, %s\n\n"
+	lookupRoomRow        = "%s`%s–%s` %s (%s) · 👥 %s · 👨‍🏫 %s\n"
+	lookupRoomFreeNow    = "\n✅ Сейчас свободна."
+	lookupTeacherNow     = "▶️ Сейчас: %s, 🏫 %s, до %s"
+	lookupTeacherNext    = "⏳ Сейчас свободен, следующее занятие в %s: %s, 🏫 %s"
+	lookupTeacherDone    = "Сегодня занятий больше нет."
+	lookupTeacherHoliday = "🎉 Сегодня праздничный день."
+	lookupSlotsMsg       = "🚪 **Свободные аудитории**\n🗓️ %s, %s\n\nВыберите время:"
+	lookupNoSlotsMsg     = "🚪 **Свободные аудитории**\n🗓️ %s, %s\n\nВ этот день занятий нет — все аудитории свободны."
+	lookupHolidaySlots   = "🚪 **Свободные аудитории**\n🗓️ %s, %s\n\n" + scheduleHolidayMsg
+	lookupFreeRoomsMsg   = "🚪 **Свободные аудитории**\n🗓️ %s, %s, %s–%s\n\n%s"
+	lookupNoFreeRoomsMsg = "Свободных аудиторий нет."
+
+	btnLookupAgain = "🔍 Новый поиск"
+	btnFreeRooms   = "🚪 Свободные аудитории"
+	btnNow         = "Сейчас"
+	btnSlots       = "← К выбору времени"
+
+	payloadLookupTeacher = "look_tch_%d_%s"
+	payloadLookupGroup   = "look_grp_%d_%s"
+	payloadLookupRoom    = "look_room_%s_%s"
+	payloadLookupFree    = "look_free_%s"
+	payloadLookupSlot    = "look_slot_%s_%s_%s"
+
+	// lookupLimit caps the matches of each kind offered to choose from.
+	lookupLimit      = 8
+	lookupSlotFormat = "1504"
+)
+
+type lookupKind int
+
+const (
+	lookupAny lookupKind = iota
+	lookupTeacher
+	lookupGroup
+	lookupRoom
+	lookupFree
+)
+
+// lookupKindWords narrow a search down to one kind of match, as in
+// "аудитория А-101" or "где преподаватель Иванов".
+var lookupKindWords = map[string]lookupKind{
+	"преподаватель": lookupTeacher,
+	"преподавателя": lookupTeacher,
+	"препод":        lookupTeacher,
+	"учитель":       lookupTeacher,
+	"группа":        lookupGroup,
+	"группы":        lookupGroup,
+	"аудитория":     lookupRoom,
+	"аудитории":     lookupRoom,
+	"аудиторию":     lookupRoom,
+	"ауд":           lookupRoom,
+	"ауд.":          lookupRoom,
+	"кабинет":       lookupRoom,
+	"свободные":     lookupFree,
+	"свободная":     lookupFree,
+	"свободную":     lookupFree,
+}
+
+// lookupFillerWords are skipped in a search such as "где сейчас Иванов".
+var lookupFillerWords = map[string]bool{
+	"сейчас": true, "сегодня": true, "находится": true, "идет": true, "идёт": true,
+	"занятия": true, "пары": true,
+}
+
+// hasLookupKindWord reports whether the words ask for a teacher, a group or a
+// room rather than a day.
+func hasLookupKindWord(words []string) bool {
+	for _, word := range words {
+		if _, ok := lookupKindWords[strings.ToLower(word)]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Bot) handleLookupCallback(ctx context.Context, userID int64, callbackID, payload string) error {
+	if payload == payloadLookup {
+		b.setPendingInput(userID, inputScheduleLookup)
+		return b.answerCallbackWithKeyboard(ctx, callbackID, b.lookupPromptKeyboard(), lookupPromptMsg)
+	}
+
+	parts := strings.SplitN(payload, "_", 4)
+	if len(parts) < 3 {
+		return fmt.Errorf("invalid lookup callback payload: %s", payload)
+	}
+
+	var (
+		text     string
+		keyboard *maxbot.Keyboard
+		err      error
+	)
+	switch parts[1] {
+	case "tch", "grp":
+		if len(parts) < 4 {
+			return fmt.Errorf("invalid lookup callback payload: %s", payload)
+		}
+		id, parseErr := strconv.ParseInt(parts[2], 10, 64)
+		if parseErr != nil {
+			return fmt.Errorf("invalid lookup callback payload: %s", payload)
+		}
+		date := b.parsePayloadDate(parts[3], schedulePayloadDate)
+		if parts[1] == "tch" {
+			text, keyboard, err = b.buildTeacherLookup(id, date)
+		} else {
+			text, keyboard, err = b.buildGroupLookup(id, date)
+		}
+	case "room":
+		if len(parts) < 4 {
+			return fmt.Errorf("invalid lookup callback payload: %s", payload)
+		}
+		text, keyboard, err = b.buildRoomLookup(parts[3], b.parsePayloadDate(parts[2], schedulePayloadDate))
+	case "free":
+		text, keyboard, err = b.buildTimeSlots(b.parsePayloadDate(parts[2], schedulePayloadDate))
+	case "slot":
+		span := []string{}
+		if len(parts) == 4 {
+			span = strings.Split(parts[3], "_")
+		}
+		if len(span) != 2 {
+			return fmt.Errorf("invalid lookup callback payload: %s", payload)
+		}
+		text, keyboard, err = b.buildFreeRooms(b.parsePayloadDate(parts[2], schedulePayloadDate), span[0], span[1])
+	default:
+		return fmt.Errorf("unknown lookup callback: %s", payload)
+	}
+	if err != nil {
+		return err
+	}
+
+	return b.answerCallbackWithKeyboard(ctx, callbackID, keyboard, text)
+}
+
+// handleLookupInput answers a search sent in reply to the lookup prompt or as
+// a text command.
+func (b *Bot) handleLookupInput(ctx context.Context, userID int64, query string) {
+	text, keyboard, found, err := b.buildLookupResult(query)
+	if err != nil {
+		b.logger.Errorf("Failed to look up schedule for %q: %v", query, err)
+		b.sendKeyboardAfterError(ctx, userID)
+		return
+	}
+	if !found {
+		b.setPendingInput(userID, inputScheduleLookup)
+	}
+	b.sendKeyboard(ctx, keyboard, userID, text)
+}
+
+// buildLookupResult searches teachers, groups and rooms. A single match, or
+// a group or room named exactly like the query, is shown right away; several
+// matches are offered as buttons.
+func (b *Bot) buildLookupResult(query string) (string, *maxbot.Keyboard, bool, error) {
+	kind := lookupAny
+	var words []string
+	for _, word := range strings.Fields(query) {
+		lower := strings.ToLower(word)
+		if k, ok := lookupKindWords[lower]; ok {
+			kind = k
+			continue
+		}
+		if lookupFillerWords[lower] {
+			continue
+		}
+		words = append(words, word)
+	}
+	query = strings.Join(words, " ")
+	today := b.today()
+
+	if kind == lookupFree {
+		text, keyboard, err := b.buildTimeSlots(today)
+		return text, keyboard, true, err
+	}
+	if query == "" {
+		return lookupPromptMsg, b.lookupPromptKeyboard(), false, nil
+	}
+
+	var (
+		teachers []database.User
+		groups   []database.Group
+		rooms    []string
+		err      error
+	)
+	if kind == lookupAny || kind == lookupTeacher {
+		if teachers, err = b.scheduleRepo.SearchTeachers(query, lookupLimit); err != nil {
+			return "", nil, false, err
+		}
+	}
+	if kind == lookupAny || kind == lookupGroup {
+		if groups, err = b.scheduleRepo.SearchGroups(query, lookupLimit); err != nil {
+			return "", nil, false, err
+		}
+	}
+	if kind == lookupAny || kind == lookupRoom {
+		if rooms, err = b.scheduleRepo.SearchRooms(query, lookupLimit); err != nil {
+			return "", nil, false, err
+		}
+	}
+
+	for _, group := range groups {
+		if strings.EqualFold(group.GroupName, query) {
+			text, keyboard, err := b.buildGroupLookup(group.GroupID, today)
+			return text, keyboard, true, err
+		}
+	}
+	for _, room := range rooms {
+		if strings.EqualFold(room, query) {
+			text, keyboard, err := b.buildRoomLookup(room, today)
+			return text, keyboard, true, err
+		}
+	}
+
+	switch len(teachers) + len(groups) + len(rooms) {
+	case 0:
+		return fmt.Sprintf(lookupNotFoundMsg, query), b.lookupPromptKeyboard(), false, nil
+	case 1:
+		var (
+			text     string
+			keyboard *maxbot.Keyboard
+		)
+		switch {
+		case len(teachers) == 1:
+			text, keyboard, err = b.buildTeacherLookup(teachers[0].UserID, today)
+		case len(groups) == 1:
+			text, keyboard, err = b.buildGroupLookup(groups[0].GroupID, today)
+		default:
+			text, keyboard, err = b.buildRoomLookup(rooms[0], today)
+		}
+		return text, keyboard, true, err
+	}
+
+	date := today.Format(schedulePayloadDate)
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	for _, teacher := range teachers {
+		keyboard.AddRow().AddCallback("👨‍🏫 "+teacher.Name, schemes.DEFAULT, fmt.Sprintf(payloadLookupTeacher, teacher.UserID, date))
+	}
+	for _, group := range groups {
+		keyboard.AddRow().AddCallback("👥 "+group.GroupName, schemes.DEFAULT, fmt.Sprintf(payloadLookupGroup, group.GroupID, date))
+	}
+	for _, room := range rooms {
+		keyboard.AddRow().AddCallback("🏫 "+room, schemes.DEFAULT, fmt.Sprintf(payloadLookupRoom, date, room))
+	}
+	keyboard.AddRow().AddCallback(btnLookupAgain, schemes.DEFAULT, payloadLookup)
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+
+	return fmt.Sprintf(lookupChooseMsg, query), keyboard, true, nil
+}
+
+// buildTeacherLookup shows where the teacher is now and their week of the
+// date.
+func (b *Bot) buildTeacherLookup(teacherID int64, date time.Time) (string, *maxbot.Keyboard, error) {
+	lessons, err := b.scheduleRepo.GetCalendarLessons(0, teacherID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	monday := date.AddDate(0, 0, 1-int(isoWeekday(date)))
+	holidays, err := b.holidayRepo.GetHolidays(monday, monday.AddDate(0, 0, 6))
+	if err != nil {
+		return "", nil, err
+	}
+
+	text := fmt.Sprintf(lookupTeacherHeader, b.getTeacherName(teacherID), b.teacherStatus(lessons)) +
+		b.formatWeek(lessons, holidays, monday, true)
+	keyboard := b.lookupWeekKeyboard(monday, func(day time.Time) string {
+		return fmt.Sprintf(payloadLookupTeacher, teacherID, day.Format(schedulePayloadDate))
+	})
+	return text, keyboard, nil
+}
+
+// teacherStatus tells which of today's lessons the teacher is giving now or
+// will give next.
+func (b *Bot) teacherStatus(lessons []database.ScheduleLesson) string {
+	today := b.today()
+	if b.isHoliday(today) {
+		return lookupTeacherHoliday
+	}
+
+	var todayLessons []database.ScheduleLesson
+	var spans [][2]time.Time
+	for _, lesson := range lessons {
+		if lesson.Weekday == isoWeekday(today) {
+			todayLessons = append(todayLessons, lesson)
+			spans = append(spans, [2]time.Time{lesson.StartTime, lesson.EndTime})
+		}
+	}
+
+	current, next := lessonMarks(today, time.Now().In(b.location), spans)
+	switch {
+	case current >= 0:
+		lesson := todayLessons[current]
+		return fmt.Sprintf(lookupTeacherNow, lesson.SubjectName, lesson.ClassRoom, lesson.EndTime.Format(timeFormat))
+	case next >= 0:
+		lesson := todayLessons[next]
+		return fmt.Sprintf(lookupTeacherNext, lesson.StartTime.Format(timeFormat), lesson.SubjectName, lesson.ClassRoom)
+	default:
+		return lookupTeacherDone
+	}
+}
+
+func (b *Bot) buildGroupLookup(groupID int64, date time.Time) (string, *maxbot.Keyboard, error) {
+	lessons, err := b.scheduleRepo.GetCalendarLessons(groupID, 0)
+	if err != nil {
+		return "", nil, err
+	}
+
+	monday := date.AddDate(0, 0, 1-int(isoWeekday(date)))
+	holidays, err := b.holidayRepo.GetHolidays(monday, monday.AddDate(0, 0, 6))
+	if err != nil {
+		return "", nil, err
+	}
+
+	text := fmt.Sprintf(lookupGroupHeader, b.getGroupName(groupID)) + b.formatWeek(lessons, holidays, monday, false)
+	keyboard := b.lookupWeekKeyboard(monday, func(day time.Time) string {
+		return fmt.Sprintf(payloadLookupGroup, groupID, day.Format(schedulePayloadDate))
+	})
+	return text, keyboard, nil
+}
+
+// buildRoomLookup lists the lessons held in the room on the date.
+func (b *Bot) buildRoomLookup(room string, date time.Time) (string, *maxbot.Keyboard, error) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, lookupRoomHeader, room, b.getWeekdayName(isoWeekday(date)), date.Format("02.01"))
+
+	if b.isHoliday(date) {
+		sb.WriteString(scheduleHolidayMsg)
+	} else {
+		lessons, err := b.scheduleRepo.GetRoomLessons(room, isoWeekday(date))
+		if err != nil {
+			return "", nil, err
+		}
+
+		spans := make([][2]time.Time, len(lessons))
+		for i, lesson := range lessons {
+			spans[i] = [2]time.Time{lesson.StartTime, lesson.EndTime}
+		}
+		now := time.Now().In(b.location)
+		current, next := lessonMarks(date, now, spans)
+
+		if len(lessons) == 0 {
+			sb.WriteString("Нет занятий.")
+		}
+		for i, lesson := range lessons {
+			var mark string
+			switch i {
+			case current:
+				mark = weekNowMark
+			case next:
+				mark = weekNextMark
+			}
+			fmt.Fprintf(&sb, lookupRoomRow, mark, lesson.StartTime.Format(timeFormat), lesson.EndTime.Format(timeFormat),
+				lesson.SubjectName, lesson.TypeName, lesson.GroupName, lesson.TeacherName)
+		}
+		if sameDay(date, now) && current < 0 {
+			sb.WriteString(lookupRoomFreeNow)
+		}
+	}
+
+	roomPayload := func(day time.Time) string {
+		return fmt.Sprintf(payloadLookupRoom, day.Format(schedulePayloadDate), room)
+	}
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	keyboard.AddRow().
+		AddCallback(btnPrev, schemes.NEGATIVE, roomPayload(date.AddDate(0, 0, -1))).
+		AddCallback(btnNext, schemes.NEGATIVE, roomPayload(date.AddDate(0, 0, 1)))
+	keyboard.AddRow().AddCallback(btnToday, schemes.DEFAULT, roomPayload(b.today()))
+	b.addLookupFooter(keyboard)
+
+	return strings.TrimSpace(sb.String()), keyboard, nil
+}
+
+// buildTimeSlots offers the lesson times of the date to look for free rooms
+// at, and the current time for today.
+func (b *Bot) buildTimeSlots(date time.Time) (string, *maxbot.Keyboard, error) {
+	dayName := b.getWeekdayName(isoWeekday(date))
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+
+	var text string
+	if b.isHoliday(date) {
+		text = fmt.Sprintf(lookupHolidaySlots, dayName, date.Format("02.01"))
+	} else {
+		slots, err := b.scheduleRepo.GetTimeSlots(isoWeekday(date))
+		if err != nil {
+			return "", nil, err
+		}
+
+		text = fmt.Sprintf(lookupSlotsMsg, dayName, date.Format("02.01"))
+		if len(slots) == 0 {
+			text = fmt.Sprintf(lookupNoSlotsMsg, dayName, date.Format("02.01"))
+		}
+
+		var row *maxbot.KeyboardRow
+		for i, slot := range slots {
+			if i%2 == 0 {
+				row = keyboard.AddRow()
+			}
+			label := slot.StartTime.Format(timeFormat) + "–" + slot.EndTime.Format(timeFormat)
+			row.AddCallback(label, schemes.DEFAULT, slotPayload(date, slot.StartTime, slot.EndTime))
+		}
+
+		now := time.Now().In(b.location)
+		if len(slots) > 0 && sameDay(date, now) {
+			end := now.Add(time.Minute)
+			if !sameDay(end, now) {
+				end = now
+			}
+			keyboard.AddRow().AddCallback(btnNow, schemes.POSITIVE, slotPayload(date, now, end))
+		}
+	}
+
+	dayPayload := func(day time.Time) string {
+		return fmt.Sprintf(payloadLookupFree, day.Format(schedulePayloadDate))
+	}
+	keyboard.AddRow().
+		AddCallback(btnPrev, schemes.NEGATIVE, dayPayload(date.AddDate(0, 0, -1))).
+		AddCallback(btnNext, schemes.NEGATIVE, dayPayload(date.AddDate(0, 0, 1)))
+	b.addLookupFooter(keyboard)
+
+	return text, keyboard, nil
+}
+
+// buildFreeRooms lists the rooms without a lesson between start and end,
+// given as HHMM, on the date.
+func (b *Bot) buildFreeRooms(date time.Time, start, end string) (string, *maxbot.Keyboard, error) {
+	startTime, err := time.Parse(lookupSlotFormat, start)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid time slot start %q: %w", start, err)
+	}
+	endTime, err := time.Parse(lookupSlotFormat, end)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid time slot end %q: %w", end, err)
+	}
+
+	rooms, err := b.scheduleRepo.GetFreeRooms(isoWeekday(date), startTime.Format(timeFormat), endTime.Format(timeFormat))
+	if err != nil {
+		return "", nil, err
+	}
+
+	list := lookupNoFreeRoomsMsg
+	if len(rooms) > 0 {
+		list = strings.Join(rooms, ", ")
+	}
+	text := fmt.Sprintf(lookupFreeRoomsMsg, b.getWeekdayName(isoWeekday(date)), date.Format("02.01"),
+		startTime.Format(timeFormat), endTime.Format(timeFormat), list)
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	keyboard.AddRow().AddCallback(btnSlots, schemes.DEFAULT, fmt.Sprintf(payloadLookupFree, date.Format(schedulePayloadDate)))
+	b.addLookupFooter(keyboard)
+
+	return text, keyboard, nil
+}
+
+func (b *Bot) lookupPromptKeyboard() *maxbot.Keyboard {
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	keyboard.AddRow().AddCallback(btnFreeRooms, schemes.DEFAULT, fmt.Sprintf(payloadLookupFree, b.today().Format(schedulePayloadDate)))
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+	return keyboard
+}
+
+// lookupWeekKeyboard moves between the weeks of a found timetable; payload
+// makes the callback for a day of the week to show.
+func (b *Bot) lookupWeekKeyboard(monday time.Time, payload func(day time.Time) string) *maxbot.Keyboard {
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	keyboard.AddRow().
+		AddCallback(btnPrev, schemes.NEGATIVE, payload(monday.AddDate(0, 0, -7))).
+		AddCallback(btnNext, schemes.NEGATIVE, payload(monday.AddDate(0, 0, 7)))
+	keyboard.AddRow().AddCallback(btnToday, schemes.DEFAULT, payload(b.today()))
+	b.addLookupFooter(keyboard)
+	return keyboard
+}
+
+func (b *Bot) addLookupFooter(keyboard *maxbot.Keyboard) {
+	keyboard.AddRow().AddCallback(btnLookupAgain, schemes.DEFAULT, payloadLookup)
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+}
+
+func slotPayload(date, start, end time.Time) string {
+	return fmt.Sprintf(payloadLookupSlot, date.Format(schedulePayloadDate), start.Format(lookupSlotFormat), end.Format(lookupSlotFormat))
+}
@@ -35,7 +35,16 @@ func (b *Bot) sendErrorAndResetUpload(ctx context.Context, userID int64, errorMs
 func (b *Bot) sendSuccessMessage(ctx context.Context, userID int64, uploadType string) {
 	message := b.getSuccessMessage(uploadType)
 	b.sendMessage(ctx, userID, message)
-	b.sendKeyboard(ctx, GetAdminKeyboard(b.MaxAPI), userID, nextActionMessage)
+
+	userRole, err := b.getUserRole(userID)
+	if err != nil {
+		b.logger.Errorf("Failed to get user role: %v", err)
+		return
+	}
+
+	if keyboard, _ := b.getMenuByRole(userRole); keyboard != nil {
+		b.sendKeyboard(ctx, keyboard, userID, nextActionMessage)
+	}
 }
 
 func (b *Bot) getSuccessMessage(uploadType string) string {
@@ -43,6 +52,12 @@ func (b *Bot) getSuccessMessage(uploadType string) string {
 		"students": studentsSuccessMessage,
 		"teachers": teachersSuccessMessage,
 		"schedule": scheduleSuccessMessage,
+		"grading":  gradingSuccessMessage,
+		"rating":   ratingSuccessMessage,
+		"holidays": holidaysSuccessMessage,
+
+		"grade_journal":      gradeJournalSuccessMsg,
+		"attendance_journal": attendJournalSuccessMsg,
 	}
 
 	if msg, exists := messages[uploadType]; exists {
@@ -109,11 +124,14 @@ func (b *Bot) sendWelcomeWithKeyboard(ctx context.Context, userID int64, role st
 		keyboard = GetTeacherKeyboard(b.MaxAPI)
 		msg = welcomeTeacherMsg
 	case "student":
-		keyboard = GetStudentKeyboard(b.MaxAPI)
+		keyboard = b.studentMenuKeyboard(userID)
 		msg = welcomeStudentMsg
+	case "parent":
+		keyboard = GetParentKeyboard(b.MaxAPI)
+		msg = welcomeParentMsg
 	default:
 		b.logger.Warnf("Unknown role: %q", role)
-		b.sendMessage(ctx, userID, "Добро пожаловать! 👋")
+		b.sendMessage(ctx, userID, welcomeGuestMsg)
 		return
 	}
 
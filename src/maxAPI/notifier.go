@@ -0,0 +1,230 @@
+package maxAPI
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	maxbot "github.com/max-messenger/max-bot-api-client-go"
+	"github.com/max-messenger/max-bot-api-client-go/schemes"
+
+	"digitalUniversity/database"
+)
+
+const (
+	categoryGrades        = "grades"
+	categoryAttendance    = "attendance"
+	categorySchedule      = "schedule"
+	categoryAnnouncements = "announcements"
+	categorySystem        = "system"
+	categoryAlerts        = "alerts"
+
+	deliveryInstant = "instant"
+	deliveryDaily   = "daily"
+
+	dailySummaryHeader    = "📬 **Сводка уведомлений за день**\n\n"
+	dailySummarySeparator = "\n\n➖➖➖\n\n"
+	maxSummaryButtons     = 5
+
+	batchSummaryHeader   = "📨 **Уведомления отправлены**\n\n%s\nДоставлено: **%d** из **%d**"
+	batchSummaryDeferred = "\nОтложено по настройкам студентов: %d"
+	batchSummarySkipped  = "\nОтключены студентами: %d"
+	batchSummaryFailed   = "\nНе доставлено: %d"
+)
+
+// routeAction is what the user's preferences say to do with a notification.
+type routeAction int
+
+const (
+	routeSend routeAction = iota
+	routeSkip
+	routeDaily
+	routePostpone
+)
+
+// routeNotification applies the user's preferences: disabled categories are
+// dropped, daily mode collects notifications for the evening summary and
+// quiet hours postpone instant delivery until they end.
+func routeNotification(settings *database.UserSettings, category string, now time.Time) (routeAction, time.Time) {
+	switch {
+	case !categoryEnabled(settings, category):
+		return routeSkip, time.Time{}
+	case settings.DeliveryMode == deliveryDaily:
+		return routeDaily, time.Time{}
+	case inQuietHours(settings, now):
+		return routePostpone, quietHoursEnd(settings, now)
+	default:
+		return routeSend, time.Time{}
+	}
+}
+
+// deliverNotifications sends the notifications to the user as one message,
+// with a button per distinct action and the attached files.
+func (b *Bot) deliverNotifications(ctx context.Context, userID int64, header string, notifications []database.OutboxNotification) error {
+	var userMaxID int64
+	if notifications[0].UserMaxID != nil {
+		userMaxID = *notifications[0].UserMaxID
+	} else {
+		maxID, err := b.userRepo.GetUserMaxIDByID(userID)
+		if err != nil {
+			return err
+		}
+		userMaxID = maxID
+	}
+
+	texts := make([]string, 0, len(notifications))
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	buttons := make(map[string]bool)
+
+	for _, n := range notifications {
+		texts = append(texts, n.MessageText)
+		if n.ButtonPayload == "" || buttons[n.ButtonPayload] || len(buttons) == maxSummaryButtons {
+			continue
+		}
+		buttons[n.ButtonPayload] = true
+		keyboard.AddRow().AddCallback(n.ButtonText, schemes.POSITIVE, n.ButtonPayload)
+	}
+
+	msg := maxbot.NewMessage().
+		SetUser(userMaxID).
+		SetText(header + strings.Join(texts, dailySummarySeparator)).
+		SetFormat("markdown")
+	if len(buttons) > 0 {
+		msg.AddKeyboard(keyboard)
+	}
+	for _, n := range notifications {
+		if n.AttachmentType == attachmentFile && n.AttachmentToken != "" {
+			msg.AddFile(&schemes.UploadedInfo{Token: n.AttachmentToken})
+		}
+	}
+
+	if _, err := b.MaxAPI.Messages.Send(ctx, msg); err != nil && err.Error() != "" {
+		return err
+	}
+
+	b.logger.Debugf("Sent %d notification(s) to user %d (max_id: %d)", len(notifications), userID, userMaxID)
+	return nil
+}
+
+// deliverDailySummaries sends collected notifications to users whose summary
+// time falls into [from, to). A failed summary stays queued for the next day.
+func (b *Bot) deliverDailySummaries(ctx context.Context, from, to string) {
+	userIDs, err := b.outboxRepo.GetSummaryUserIDs(from, to)
+	if err != nil {
+		b.logger.Errorf("Failed to get daily summary recipients: %v", err)
+		return
+	}
+
+	for _, userID := range userIDs {
+		notifications, err := b.outboxRepo.GetDailyNotifications(userID)
+		if err != nil {
+			b.logger.Errorf("Failed to get daily notifications for user %d: %v", userID, err)
+			continue
+		}
+		if len(notifications) == 0 {
+			continue
+		}
+
+		if err := b.deliverNotifications(ctx, userID, dailySummaryHeader, notifications); err != nil {
+			b.logger.Warnf("Failed to send daily summary to user %d: %v", userID, err)
+			continue
+		}
+
+		ids := make([]int64, len(notifications))
+		for i, n := range notifications {
+			ids[i] = n.OutboxID
+		}
+		if err := b.outboxRepo.MarkSent(ids); err != nil {
+			b.logger.Errorf("Failed to mark daily summary of user %d as sent: %v", userID, err)
+		}
+	}
+}
+
+// sendBatchSummaries tells the requester of each finished batch how many of
+// its notifications were delivered. The summary itself goes through the
+// outbox, in the same transaction that closes the batch.
+func (b *Bot) sendBatchSummaries() {
+	summaries, err := b.outboxRepo.GetFinishedBatches()
+	if err != nil {
+		b.logger.Errorf("Failed to get finished notification batches: %v", err)
+		return
+	}
+
+	for _, summary := range summaries {
+		err := b.inTx(func(tx *sqlx.Tx) error {
+			if _, err := b.outboxRepo.Enqueue(tx, batchSummaryNotification(summary)); err != nil {
+				return err
+			}
+			return b.outboxRepo.MarkBatchSummarySent(tx, summary.BatchID)
+		})
+		if err != nil {
+			b.logger.Errorf("Failed to queue summary of batch %d: %v", summary.BatchID, err)
+			continue
+		}
+		b.logger.Infof("Batch %d finished: %d of %d delivered", summary.BatchID, summary.Sent, summary.Total)
+	}
+}
+
+func batchSummaryNotification(summary database.NotificationBatchSummary) database.OutboxNotification {
+	text := fmt.Sprintf(batchSummaryHeader, summary.Title, summary.Sent, summary.Total)
+	if summary.Deferred > 0 {
+		text += fmt.Sprintf(batchSummaryDeferred, summary.Deferred)
+	}
+	if summary.Skipped > 0 {
+		text += fmt.Sprintf(batchSummarySkipped, summary.Skipped)
+	}
+	if summary.Failed > 0 {
+		text += fmt.Sprintf(batchSummaryFailed, summary.Failed)
+	}
+
+	return database.OutboxNotification{
+		UserID:      summary.RequestedBy,
+		Category:    categorySystem,
+		MessageText: text,
+	}
+}
+
+func categoryEnabled(settings *database.UserSettings, category string) bool {
+	switch category {
+	case categoryGrades:
+		return settings.NotifyGrades
+	case categoryAttendance:
+		return settings.NotifyAttendance
+	case categorySchedule:
+		return settings.NotifySchedule
+	case categoryAnnouncements:
+		return settings.NotifyAnnouncements
+	default:
+		return true
+	}
+}
+
+func inQuietHours(settings *database.UserSettings, now time.Time) bool {
+	if settings.QuietFrom == nil || settings.QuietTo == nil {
+		return false
+	}
+
+	current := minutesOfDay(now)
+	from, to := minutesOfDay(*settings.QuietFrom), minutesOfDay(*settings.QuietTo)
+
+	if from <= to {
+		return current >= from && current < to
+	}
+	return current >= from || current < to
+}
+
+// quietHoursEnd returns the nearest moment after now when quiet hours end.
+func quietHoursEnd(settings *database.UserSettings, now time.Time) time.Time {
+	to := *settings.QuietTo
+	end := time.Date(now.Year(), now.Month(), now.Day(), to.Hour(), to.Minute(), 0, 0, now.Location())
+	if !end.After(now) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return end
+}
+
+func minutesOfDay(t time.Time) int {
+	return t.Hour()*60 + t.Minute()
+}
@@ -0,0 +1,121 @@
+package maxAPI
+
+import (
+	"context"
+	"time"
+
+	"digitalUniversity/config"
+	"digitalUniversity/database"
+)
+
+// StartOutbox runs the worker that delivers queued notifications. Sends are
+// rate limited; failed ones are retried with exponential backoff and moved to
+// the dead letters after the configured number of attempts.
+func (b *Bot) StartOutbox(ctx context.Context, cfg *config.OutboxConfig) {
+	released, err := b.outboxRepo.ReleaseStale()
+	if err != nil {
+		b.logger.Errorf("Failed to release stale outbox notifications: %v", err)
+	} else if released > 0 {
+		b.logger.Warnf("Returned %d interrupted notifications to the outbox", released)
+	}
+
+	go b.runOutbox(ctx, cfg)
+}
+
+func (b *Bot) runOutbox(ctx context.Context, cfg *config.OutboxConfig) {
+	poll := time.NewTicker(cfg.Interval)
+	defer poll.Stop()
+
+	limiter := time.NewTicker(time.Second / time.Duration(max(cfg.RatePerSecond, 1)))
+	defer limiter.Stop()
+
+	b.logger.Infof("Outbox worker started: interval=%s, rate=%d/s", cfg.Interval, cfg.RatePerSecond)
+
+	for {
+		select {
+		case <-ctx.Done():
+			b.logger.Infof("Outbox worker stopped")
+			return
+		case <-poll.C:
+		}
+
+		notifications, err := b.outboxRepo.ClaimDue(cfg.BatchSize)
+		if err != nil {
+			b.logger.Errorf("Failed to claim outbox notifications: %v", err)
+			continue
+		}
+
+		for i, n := range notifications {
+			select {
+			case <-ctx.Done():
+				b.releaseUnprocessed(notifications[i:])
+				return
+			case <-limiter.C:
+			}
+			b.processOutboxNotification(ctx, cfg, n)
+		}
+
+		b.sendBatchSummaries()
+	}
+}
+
+func (b *Bot) processOutboxNotification(ctx context.Context, cfg *config.OutboxConfig, n database.OutboxNotification) {
+	settings, err := b.settingsRepo.GetUserSettings(n.UserID)
+	if err != nil {
+		b.failOutboxNotification(cfg, n, err)
+		return
+	}
+
+	action, until := routeNotification(settings, n.Category, time.Now().In(b.location))
+
+	switch action {
+	case routeSkip:
+		err = b.outboxRepo.SetStatus(n.OutboxID, database.OutboxStatusSkipped)
+	case routeDaily:
+		err = b.outboxRepo.SetStatus(n.OutboxID, database.OutboxStatusDaily)
+	case routePostpone:
+		err = b.outboxRepo.Postpone(n.OutboxID, until)
+	default:
+		if sendErr := b.deliverNotifications(ctx, n.UserID, "", []database.OutboxNotification{n}); sendErr != nil {
+			b.failOutboxNotification(cfg, n, sendErr)
+			return
+		}
+		err = b.outboxRepo.MarkSent([]int64{n.OutboxID})
+	}
+
+	if err != nil {
+		b.logger.Errorf("Failed to update outbox notification %d: %v", n.OutboxID, err)
+	}
+}
+
+func (b *Bot) failOutboxNotification(cfg *config.OutboxConfig, n database.OutboxNotification, cause error) {
+	retryAt := time.Now().Add(retryBackoff(cfg, n.Attempts))
+	if n.Attempts+1 >= cfg.MaxAttempts {
+		b.logger.Errorf("Notification %d for user %d is dead after %d attempts: %v", n.OutboxID, n.UserID, n.Attempts+1, cause)
+	} else {
+		b.logger.Warnf("Notification %d for user %d failed (attempt %d), retry at %s: %v",
+			n.OutboxID, n.UserID, n.Attempts+1, retryAt.Format(time.RFC3339), cause)
+	}
+
+	if err := b.outboxRepo.MarkFailed(n.OutboxID, cause.Error(), retryAt, cfg.MaxAttempts); err != nil {
+		b.logger.Errorf("Failed to record outbox failure %d: %v", n.OutboxID, err)
+	}
+}
+
+// releaseUnprocessed returns claimed notifications to the queue on shutdown.
+func (b *Bot) releaseUnprocessed(notifications []database.OutboxNotification) {
+	for _, n := range notifications {
+		if err := b.outboxRepo.Postpone(n.OutboxID, n.NextAttemptAt); err != nil {
+			b.logger.Errorf("Failed to release outbox notification %d: %v", n.OutboxID, err)
+		}
+	}
+}
+
+// retryBackoff doubles the delay with each attempt, capped at RetryMax.
+func retryBackoff(cfg *config.OutboxConfig, attempts int) time.Duration {
+	delay := cfg.RetryBase
+	for i := 0; i < attempts && delay < cfg.RetryMax; i++ {
+		delay *= 2
+	}
+	return min(delay, cfg.RetryMax)
+}
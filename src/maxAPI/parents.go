@@ -0,0 +1,437 @@
+package maxAPI
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	maxbot "github.com/max-messenger/max-bot-api-client-go"
+	"github.com/max-messenger/max-bot-api-client-go/schemes"
+
+	"digitalUniversity/database"
+	"digitalUniversity/services"
+)
+
+const (
+	inputParentCode = "parent_code"
+
+	parentInviteCreatedMsg  = "👪 Код приглашения для родителя студента **%s**: `%s`\n\nДействует до %s. Родитель должен открыть бота и отправить этот код сообщением. Код можно использовать один раз."
+	parentInviteSelectGroup = "Выберите группу студента:"
+	parentInviteSelectStud  = "Выберите студента, для родителя которого нужен код:"
+	parentInviteErrorMsg    = "Не удалось создать код приглашения."
+	parentEnterCodeMsg      = "Отправьте код приглашения, полученный у студента или администратора."
+	parentInvalidCodeMsg    = "❌ Код приглашения не найден, уже использован или истёк. Попросите новый код у студента или администратора."
+	parentLinkedMsg         = "✅ Вы подключены как родитель студента **%s**."
+	parentLinkErrorMsg      = "Не удалось подключить аккаунт. Попробуйте позже."
+	parentWrongRoleMsg      = "Код приглашения предназначен для родителей, а ваш аккаунт зарегистрирован с другой ролью. Код не использован — передайте его родителю."
+	parentNoChildrenMsg     = "К вашему аккаунту пока не привязан ни один студент."
+	parentChildrenMsg       = "👪 Выберите студента:"
+	parentChildMenuMsg      = "👤 **%s**\nГруппа: %s\n\nВыберите раздел:"
+	parentNoGroupMsg        = "Студент пока не распределён в группу."
+	parentNoSubjectsMsg     = "У группы студента пока нет предметов."
+	parentSelectSubjectMsg  = "Выберите предмет:"
+	parentForbiddenMsg      = "Раздел доступен только родителям."
+	parentNotLinkedMsg      = "Этот студент не привязан к вашему аккаунту."
+	parentMirrorPrefix      = "👪 **%s**\n\n"
+	parentNoGroupName       = "не указана"
+
+	btnParentSchedule = "Расписание"
+	btnParentGrades   = "Оценки"
+	btnParentAttend   = "Посещаемость"
+	btnParentMirror   = "🔔 Копии уведомлений: %s"
+	btnParentBack     = "← К студенту"
+	btnParentSubjects = "← Другой предмет"
+	btnParentOpen     = "👪 Открыть"
+
+	parentInviteTTL = 72 * time.Hour
+)
+
+// handleParentInviteStart gives a student an invitation code for a parent,
+// and lets an administrator pick the student first.
+func (b *Bot) handleParentInviteStart(ctx context.Context, userID int64, callbackID string) error {
+	userRole, err := b.getUserRole(userID)
+	if err != nil {
+		return err
+	}
+
+	switch userRole {
+	case "student":
+		studentID, err := b.userRepo.GetUserIDByMaxID(userID)
+		if err != nil {
+			return err
+		}
+		return b.answerParentInvite(ctx, callbackID, studentID, studentID, GetStudentKeyboard(b.MaxAPI))
+
+	case "admin":
+		groups, err := b.groupRepo.GetAllGroups()
+		if err != nil {
+			return err
+		}
+
+		keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+		for _, group := range groups {
+			keyboard.AddRow().AddCallback(group.GroupName, schemes.DEFAULT, fmt.Sprintf("par_inv_grp_%d", group.GroupID))
+		}
+		keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+		return b.answerWithKeyboard(ctx, callbackID, parentInviteSelectGroup, keyboard)
+
+	default:
+		return b.answerCallbackWithNotification(ctx, callbackID, announceForbiddenMsg)
+	}
+}
+
+func (b *Bot) answerParentInvite(ctx context.Context, callbackID string, studentID, createdBy int64, keyboard *maxbot.Keyboard) error {
+	code, err := services.GenerateInviteCode()
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(parentInviteTTL)
+	if err := b.parentRepo.CreateInvite(code, studentID, createdBy, expiresAt); err != nil {
+		b.logger.Errorf("Failed to create parent invite for student %d: %v", studentID, err)
+		return b.answerCallbackWithNotification(ctx, callbackID, parentInviteErrorMsg)
+	}
+
+	studentName, err := b.gradeRepo.GetStudentNameByID(studentID)
+	if err != nil {
+		b.logger.Warnf("Failed to get student name: %v", err)
+	}
+
+	b.logger.Infof("User %d created a parent invite for student %d", createdBy, studentID)
+
+	text := fmt.Sprintf(parentInviteCreatedMsg, studentName, code, expiresAt.In(b.location).Format("02.01.2006 15:04"))
+	return b.answerWithKeyboardMarkdown(ctx, callbackID, text, keyboard)
+}
+
+func (b *Bot) handleParentCallback(ctx context.Context, userID int64, callbackID, payload string) error {
+	userRole, err := b.getUserRole(userID)
+	if err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(payload, "par_inv_") {
+		if userRole != "admin" {
+			return b.answerCallbackWithNotification(ctx, callbackID, announceForbiddenMsg)
+		}
+		return b.handleParentInviteCallback(ctx, userID, callbackID, payload)
+	}
+
+	if userRole != "parent" {
+		return b.answerCallbackWithNotification(ctx, callbackID, parentForbiddenMsg)
+	}
+
+	parentID, err := b.userRepo.GetUserIDByMaxID(userID)
+	if err != nil {
+		return err
+	}
+
+	switch payload {
+	case payloadParentChildren:
+		return b.handleParentChildren(ctx, parentID, callbackID)
+	case payloadParentAdd:
+		b.setPendingInput(userID, inputParentCode)
+		return b.answerCallbackWithNotification(ctx, callbackID, parentEnterCodeMsg)
+	}
+
+	var studentID, arg int64
+	parts := strings.Split(payload, "_")
+	if len(parts) < 3 {
+		return fmt.Errorf("invalid parent callback payload: %s", payload)
+	}
+	action := parts[1]
+	fmt.Sscanf(parts[2], "%d", &studentID)
+	if len(parts) > 3 {
+		fmt.Sscanf(parts[3], "%d", &arg)
+	}
+
+	child, err := b.parentRepo.GetChild(parentID, studentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		b.logger.Warnf("Parent %d requested data of unlinked student %d", parentID, studentID)
+		return b.answerCallbackWithNotification(ctx, callbackID, parentNotLinkedMsg)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "kid":
+		return b.answerParentChildMenu(ctx, callbackID, child)
+	case "mir":
+		if err := b.parentRepo.SetMirrorNotifications(parentID, studentID, !child.MirrorNotifications); err != nil {
+			return err
+		}
+		child.MirrorNotifications = !child.MirrorNotifications
+		return b.answerParentChildMenu(ctx, callbackID, child)
+	}
+
+	if child.GroupID == nil {
+		return b.answerCallbackWithNotification(ctx, callbackID, parentNoGroupMsg)
+	}
+
+	switch action {
+	case "sch":
+		return b.answerParentSchedule(ctx, callbackID, child, int16(arg))
+	case "grd":
+		return b.answerParentSubjects(ctx, callbackID, child, "par_grs_%d_%d")
+	case "att":
+		return b.answerParentSubjects(ctx, callbackID, child, "par_ats_%d_%d")
+	case "grs":
+		text, err := b.buildStudentGradesText(studentID, arg)
+		if err != nil {
+			return err
+		}
+		return b.answerWithPhotoMarkdown(ctx, callbackID, text, b.gradeTimelineChart(ctx, studentID, arg), b.parentChildBackKeyboard(studentID, fmt.Sprintf("par_grd_%d", studentID)))
+	case "ats":
+		text, err := b.buildStudentAttendanceText(studentID, arg)
+		if err != nil {
+			return err
+		}
+		return b.answerWithPhotoMarkdown(ctx, callbackID, text, b.attendanceHeatmapChart(ctx, studentID, arg), b.parentChildBackKeyboard(studentID, fmt.Sprintf("par_att_%d", studentID)))
+	default:
+		return fmt.Errorf("unknown parent callback type: %s", action)
+	}
+}
+
+func (b *Bot) handleParentInviteCallback(ctx context.Context, userID int64, callbackID, payload string) error {
+	var id int64
+
+	if strings.HasPrefix(payload, "par_inv_grp_") {
+		fmt.Sscanf(payload, "par_inv_grp_%d", &id)
+
+		students, err := b.gradeRepo.GetStudentsByGroup(id)
+		if err != nil {
+			return err
+		}
+		if len(students) == 0 {
+			return b.answerCallbackWithNotification(ctx, callbackID, noStudentsMsg)
+		}
+
+		keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+		for _, student := range students {
+			keyboard.AddRow().AddCallback(student.Name, schemes.DEFAULT, fmt.Sprintf("par_inv_stu_%d", student.UserID))
+		}
+		keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+		return b.answerWithKeyboard(ctx, callbackID, parentInviteSelectStud, keyboard)
+	}
+
+	fmt.Sscanf(payload, "par_inv_stu_%d", &id)
+
+	adminID, err := b.userRepo.GetUserIDByMaxID(userID)
+	if err != nil {
+		return err
+	}
+	return b.answerParentInvite(ctx, callbackID, id, adminID, GetAdminKeyboard(b.MaxAPI))
+}
+
+func (b *Bot) handleParentChildren(ctx context.Context, parentID int64, callbackID string) error {
+	children, err := b.parentRepo.GetChildren(parentID)
+	if err != nil {
+		b.logger.Errorf("Failed to get children of parent %d: %v", parentID, err)
+		return err
+	}
+
+	switch len(children) {
+	case 0:
+		return b.answerCallbackWithNotification(ctx, callbackID, parentNoChildrenMsg)
+	case 1:
+		return b.answerParentChildMenu(ctx, callbackID, &children[0])
+	}
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	for _, child := range children {
+		keyboard.AddRow().AddCallback(child.StudentName, schemes.DEFAULT, fmt.Sprintf("par_kid_%d", child.StudentID))
+	}
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+	return b.answerWithKeyboard(ctx, callbackID, parentChildrenMsg, keyboard)
+}
+
+func (b *Bot) answerParentChildMenu(ctx context.Context, callbackID string, child *database.ParentChild) error {
+	groupName := parentNoGroupName
+	if child.GroupName != nil {
+		groupName = *child.GroupName
+	}
+
+	mirror := btnOff
+	if child.MirrorNotifications {
+		mirror = btnOn
+	}
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	keyboard.AddRow().AddCallback(btnParentSchedule, schemes.NEGATIVE, fmt.Sprintf("par_sch_%d_%d", child.StudentID, isoWeekday(time.Now().In(b.location))))
+	keyboard.AddRow().AddCallback(btnParentGrades, schemes.NEGATIVE, fmt.Sprintf("par_grd_%d", child.StudentID))
+	keyboard.AddRow().AddCallback(btnParentAttend, schemes.NEGATIVE, fmt.Sprintf("par_att_%d", child.StudentID))
+	keyboard.AddRow().AddCallback(fmt.Sprintf(btnParentMirror, mirror), schemes.DEFAULT, fmt.Sprintf("par_mir_%d", child.StudentID))
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+
+	text := fmt.Sprintf(parentChildMenuMsg, child.StudentName, groupName)
+	return b.answerWithKeyboardMarkdown(ctx, callbackID, text, keyboard)
+}
+
+func (b *Bot) answerParentSchedule(ctx context.Context, callbackID string, child *database.ParentChild, weekday int16) error {
+	if weekday < 1 || weekday > 7 {
+		weekday = isoWeekday(time.Now().In(b.location))
+	}
+
+	entries, err := b.scheduleRepo.GetScheduleForDateByGroup(weekday, *child.GroupID)
+	if err != nil {
+		b.logger.Errorf("Failed to get schedule for group %d: %v", *child.GroupID, err)
+		return err
+	}
+
+	prevDay, nextDay := b.calculateNavigationDays(weekday)
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	keyboard.AddRow().
+		AddCallback(btnPrev, schemes.NEGATIVE, fmt.Sprintf("par_sch_%d_%d", child.StudentID, prevDay)).
+		AddCallback(btnNext, schemes.NEGATIVE, fmt.Sprintf("par_sch_%d_%d", child.StudentID, nextDay))
+	keyboard.AddRow().AddCallback(btnParentBack, schemes.DEFAULT, fmt.Sprintf("par_kid_%d", child.StudentID))
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+
+	return b.answerWithKeyboardMarkdown(ctx, callbackID, b.formatSchedule(entries, b.getNearestDateForWeekday(weekday)), keyboard)
+}
+
+func (b *Bot) answerParentSubjects(ctx context.Context, callbackID string, child *database.ParentChild, payloadFormat string) error {
+	subjects, err := b.gradeRepo.GetSubjectsByStudentGroup(*child.GroupID)
+	if err != nil {
+		b.logger.Errorf("Failed to get subjects for group %d: %v", *child.GroupID, err)
+		return err
+	}
+	if len(subjects) == 0 {
+		return b.answerCallbackWithNotification(ctx, callbackID, parentNoSubjectsMsg)
+	}
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	for _, subject := range subjects {
+		keyboard.AddRow().AddCallback(subject.SubjectName, schemes.DEFAULT, fmt.Sprintf(payloadFormat, child.StudentID, subject.SubjectID))
+	}
+	keyboard.AddRow().AddCallback(btnParentBack, schemes.DEFAULT, fmt.Sprintf("par_kid_%d", child.StudentID))
+	return b.answerWithKeyboard(ctx, callbackID, parentSelectSubjectMsg, keyboard)
+}
+
+func (b *Bot) parentChildBackKeyboard(studentID int64, subjectsPayload string) *maxbot.Keyboard {
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	keyboard.AddRow().AddCallback(btnParentSubjects, schemes.DEFAULT, subjectsPayload)
+	keyboard.AddRow().AddCallback(btnParentBack, schemes.DEFAULT, fmt.Sprintf("par_kid_%d", studentID))
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+	return keyboard
+}
+
+// handleParentCodeInput handles a code sent by a parent who asked to add
+// another child.
+func (b *Bot) handleParentCodeInput(ctx context.Context, userID int64, text string) {
+	code, ok := services.NormalizeInviteCode(text)
+	if !ok {
+		b.sendKeyboard(ctx, GetParentKeyboard(b.MaxAPI), userID, parentInvalidCodeMsg)
+		return
+	}
+	b.redeemParentInvite(ctx, schemes.User{UserId: userID}, code)
+}
+
+// redeemParentInvite links the sender to the invited student, registering
+// the sender as a parent first if needed. Users with another role are turned
+// away before the code is spent.
+func (b *Bot) redeemParentInvite(ctx context.Context, sender schemes.User, code string) {
+	userRole, err := b.getUserRole(sender.UserId)
+	switch {
+	case err == nil && userRole != "parent":
+		b.logger.Warnf("User %d with role %s sent a parent invite code", sender.UserId, userRole)
+		if keyboard, _ := b.getMenuByRole(userRole); keyboard != nil {
+			b.sendKeyboard(ctx, keyboard, sender.UserId, parentWrongRoleMsg)
+		} else {
+			b.sendMessage(ctx, sender.UserId, parentWrongRoleMsg)
+		}
+		return
+	case err != nil && !errors.Is(err, sql.ErrNoRows):
+		b.logger.Errorf("Failed to get role of user %d: %v", sender.UserId, err)
+		b.sendMessage(ctx, sender.UserId, parentLinkErrorMsg)
+		return
+	}
+
+	var studentID int64
+	err = b.inTx(func(tx *sqlx.Tx) error {
+		parentID, err := b.userRepo.GetUserIDByMaxID(sender.UserId)
+		if errors.Is(err, sql.ErrNoRows) {
+			parentID, err = b.userRepo.CreateParent(tx, sender.UserId, senderName(sender))
+		}
+		if err != nil {
+			return err
+		}
+
+		studentID, err = b.parentRepo.RedeemInvite(tx, code, parentID)
+		return err
+	})
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		b.logger.Warnf("User %d sent an invalid parent invite code", sender.UserId)
+		if _, roleErr := b.getUserRole(sender.UserId); roleErr == nil {
+			b.sendKeyboard(ctx, GetParentKeyboard(b.MaxAPI), sender.UserId, parentInvalidCodeMsg)
+		} else {
+			b.sendMessage(ctx, sender.UserId, parentInvalidCodeMsg)
+		}
+		return
+	case err != nil:
+		b.logger.Errorf("Failed to redeem parent invite for user %d: %v", sender.UserId, err)
+		b.sendMessage(ctx, sender.UserId, parentLinkErrorMsg)
+		return
+	}
+
+	studentName, err := b.gradeRepo.GetStudentNameByID(studentID)
+	if err != nil {
+		b.logger.Warnf("Failed to get student name: %v", err)
+	}
+
+	b.logger.Infof("User %d linked as parent of student %d", sender.UserId, studentID)
+	b.sendKeyboard(ctx, GetParentKeyboard(b.MaxAPI), sender.UserId, fmt.Sprintf(parentLinkedMsg, studentName))
+}
+
+// enqueueStudentNotification queues a notification for the student and a
+// copy for every parent who mirrors the student's notifications. A student
+// from the roster without a Max account gets nothing, but the parents still
+// get their copies; queued reports whether the student's own notification
+// was queued. Copies stay out of the teacher's batch so its delivery report
+// counts students only.
+func (b *Bot) enqueueStudentNotification(tx *sqlx.Tx, notification database.OutboxNotification) (queued bool, err error) {
+	linked, err := b.userRepo.HasMaxID(tx, notification.UserID)
+	if err != nil {
+		return false, err
+	}
+	if linked {
+		if _, err := b.outboxRepo.Enqueue(tx, notification); err != nil {
+			return false, err
+		}
+	}
+
+	parents, err := b.parentRepo.GetMirroringParents(tx, notification.UserID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, parent := range parents {
+		mirrored := notification
+		mirrored.UserID = parent.ParentID
+		mirrored.BatchID = nil
+		mirrored.MessageText = fmt.Sprintf(parentMirrorPrefix, parent.StudentName) + notification.MessageText
+		mirrored.ButtonText = btnParentOpen
+		mirrored.ButtonPayload = fmt.Sprintf("par_kid_%d", parent.StudentID)
+
+		if _, err := b.outboxRepo.Enqueue(tx, mirrored); err != nil {
+			return false, err
+		}
+	}
+	return linked, nil
+}
+
+func senderName(sender schemes.User) string {
+	if name := strings.TrimSpace(sender.FirstName + " " + sender.LastName); name != "" {
+		return name
+	}
+	if sender.Name != "" {
+		return sender.Name
+	}
+	return fmt.Sprintf("Родитель %d", sender.UserId)
+}
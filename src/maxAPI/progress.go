@@ -0,0 +1,118 @@
+package maxAPI
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"digitalUniversity/database"
+	"digitalUniversity/grading"
+)
+
+const (
+	progressHeader       = "🎓 **Моя успеваемость**\n\n"
+	progressSubjectRow   = "%s **%s**\n"
+	progressGradesFormat = "   Средний балл: **%s** (оценок: %d)\n"
+	progressNoGrades     = "   Оценок пока нет\n"
+	progressAttendFormat = "   Посещаемость: **%.0f%%** (%d из %d)\n"
+	progressNoAttendance = "   Посещаемость ещё не отмечалась\n"
+	progressGPAFormat    = "\n📈 Общий средний балл: **%.2f** из 5"
+	progressNoGPA        = "\n📈 Общий средний балл появится после первых оценок."
+	progressDetailsHint  = "\n\nВыберите предмет, чтобы посмотреть оценки подробнее."
+
+	trendUp     = "📈"
+	trendDown   = "📉"
+	trendFlat   = "➖"
+	trendNoData = "▫️"
+
+	// progressRecentGrades is how many latest grades are compared with the
+	// earlier ones to show the trend.
+	progressRecentGrades = 3
+	// progressTrendThreshold is the change of the average, as a share of the
+	// scale, below which the trend is shown as flat.
+	progressTrendThreshold = 0.05
+	progressGPAScale       = 5
+)
+
+func (b *Bot) handleShowProgress(ctx context.Context, userID int64, callbackID string) error {
+	studentID, err := b.userRepo.GetUserIDByMaxID(userID)
+	if err != nil {
+		return err
+	}
+
+	groupID, err := b.userRepo.GetStudentGroupID(studentID)
+	if err != nil {
+		return err
+	}
+
+	progress, err := b.gradeRepo.GetStudentProgress(studentID, groupID, progressRecentGrades)
+	if err != nil {
+		return err
+	}
+	if len(progress) == 0 {
+		return b.answerCallbackWithNotification(ctx, callbackID, noSubjectsMsgStudent)
+	}
+
+	subjects := make([]database.Subject, 0, len(progress))
+	for _, p := range progress {
+		subjects = append(subjects, database.Subject{SubjectID: p.SubjectID, SubjectName: p.SubjectName})
+	}
+
+	text := formatProgress(progress) + progressDetailsHint
+	return b.answerWithKeyboardMarkdown(ctx, callbackID, text, b.studentSubjectsKeyboard(subjects, "show_grades_subj_%d"))
+}
+
+// formatProgress lists the subjects with their averages, trends and
+// attendance. The overall average brings every subject to the five-point
+// scale, as subjects may be graded on different scales.
+func formatProgress(progress []database.SubjectProgress) string {
+	var sb strings.Builder
+	sb.WriteString(progressHeader)
+
+	var normalizedSum float64
+	graded := 0
+
+	for _, p := range progress {
+		scale := grading.GetScale(p.GradingScale)
+		fmt.Fprintf(&sb, progressSubjectRow, progressTrend(p, scale), p.SubjectName)
+
+		if p.GradeAverage != nil {
+			fmt.Fprintf(&sb, progressGradesFormat, scale.FormatAverage(*p.GradeAverage), p.GradeCount)
+			normalizedSum += scale.Normalize(*p.GradeAverage)
+			graded++
+		} else {
+			sb.WriteString(progressNoGrades)
+		}
+
+		if p.Marked > 0 {
+			fmt.Fprintf(&sb, progressAttendFormat, float64(p.Attended)*100/float64(p.Marked), p.Attended, p.Marked)
+		} else {
+			sb.WriteString(progressNoAttendance)
+		}
+	}
+
+	if graded == 0 {
+		sb.WriteString(progressNoGPA)
+	} else {
+		fmt.Fprintf(&sb, progressGPAFormat, normalizedSum/float64(graded)*progressGPAScale)
+	}
+
+	return sb.String()
+}
+
+// progressTrend compares the latest grades with the earlier ones.
+func progressTrend(p database.SubjectProgress, scale grading.Scale) string {
+	if p.RecentAverage == nil || p.EarlierAverage == nil {
+		return trendNoData
+	}
+
+	change := scale.Normalize(*p.RecentAverage) - scale.Normalize(*p.EarlierAverage)
+	switch {
+	case change > progressTrendThreshold:
+		return trendUp
+	case change < -progressTrendThreshold:
+		return trendDown
+	default:
+		return trendFlat
+	}
+}
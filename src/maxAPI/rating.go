@@ -0,0 +1,283 @@
+package maxAPI
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/max-messenger/max-bot-api-client-go/schemes"
+
+	"digitalUniversity/database"
+	"digitalUniversity/grading"
+)
+
+const (
+	selectSubjectForRatingMsg = "Выберите предмет для просмотра рейтинга:"
+	selectGroupForRatingMsg   = "Выберите группу:"
+	noSubjectsForRatingMsg    = "У вас нет предметов."
+	ratingForbiddenMsg        = "Рейтинг доступен только по вашим предметам."
+
+	ratingHeader       = "🏆 **Рейтинг по предмету**\n"
+	ratingScoreFormat  = "• Текущий рейтинг: **%.1f** из 100\n"
+	ratingGradeFormat  = "• Средний балл с учётом весов: **%s**\n"
+	ratingAttendFormat = "• Посещаемость: **%.0f%%**\n"
+	ratingMarkFormat   = "• Прогноз итоговой оценки: **%s**\n"
+	ratingAdmitted     = "• Допуск к экзамену: ✅ есть"
+	ratingNotAdmitted  = "• Допуск к экзамену: ❌ нет (%s)"
+	ratingNoData       = "• Текущий рейтинг: нет данных\n"
+
+	groupRatingHeader = "🏆 Рейтинг группы **%s** по предмету **%s**:\n\n"
+	groupRatingEntry  = "%d. %s — **%.1f** (прогноз: %s) %s\n"
+	groupRatingNoData = "%d. %s — нет данных\n"
+	groupRatingFooter = "\nДопущено к экзамену: **%d** из **%d**"
+	noStudentsRating  = "В группе нет студентов."
+)
+
+func (b *Bot) handleShowRatingStart(ctx context.Context, userID int64, callbackID string) error {
+	teacherID, err := b.userRepo.GetUserIDByMaxID(userID)
+	if err != nil {
+		b.logger.Errorf("Failed to get teacher ID: %v", err)
+		return err
+	}
+
+	subjects, err := b.gradeRepo.GetSubjectsByTeacher(teacherID)
+	if err != nil {
+		b.logger.Errorf("Failed to get subjects for teacher %d: %v", teacherID, err)
+		return err
+	}
+
+	if len(subjects) == 0 {
+		return b.answerCallbackWithNotification(ctx, callbackID, noSubjectsForRatingMsg)
+	}
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	for _, subject := range subjects {
+		payload := fmt.Sprintf("rating_subj_%d", subject.SubjectID)
+		keyboard.AddRow().AddCallback(subject.SubjectName, schemes.DEFAULT, payload)
+	}
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+
+	return b.answerWithKeyboard(ctx, callbackID, selectSubjectForRatingMsg, keyboard)
+}
+
+func (b *Bot) handleRatingCallback(ctx context.Context, userID int64, callbackID, payload string) error {
+	userRole, err := b.getUserRole(userID)
+	if err != nil {
+		return err
+	}
+	if userRole != "teacher" {
+		return b.answerCallbackWithNotification(ctx, callbackID, ratingForbiddenMsg)
+	}
+
+	parts := strings.Split(payload, "_")
+	if len(parts) < 3 {
+		return fmt.Errorf("invalid rating callback payload: %s", payload)
+	}
+
+	switch parts[1] {
+	case "subj":
+		return b.handleRatingSubjectSelected(ctx, userID, callbackID, payload)
+	case "grp":
+		return b.handleRatingGroupSelected(ctx, userID, callbackID, payload)
+	default:
+		return fmt.Errorf("unknown rating callback type: %s", parts[1])
+	}
+}
+
+func (b *Bot) handleRatingSubjectSelected(ctx context.Context, userID int64, callbackID, payload string) error {
+	var subjectID int64
+	if _, err := fmt.Sscanf(payload, "rating_subj_%d", &subjectID); err != nil {
+		return fmt.Errorf("invalid rating callback payload: %s", payload)
+	}
+
+	teacherID, err := b.userRepo.GetUserIDByMaxID(userID)
+	if err != nil {
+		return err
+	}
+
+	groups, err := b.gradeRepo.GetGroupsBySubjectAndTeacher(subjectID, teacherID)
+	if err != nil {
+		b.logger.Errorf("Failed to get groups: %v", err)
+		return err
+	}
+
+	if len(groups) == 0 {
+		return b.answerCallbackWithNotification(ctx, callbackID, noGroupsMsg)
+	}
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	for _, group := range groups {
+		payload := fmt.Sprintf("rating_grp_%d_%d", subjectID, group.GroupID)
+		keyboard.AddRow().AddCallback(group.GroupName, schemes.DEFAULT, payload)
+	}
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+
+	return b.answerWithKeyboard(ctx, callbackID, selectGroupForRatingMsg, keyboard)
+}
+
+func (b *Bot) handleRatingGroupSelected(ctx context.Context, userID int64, callbackID, payload string) error {
+	var subjectID, groupID int64
+	if _, err := fmt.Sscanf(payload, "rating_grp_%d_%d", &subjectID, &groupID); err != nil {
+		return fmt.Errorf("invalid rating callback payload: %s", payload)
+	}
+
+	teacherID, err := b.userRepo.GetUserIDByMaxID(userID)
+	if err != nil {
+		return err
+	}
+	groups, err := b.gradeRepo.GetGroupsBySubjectAndTeacher(subjectID, teacherID)
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(groups, func(g database.Group) bool { return g.GroupID == groupID }) {
+		return b.answerCallbackWithNotification(ctx, callbackID, ratingForbiddenMsg)
+	}
+
+	students, err := b.gradeRepo.GetStudentsByGroup(groupID)
+	if err != nil {
+		b.logger.Errorf("Failed to get students: %v", err)
+		return err
+	}
+
+	if len(students) == 0 {
+		return b.answerCallbackWithNotification(ctx, callbackID, noStudentsRating)
+	}
+
+	grades, err := b.gradeRepo.GetGradesBySubjectAndGroup(subjectID, groupID)
+	if err != nil {
+		b.logger.Errorf("Failed to get group grades: %v", err)
+		return err
+	}
+
+	attendance, err := b.attendanceRepo.GetAttendanceBySubjectAndGroup(subjectID, groupID)
+	if err != nil {
+		b.logger.Errorf("Failed to get group attendance: %v", err)
+		return err
+	}
+
+	text := b.formatGroupRating(subjectID, groupID, students, grades, attendance)
+
+	return b.answerWithKeyboardMarkdown(ctx, callbackID, text, GetTeacherKeyboard(b.MaxAPI))
+}
+
+type studentRating struct {
+	name   string
+	rating grading.Rating
+}
+
+func (b *Bot) formatGroupRating(subjectID, groupID int64, students []database.User, grades []database.Grade, attendance []database.Attendance) string {
+	scale := b.getSubjectScale(subjectID)
+	rules := b.getRatingRules(subjectID)
+	assessmentTypes := b.getAssessmentTypes(subjectID)
+
+	gradesByStudent := make(map[int64][]database.Grade)
+	for _, grade := range grades {
+		gradesByStudent[grade.StudentID] = append(gradesByStudent[grade.StudentID], grade)
+	}
+
+	attendanceByStudent := make(map[int64][]database.Attendance)
+	for _, att := range attendance {
+		attendanceByStudent[att.StudentID] = append(attendanceByStudent[att.StudentID], att)
+	}
+
+	ratings := make([]studentRating, 0, len(students))
+	for _, student := range students {
+		input := buildRatingInput(gradesByStudent[student.UserID], attendanceByStudent[student.UserID], assessmentTypes)
+		ratings = append(ratings, studentRating{
+			name:   student.Name,
+			rating: grading.CalculateRating(scale, rules, input),
+		})
+	}
+
+	sort.SliceStable(ratings, func(i, j int) bool {
+		if ratings[i].rating.Rated != ratings[j].rating.Rated {
+			return ratings[i].rating.Rated
+		}
+		return ratings[i].rating.Score > ratings[j].rating.Score
+	})
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, groupRatingHeader, b.getGroupName(groupID), b.getSubjectName(subjectID))
+
+	admitted := 0
+	for i, r := range ratings {
+		if !r.rating.Rated {
+			fmt.Fprintf(&sb, groupRatingNoData, i+1, r.name)
+			continue
+		}
+		status := "❌"
+		if r.rating.Admitted {
+			status = "✅"
+			admitted++
+		}
+		fmt.Fprintf(&sb, groupRatingEntry, i+1, r.name, r.rating.Score, scale.Label(r.rating.ProjectedMark), status)
+	}
+
+	fmt.Fprintf(&sb, groupRatingFooter, admitted, len(ratings))
+
+	return sb.String()
+}
+
+func (b *Bot) getRatingRules(subjectID int64) grading.RatingRules {
+	rule, err := b.ratingRuleRepo.GetRatingRule(subjectID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			b.logger.Errorf("Failed to get rating rules for subject %d: %v", subjectID, err)
+		}
+		return grading.DefaultRatingRules()
+	}
+
+	return grading.RatingRules{
+		GradeWeight:           rule.GradeWeight,
+		AttendanceWeight:      rule.AttendanceWeight,
+		MinAttendancePercent:  rule.MinAttendancePercent,
+		MinRatingForAdmission: rule.MinRating,
+	}
+}
+
+func buildRatingInput(grades []database.Grade, attendance []database.Attendance, assessmentTypes []database.AssessmentType) grading.RatingInput {
+	input := grading.RatingInput{
+		Grades:       weightedGradeValues(grades, assessmentTypes),
+		TotalLessons: len(attendance),
+	}
+	for _, att := range attendance {
+		if att.Attended {
+			input.AttendedLessons++
+		}
+	}
+	return input
+}
+
+func formatRating(rating grading.Rating, scale grading.Scale) string {
+	var sb strings.Builder
+	sb.WriteString(ratingHeader)
+	if rating.Rated {
+		fmt.Fprintf(&sb, ratingScoreFormat, rating.Score)
+	} else {
+		sb.WriteString(ratingNoData)
+	}
+
+	if rating.HasGrades {
+		fmt.Fprintf(&sb, ratingGradeFormat, scale.FormatAverage(rating.GradeAverage))
+	}
+	if rating.HasAttendance {
+		fmt.Fprintf(&sb, ratingAttendFormat, rating.AttendancePercent)
+	}
+	if !rating.Rated {
+		return strings.TrimSuffix(sb.String(), "\n")
+	}
+
+	fmt.Fprintf(&sb, ratingMarkFormat, scale.Label(rating.ProjectedMark))
+
+	if rating.Admitted {
+		sb.WriteString(ratingAdmitted)
+	} else {
+		fmt.Fprintf(&sb, ratingNotAdmitted, strings.Join(rating.Reasons, "; "))
+	}
+
+	return sb.String()
+}
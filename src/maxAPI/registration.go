@@ -0,0 +1,448 @@
+package maxAPI
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/max-messenger/max-bot-api-client-go/schemes"
+
+	"digitalUniversity/database"
+	"digitalUniversity/services"
+)
+
+const (
+	inputRegistrationName = "registration_name"
+
+	registrationClaimedMsg     = "✅ Вы зарегистрированы как студент **%s**."
+	registrationEnterNameMsg   = "Группа %s. Отправьте фамилию и имя так, как они записаны в списке группы, например: Иванов Александр."
+	registrationNameFormatMsg  = "Отправьте фамилию и имя через пробел, например: Иванов Александр."
+	registrationNotFoundMsg    = "❌ Студент %s не найден в группе %s или уже зарегистрирован. Проверьте написание и отправьте фамилию и имя ещё раз."
+	registrationRequestSentMsg = "📝 В группе несколько студентов с таким именем. Заявка отправлена администратору — бот сообщит, когда её рассмотрят."
+	registrationTakenMsg       = "❌ Эта запись уже привязана к другому аккаунту. Обратитесь к администратору."
+	registrationErrorMsg       = "Не удалось завершить регистрацию. Попробуйте позже."
+	registrationRejectedMsg    = "❌ Заявка на регистрацию отклонена. Обратитесь к администратору, чтобы получить личный код."
+	registrationRequestNotice  = "📝 **Заявка на регистрацию**\n\n%s, группа %s. Подходящих записей в списке несколько — выберите нужную."
+
+	registrationSelectGroup    = "Выберите группу:"
+	registrationCodesMsg       = "🔑 **Коды регистрации группы %s**\n\nКод группы: `%s`\nПо нему студент регистрируется, указав фамилию и имя.\n\n"
+	registrationPersonalHeader = "Личные коды студентов, ещё не подключившихся к боту:\n"
+	registrationPersonalLine   = "• %s — `%s`\n"
+	registrationAllClaimedMsg  = "Все студенты группы подключены к боту."
+	registrationNoRequestsMsg  = "Необработанных заявок нет."
+	registrationRequestsMsg    = "📝 Заявки на регистрацию:"
+	registrationRequestMsg     = "📝 **Заявка на регистрацию**\n\n%s, группа %s\nПодана: %s\n\nВыберите запись студента из списка группы:"
+	registrationNoCandidates   = "📝 **Заявка на регистрацию**\n\n%s, группа %s\nПодана: %s\n\nВ группе не осталось неподключённых студентов."
+	registrationResolvedMsg    = "Заявка уже рассмотрена."
+	registrationApprovedMsg    = "✅ Студент **%s** зарегистрирован."
+	registrationDeclinedMsg    = "Заявка отклонена."
+	registrationForbiddenMsg   = "Раздел доступен только администраторам."
+
+	btnRegistrationReview = "Рассмотреть"
+	btnRegistrationReject = "❌ Отклонить"
+	btnRegistrationList   = "← К заявкам"
+	btnRegistrationStud   = "%s (№%d)"
+
+	maxRegistrationRequests = 10
+)
+
+var (
+	errRegistrationResolved = errors.New("registration request already resolved")
+	errRegistrationTaken    = errors.New("student record already claimed")
+)
+
+// handleGuestInviteCode handles a code sent by someone the bot does not know
+// yet. A personal code binds the sender to a roster record, a group code asks
+// for the student's name, and any other code is tried as a parent invitation.
+// It reports whether the message was consumed.
+func (b *Bot) handleGuestInviteCode(ctx context.Context, sender schemes.User, text string) bool {
+	code, ok := services.NormalizeInviteCode(text)
+	if !ok {
+		return false
+	}
+	if _, err := b.getUserRole(sender.UserId); !errors.Is(err, sql.ErrNoRows) {
+		return false
+	}
+
+	name, err := b.userRepo.ClaimByInviteCode(code, sender.UserId)
+	if err == nil {
+		b.logger.Infof("User %d claimed student record %q with a personal code", sender.UserId, name)
+		b.sendKeyboard(ctx, GetStudentKeyboard(b.MaxAPI), sender.UserId, fmt.Sprintf(registrationClaimedMsg, name))
+		return true
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		b.logger.Errorf("Failed to claim student record for user %d: %v", sender.UserId, err)
+		b.sendMessage(ctx, sender.UserId, registrationErrorMsg)
+		return true
+	}
+
+	group, err := b.groupRepo.GetGroupByJoinCode(code)
+	if err == nil {
+		b.mu.Lock()
+		b.registrations[sender.UserId] = group.GroupID
+		b.mu.Unlock()
+
+		b.setPendingInput(sender.UserId, inputRegistrationName)
+		b.sendMessage(ctx, sender.UserId, fmt.Sprintf(registrationEnterNameMsg, group.GroupName))
+		return true
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		b.logger.Errorf("Failed to find group by join code: %v", err)
+		b.sendMessage(ctx, sender.UserId, registrationErrorMsg)
+		return true
+	}
+
+	b.redeemParentInvite(ctx, sender, code)
+	return true
+}
+
+// handleRegistrationNameInput matches the name sent after a group code
+// against unclaimed students of the group. A single match is claimed at once,
+// several matches go to administrators as a registration request.
+func (b *Bot) handleRegistrationNameInput(ctx context.Context, userID int64, text string) {
+	b.mu.Lock()
+	groupID, ok := b.registrations[userID]
+	b.mu.Unlock()
+	if !ok {
+		b.sendMessage(ctx, userID, welcomeGuestMsg)
+		return
+	}
+
+	fields := strings.Fields(text)
+	if len(fields) < 2 {
+		b.setPendingInput(userID, inputRegistrationName)
+		b.sendMessage(ctx, userID, registrationNameFormatMsg)
+		return
+	}
+	lastName, firstName := fields[0], fields[1]
+
+	students, err := b.userRepo.GetUnclaimedStudents(groupID, lastName, firstName)
+	if err != nil {
+		b.logger.Errorf("Failed to find unclaimed students in group %d: %v", groupID, err)
+		b.sendMessage(ctx, userID, registrationErrorMsg)
+		return
+	}
+
+	switch len(students) {
+	case 0:
+		groupName, err := b.groupRepo.GetGroupName(groupID)
+		if err != nil {
+			b.logger.Warnf("Failed to get group name: %v", err)
+		}
+		b.setPendingInput(userID, inputRegistrationName)
+		b.sendMessage(ctx, userID, fmt.Sprintf(registrationNotFoundMsg, lastName+" "+firstName, groupName))
+		return
+
+	case 1:
+		student := students[0]
+		err = b.inTx(func(tx *sqlx.Tx) error {
+			claimed, err := b.userRepo.ClaimStudent(tx, student.UserID, userID)
+			if err != nil {
+				return err
+			}
+			if !claimed {
+				return errRegistrationTaken
+			}
+			return nil
+		})
+
+	default:
+		err = b.inTx(func(tx *sqlx.Tx) error {
+			return b.createRegistrationRequest(tx, userID, lastName+" "+firstName, groupID)
+		})
+	}
+
+	switch {
+	case errors.Is(err, errRegistrationTaken):
+		b.sendMessage(ctx, userID, registrationTakenMsg)
+		return
+	case err != nil:
+		b.logger.Errorf("Failed to register user %d: %v", userID, err)
+		b.sendMessage(ctx, userID, registrationErrorMsg)
+		return
+	}
+
+	b.mu.Lock()
+	delete(b.registrations, userID)
+	b.mu.Unlock()
+
+	if len(students) > 1 {
+		b.logger.Infof("User %d filed a registration request for %s %s in group %d", userID, lastName, firstName, groupID)
+		b.sendMessage(ctx, userID, registrationRequestSentMsg)
+		return
+	}
+
+	b.logger.Infof("User %d claimed student record %d with a group code", userID, students[0].UserID)
+	b.sendKeyboard(ctx, GetStudentKeyboard(b.MaxAPI), userID, fmt.Sprintf(registrationClaimedMsg, students[0].Name))
+}
+
+// createRegistrationRequest files the request and tells every administrator
+// about it.
+func (b *Bot) createRegistrationRequest(tx *sqlx.Tx, userMaxID int64, fullName string, groupID int64) error {
+	requestID, err := b.registrationRepo.CreateRequest(tx, userMaxID, fullName, groupID)
+	if err != nil {
+		return err
+	}
+
+	groupName, err := b.groupRepo.GetGroupName(groupID)
+	if err != nil {
+		return err
+	}
+
+	adminIDs, err := b.userRepo.GetAdminIDs(tx)
+	if err != nil {
+		return err
+	}
+
+	for _, adminID := range adminIDs {
+		notification := database.OutboxNotification{
+			UserID:        adminID,
+			Category:      categorySystem,
+			MessageText:   fmt.Sprintf(registrationRequestNotice, fullName, groupName),
+			ButtonText:    btnRegistrationReview,
+			ButtonPayload: fmt.Sprintf("reg_req_%d", requestID),
+		}
+		if _, err := b.outboxRepo.Enqueue(tx, notification); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Bot) handleRegistrationCallback(ctx context.Context, userID int64, callbackID, payload string) error {
+	userRole, err := b.getUserRole(userID)
+	if err != nil {
+		return err
+	}
+	if userRole != "admin" {
+		return b.answerCallbackWithNotification(ctx, callbackID, registrationForbiddenMsg)
+	}
+
+	var id, studentID int64
+
+	switch {
+	case payload == payloadRegCodes:
+		return b.answerRegistrationGroups(ctx, callbackID)
+	case payload == payloadRegRequests:
+		return b.answerRegistrationRequests(ctx, callbackID)
+	case strings.HasPrefix(payload, "reg_grp_"):
+		fmt.Sscanf(payload, "reg_grp_%d", &id)
+		return b.answerRegistrationCodes(ctx, callbackID, id)
+	case strings.HasPrefix(payload, "reg_req_"):
+		fmt.Sscanf(payload, "reg_req_%d", &id)
+		return b.answerRegistrationRequest(ctx, callbackID, id)
+	case strings.HasPrefix(payload, "reg_ok_"):
+		fmt.Sscanf(payload, "reg_ok_%d_%d", &id, &studentID)
+		return b.approveRegistration(ctx, userID, callbackID, id, studentID)
+	case strings.HasPrefix(payload, "reg_no_"):
+		fmt.Sscanf(payload, "reg_no_%d", &id)
+		return b.rejectRegistration(ctx, userID, callbackID, id)
+	default:
+		return fmt.Errorf("unknown registration callback: %s", payload)
+	}
+}
+
+func (b *Bot) answerRegistrationGroups(ctx context.Context, callbackID string) error {
+	groups, err := b.groupRepo.GetAllGroups()
+	if err != nil {
+		return err
+	}
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	for _, group := range groups {
+		keyboard.AddRow().AddCallback(group.GroupName, schemes.DEFAULT, fmt.Sprintf("reg_grp_%d", group.GroupID))
+	}
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+	return b.answerWithKeyboard(ctx, callbackID, registrationSelectGroup, keyboard)
+}
+
+// answerRegistrationCodes shows the group code, creating it on first use,
+// and the personal codes of students who have not claimed their records.
+func (b *Bot) answerRegistrationCodes(ctx context.Context, callbackID string, groupID int64) error {
+	code, err := services.GenerateInviteCode()
+	if err != nil {
+		return err
+	}
+
+	joinCode, err := b.groupRepo.EnsureJoinCode(groupID, code)
+	if err != nil {
+		return err
+	}
+
+	groupName, err := b.groupRepo.GetGroupName(groupID)
+	if err != nil {
+		return err
+	}
+
+	students, err := b.userRepo.GetUnclaimedStudents(groupID, "", "")
+	if err != nil {
+		return err
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, registrationCodesMsg, groupName, joinCode)
+	if len(students) == 0 {
+		text.WriteString(registrationAllClaimedMsg)
+	} else {
+		text.WriteString(registrationPersonalHeader)
+		for _, student := range students {
+			personalCode := "—"
+			if student.InviteCode != nil {
+				personalCode = *student.InviteCode
+			}
+			fmt.Fprintf(&text, registrationPersonalLine, student.Name, personalCode)
+		}
+	}
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	keyboard.AddRow().AddCallback(btnPrev, schemes.DEFAULT, payloadRegCodes)
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+	return b.answerWithKeyboardMarkdown(ctx, callbackID, text.String(), keyboard)
+}
+
+func (b *Bot) answerRegistrationRequests(ctx context.Context, callbackID string) error {
+	requests, err := b.registrationRepo.GetPendingRequests(maxRegistrationRequests)
+	if err != nil {
+		return err
+	}
+	if len(requests) == 0 {
+		return b.answerCallbackWithNotification(ctx, callbackID, registrationNoRequestsMsg)
+	}
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	for _, request := range requests {
+		keyboard.AddRow().AddCallback(fmt.Sprintf("%s (%s)", request.FullName, request.GroupName),
+			schemes.DEFAULT, fmt.Sprintf("reg_req_%d", request.RequestID))
+	}
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+	return b.answerWithKeyboard(ctx, callbackID, registrationRequestsMsg, keyboard)
+}
+
+// answerRegistrationRequest lists the roster records the request may refer
+// to. If none matches the name any more, all unclaimed students of the group
+// are offered.
+func (b *Bot) answerRegistrationRequest(ctx context.Context, callbackID string, requestID int64) error {
+	request, err := b.registrationRepo.GetRequest(requestID)
+	if err != nil {
+		return err
+	}
+	if request.Status != database.RegistrationPending {
+		return b.answerCallbackWithNotification(ctx, callbackID, registrationResolvedMsg)
+	}
+
+	var lastName, firstName string
+	if fields := strings.Fields(request.FullName); len(fields) >= 2 {
+		lastName, firstName = fields[0], fields[1]
+	}
+
+	candidates, err := b.userRepo.GetUnclaimedStudents(request.GroupID, lastName, firstName)
+	if err != nil {
+		return err
+	}
+	if len(candidates) == 0 {
+		candidates, err = b.userRepo.GetUnclaimedStudents(request.GroupID, "", "")
+		if err != nil {
+			return err
+		}
+	}
+
+	createdAt := request.CreatedAt.In(b.location).Format("02.01.2006 15:04")
+	text := fmt.Sprintf(registrationRequestMsg, request.FullName, request.GroupName, createdAt)
+	if len(candidates) == 0 {
+		text = fmt.Sprintf(registrationNoCandidates, request.FullName, request.GroupName, createdAt)
+	}
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	for _, candidate := range candidates {
+		keyboard.AddRow().AddCallback(fmt.Sprintf(btnRegistrationStud, candidate.Name, candidate.UserID),
+			schemes.POSITIVE, fmt.Sprintf("reg_ok_%d_%d", request.RequestID, candidate.UserID))
+	}
+	keyboard.AddRow().AddCallback(btnRegistrationReject, schemes.NEGATIVE, fmt.Sprintf("reg_no_%d", request.RequestID))
+	keyboard.AddRow().AddCallback(btnRegistrationList, schemes.DEFAULT, payloadRegRequests)
+	return b.answerWithKeyboardMarkdown(ctx, callbackID, text, keyboard)
+}
+
+func (b *Bot) approveRegistration(ctx context.Context, userID int64, callbackID string, requestID, studentID int64) error {
+	adminID, err := b.userRepo.GetUserIDByMaxID(userID)
+	if err != nil {
+		return err
+	}
+
+	request, err := b.registrationRepo.GetRequest(requestID)
+	if err != nil {
+		return err
+	}
+
+	err = b.inTx(func(tx *sqlx.Tx) error {
+		resolved, err := b.registrationRepo.Resolve(tx, requestID, database.RegistrationApproved, &studentID, adminID)
+		if err != nil {
+			return err
+		}
+		if !resolved {
+			return errRegistrationResolved
+		}
+
+		claimed, err := b.userRepo.ClaimStudent(tx, studentID, request.UserMaxID)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			return errRegistrationTaken
+		}
+		return nil
+	})
+
+	switch {
+	case errors.Is(err, errRegistrationResolved):
+		return b.answerCallbackWithNotification(ctx, callbackID, registrationResolvedMsg)
+	case errors.Is(err, errRegistrationTaken):
+		return b.answerCallbackWithNotification(ctx, callbackID, registrationTakenMsg)
+	case err != nil:
+		return err
+	}
+
+	studentName, err := b.gradeRepo.GetStudentNameByID(studentID)
+	if err != nil {
+		b.logger.Warnf("Failed to get student name: %v", err)
+	}
+
+	b.logger.Infof("Admin %d approved registration request %d for student %d", adminID, requestID, studentID)
+	b.sendKeyboard(ctx, GetStudentKeyboard(b.MaxAPI), request.UserMaxID, fmt.Sprintf(registrationClaimedMsg, studentName))
+
+	return b.answerWithKeyboardMarkdown(ctx, callbackID, fmt.Sprintf(registrationApprovedMsg, studentName), GetAdminKeyboard(b.MaxAPI))
+}
+
+func (b *Bot) rejectRegistration(ctx context.Context, userID int64, callbackID string, requestID int64) error {
+	adminID, err := b.userRepo.GetUserIDByMaxID(userID)
+	if err != nil {
+		return err
+	}
+
+	request, err := b.registrationRepo.GetRequest(requestID)
+	if err != nil {
+		return err
+	}
+
+	var resolved bool
+	err = b.inTx(func(tx *sqlx.Tx) error {
+		var err error
+		resolved, err = b.registrationRepo.Resolve(tx, requestID, database.RegistrationRejected, nil, adminID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if !resolved {
+		return b.answerCallbackWithNotification(ctx, callbackID, registrationResolvedMsg)
+	}
+
+	b.logger.Infof("Admin %d rejected registration request %d", adminID, requestID)
+	if err := b.sendMessage(ctx, request.UserMaxID, registrationRejectedMsg); err != nil {
+		b.logger.Warnf("Failed to notify user %d about rejected registration: %v", request.UserMaxID, err)
+	}
+
+	return b.answerWithKeyboard(ctx, callbackID, registrationDeclinedMsg, GetAdminKeyboard(b.MaxAPI))
+}
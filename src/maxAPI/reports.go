@@ -0,0 +1,413 @@
+package maxAPI
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	maxbot "github.com/max-messenger/max-bot-api-client-go"
+	"github.com/max-messenger/max-bot-api-client-go/schemes"
+
+	"digitalUniversity/database"
+	"digitalUniversity/grading"
+	"digitalUniversity/services"
+	"digitalUniversity/xlsx"
+)
+
+const (
+	reportsMenuMsg      = "📑 **Отчёты**\n\nВыберите отчёт. Любой отчёт можно скачать вместе с остальными одним файлом XLSX."
+	reportsForbiddenMsg = "Отчёты доступны только администраторам."
+	reportsErrorMsg     = "Не удалось построить отчёт. Попробуйте позже."
+
+	btnReportGroups   = "👥 Успеваемость групп"
+	btnReportUnmarked = "📋 Неотмеченные занятия"
+	btnReportInactive = "💤 Неактивные студенты"
+	btnReportLoad     = "🧑‍🏫 Нагрузка преподавателей"
+	btnReportConflict = "⚠️ Пересечения в расписании"
+	btnReportXLSX     = "📥 Скачать XLSX"
+	btnReportsBack    = "← К отчётам"
+
+	payloadReportGroups   = "rep_groups"
+	payloadReportUnmarked = "rep_unmarked"
+	payloadReportInactive = "rep_inactive"
+	payloadReportLoad     = "rep_load"
+	payloadReportConflict = "rep_conflicts"
+	payloadReportXLSX     = "rep_xlsx"
+
+	reportGroupsHeader   = "👥 **Успеваемость групп**\n\n"
+	reportGroupRow       = "**%s** (студентов: %d)\n   Средний балл: %s · Посещаемость: %s\n"
+	reportUnmarkedHeader = "📋 **Неотмеченные занятия** за %d дн.\n\n"
+	reportUnmarkedRow    = "• %s — %s %s, %s, группа %s\n"
+	reportInactiveHeader = "💤 **Неактивные студенты** за %d дн.\nНет оценок и посещённых занятий.\n\n"
+	reportInactiveRow    = "• %s (%s)%s\n"
+	reportNotLinked      = " — не подключён к боту"
+	reportLoadHeader     = "🧑‍🏫 **Нагрузка преподавателей** в неделю\n\n"
+	reportLoadRow        = "• %s — занятий: **%d**, часов: %.1f, групп: %d, предметов: %d\n"
+	reportConflictHeader = "⚠️ **Пересечения в расписании**\n\n"
+	reportConflictRow    = "• %s %s: %s\n   %s (%s) и %s (%s)\n"
+	reportEmpty          = "Нет данных."
+	reportMore           = "\n…и ещё %d. Полный список — в файле XLSX."
+	reportXLSXCaption    = "📥 Отчёты на %s. Откройте файл в Excel или LibreOffice."
+	reportXLSXFileName   = "reports_%s.xlsx"
+	reportNoGroup        = "без группы"
+	reportNoValue        = "—"
+
+	// reportUnmarkedDays and reportInactiveDays are the report periods.
+	reportUnmarkedDays = 14
+	reportInactiveDays = 30
+	// reportChatRows limits the rows shown in chat; the XLSX file has all.
+	reportChatRows = 30
+)
+
+func (b *Bot) handleReportsCallback(ctx context.Context, userID int64, callbackID, payload string) error {
+	userRole, err := b.getUserRole(userID)
+	if err != nil {
+		return err
+	}
+	if userRole != "admin" {
+		return b.answerCallbackWithNotification(ctx, callbackID, reportsForbiddenMsg)
+	}
+
+	var text string
+	switch payload {
+	case payloadReports:
+		return b.answerWithKeyboardMarkdown(ctx, callbackID, reportsMenuMsg, b.reportsKeyboard())
+	case payloadReportXLSX:
+		return b.sendReportsXLSX(ctx, callbackID)
+	case payloadReportGroups:
+		stats, err := b.reportRepo.GetGroupSubjectStats()
+		if err != nil {
+			return b.reportFailed(ctx, callbackID, err)
+		}
+		text = formatGroupsReport(stats)
+	case payloadReportUnmarked:
+		lessons, err := b.reportRepo.GetUnmarkedLessons(reportUnmarkedDays)
+		if err != nil {
+			return b.reportFailed(ctx, callbackID, err)
+		}
+		text = formatUnmarkedReport(lessons)
+	case payloadReportInactive:
+		students, err := b.reportRepo.GetInactiveStudents(reportInactiveDays)
+		if err != nil {
+			return b.reportFailed(ctx, callbackID, err)
+		}
+		text = formatInactiveReport(students)
+	case payloadReportLoad:
+		load, err := b.reportRepo.GetTeacherLoad()
+		if err != nil {
+			return b.reportFailed(ctx, callbackID, err)
+		}
+		text = formatLoadReport(load)
+	case payloadReportConflict:
+		conflicts, err := b.getScheduleConflicts()
+		if err != nil {
+			return b.reportFailed(ctx, callbackID, err)
+		}
+		text = formatConflictsReport(conflicts)
+	default:
+		return fmt.Errorf("unknown reports callback: %s", payload)
+	}
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	keyboard.AddRow().AddCallback(btnReportXLSX, schemes.POSITIVE, payloadReportXLSX)
+	keyboard.AddRow().AddCallback(btnReportsBack, schemes.DEFAULT, payloadReports)
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+	return b.answerWithKeyboardMarkdown(ctx, callbackID, text, keyboard)
+}
+
+func (b *Bot) reportsKeyboard() *maxbot.Keyboard {
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	keyboard.AddRow().AddCallback(btnReportGroups, schemes.DEFAULT, payloadReportGroups)
+	keyboard.AddRow().AddCallback(btnReportUnmarked, schemes.DEFAULT, payloadReportUnmarked)
+	keyboard.AddRow().AddCallback(btnReportInactive, schemes.DEFAULT, payloadReportInactive)
+	keyboard.AddRow().AddCallback(btnReportLoad, schemes.DEFAULT, payloadReportLoad)
+	keyboard.AddRow().AddCallback(btnReportConflict, schemes.DEFAULT, payloadReportConflict)
+	keyboard.AddRow().AddCallback(btnReportXLSX, schemes.POSITIVE, payloadReportXLSX)
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+	return keyboard
+}
+
+func (b *Bot) reportFailed(ctx context.Context, callbackID string, err error) error {
+	b.logger.Errorf("Failed to build report: %v", err)
+	return b.answerCallbackWithNotification(ctx, callbackID, reportsErrorMsg)
+}
+
+// sendReportsXLSX builds every report into one workbook, a sheet per report,
+// and sends it as a file.
+func (b *Bot) sendReportsXLSX(ctx context.Context, callbackID string) error {
+	stats, err := b.reportRepo.GetGroupSubjectStats()
+	if err != nil {
+		return b.reportFailed(ctx, callbackID, err)
+	}
+	lessons, err := b.reportRepo.GetUnmarkedLessons(reportUnmarkedDays)
+	if err != nil {
+		return b.reportFailed(ctx, callbackID, err)
+	}
+	students, err := b.reportRepo.GetInactiveStudents(reportInactiveDays)
+	if err != nil {
+		return b.reportFailed(ctx, callbackID, err)
+	}
+	load, err := b.reportRepo.GetTeacherLoad()
+	if err != nil {
+		return b.reportFailed(ctx, callbackID, err)
+	}
+	conflicts, err := b.getScheduleConflicts()
+	if err != nil {
+		return b.reportFailed(ctx, callbackID, err)
+	}
+
+	workbook, err := xlsx.Bytes(reportSheets(stats, lessons, students, load, conflicts))
+	if err != nil {
+		return b.reportFailed(ctx, callbackID, err)
+	}
+
+	now := time.Now().In(b.location)
+	file, err := b.uploadNamedFile(ctx, fmt.Sprintf(reportXLSXFileName, now.Format("2006-01-02")), workbook)
+	if err != nil {
+		return b.reportFailed(ctx, callbackID, err)
+	}
+
+	caption := fmt.Sprintf(reportXLSXCaption, now.Format("02.01.2006 15:04"))
+	return b.answerWithFileMarkdown(ctx, callbackID, caption, file, b.reportsKeyboard())
+}
+
+// groupSummary aggregates a group's subjects. The grade average brings each
+// subject to the five-point scale, as subjects may use different scales.
+type groupSummary struct {
+	name          string
+	students      int
+	normalizedSum float64
+	graded        int
+	attended      int
+	marked        int
+}
+
+func summarizeGroups(stats []database.GroupSubjectStats) []*groupSummary {
+	var summaries []*groupSummary
+	byGroup := make(map[int64]*groupSummary)
+	for _, s := range stats {
+		summary, ok := byGroup[s.GroupID]
+		if !ok {
+			summary = &groupSummary{name: s.GroupName, students: s.Students}
+			byGroup[s.GroupID] = summary
+			summaries = append(summaries, summary)
+		}
+		if s.GradeAverage != nil {
+			summary.normalizedSum += grading.GetScale(s.GradingScale).Normalize(*s.GradeAverage)
+			summary.graded++
+		}
+		summary.attended += s.Attended
+		summary.marked += s.Marked
+	}
+	return summaries
+}
+
+func (g *groupSummary) average() *float64 {
+	if g.graded == 0 {
+		return nil
+	}
+	avg := g.normalizedSum / float64(g.graded) * progressGPAScale
+	return &avg
+}
+
+func (g *groupSummary) attendance() *float64 {
+	return attendancePercent(g.attended, g.marked)
+}
+
+func attendancePercent(attended, marked int) *float64 {
+	if marked == 0 {
+		return nil
+	}
+	percent := float64(attended) * 100 / float64(marked)
+	return &percent
+}
+
+func formatOptional(value *float64, format string) string {
+	if value == nil {
+		return reportNoValue
+	}
+	return fmt.Sprintf(format, *value)
+}
+
+func formatGroupsReport(stats []database.GroupSubjectStats) string {
+	summaries := summarizeGroups(stats)
+	if len(summaries) == 0 {
+		return reportGroupsHeader + reportEmpty
+	}
+
+	var sb strings.Builder
+	sb.WriteString(reportGroupsHeader)
+	for i, g := range summaries {
+		if i == reportChatRows {
+			fmt.Fprintf(&sb, reportMore, len(summaries)-reportChatRows)
+			break
+		}
+		fmt.Fprintf(&sb, reportGroupRow, g.name, g.students,
+			formatOptional(g.average(), "%.2f"), formatOptional(g.attendance(), "%.0f%%"))
+	}
+	return sb.String()
+}
+
+func formatUnmarkedReport(lessons []database.UnmarkedLesson) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, reportUnmarkedHeader, reportUnmarkedDays)
+	if len(lessons) == 0 {
+		sb.WriteString(reportEmpty)
+		return sb.String()
+	}
+
+	for i, l := range lessons {
+		if i == reportChatRows {
+			fmt.Fprintf(&sb, reportMore, len(lessons)-reportChatRows)
+			break
+		}
+		fmt.Fprintf(&sb, reportUnmarkedRow, l.TeacherName, l.LessonDate.Format("02.01"),
+			l.StartTime.Format(timeFormat), l.SubjectName, l.GroupName)
+	}
+	return sb.String()
+}
+
+func formatInactiveReport(students []database.InactiveStudent) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, reportInactiveHeader, reportInactiveDays)
+	if len(students) == 0 {
+		sb.WriteString(reportEmpty)
+		return sb.String()
+	}
+
+	for i, s := range students {
+		if i == reportChatRows {
+			fmt.Fprintf(&sb, reportMore, len(students)-reportChatRows)
+			break
+		}
+		note := ""
+		if !s.Linked {
+			note = reportNotLinked
+		}
+		fmt.Fprintf(&sb, reportInactiveRow, s.StudentName, groupOrNone(s.GroupName), note)
+	}
+	return sb.String()
+}
+
+func formatLoadReport(load []database.TeacherLoad) string {
+	var sb strings.Builder
+	sb.WriteString(reportLoadHeader)
+	if len(load) == 0 {
+		sb.WriteString(reportEmpty)
+		return sb.String()
+	}
+
+	for i, l := range load {
+		if i == reportChatRows {
+			fmt.Fprintf(&sb, reportMore, len(load)-reportChatRows)
+			break
+		}
+		fmt.Fprintf(&sb, reportLoadRow, l.TeacherName, l.Lessons, l.Hours, l.Groups, l.Subjects)
+	}
+	return sb.String()
+}
+
+// getScheduleConflicts checks the whole current schedule for conflicts.
+func (b *Bot) getScheduleConflicts() ([]services.ScheduleConflict, error) {
+	lessons, err := b.scheduleRepo.GetCalendarLessons(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	return services.FindScheduleConflicts(lessons), nil
+}
+
+func formatConflictsReport(conflicts []services.ScheduleConflict) string {
+	var sb strings.Builder
+	sb.WriteString(reportConflictHeader)
+	if len(conflicts) == 0 {
+		sb.WriteString(reportEmpty)
+		return sb.String()
+	}
+
+	for i, c := range conflicts {
+		if i == reportChatRows {
+			fmt.Fprintf(&sb, reportMore, len(conflicts)-reportChatRows)
+			break
+		}
+		fmt.Fprintf(&sb, reportConflictRow, shortWeekdayNames[c.First.Weekday], c.First.StartTime.Format(timeFormat), c.Reason(),
+			c.First.SubjectName, c.First.GroupName, c.Second.SubjectName, c.Second.GroupName)
+	}
+	return sb.String()
+}
+
+func groupOrNone(groupName *string) string {
+	if groupName == nil {
+		return reportNoGroup
+	}
+	return *groupName
+}
+
+func reportSheets(stats []database.GroupSubjectStats, lessons []database.UnmarkedLesson, students []database.InactiveStudent, load []database.TeacherLoad, conflicts []services.ScheduleConflict) []xlsx.Sheet {
+	groups := xlsx.Sheet{
+		Name: "Группы",
+		Rows: [][]any{{"Группа", "Студентов", "Средний балл (из 5)", "Посещаемость, %"}},
+	}
+	for _, g := range summarizeGroups(stats) {
+		groups.Rows = append(groups.Rows, []any{g.name, g.students, g.average(), g.attendance()})
+	}
+
+	subjects := xlsx.Sheet{
+		Name: "Группы и предметы",
+		Rows: [][]any{{"Группа", "Предмет", "Шкала", "Средний балл", "Оценок", "Посещено", "Отмечено", "Посещаемость, %"}},
+	}
+	for _, s := range stats {
+		subjects.Rows = append(subjects.Rows, []any{
+			s.GroupName, s.SubjectName, grading.GetScale(s.GradingScale).Title, s.GradeAverage,
+			s.GradeCount, s.Attended, s.Marked, attendancePercent(s.Attended, s.Marked),
+		})
+	}
+
+	unmarked := xlsx.Sheet{
+		Name: "Неотмеченные занятия",
+		Rows: [][]any{{"Преподаватель", "Дата", "Время", "Предмет", "Группа"}},
+	}
+	for _, l := range lessons {
+		unmarked.Rows = append(unmarked.Rows, []any{
+			l.TeacherName, l.LessonDate.Format("02.01.2006"), l.StartTime.Format(timeFormat), l.SubjectName, l.GroupName,
+		})
+	}
+
+	inactive := xlsx.Sheet{
+		Name: "Неактивные студенты",
+		Rows: [][]any{{"Студент", "Группа", "Подключён к боту"}},
+	}
+	for _, s := range students {
+		linked := "нет"
+		if s.Linked {
+			linked = "да"
+		}
+		inactive.Rows = append(inactive.Rows, []any{s.StudentName, groupOrNone(s.GroupName), linked})
+	}
+
+	teachers := xlsx.Sheet{
+		Name: "Нагрузка",
+		Rows: [][]any{{"Преподаватель", "Занятий в неделю", "Часов в неделю", "Групп", "Предметов"}},
+	}
+	for _, l := range load {
+		teachers.Rows = append(teachers.Rows, []any{l.TeacherName, l.Lessons, l.Hours, l.Groups, l.Subjects})
+	}
+
+	overlaps := xlsx.Sheet{
+		Name: "Пересечения",
+		Rows: [][]any{{"День", "Пересечение", "Первое занятие", "Группа", "Время", "Второе занятие", "Группа", "Время"}},
+	}
+	for _, c := range conflicts {
+		overlaps.Rows = append(overlaps.Rows, []any{
+			weekdayNames[c.First.Weekday], c.Reason(),
+			c.First.SubjectName, c.First.GroupName, lessonSpan(c.First),
+			c.Second.SubjectName, c.Second.GroupName, lessonSpan(c.Second),
+		})
+	}
+
+	return []xlsx.Sheet{groups, subjects, unmarked, inactive, teachers, overlaps}
+}
+
+func lessonSpan(lesson *database.ScheduleLesson) string {
+	return lesson.StartTime.Format(timeFormat) + "–" + lesson.EndTime.Format(timeFormat)
+}
@@ -4,15 +4,35 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
+	maxbot "github.com/max-messenger/max-bot-api-client-go"
 	"github.com/max-messenger/max-bot-api-client-go/schemes"
 
 	"digitalUniversity/database"
 )
 
 const (
-	scheduleTemplate = "%d. **%s** (%s)\n   👨‍🏫 %s\n   👥 %s\n   🏫 %s\n   ⏰ %s–%s\n\n"
+	scheduleTemplate = "%d. **%s** (%s)\n   👨‍🏫 %s\n   👥 %s\n   🏫 %s\n   ⏰ %s–%s\n%s\n"
 	timeFormat       = "15:04"
+
+	scheduleHolidayMsg   = "🎉 Праздничный день, занятий нет."
+	scheduleNowMarker    = "   ▶️ **Сейчас идёт**, до конца %s\n"
+	scheduleNextMarker   = "   ⏳ **Начнётся через %s**\n"
+	weekHeader           = "🗓️ **Неделя %s – %s**\n"
+	weekDayHeader        = "\n**%s, %s**%s\n"
+	weekToday            = " · сегодня"
+	weekNoLessons        = "нет занятий\n"
+	weekHoliday          = "🎉 праздничный день\n"
+	weekLessonRow        = "%s`%s–%s` %s (%s) · 🏫 %s%s\n"
+	weekLessonGroup      = " · 👥 %s"
+	weekNowMark          = "▶️ "
+	weekNextMark         = "⏳ "
+	datePickerMsg        = "📆 Выберите дату: **%s %d**"
+	datePickerTodayLabel = "·%d·"
+
+	schedulePayloadDate  = "20060102"
+	schedulePayloadMonth = "200601"
 )
 
 var weekdayNames = map[int16]string{
@@ -25,19 +45,55 @@ var weekdayNames = map[int16]string{
 	7: "Воскресенье",
 }
 
-func (b *Bot) formatSchedule(entries []database.Schedule, weekday int16) string {
-	dayName := b.getWeekdayName(weekday)
-	date := b.getNearestDateForWeekday(weekday).Format("02.01")
+var monthNames = map[time.Month]string{
+	time.January:   "Январь",
+	time.February:  "Февраль",
+	time.March:     "Март",
+	time.April:     "Апрель",
+	time.May:       "Май",
+	time.June:      "Июнь",
+	time.July:      "Июль",
+	time.August:    "Август",
+	time.September: "Сентябрь",
+	time.October:   "Октябрь",
+	time.November:  "Ноябрь",
+	time.December:  "Декабрь",
+}
+
+// formatSchedule lists the lessons of the date. On a holiday the lessons are
+// replaced by a note; for today the lesson going on now and the next one are
+// highlighted.
+func (b *Bot) formatSchedule(entries []database.Schedule, date time.Time) string {
+	dayName := b.getWeekdayName(isoWeekday(date))
 
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🗓️%s **%s**\n\n", date.Format("02.01"), dayName)
+
+	if b.isHoliday(date) {
+		sb.WriteString(scheduleHolidayMsg)
+		return sb.String()
+	}
 	if len(entries) == 0 {
-		return fmt.Sprintf("🗓️%s **%s**\n\nНет занятий.", date, dayName)
+		sb.WriteString("Нет занятий.")
+		return sb.String()
 	}
 
-	var sb strings.Builder
-	fmt.Fprintf(&sb, "🗓️%s **%s**\n\n", date, dayName)
+	spans := make([][2]time.Time, len(entries))
+	for i, entry := range entries {
+		spans[i] = [2]time.Time{entry.StartTime, entry.EndTime}
+	}
+	now := time.Now().In(b.location)
+	current, next := lessonMarks(date, now, spans)
 
 	for i, entry := range entries {
-		b.appendScheduleEntry(&sb, i+1, entry)
+		var marker string
+		switch i {
+		case current:
+			marker = fmt.Sprintf(scheduleNowMarker, formatMinutes(atClock(date, entry.EndTime).Sub(now)))
+		case next:
+			marker = fmt.Sprintf(scheduleNextMarker, formatMinutes(atClock(date, entry.StartTime).Sub(now)))
+		}
+		b.appendScheduleEntry(&sb, i+1, entry, marker)
 	}
 
 	return strings.TrimSpace(sb.String())
@@ -50,7 +106,7 @@ func (b *Bot) getWeekdayName(weekday int16) string {
 	return fmt.Sprintf("День %d", weekday)
 }
 
-func (b *Bot) appendScheduleEntry(sb *strings.Builder, index int, entry database.Schedule) {
+func (b *Bot) appendScheduleEntry(sb *strings.Builder, index int, entry database.Schedule, marker string) {
 	subjectName := b.getSubjectName(entry.SubjectID)
 	lessonTypeName := b.getLessonTypeName(entry.LessonTypeID)
 	teacherName := b.getTeacherName(entry.TeacherID)
@@ -68,6 +124,7 @@ func (b *Bot) appendScheduleEntry(sb *strings.Builder, index int, entry database
 		entry.ClassRoom,
 		startTime,
 		endTime,
+		marker,
 	)
 }
 
@@ -85,85 +142,269 @@ func (b *Bot) calculateNavigationDays(weekday int16) (prev, next int16) {
 	return prev, next
 }
 
-func (b *Bot) getScheduleEntriesForUser(maxUserID int64, weekday int16) ([]database.Schedule, error) {
+// lessonMarks returns the index of the lesson going on now and of the next
+// one to start, or -1, given the start and end clock times of the date's
+// lessons in order. Only today's lessons are marked.
+func lessonMarks(date, now time.Time, spans [][2]time.Time) (current, next int) {
+	current, next = -1, -1
+	if !sameDay(date, now) {
+		return current, next
+	}
+
+	for i, span := range spans {
+		start, end := atClock(date, span[0]), atClock(date, span[1])
+		switch {
+		case current == -1 && !now.Before(start) && now.Before(end):
+			current = i
+		case next == -1 && now.Before(start):
+			next = i
+		}
+	}
+	return current, next
+}
+
+// formatMinutes rounds the duration up to whole minutes.
+func formatMinutes(d time.Duration) string {
+	minutes := int((d + time.Minute - 1) / time.Minute)
+	if minutes < 60 {
+		return fmt.Sprintf("%d мин.", minutes)
+	}
+	if minutes%60 == 0 {
+		return fmt.Sprintf("%d ч", minutes/60)
+	}
+	return fmt.Sprintf("%d ч %d мин.", minutes/60, minutes%60)
+}
+
+func sameDay(a, b time.Time) bool {
+	return a.Year() == b.Year() && a.YearDay() == b.YearDay()
+}
+
+func (b *Bot) isHoliday(date time.Time) bool {
+	holiday, err := b.holidayRepo.IsHoliday(date)
+	if err != nil {
+		b.logger.Errorf("Failed to check holiday for %s: %v", date.Format("2006-01-02"), err)
+		return false
+	}
+	return holiday
+}
+
+// today returns the start of the current day in the bot's timezone.
+func (b *Bot) today() time.Time {
+	now := time.Now().In(b.location)
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, b.location)
+}
+
+// scheduleOwner returns whose lessons the user sees: the group's for a
+// student, their own for a teacher. The other ID is zero.
+func (b *Bot) scheduleOwner(maxUserID int64) (groupID, teacherID int64, err error) {
 	userRole, err := b.getUserRole(maxUserID)
 	if err != nil {
 		b.logger.Errorf("Failed to get user role: %v", err)
-		return nil, err
+		return 0, 0, err
 	}
 
 	switch userRole {
 	case "teacher":
-		teacherID, err := b.userRepo.GetUserIDByMaxID(maxUserID)
+		teacherID, err = b.userRepo.GetUserIDByMaxID(maxUserID)
 		if err != nil {
 			b.logger.Errorf("Failed to get teacher ID: %v", err)
-			return nil, err
 		}
-		return b.scheduleRepo.GetScheduleForDateByTeacher(weekday, teacherID)
+		return 0, teacherID, err
 
 	case "student":
 		studentID, err := b.userRepo.GetUserIDByMaxID(maxUserID)
 		if err != nil {
 			b.logger.Errorf("Failed to get student ID: %v", err)
-			return nil, err
+			return 0, 0, err
 		}
 
-		groupID, err := b.userRepo.GetStudentGroupID(studentID)
+		groupID, err = b.userRepo.GetStudentGroupID(studentID)
 		if err != nil {
 			b.logger.Errorf("Failed to get group ID for student %d: %v", studentID, err)
-			return nil, err
 		}
-
-		return b.scheduleRepo.GetScheduleForDateByGroup(weekday, groupID)
+		return groupID, 0, err
 
 	default:
 		b.logger.Warnf("User %d with role %s tried to access schedule", maxUserID, userRole)
-		return nil, fmt.Errorf("schedule not available for role: %s", userRole)
+		return 0, 0, fmt.Errorf("schedule not available for role: %s", userRole)
 	}
 }
 
-func (b *Bot) sendScheduleForDay(ctx context.Context, maxUserID int64, callbackID string, weekday int16) error {
-	entries, err := b.getScheduleEntriesForUser(maxUserID, weekday)
+func (b *Bot) getScheduleEntriesForUser(maxUserID int64, weekday int16) ([]database.Schedule, error) {
+	groupID, teacherID, err := b.scheduleOwner(maxUserID)
+	if err != nil {
+		return nil, err
+	}
+	if teacherID != 0 {
+		return b.scheduleRepo.GetScheduleForDateByTeacher(weekday, teacherID)
+	}
+	return b.scheduleRepo.GetScheduleForDateByGroup(weekday, groupID)
+}
+
+func (b *Bot) buildScheduleForDate(maxUserID int64, date time.Time) (string, *maxbot.Keyboard, error) {
+	entries, err := b.getScheduleEntriesForUser(maxUserID, isoWeekday(date))
+	if err != nil {
+		return "", nil, err
+	}
+	return b.formatSchedule(entries, date), GetScheduleKeyboard(b.MaxAPI, date, b.today()), nil
+}
+
+// sendScheduleMessage sends the schedule as a new message; used when there is
+// no callback to answer, e.g. for text commands.
+func (b *Bot) sendScheduleMessage(ctx context.Context, maxUserID int64, date time.Time) error {
+	text, keyboard, err := b.buildScheduleForDate(maxUserID, date)
 	if err != nil {
 		return err
 	}
 
-	text := b.formatSchedule(entries, weekday)
-	b.logger.Infof("Sending schedule for weekday %d to user %d", weekday, maxUserID)
+	b.logger.Infof("Sending schedule message for %s to user %d", date.Format("2006-01-02"), maxUserID)
+	b.sendKeyboard(ctx, keyboard, maxUserID, text)
 
-	prevDay, nextDay := b.calculateNavigationDays(weekday)
+	return nil
+}
 
-	messageBody := &schemes.NewMessageBody{
-		Text:        text,
-		Format:      "markdown",
-		Attachments: []any{schemes.NewInlineKeyboardAttachmentRequest(GetScheduleKeyboard(b.MaxAPI, prevDay, nextDay).Build())},
+func (b *Bot) answerScheduleCallback(ctx context.Context, maxUserID int64, callbackID string, date time.Time) error {
+	text, keyboard, err := b.buildScheduleForDate(maxUserID, date)
+	if err != nil {
+		return err
 	}
 
-	answer := &schemes.CallbackAnswer{Message: messageBody}
-	_, err = b.MaxAPI.Messages.AnswerOnCallback(ctx, callbackID, answer)
-	if err != nil && err.Error() != "" {
-		b.logger.Errorf("Failed to answer callback with schedule: %v", err)
+	b.logger.Infof("Answering callback for %s, user %d", date.Format("2006-01-02"), maxUserID)
+
+	if err := b.answerCallbackWithKeyboard(ctx, callbackID, keyboard, text); err != nil {
+		b.logger.Errorf("Failed to answer callback: %v", err)
 		return err
 	}
 
 	return nil
 }
 
-func (b *Bot) answerScheduleCallback(ctx context.Context, maxUserID int64, callbackID string, weekday int16) error {
-	entries, err := b.getScheduleEntriesForUser(maxUserID, weekday)
+// answerScheduleWeek shows the whole week of the date in a compact form, one
+// line per lesson.
+func (b *Bot) answerScheduleWeek(ctx context.Context, maxUserID int64, callbackID string, date time.Time) error {
+	groupID, teacherID, err := b.scheduleOwner(maxUserID)
 	if err != nil {
 		return err
 	}
 
-	text := b.formatSchedule(entries, weekday)
-	b.logger.Infof("Answering callback for weekday %d, user %d", weekday, maxUserID)
-
-	prevDay, nextDay := b.calculateNavigationDays(weekday)
+	lessons, err := b.scheduleRepo.GetCalendarLessons(groupID, teacherID)
+	if err != nil {
+		return err
+	}
 
-	if err := b.answerCallbackWithKeyboard(ctx, callbackID, GetScheduleKeyboard(b.MaxAPI, prevDay, nextDay), text); err != nil {
-		b.logger.Errorf("Failed to answer callback: %v", err)
+	monday := date.AddDate(0, 0, 1-int(isoWeekday(date)))
+	holidays, err := b.holidayRepo.GetHolidays(monday, monday.AddDate(0, 0, 6))
+	if err != nil {
 		return err
 	}
 
-	return nil
+	text := b.formatWeek(lessons, holidays, monday, teacherID != 0)
+	return b.answerCallbackWithKeyboard(ctx, callbackID, b.weekKeyboard(monday), text)
+}
+
+func (b *Bot) formatWeek(lessons []database.ScheduleLesson, holidays []time.Time, monday time.Time, forTeacher bool) string {
+	byDay := make(map[int16][]database.ScheduleLesson)
+	for _, lesson := range lessons {
+		byDay[lesson.Weekday] = append(byDay[lesson.Weekday], lesson)
+	}
+	holidayDays := make(map[int16]bool)
+	for _, holiday := range holidays {
+		holidayDays[isoWeekday(holiday)] = true
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, weekHeader, monday.Format("02.01"), monday.AddDate(0, 0, 6).Format("02.01"))
+
+	now := time.Now().In(b.location)
+	for weekday := int16(1); weekday <= 7; weekday++ {
+		day := monday.AddDate(0, 0, int(weekday)-1)
+		dayLessons := byDay[weekday]
+		if len(dayLessons) == 0 && (weekday > 5 || holidayDays[weekday]) {
+			continue
+		}
+
+		todayMark := ""
+		if sameDay(day, now) {
+			todayMark = weekToday
+		}
+		fmt.Fprintf(&sb, weekDayHeader, shortWeekdayNames[weekday], day.Format("02.01"), todayMark)
+
+		switch {
+		case holidayDays[weekday]:
+			sb.WriteString(weekHoliday)
+			continue
+		case len(dayLessons) == 0:
+			sb.WriteString(weekNoLessons)
+			continue
+		}
+
+		spans := make([][2]time.Time, len(dayLessons))
+		for i, lesson := range dayLessons {
+			spans[i] = [2]time.Time{lesson.StartTime, lesson.EndTime}
+		}
+		current, next := lessonMarks(day, now, spans)
+
+		for i, lesson := range dayLessons {
+			var mark, group string
+			switch i {
+			case current:
+				mark = weekNowMark
+			case next:
+				mark = weekNextMark
+			}
+			if forTeacher {
+				group = fmt.Sprintf(weekLessonGroup, lesson.GroupName)
+			}
+			fmt.Fprintf(&sb, weekLessonRow, mark, lesson.StartTime.Format(timeFormat), lesson.EndTime.Format(timeFormat),
+				lesson.SubjectName, lesson.TypeName, lesson.ClassRoom, group)
+		}
+	}
+
+	return strings.TrimSpace(sb.String())
+}
+
+func (b *Bot) weekKeyboard(monday time.Time) *maxbot.Keyboard {
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+
+	days := keyboard.AddRow()
+	for weekday := int16(1); weekday <= 7; weekday++ {
+		days.AddCallback(shortWeekdayNames[weekday], schemes.DEFAULT, scheduleDatePayload(monday.AddDate(0, 0, int(weekday)-1)))
+	}
+	keyboard.AddRow().
+		AddCallback(btnPrev, schemes.NEGATIVE, fmt.Sprintf(payloadScheduleWeek, monday.AddDate(0, 0, -7).Format(schedulePayloadDate))).
+		AddCallback(btnNext, schemes.NEGATIVE, fmt.Sprintf(payloadScheduleWeek, monday.AddDate(0, 0, 7).Format(schedulePayloadDate)))
+	keyboard.AddRow().
+		AddCallback(btnToday, schemes.DEFAULT, scheduleDatePayload(b.today())).
+		AddCallback(btnPickDate, schemes.DEFAULT, fmt.Sprintf(payloadSchedulePick, monday.Format(schedulePayloadMonth)))
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+
+	return keyboard
+}
+
+// answerDatePicker shows the days of the month as buttons, a row per week.
+func (b *Bot) answerDatePicker(ctx context.Context, callbackID string, month time.Time) error {
+	first := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, b.location)
+	today := b.today()
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	var row *maxbot.KeyboardRow
+	for day := first; day.Month() == first.Month(); day = day.AddDate(0, 0, 1) {
+		if row == nil || isoWeekday(day) == 1 {
+			row = keyboard.AddRow()
+		}
+		label := fmt.Sprintf("%d", day.Day())
+		if day.Equal(today) {
+			label = fmt.Sprintf(datePickerTodayLabel, day.Day())
+		}
+		row.AddCallback(label, schemes.DEFAULT, scheduleDatePayload(day))
+	}
+
+	keyboard.AddRow().
+		AddCallback(btnPrev, schemes.NEGATIVE, fmt.Sprintf(payloadSchedulePick, first.AddDate(0, -1, 0).Format(schedulePayloadMonth))).
+		AddCallback(btnNext, schemes.NEGATIVE, fmt.Sprintf(payloadSchedulePick, first.AddDate(0, 1, 0).Format(schedulePayloadMonth)))
+	keyboard.AddRow().AddCallback(btnToday, schemes.DEFAULT, scheduleDatePayload(today))
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+
+	text := fmt.Sprintf(datePickerMsg, monthNames[first.Month()], first.Year())
+	return b.answerCallbackWithKeyboard(ctx, callbackID, keyboard, text)
 }
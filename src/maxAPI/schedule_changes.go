@@ -0,0 +1,213 @@
+package maxAPI
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"digitalUniversity/database"
+	"digitalUniversity/services"
+)
+
+const (
+	scheduleChangesHeader     = "🗓️ **Изменения в расписании**\n\n"
+	scheduleChangesMore       = "…и ещё изменений: %d"
+	scheduleChangesBatchTitle = "Изменения расписания: добавлено %d, отменено %d, перенесено %d"
+
+	scheduleChangeAdded   = "➕ %s: %s"
+	scheduleChangeRemoved = "❌ %s: %s — отменено"
+	scheduleChangeMoved   = "🔁 %s: %s → %s"
+	scheduleChangeTeacher = ", преподаватель %s"
+	scheduleChangeReplace = "👤 %s: %s — замена, преподаватель %s"
+	scheduleChangeSlot    = "%s %s–%s, ауд. %s"
+
+	maxScheduleChangeLines = 15
+)
+
+var shortWeekdayNames = map[int16]string{
+	1: "Пн",
+	2: "Вт",
+	3: "Ср",
+	4: "Чт",
+	5: "Пт",
+	6: "Сб",
+	7: "Вс",
+}
+
+func (b *Bot) importSchedule(importer *services.CSVImporter, userID int64, filePath string) error {
+	adminID, err := b.userRepo.GetUserIDByMaxID(userID)
+	if err != nil {
+		return err
+	}
+
+	return importer.ImportSchedule(filePath, func(tx *sqlx.Tx, changes []services.ScheduleChange) error {
+		return b.enqueueScheduleChanges(tx, adminID, changes)
+	})
+}
+
+// enqueueScheduleChanges queues for every affected student and teacher a
+// summary of the changes to their week. Students see the changes of their
+// group, teachers the changes of lessons they teach before or after the
+// import. The notifications form a batch, so the admin gets a delivery report.
+func (b *Bot) enqueueScheduleChanges(tx *sqlx.Tx, adminID int64, changes []services.ScheduleChange) error {
+	recipients, order, err := b.scheduleChangeRecipients(tx, changes)
+	if err != nil {
+		return err
+	}
+	if len(order) == 0 {
+		return nil
+	}
+
+	var added, removed, moved int
+	for _, change := range changes {
+		switch change.Kind {
+		case services.ScheduleChangeAdded:
+			added++
+		case services.ScheduleChangeRemoved:
+			removed++
+		case services.ScheduleChangeMoved:
+			moved++
+		}
+	}
+
+	batchID, err := b.outboxRepo.CreateBatch(tx, adminID, fmt.Sprintf(scheduleChangesBatchTitle, added, removed, moved))
+	if err != nil {
+		return err
+	}
+
+	for _, recipientID := range order {
+		recipient := recipients[recipientID]
+		notification := database.OutboxNotification{
+			UserID:        recipientID,
+			BatchID:       &batchID,
+			Category:      categorySchedule,
+			MessageText:   formatScheduleChanges(changes, recipient.changes, recipient.teacher),
+			ButtonText:    btnShowSchedule,
+			ButtonPayload: payloadShowSchedule,
+		}
+		if _, err := b.outboxRepo.Enqueue(tx, notification); err != nil {
+			return err
+		}
+	}
+
+	b.logger.Infof("Queued schedule changes (%d added, %d removed, %d moved) for %d users",
+		added, removed, moved, len(order))
+	return nil
+}
+
+type scheduleChangeRecipient struct {
+	teacher bool
+	changes []int
+}
+
+// scheduleChangeRecipients maps every user reachable through the bot to the
+// indexes of the changes that concern them.
+func (b *Bot) scheduleChangeRecipients(tx *sqlx.Tx, changes []services.ScheduleChange) (map[int64]*scheduleChangeRecipient, []int64, error) {
+	recipients := make(map[int64]*scheduleChangeRecipient)
+	var order []int64
+
+	add := func(userID int64, teacher bool, index int) {
+		recipient, ok := recipients[userID]
+		if !ok {
+			recipient = &scheduleChangeRecipient{teacher: teacher}
+			recipients[userID] = recipient
+			order = append(order, userID)
+		}
+		if n := len(recipient.changes); n == 0 || recipient.changes[n-1] != index {
+			recipient.changes = append(recipient.changes, index)
+		}
+	}
+
+	students := make(map[int64][]int64)
+	linkedTeachers := make(map[int64]bool)
+
+	for i, change := range changes {
+		lesson := change.After
+		if lesson == nil {
+			lesson = change.Before
+		}
+
+		studentIDs, ok := students[lesson.GroupID]
+		if !ok {
+			var err error
+			studentIDs, err = b.userRepo.GetNotifiableStudentIDs(tx, lesson.GroupID)
+			if err != nil {
+				return nil, nil, err
+			}
+			students[lesson.GroupID] = studentIDs
+		}
+		for _, studentID := range studentIDs {
+			add(studentID, false, i)
+		}
+
+		for _, l := range []*database.ScheduleLesson{change.Before, change.After} {
+			if l == nil {
+				continue
+			}
+
+			linked, ok := linkedTeachers[l.TeacherID]
+			if !ok {
+				var err error
+				linked, err = b.userRepo.HasMaxID(tx, l.TeacherID)
+				if err != nil {
+					return nil, nil, err
+				}
+				linkedTeachers[l.TeacherID] = linked
+			}
+			if linked {
+				add(l.TeacherID, true, i)
+			}
+		}
+	}
+
+	return recipients, order, nil
+}
+
+func formatScheduleChanges(changes []services.ScheduleChange, indexes []int, forTeacher bool) string {
+	lines := make([]string, 0, maxScheduleChangeLines+1)
+	for _, i := range indexes {
+		if len(lines) == maxScheduleChangeLines {
+			lines = append(lines, fmt.Sprintf(scheduleChangesMore, len(indexes)-maxScheduleChangeLines))
+			break
+		}
+		lines = append(lines, formatScheduleChange(changes[i], forTeacher))
+	}
+	return scheduleChangesHeader + strings.Join(lines, "\n")
+}
+
+func formatScheduleChange(change services.ScheduleChange, forTeacher bool) string {
+	switch change.Kind {
+	case services.ScheduleChangeAdded:
+		return fmt.Sprintf(scheduleChangeAdded, formatChangedCourse(change.After, forTeacher), formatLessonSlot(change.After))
+	case services.ScheduleChangeRemoved:
+		return fmt.Sprintf(scheduleChangeRemoved, formatChangedCourse(change.Before, forTeacher), formatLessonSlot(change.Before))
+	default:
+		before, after := formatLessonSlot(change.Before), formatLessonSlot(change.After)
+		teacherChanged := change.Before.TeacherID != change.After.TeacherID
+		if before == after && teacherChanged {
+			return fmt.Sprintf(scheduleChangeReplace, formatChangedCourse(change.After, forTeacher), after, change.After.TeacherName)
+		}
+		line := fmt.Sprintf(scheduleChangeMoved, formatChangedCourse(change.After, forTeacher),
+			before, after)
+		if teacherChanged {
+			line += fmt.Sprintf(scheduleChangeTeacher, change.After.TeacherName)
+		}
+		return line
+	}
+}
+
+func formatChangedCourse(lesson *database.ScheduleLesson, withGroup bool) string {
+	if withGroup {
+		return fmt.Sprintf("**%s** (%s, %s)", lesson.SubjectName, lesson.TypeName, lesson.GroupName)
+	}
+	return fmt.Sprintf("**%s** (%s)", lesson.SubjectName, lesson.TypeName)
+}
+
+func formatLessonSlot(lesson *database.ScheduleLesson) string {
+	return fmt.Sprintf(scheduleChangeSlot,
+		shortWeekdayNames[lesson.Weekday],
+		lesson.StartTime.Format(timeFormat),
+		lesson.EndTime.Format(timeFormat),
+		lesson.ClassRoom)
+}
@@ -0,0 +1,876 @@
+package maxAPI
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	maxbot "github.com/max-messenger/max-bot-api-client-go"
+	"github.com/max-messenger/max-bot-api-client-go/schemes"
+
+	"digitalUniversity/database"
+	"digitalUniversity/services"
+)
+
+const (
+	inputScheduleEdit = "schedule_edit"
+
+	editFieldRoom    = "room"
+	editFieldTime    = "time"
+	editFieldTeacher = "teacher"
+
+	editSelectGroupMsg   = "✏️ **Редактирование расписания**\n\nВыберите группу:"
+	editSelectDayMsg     = "✏️ Группа **%s**\n\nВыберите день недели:"
+	editDayHeader        = "✏️ Группа **%s**, %s\n\n"
+	editDayEmpty         = "Занятий нет."
+	editDayFooter        = "\nВыберите занятие или добавьте новое."
+	editLessonCard       = "📚 **%s** (%s)\n👥 Группа %s\n🗓️ %s, %s–%s\n🏫 Ауд. %s\n👨‍🏫 %s"
+	editSavedMsg         = "✅ Изменения сохранены.\n\n"
+	editAddedMsg         = "✅ Занятие добавлено.\n\n"
+	editDeletedMsg       = "✅ Занятие удалено.\n\n"
+	editDeleteConfirmMsg = "Удалить занятие?\n\n%s\n\nЕсли по нему уже есть оценки или посещаемость, оно пропадёт из расписания, а отметки сохранятся."
+	editRoomPrompt       = "Отправьте номер аудитории, например «А-101»."
+	editTimePrompt       = "Отправьте время занятия, например «09:00-10:30». Чтобы перенести занятие на другой день, укажите его перед временем: «Ср 09:00-10:30»."
+	editTeacherPrompt    = "Отправьте фамилию преподавателя."
+	editSelectTypeMsg    = "Выберите тип занятия:"
+	editSelectSubjectMsg = "➕ Новое занятие: группа **%s**, %s\n\nВыберите предмет:"
+	editSelectTeacherMsg = "Найдено несколько преподавателей, выберите:"
+	editPreviewMsg       = "➕ **Новое занятие**\n\n%s\n\nСохранить?"
+	editInvalidRoomMsg   = "Номер аудитории не должен быть пустым или длиннее %d символов. " + editRoomPrompt
+	editInvalidTimeMsg   = "Не удалось разобрать время «%s». " + editTimePrompt
+	editTimeOrderMsg     = "Занятие должно заканчиваться позже, чем начинается. " + editTimePrompt
+	editTeacherNotFound  = "Преподаватель «%s» не найден. " + editTeacherPrompt
+	editConflictHeader   = "⚠️ Занятие пересекается с другими, изменение не сохранено:\n\n"
+	editConflictRow      = "• %s — %s (%s, группа %s), %s–%s\n"
+	editConflictRetry    = "\nОтправьте другое значение или отмените изменение."
+	editNoSubjectsMsg    = "Предметов нет. Сначала загрузите расписание из файла."
+	editNoTypesMsg       = "Типов занятий нет. Сначала загрузите расписание из файла."
+	editNotFoundMsg      = "Занятие не найдено — возможно, его уже удалили."
+	editExpiredMsg       = "Изменение не найдено, начните заново."
+	editForbiddenMsg     = "Редактирование расписания доступно только администраторам."
+	editErrorMsg         = "Не удалось сохранить изменение. Попробуйте позже."
+
+	btnEditRoom       = "🏫 Аудитория"
+	btnEditTime       = "🕘 Время и день"
+	btnEditTeacher    = "👨‍🏫 Преподаватель"
+	btnEditType       = "📚 Тип занятия"
+	btnEditDelete     = "🗑 Удалить"
+	btnEditDeleteOK   = "🗑 Да, удалить"
+	btnEditAdd        = "➕ Добавить занятие"
+	btnEditAllSubject = "📚 Все предметы"
+	btnEditSave       = "✅ Сохранить"
+	btnEditCancel     = "❌ Отмена"
+	btnEditToDay      = "← К занятиям дня"
+	btnEditToDays     = "← К дням недели"
+	btnEditToGroups   = "← К группам"
+	btnEditDayCount   = "%s (%d)"
+
+	payloadEditGroup      = "sed_grp_%d"
+	payloadEditDay        = "sed_day_%d_%d"
+	payloadEditLesson     = "sed_les_%d"
+	payloadEditRoom       = "sed_room_%d"
+	payloadEditTime       = "sed_time_%d"
+	payloadEditTeacher    = "sed_tchr_%d"
+	payloadEditType       = "sed_type_%d"
+	payloadEditDelete     = "sed_del_%d"
+	payloadEditDeleteOK   = "sed_delok_%d"
+	payloadEditAdd        = "sed_add_%d_%d"
+	payloadEditAllSubject = "sed_allsubj"
+	payloadEditSubject    = "sed_subj_%d"
+	payloadEditSetType    = "sed_settype_%d"
+	payloadEditSetTeacher = "sed_tch_%d"
+	payloadEditSave       = "sed_save"
+	payloadEditCancel     = "sed_cancel"
+
+	// maxClassRoomLength is the size of schedule.class_room.
+	maxClassRoomLength = 100
+	// editTeacherLimit caps the teachers offered to choose from.
+	editTeacherLimit = 8
+)
+
+// scheduleDraft is a lesson being edited or added. A new lesson has no ID
+// and is filled in step by step; field is the value the admin is asked to
+// type next.
+type scheduleDraft struct {
+	lesson database.ScheduleLesson
+	field  string
+}
+
+func (b *Bot) handleScheduleEditCallback(ctx context.Context, userID int64, callbackID, payload string) error {
+	userRole, err := b.getUserRole(userID)
+	if err != nil {
+		return err
+	}
+	if userRole != "admin" {
+		return b.answerCallbackWithNotification(ctx, callbackID, editForbiddenMsg)
+	}
+
+	parts := strings.Split(payload, "_")
+	if len(parts) < 2 {
+		return fmt.Errorf("invalid schedule edit callback payload: %s", payload)
+	}
+
+	ids := make([]int64, 0, 2)
+	for _, part := range parts[2:] {
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid schedule edit callback payload: %s", payload)
+		}
+		ids = append(ids, id)
+	}
+	needIDs := func(n int) error {
+		if len(ids) != n || n == 2 && (ids[1] < 1 || ids[1] > 7) {
+			return fmt.Errorf("invalid schedule edit callback payload: %s", payload)
+		}
+		return nil
+	}
+
+	switch parts[1] {
+	case "start":
+		b.clearScheduleDraft(userID)
+		return b.answerEditGroups(ctx, callbackID)
+	case "grp":
+		if err := needIDs(1); err != nil {
+			return err
+		}
+		return b.answerEditDays(ctx, callbackID, ids[0])
+	case "day":
+		if err := needIDs(2); err != nil {
+			return err
+		}
+		b.clearScheduleDraft(userID)
+		text, keyboard, err := b.buildEditDay(ids[0], int16(ids[1]))
+		if err != nil {
+			return err
+		}
+		return b.answerCallbackWithKeyboard(ctx, callbackID, keyboard, text)
+	case "les":
+		if err := needIDs(1); err != nil {
+			return err
+		}
+		b.clearScheduleDraft(userID)
+		return b.answerEditLesson(ctx, callbackID, ids[0], "")
+	case "room", "time", "tchr":
+		if err := needIDs(1); err != nil {
+			return err
+		}
+		return b.startLessonFieldEdit(ctx, userID, callbackID, ids[0], parts[1])
+	case "type":
+		if err := needIDs(1); err != nil {
+			return err
+		}
+		return b.startLessonTypeEdit(ctx, userID, callbackID, ids[0])
+	case "del", "delok":
+		if err := needIDs(1); err != nil {
+			return err
+		}
+		return b.handleEditDelete(ctx, userID, callbackID, ids[0], parts[1] == "delok")
+	case "add":
+		if err := needIDs(2); err != nil {
+			return err
+		}
+		return b.startNewLesson(ctx, userID, callbackID, ids[0], int16(ids[1]))
+	case "allsubj":
+		return b.answerEditSubjects(ctx, userID, callbackID, true)
+	case "subj", "settype", "tch":
+		if err := needIDs(1); err != nil {
+			return err
+		}
+		return b.setDraftChoice(ctx, userID, callbackID, parts[1], ids[0])
+	case "save":
+		return b.saveNewLesson(ctx, userID, callbackID)
+	case "cancel":
+		return b.cancelScheduleEdit(ctx, userID, callbackID)
+	default:
+		return fmt.Errorf("unknown schedule edit callback: %s", payload)
+	}
+}
+
+func (b *Bot) answerEditGroups(ctx context.Context, callbackID string) error {
+	groups, err := b.groupRepo.GetAllGroups()
+	if err != nil {
+		return err
+	}
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	var row *maxbot.KeyboardRow
+	for i, group := range groups {
+		if i%2 == 0 {
+			row = keyboard.AddRow()
+		}
+		row.AddCallback(group.GroupName, schemes.DEFAULT, fmt.Sprintf(payloadEditGroup, group.GroupID))
+	}
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+
+	return b.answerCallbackWithKeyboard(ctx, callbackID, keyboard, editSelectGroupMsg)
+}
+
+// answerEditDays offers the days of the week with the number of the group's
+// lessons on each.
+func (b *Bot) answerEditDays(ctx context.Context, callbackID string, groupID int64) error {
+	lessons, err := b.scheduleRepo.GetCalendarLessons(groupID, 0)
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[int16]int)
+	for _, lesson := range lessons {
+		counts[lesson.Weekday]++
+	}
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	var row *maxbot.KeyboardRow
+	for day := int16(1); day <= 7; day++ {
+		if (day-1)%3 == 0 {
+			row = keyboard.AddRow()
+		}
+		row.AddCallback(fmt.Sprintf(btnEditDayCount, shortWeekdayNames[day], counts[day]), schemes.DEFAULT,
+			fmt.Sprintf(payloadEditDay, groupID, day))
+	}
+	keyboard.AddRow().AddCallback(btnEditToGroups, schemes.DEFAULT, payloadScheduleEditor)
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+
+	return b.answerCallbackWithKeyboard(ctx, callbackID, keyboard, fmt.Sprintf(editSelectDayMsg, b.getGroupName(groupID)))
+}
+
+// buildEditDay lists the group's lessons on the weekday as buttons.
+func (b *Bot) buildEditDay(groupID int64, weekday int16) (string, *maxbot.Keyboard, error) {
+	lessons, err := b.scheduleRepo.GetCalendarLessons(groupID, 0)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, editDayHeader, b.getGroupName(groupID), b.getWeekdayName(weekday))
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	found := false
+	for _, lesson := range lessons {
+		if lesson.Weekday != weekday {
+			continue
+		}
+		found = true
+		label := fmt.Sprintf("%s %s (%s)", lesson.StartTime.Format(timeFormat), lesson.SubjectName, lesson.TypeName)
+		keyboard.AddRow().AddCallback(label, schemes.DEFAULT, fmt.Sprintf(payloadEditLesson, lesson.ScheduleID))
+	}
+	if !found {
+		sb.WriteString(editDayEmpty)
+	}
+	sb.WriteString(editDayFooter)
+
+	keyboard.AddRow().AddCallback(btnEditAdd, schemes.POSITIVE, fmt.Sprintf(payloadEditAdd, groupID, weekday))
+	keyboard.AddRow().AddCallback(btnEditToDays, schemes.DEFAULT, fmt.Sprintf(payloadEditGroup, groupID))
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+
+	return sb.String(), keyboard, nil
+}
+
+// answerEditLesson shows a lesson with the actions on it, after the notice
+// of what was just done.
+func (b *Bot) answerEditLesson(ctx context.Context, callbackID string, scheduleID int64, notice string) error {
+	lesson, err := b.scheduleRepo.GetLesson(scheduleID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return b.answerCallbackWithNotification(ctx, callbackID, editNotFoundMsg)
+	}
+	if err != nil {
+		return err
+	}
+
+	return b.answerCallbackWithKeyboard(ctx, callbackID, b.editLessonKeyboard(lesson), notice+b.formatEditLesson(lesson))
+}
+
+func (b *Bot) editLessonKeyboard(lesson *database.ScheduleLesson) *maxbot.Keyboard {
+	id := lesson.ScheduleID
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	keyboard.AddRow().
+		AddCallback(btnEditRoom, schemes.DEFAULT, fmt.Sprintf(payloadEditRoom, id)).
+		AddCallback(btnEditTime, schemes.DEFAULT, fmt.Sprintf(payloadEditTime, id))
+	keyboard.AddRow().
+		AddCallback(btnEditTeacher, schemes.DEFAULT, fmt.Sprintf(payloadEditTeacher, id)).
+		AddCallback(btnEditType, schemes.DEFAULT, fmt.Sprintf(payloadEditType, id))
+	keyboard.AddRow().AddCallback(btnEditDelete, schemes.NEGATIVE, fmt.Sprintf(payloadEditDelete, id))
+	keyboard.AddRow().AddCallback(btnEditToDay, schemes.DEFAULT, fmt.Sprintf(payloadEditDay, lesson.GroupID, lesson.Weekday))
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+	return keyboard
+}
+
+func (b *Bot) formatEditLesson(lesson *database.ScheduleLesson) string {
+	return fmt.Sprintf(editLessonCard, lesson.SubjectName, lesson.TypeName, lesson.GroupName,
+		b.getWeekdayName(lesson.Weekday), lesson.StartTime.Format(timeFormat), lesson.EndTime.Format(timeFormat),
+		lesson.ClassRoom, lesson.TeacherName)
+}
+
+// startLessonFieldEdit asks for a new room, time or teacher of a lesson.
+func (b *Bot) startLessonFieldEdit(ctx context.Context, userID int64, callbackID string, scheduleID int64, action string) error {
+	lesson, err := b.scheduleRepo.GetLesson(scheduleID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return b.answerCallbackWithNotification(ctx, callbackID, editNotFoundMsg)
+	}
+	if err != nil {
+		return err
+	}
+
+	field, prompt := editFieldRoom, editRoomPrompt
+	switch action {
+	case "time":
+		field, prompt = editFieldTime, editTimePrompt
+	case "tchr":
+		field, prompt = editFieldTeacher, editTeacherPrompt
+	}
+
+	b.setScheduleDraft(userID, &scheduleDraft{lesson: *lesson, field: field})
+	return b.answerCallbackWithKeyboard(ctx, callbackID, b.editCancelKeyboard(), b.formatEditLesson(lesson)+"\n\n"+prompt)
+}
+
+func (b *Bot) startLessonTypeEdit(ctx context.Context, userID int64, callbackID string, scheduleID int64) error {
+	lesson, err := b.scheduleRepo.GetLesson(scheduleID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return b.answerCallbackWithNotification(ctx, callbackID, editNotFoundMsg)
+	}
+	if err != nil {
+		return err
+	}
+
+	b.setScheduleDraft(userID, &scheduleDraft{lesson: *lesson})
+	return b.answerEditTypes(ctx, userID, callbackID, b.formatEditLesson(lesson)+"\n\n")
+}
+
+func (b *Bot) answerEditTypes(ctx context.Context, userID int64, callbackID, header string) error {
+	types, err := b.lessonTypeRepo.GetLessonTypes()
+	if err != nil {
+		return err
+	}
+	if len(types) == 0 {
+		b.clearScheduleDraft(userID)
+		return b.answerCallbackWithNotification(ctx, callbackID, editNoTypesMsg)
+	}
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	for _, lessonType := range types {
+		keyboard.AddRow().AddCallback(lessonType.TypeName, schemes.DEFAULT, fmt.Sprintf(payloadEditSetType, lessonType.LessonTypeID))
+	}
+	keyboard.AddRow().AddCallback(btnEditCancel, schemes.DEFAULT, payloadEditCancel)
+
+	return b.answerCallbackWithKeyboard(ctx, callbackID, keyboard, header+editSelectTypeMsg)
+}
+
+func (b *Bot) handleEditDelete(ctx context.Context, userID int64, callbackID string, scheduleID int64, confirmed bool) error {
+	lesson, err := b.scheduleRepo.GetLesson(scheduleID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return b.answerCallbackWithNotification(ctx, callbackID, editNotFoundMsg)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !confirmed {
+		keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+		keyboard.AddRow().AddCallback(btnEditDeleteOK, schemes.NEGATIVE, fmt.Sprintf(payloadEditDeleteOK, scheduleID))
+		keyboard.AddRow().AddCallback(btnEditCancel, schemes.DEFAULT, fmt.Sprintf(payloadEditLesson, scheduleID))
+		return b.answerCallbackWithKeyboard(ctx, callbackID, keyboard, fmt.Sprintf(editDeleteConfirmMsg, b.formatEditLesson(lesson)))
+	}
+
+	change := services.ScheduleChange{Kind: services.ScheduleChangeRemoved, Before: lesson}
+	if _, err := b.applyScheduleEdit(userID, change); err != nil {
+		b.logger.Errorf("Failed to delete lesson %d: %v", scheduleID, err)
+		return b.answerCallbackWithNotification(ctx, callbackID, editErrorMsg)
+	}
+	b.logger.Infof("Admin %d deleted lesson %d", userID, scheduleID)
+
+	text, keyboard, err := b.buildEditDay(lesson.GroupID, lesson.Weekday)
+	if err != nil {
+		return err
+	}
+	return b.answerCallbackWithKeyboard(ctx, callbackID, keyboard, editDeletedMsg+text)
+}
+
+// startNewLesson starts a lesson of the group on the weekday; the admin
+// picks its subject first.
+func (b *Bot) startNewLesson(ctx context.Context, userID int64, callbackID string, groupID int64, weekday int16) error {
+	lesson := database.ScheduleLesson{GroupName: b.getGroupName(groupID)}
+	lesson.GroupID = groupID
+	lesson.Weekday = weekday
+
+	b.setScheduleDraft(userID, &scheduleDraft{lesson: lesson})
+	return b.answerEditSubjects(ctx, userID, callbackID, false)
+}
+
+// answerEditSubjects offers the subjects of the draft's group, or all
+// subjects when asked or when the group has none yet.
+func (b *Bot) answerEditSubjects(ctx context.Context, userID int64, callbackID string, all bool) error {
+	draft, ok := b.getScheduleDraft(userID)
+	if !ok || draft.lesson.ScheduleID != 0 {
+		return b.answerCallbackWithNotification(ctx, callbackID, editExpiredMsg)
+	}
+
+	var subjects []database.Subject
+	var err error
+	if !all {
+		if subjects, err = b.gradeRepo.GetSubjectsByStudentGroup(draft.lesson.GroupID); err != nil {
+			return err
+		}
+	}
+	if len(subjects) == 0 {
+		all = true
+		if subjects, err = b.subjectRepo.GetAllSubjects(); err != nil {
+			return err
+		}
+	}
+	if len(subjects) == 0 {
+		b.clearScheduleDraft(userID)
+		return b.answerCallbackWithNotification(ctx, callbackID, editNoSubjectsMsg)
+	}
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	for _, subject := range subjects {
+		keyboard.AddRow().AddCallback(subject.SubjectName, schemes.DEFAULT, fmt.Sprintf(payloadEditSubject, subject.SubjectID))
+	}
+	if !all {
+		keyboard.AddRow().AddCallback(btnEditAllSubject, schemes.DEFAULT, payloadEditAllSubject)
+	}
+	keyboard.AddRow().AddCallback(btnEditCancel, schemes.DEFAULT, payloadEditCancel)
+
+	text := fmt.Sprintf(editSelectSubjectMsg, draft.lesson.GroupName, b.getWeekdayName(draft.lesson.Weekday))
+	return b.answerCallbackWithKeyboard(ctx, callbackID, keyboard, text)
+}
+
+// setDraftChoice stores a subject, lesson type or teacher picked with a
+// button and moves the draft on.
+func (b *Bot) setDraftChoice(ctx context.Context, userID int64, callbackID, choice string, id int64) error {
+	draft, ok := b.getScheduleDraft(userID)
+	if !ok {
+		return b.answerCallbackWithNotification(ctx, callbackID, editExpiredMsg)
+	}
+
+	lesson := draft.lesson
+	switch choice {
+	case "subj":
+		if lesson.ScheduleID != 0 {
+			return b.answerCallbackWithNotification(ctx, callbackID, editExpiredMsg)
+		}
+		name, err := b.subjectRepo.GetSubjectName(id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return b.answerCallbackWithNotification(ctx, callbackID, editExpiredMsg)
+		}
+		if err != nil {
+			return err
+		}
+		lesson.SubjectID, lesson.SubjectName = id, name
+	case "settype":
+		name, err := b.lessonTypeRepo.GetLessonTypeName(id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return b.answerCallbackWithNotification(ctx, callbackID, editExpiredMsg)
+		}
+		if err != nil {
+			return err
+		}
+		lesson.LessonTypeID, lesson.TypeName = id, name
+	case "tch":
+		name, err := b.userRepo.GetTeacherName(id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return b.answerCallbackWithNotification(ctx, callbackID, editExpiredMsg)
+		}
+		if err != nil {
+			return err
+		}
+		lesson.TeacherID, lesson.TeacherName = id, name
+	}
+
+	text, keyboard, err := b.advanceScheduleDraft(userID, draft, lesson)
+	if err != nil {
+		return err
+	}
+	return b.answerCallbackWithKeyboard(ctx, callbackID, keyboard, text)
+}
+
+// handleScheduleEditInput takes the room, time or teacher typed in reply to
+// the prompt of the draft.
+func (b *Bot) handleScheduleEditInput(ctx context.Context, userID int64, text string) {
+	userRole, err := b.getUserRole(userID)
+	if err != nil || userRole != "admin" {
+		b.clearScheduleDraft(userID)
+		b.handleUnexpectedMessage(ctx, userID)
+		return
+	}
+
+	draft, ok := b.getScheduleDraft(userID)
+	if !ok {
+		b.sendMessage(ctx, userID, editExpiredMsg)
+		return
+	}
+
+	retry := func(msg string) {
+		b.setPendingInput(userID, inputScheduleEdit)
+		b.sendKeyboard(ctx, b.editCancelKeyboard(), userID, msg)
+	}
+
+	text = strings.TrimSpace(text)
+	lesson := draft.lesson
+	switch draft.field {
+	case editFieldRoom:
+		if text == "" || len([]rune(text)) > maxClassRoomLength {
+			retry(fmt.Sprintf(editInvalidRoomMsg, maxClassRoomLength))
+			return
+		}
+		lesson.ClassRoom = text
+	case editFieldTime:
+		weekday, start, end, ok := parseLessonSpan(text)
+		if !ok {
+			retry(fmt.Sprintf(editInvalidTimeMsg, text))
+			return
+		}
+		if !start.Before(end) {
+			retry(editTimeOrderMsg)
+			return
+		}
+		if weekday != 0 {
+			lesson.Weekday = weekday
+		}
+		lesson.StartTime, lesson.EndTime = start, end
+	case editFieldTeacher:
+		teachers, err := b.scheduleRepo.SearchTeachers(text, editTeacherLimit)
+		if err != nil {
+			b.logger.Errorf("Failed to search teachers for %q: %v", text, err)
+			b.sendKeyboardAfterError(ctx, userID)
+			return
+		}
+		switch len(teachers) {
+		case 0:
+			retry(fmt.Sprintf(editTeacherNotFound, text))
+			return
+		case 1:
+			lesson.TeacherID, lesson.TeacherName = teachers[0].UserID, teachers[0].Name
+		default:
+			keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+			for _, teacher := range teachers {
+				keyboard.AddRow().AddCallback(teacher.Name, schemes.DEFAULT, fmt.Sprintf(payloadEditSetTeacher, teacher.UserID))
+			}
+			keyboard.AddRow().AddCallback(btnEditCancel, schemes.DEFAULT, payloadEditCancel)
+			b.setPendingInput(userID, inputScheduleEdit)
+			b.sendKeyboard(ctx, keyboard, userID, editSelectTeacherMsg)
+			return
+		}
+	default:
+		b.sendMessage(ctx, userID, editExpiredMsg)
+		return
+	}
+
+	reply, keyboard, err := b.advanceScheduleDraft(userID, draft, lesson)
+	if err != nil {
+		b.logger.Errorf("Failed to edit schedule: %v", err)
+		b.sendKeyboardAfterError(ctx, userID)
+		return
+	}
+	b.sendKeyboard(ctx, keyboard, userID, reply)
+}
+
+// advanceScheduleDraft applies a changed lesson to the draft. A new lesson
+// moves to its next missing value or to the preview; an existing lesson is
+// saved unless it conflicts with the schedule, in which case the admin may
+// type another value. The draft of an existing lesson is taken before saving,
+// so a repeated press saves it once.
+func (b *Bot) advanceScheduleDraft(userID int64, draft scheduleDraft, lesson database.ScheduleLesson) (string, *maxbot.Keyboard, error) {
+	if lesson.ScheduleID == 0 {
+		draft.lesson = lesson
+		return b.nextNewLessonStep(userID, draft)
+	}
+
+	current, ok := b.takeScheduleDraft(userID)
+	if !ok || current.lesson.ScheduleID != lesson.ScheduleID {
+		return editExpiredMsg, b.editLessonKeyboard(&lesson), nil
+	}
+
+	before := current.lesson
+	change := services.ScheduleChange{Kind: services.ScheduleChangeMoved, Before: &before, After: &lesson}
+	conflicts, err := b.applyScheduleEdit(userID, change)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(conflicts) > 0 {
+		if current.field != "" {
+			b.setScheduleDraft(userID, &current)
+			return formatEditConflicts(conflicts) + editConflictRetry, b.editCancelKeyboard(), nil
+		}
+		return formatEditConflicts(conflicts), b.editLessonKeyboard(&before), nil
+	}
+	b.logger.Infof("Admin %d edited lesson %d", userID, lesson.ScheduleID)
+
+	return editSavedMsg + b.formatEditLesson(&lesson), b.editLessonKeyboard(&lesson), nil
+}
+
+// nextNewLessonStep stores the draft of a new lesson, asks for the first
+// value it still lacks and shows the preview once it is complete.
+func (b *Bot) nextNewLessonStep(userID int64, draft scheduleDraft) (string, *maxbot.Keyboard, error) {
+	lesson := draft.lesson
+	field, prompt := "", ""
+	switch {
+	case lesson.LessonTypeID == 0:
+		types, err := b.lessonTypeRepo.GetLessonTypes()
+		if err != nil {
+			return "", nil, err
+		}
+		keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+		for _, lessonType := range types {
+			keyboard.AddRow().AddCallback(lessonType.TypeName, schemes.DEFAULT, fmt.Sprintf(payloadEditSetType, lessonType.LessonTypeID))
+		}
+		keyboard.AddRow().AddCallback(btnEditCancel, schemes.DEFAULT, payloadEditCancel)
+
+		draft.field = ""
+		b.setScheduleDraft(userID, &draft)
+		return editSelectTypeMsg, keyboard, nil
+	case lesson.StartTime.IsZero():
+		field, prompt = editFieldTime, editTimePrompt
+	case lesson.ClassRoom == "":
+		field, prompt = editFieldRoom, editRoomPrompt
+	case lesson.TeacherID == 0:
+		field, prompt = editFieldTeacher, editTeacherPrompt
+	}
+
+	draft.field = field
+	b.setScheduleDraft(userID, &draft)
+
+	if field == "" {
+		keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+		keyboard.AddRow().AddCallback(btnEditSave, schemes.POSITIVE, payloadEditSave)
+		keyboard.AddRow().AddCallback(btnEditCancel, schemes.DEFAULT, payloadEditCancel)
+		return fmt.Sprintf(editPreviewMsg, b.formatEditLesson(&lesson)), keyboard, nil
+	}
+
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	if field == editFieldTeacher {
+		if subject, err := b.subjectRepo.GetSubject(lesson.SubjectID); err == nil {
+			keyboard.AddRow().AddCallback("👨‍🏫 "+b.getTeacherName(subject.TeacherID), schemes.DEFAULT,
+				fmt.Sprintf(payloadEditSetTeacher, subject.TeacherID))
+		}
+	}
+	keyboard.AddRow().AddCallback(btnEditCancel, schemes.DEFAULT, payloadEditCancel)
+	return prompt, keyboard, nil
+}
+
+// saveNewLesson adds the previewed lesson unless it conflicts with the
+// schedule. The draft is taken before saving, so a repeated press of the
+// button adds the lesson once.
+func (b *Bot) saveNewLesson(ctx context.Context, userID int64, callbackID string) error {
+	draft, ok := b.takeScheduleDraft(userID)
+	if !ok || draft.lesson.ScheduleID != 0 || draft.field != "" {
+		if ok {
+			b.setScheduleDraft(userID, &draft)
+		}
+		return b.answerCallbackWithNotification(ctx, callbackID, editExpiredMsg)
+	}
+	lesson := draft.lesson
+
+	change := services.ScheduleChange{Kind: services.ScheduleChangeAdded, After: &lesson}
+	conflicts, err := b.applyScheduleEdit(userID, change)
+	if err != nil {
+		b.setScheduleDraft(userID, &draft)
+		b.logger.Errorf("Failed to add lesson: %v", err)
+		return b.answerCallbackWithNotification(ctx, callbackID, editErrorMsg)
+	}
+	if len(conflicts) > 0 {
+		keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+		keyboard.AddRow().AddCallback(btnEditToDay, schemes.DEFAULT, fmt.Sprintf(payloadEditDay, lesson.GroupID, lesson.Weekday))
+		keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+		return b.answerCallbackWithKeyboard(ctx, callbackID, keyboard, formatEditConflicts(conflicts))
+	}
+	b.logger.Infof("Admin %d added a lesson of subject %d for group %d", userID, lesson.SubjectID, lesson.GroupID)
+
+	text, keyboard, err := b.buildEditDay(lesson.GroupID, lesson.Weekday)
+	if err != nil {
+		return err
+	}
+	return b.answerCallbackWithKeyboard(ctx, callbackID, keyboard, editAddedMsg+text)
+}
+
+// cancelScheduleEdit drops the draft and returns to the lesson or, for a new
+// lesson, to its day.
+func (b *Bot) cancelScheduleEdit(ctx context.Context, userID int64, callbackID string) error {
+	draft, ok := b.takeScheduleDraft(userID)
+	if !ok {
+		return b.answerEditGroups(ctx, callbackID)
+	}
+	if draft.lesson.ScheduleID != 0 {
+		return b.answerEditLesson(ctx, callbackID, draft.lesson.ScheduleID, "")
+	}
+
+	text, keyboard, err := b.buildEditDay(draft.lesson.GroupID, draft.lesson.Weekday)
+	if err != nil {
+		return err
+	}
+	return b.answerCallbackWithKeyboard(ctx, callbackID, keyboard, text)
+}
+
+// applyScheduleEdit saves one change of the schedule and queues the
+// notifications about it, as a schedule import does. An added or moved
+// lesson is checked against the schedule in the same transaction, with the
+// schedule locked, and is not saved if it conflicts.
+func (b *Bot) applyScheduleEdit(userID int64, change services.ScheduleChange) ([]services.ScheduleConflict, error) {
+	adminID, err := b.userRepo.GetUserIDByMaxID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := b.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if change.After != nil {
+		if err := b.scheduleRepo.LockSchedule(tx); err != nil {
+			return nil, err
+		}
+		schedule, err := b.scheduleRepo.GetCurrentLessons(tx)
+		if err != nil {
+			return nil, err
+		}
+		if conflicts := services.FindLessonConflicts(*change.After, schedule); len(conflicts) > 0 {
+			return conflicts, nil
+		}
+	}
+
+	switch change.Kind {
+	case services.ScheduleChangeAdded:
+		l := change.After
+		if err := b.subjectRepo.LinkGroupToSubject(tx, l.GroupID, l.SubjectID); err != nil {
+			return nil, err
+		}
+		err = b.scheduleRepo.CreateSchedule(tx, int(l.Weekday), l.StartTime.Format(timeFormat),
+			l.EndTime.Format(timeFormat), l.ClassRoom, l.SubjectID, l.TeacherID, l.GroupID, l.LessonTypeID)
+	case services.ScheduleChangeMoved:
+		l := change.After
+		if l.TeacherID != change.Before.TeacherID {
+			// Subjects belong to a teacher, so the lesson moves to the new
+			// teacher's subject of the same name.
+			subjectID, err := b.subjectRepo.CreateOrGetSubject(tx, l.SubjectName, l.TeacherID)
+			if err != nil {
+				return nil, err
+			}
+			if err := b.subjectRepo.LinkGroupToSubject(tx, l.GroupID, subjectID); err != nil {
+				return nil, err
+			}
+			if err := b.scheduleRepo.SetLessonSubject(tx, l.ScheduleID, subjectID); err != nil {
+				return nil, err
+			}
+			l.SubjectID = subjectID
+		}
+		err = b.scheduleRepo.UpdateLesson(tx, l.ScheduleID, l.Weekday, l.StartTime.Format(timeFormat),
+			l.EndTime.Format(timeFormat), l.ClassRoom, l.TeacherID)
+		if err == nil && l.LessonTypeID != change.Before.LessonTypeID {
+			err = b.scheduleRepo.SetLessonType(tx, l.ScheduleID, l.LessonTypeID)
+		}
+	case services.ScheduleChangeRemoved:
+		err = b.scheduleRepo.RemoveLesson(tx, change.Before.ScheduleID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := b.enqueueScheduleChanges(tx, adminID, []services.ScheduleChange{change}); err != nil {
+		return nil, err
+	}
+	return nil, tx.Commit()
+}
+
+func formatEditConflicts(conflicts []services.ScheduleConflict) string {
+	var sb strings.Builder
+	sb.WriteString(editConflictHeader)
+	for _, c := range conflicts {
+		other := c.Second
+		fmt.Fprintf(&sb, editConflictRow, c.Reason(), other.SubjectName, other.TypeName, other.GroupName,
+			other.StartTime.Format(timeFormat), other.EndTime.Format(timeFormat))
+	}
+	return sb.String()
+}
+
+func (b *Bot) editCancelKeyboard() *maxbot.Keyboard {
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	keyboard.AddRow().AddCallback(btnEditCancel, schemes.DEFAULT, payloadEditCancel)
+	return keyboard
+}
+
+// parseLessonSpan reads "09:00-10:30" with an optional weekday in front,
+// short or full: "Ср 09:00-10:30". The weekday is zero when not given.
+func parseLessonSpan(text string) (int16, time.Time, time.Time, bool) {
+	var weekday int16
+	fields := strings.Fields(text)
+	if len(fields) > 1 {
+		if weekday = parseWeekdayName(fields[0]); weekday != 0 {
+			fields = fields[1:]
+		}
+	}
+
+	span := strings.NewReplacer("–", "-", "—", "-").Replace(strings.Join(fields, ""))
+	bounds := strings.Split(span, "-")
+	if len(bounds) != 2 {
+		return 0, time.Time{}, time.Time{}, false
+	}
+
+	start, err := time.Parse(timeFormat, bounds[0])
+	if err != nil {
+		return 0, time.Time{}, time.Time{}, false
+	}
+	end, err := time.Parse(timeFormat, bounds[1])
+	if err != nil {
+		return 0, time.Time{}, time.Time{}, false
+	}
+	return weekday, start, end, true
+}
+
+func parseWeekdayName(word string) int16 {
+	word = strings.TrimSuffix(strings.ToLower(word), ",")
+	for day := int16(1); day <= 7; day++ {
+		if word == strings.ToLower(shortWeekdayNames[day]) || word == strings.ToLower(weekdayNames[day]) {
+			return day
+		}
+	}
+	return 0
+}
+
+// getScheduleDraft returns a copy of the draft taken under b.mu.
+func (b *Bot) getScheduleDraft(userID int64) (scheduleDraft, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	draft, ok := b.scheduleDrafts[userID]
+	if !ok {
+		return scheduleDraft{}, false
+	}
+	return *draft, true
+}
+
+// takeScheduleDraft removes the draft and returns it in one step under b.mu.
+func (b *Bot) takeScheduleDraft(userID int64) (scheduleDraft, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	draft, ok := b.scheduleDrafts[userID]
+	if !ok {
+		return scheduleDraft{}, false
+	}
+	delete(b.scheduleDrafts, userID)
+	if b.pendingInputs[userID] == inputScheduleEdit {
+		delete(b.pendingInputs, userID)
+	}
+	return *draft, true
+}
+
+func (b *Bot) setScheduleDraft(userID int64, draft *scheduleDraft) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.scheduleDrafts[userID] = draft
+	if draft.field != "" {
+		b.pendingInputs[userID] = inputScheduleEdit
+	}
+}
+
+func (b *Bot) clearScheduleDraft(userID int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.scheduleDrafts, userID)
+	if b.pendingInputs[userID] == inputScheduleEdit {
+		delete(b.pendingInputs, userID)
+	}
+}
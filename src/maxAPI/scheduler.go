@@ -0,0 +1,158 @@
+package maxAPI
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"digitalUniversity/config"
+	"digitalUniversity/database"
+)
+
+const (
+	digestHeader     = "☀️ Доброе утро! Ваше расписание на сегодня:\n\n"
+	reminderTemplate = "⏰ Через %d мин. начинается занятие\n\n**%s** (%s)\n🏫 %s\n👨‍🏫 %s\n👥 %s\n🕐 %s–%s"
+
+	schedulerClockFormat = "15:04:05"
+	schedulerEndOfDay    = "24:00:00"
+	fallbackTimezone     = "MSK"
+	fallbackUTCOffset    = 3 * 60 * 60
+)
+
+// StartScheduler runs the background loop that sends the morning schedule
+// digest, reminders before lessons and daily notification summaries
+// according to each user's settings. It must be called before Start and
+// StartOutbox, as they use the configured timezone for quiet hours.
+func (b *Bot) StartScheduler(ctx context.Context, cfg *config.SchedulerConfig) {
+	loc, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		b.logger.Warnf("Failed to load timezone %q, using UTC+3: %v", cfg.Timezone, err)
+		loc = time.FixedZone(fallbackTimezone, fallbackUTCOffset)
+	}
+	b.location = loc
+
+	go b.runScheduler(ctx, loc, cfg.Interval)
+}
+
+func (b *Bot) runScheduler(ctx context.Context, loc *time.Location, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := time.Now().In(loc)
+	b.logger.Infof("Scheduler started: timezone=%s, interval=%s", loc, interval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			b.logger.Infof("Scheduler stopped")
+			return
+		case tick := <-ticker.C:
+			now := tick.In(loc)
+			b.runSchedulerTick(ctx, last, now)
+			last = now
+		}
+	}
+}
+
+// runSchedulerTick handles everything due in [from, to). A window that
+// crosses midnight is split into the end of the previous day and the start
+// of the new one, so nothing due just before midnight is skipped. Windows
+// longer than that, e.g. after downtime, are clipped to the previous day.
+func (b *Bot) runSchedulerTick(ctx context.Context, from, to time.Time) {
+	startOfDay := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, to.Location())
+	previousDay := startOfDay.AddDate(0, 0, -1)
+	if from.Before(previousDay) {
+		from = previousDay
+	}
+
+	if from.Before(startOfDay) {
+		b.runSchedulerDay(ctx, previousDay, from.Format(schedulerClockFormat), schedulerEndOfDay)
+		b.runSchedulerDay(ctx, startOfDay, startOfDay.Format(schedulerClockFormat), to.Format(schedulerClockFormat))
+	} else {
+		b.runSchedulerDay(ctx, startOfDay, from.Format(schedulerClockFormat), to.Format(schedulerClockFormat))
+	}
+
+	b.sendLessonReminders(ctx, from, to)
+}
+
+// runSchedulerDay handles the daily jobs whose time of day falls into
+// [from, to) of the given day.
+func (b *Bot) runSchedulerDay(ctx context.Context, day time.Time, from, to string) {
+	b.deliverDailySummaries(ctx, from, to)
+	b.runNightlyAlerts(from, to)
+
+	holiday, err := b.holidayRepo.IsHoliday(day)
+	if err != nil {
+		b.logger.Errorf("Failed to check holiday for %s: %v", day.Format("2006-01-02"), err)
+		return
+	}
+	if holiday {
+		return
+	}
+
+	b.sendDigests(ctx, day, from, to)
+}
+
+// sendDigests sends today's schedule to users whose digest time has come.
+// Users without lessons today, e.g. on weekends, are not selected.
+func (b *Bot) sendDigests(ctx context.Context, day time.Time, from, to string) {
+	weekday := isoWeekday(day)
+	recipients, err := b.settingsRepo.GetDigestRecipients(weekday, from, to)
+	if err != nil {
+		b.logger.Errorf("Failed to get digest recipients: %v", err)
+		return
+	}
+
+	for _, maxUserID := range recipients {
+		entries, err := b.getScheduleEntriesForUser(maxUserID, weekday)
+		if err != nil {
+			b.logger.Errorf("Failed to get schedule for digest to user %d: %v", maxUserID, err)
+			continue
+		}
+		if len(entries) == 0 {
+			continue
+		}
+
+		text := digestHeader + b.formatSchedule(entries, day)
+		b.sendKeyboard(ctx, GetScheduleKeyboard(b.MaxAPI, day, day), maxUserID, text)
+	}
+
+	if len(recipients) > 0 {
+		b.logger.Infof("Sent schedule digest to %d users", len(recipients))
+	}
+}
+
+// sendLessonReminders sends the reminders due in [from, to). A reminder may
+// fall on the day before its lesson, e.g. for a lesson right after midnight.
+func (b *Bot) sendLessonReminders(ctx context.Context, from, to time.Time) {
+	reminders, err := b.settingsRepo.GetLessonReminders(from, to)
+	if err != nil {
+		b.logger.Errorf("Failed to get lesson reminders: %v", err)
+		return
+	}
+
+	for _, reminder := range reminders {
+		date := reminder.LessonDate
+		day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, from.Location())
+		text := b.formatLessonReminder(reminder)
+		b.sendKeyboard(ctx, GetScheduleKeyboard(b.MaxAPI, day, day), reminder.UserMaxID, text)
+	}
+
+	if len(reminders) > 0 {
+		b.logger.Infof("Sent %d lesson reminders", len(reminders))
+	}
+}
+
+func (b *Bot) formatLessonReminder(reminder database.LessonReminder) string {
+	entry := reminder.Schedule
+	return fmt.Sprintf(reminderTemplate,
+		reminder.ReminderMinutes,
+		b.getSubjectName(entry.SubjectID),
+		b.getLessonTypeName(entry.LessonTypeID),
+		entry.ClassRoom,
+		b.getTeacherName(entry.TeacherID),
+		b.getGroupName(entry.GroupID),
+		entry.StartTime.Format(timeFormat),
+		entry.EndTime.Format(timeFormat),
+	)
+}
@@ -0,0 +1,253 @@
+package maxAPI
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	maxbot "github.com/max-messenger/max-bot-api-client-go"
+	"github.com/max-messenger/max-bot-api-client-go/schemes"
+
+	"digitalUniversity/database"
+)
+
+const (
+	settingsHeader       = "⚙️ **Настройки уведомлений**\n\n"
+	settingsDigestFormat = "📅 Утренняя сводка расписания: %s, в %s\n"
+	settingsRemindFormat = "⏰ Напоминание перед парой: %s, за %d мин.\n\n"
+	settingsCategories   = "🔔 Уведомления: оценки %s, посещаемость %s, изменения расписания %s, объявления %s\n"
+	settingsQuietFormat  = "🌙 Тихие часы: %s\n"
+	settingsModeInstant  = "📨 Доставка: сразу"
+	settingsModeDaily    = "📨 Доставка: одной сводкой в %s"
+	settingsQuietOff     = "нет"
+	settingsOn           = "включена"
+	settingsOff          = "выключена"
+	settingsRemindOn     = "включено"
+	settingsRemindOff    = "выключено"
+	settingsSavedMsg     = "Настройки сохранены"
+
+	btnDigestToggle   = "Сводка: %s"
+	btnDigestTime     = "Время сводки: %s"
+	btnReminderToggle = "Напоминания: %s"
+	btnReminderLead   = "Напоминать за %d мин."
+	btnOn             = "вкл"
+	btnOff            = "выкл"
+	btnCategoryFormat = "%s %s"
+	btnQuietHours     = "Тихие часы: %s"
+	btnModeInstant    = "Доставка: сразу"
+	btnModeDaily      = "Доставка: сводкой"
+	btnSummaryTime    = "Время сводки уведомлений: %s"
+
+	payloadSettingsDigest     = "settings_digest"
+	payloadSettingsDigestTime = "settings_digest_time"
+	payloadSettingsRemind     = "settings_remind"
+	payloadSettingsRemindLead = "settings_remind_lead"
+	payloadSettingsCategory   = "settings_cat_%s"
+	payloadSettingsQuiet      = "settings_quiet"
+	payloadSettingsMode       = "settings_mode"
+	payloadSettingsSummary    = "settings_summary_time"
+
+	quietHoursSeparator = "–"
+)
+
+// digestTimeOptions and reminderLeadOptions are cycled through by the
+// corresponding settings buttons.
+var (
+	digestTimeOptions   = []string{"06:30", "07:00", "07:30", "08:00", "08:30", "09:00"}
+	reminderLeadOptions = []int{5, 10, 15, 30, 60}
+	quietHoursOptions   = []string{settingsQuietOff, "22:00–08:00", "23:00–07:00", "21:00–09:00", "00:00–08:00"}
+	summaryTimeOptions  = []string{"18:00", "19:00", "20:00", "21:00", "22:00"}
+)
+
+// notificationCategories lists the categories in the order they appear in
+// the settings keyboard.
+var notificationCategories = []struct {
+	code  string
+	title string
+}{
+	{categoryGrades, "Оценки"},
+	{categoryAttendance, "Посещаемость"},
+	{categorySchedule, "Расписание"},
+	{categoryAnnouncements, "Объявления"},
+}
+
+func (b *Bot) handleShowSettingsStart(ctx context.Context, userID int64, callbackID string) error {
+	settings, err := b.getUserSettings(userID)
+	if err != nil {
+		return err
+	}
+
+	return b.answerWithKeyboardMarkdown(ctx, callbackID, formatSettings(settings), b.settingsKeyboard(settings))
+}
+
+func (b *Bot) handleSettingsCallback(ctx context.Context, userID int64, callbackID, payload string) error {
+	settings, err := b.getUserSettings(userID)
+	if err != nil {
+		return err
+	}
+
+	switch payload {
+	case payloadSettingsDigest:
+		settings.DigestEnabled = !settings.DigestEnabled
+	case payloadSettingsDigestTime:
+		next := nextOption(digestTimeOptions, settings.DigestTime.Format(timeFormat))
+		settings.DigestTime, _ = time.Parse(timeFormat, next)
+	case payloadSettingsRemind:
+		settings.RemindersEnabled = !settings.RemindersEnabled
+	case payloadSettingsRemindLead:
+		settings.ReminderMinutes = nextOption(reminderLeadOptions, settings.ReminderMinutes)
+	case payloadSettingsQuiet:
+		settings.QuietFrom, settings.QuietTo = parseQuietHours(nextOption(quietHoursOptions, formatQuietHours(settings)))
+	case payloadSettingsMode:
+		if settings.DeliveryMode == deliveryDaily {
+			settings.DeliveryMode = deliveryInstant
+		} else {
+			settings.DeliveryMode = deliveryDaily
+		}
+	case payloadSettingsSummary:
+		next := nextOption(summaryTimeOptions, settings.SummaryTime.Format(timeFormat))
+		settings.SummaryTime, _ = time.Parse(timeFormat, next)
+	default:
+		if !strings.HasPrefix(payload, "settings_cat_") || !toggleCategory(settings, strings.TrimPrefix(payload, "settings_cat_")) {
+			return fmt.Errorf("unknown settings callback: %s", payload)
+		}
+	}
+
+	if err := b.settingsRepo.SaveUserSettings(*settings); err != nil {
+		b.logger.Errorf("Failed to save settings for user %d: %v", settings.UserID, err)
+		return err
+	}
+
+	b.logger.Infof("User %d updated notification settings: %s", userID, payload)
+	return b.answerWithKeyboardAndNotification(ctx, callbackID, formatSettings(settings), b.settingsKeyboard(settings), settingsSavedMsg)
+}
+
+func (b *Bot) getUserSettings(maxUserID int64) (*database.UserSettings, error) {
+	userID, err := b.userRepo.GetUserIDByMaxID(maxUserID)
+	if err != nil {
+		b.logger.Errorf("Failed to get user ID: %v", err)
+		return nil, err
+	}
+
+	settings, err := b.settingsRepo.GetUserSettings(userID)
+	if err != nil {
+		b.logger.Errorf("Failed to get settings for user %d: %v", userID, err)
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+func (b *Bot) settingsKeyboard(settings *database.UserSettings) *maxbot.Keyboard {
+	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
+	keyboard.AddRow().
+		AddCallback(fmt.Sprintf(btnDigestToggle, onOff(settings.DigestEnabled)), schemes.DEFAULT, payloadSettingsDigest).
+		AddCallback(fmt.Sprintf(btnDigestTime, settings.DigestTime.Format(timeFormat)), schemes.DEFAULT, payloadSettingsDigestTime)
+	keyboard.AddRow().
+		AddCallback(fmt.Sprintf(btnReminderToggle, onOff(settings.RemindersEnabled)), schemes.DEFAULT, payloadSettingsRemind).
+		AddCallback(fmt.Sprintf(btnReminderLead, settings.ReminderMinutes), schemes.DEFAULT, payloadSettingsRemindLead)
+
+	var row *maxbot.KeyboardRow
+	for i, category := range notificationCategories {
+		if i%2 == 0 {
+			row = keyboard.AddRow()
+		}
+		text := fmt.Sprintf(btnCategoryFormat, category.title, onOff(categoryEnabled(settings, category.code)))
+		row.AddCallback(text, schemes.DEFAULT, fmt.Sprintf(payloadSettingsCategory, category.code))
+	}
+
+	keyboard.AddRow().AddCallback(fmt.Sprintf(btnQuietHours, formatQuietHours(settings)), schemes.DEFAULT, payloadSettingsQuiet)
+
+	if settings.DeliveryMode == deliveryDaily {
+		keyboard.AddRow().
+			AddCallback(btnModeDaily, schemes.DEFAULT, payloadSettingsMode).
+			AddCallback(fmt.Sprintf(btnSummaryTime, settings.SummaryTime.Format(timeFormat)), schemes.DEFAULT, payloadSettingsSummary)
+	} else {
+		keyboard.AddRow().AddCallback(btnModeInstant, schemes.DEFAULT, payloadSettingsMode)
+	}
+
+	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
+	return keyboard
+}
+
+func formatSettings(settings *database.UserSettings) string {
+	digest, remind := settingsOff, settingsRemindOff
+	if settings.DigestEnabled {
+		digest = settingsOn
+	}
+	if settings.RemindersEnabled {
+		remind = settingsRemindOn
+	}
+
+	mode := settingsModeInstant
+	if settings.DeliveryMode == deliveryDaily {
+		mode = fmt.Sprintf(settingsModeDaily, settings.SummaryTime.Format(timeFormat))
+	}
+
+	return settingsHeader +
+		fmt.Sprintf(settingsDigestFormat, digest, settings.DigestTime.Format(timeFormat)) +
+		fmt.Sprintf(settingsRemindFormat, remind, settings.ReminderMinutes) +
+		fmt.Sprintf(settingsCategories,
+			onOff(settings.NotifyGrades), onOff(settings.NotifyAttendance),
+			onOff(settings.NotifySchedule), onOff(settings.NotifyAnnouncements)) +
+		fmt.Sprintf(settingsQuietFormat, formatQuietHours(settings)) +
+		mode
+}
+
+func toggleCategory(settings *database.UserSettings, category string) bool {
+	switch category {
+	case categoryGrades:
+		settings.NotifyGrades = !settings.NotifyGrades
+	case categoryAttendance:
+		settings.NotifyAttendance = !settings.NotifyAttendance
+	case categorySchedule:
+		settings.NotifySchedule = !settings.NotifySchedule
+	case categoryAnnouncements:
+		settings.NotifyAnnouncements = !settings.NotifyAnnouncements
+	default:
+		return false
+	}
+	return true
+}
+
+func formatQuietHours(settings *database.UserSettings) string {
+	if settings.QuietFrom == nil || settings.QuietTo == nil {
+		return settingsQuietOff
+	}
+	return settings.QuietFrom.Format(timeFormat) + quietHoursSeparator + settings.QuietTo.Format(timeFormat)
+}
+
+// parseQuietHours turns an option like "22:00–08:00" into its bounds; the
+// "off" option yields nil bounds.
+func parseQuietHours(option string) (*time.Time, *time.Time) {
+	from, to, ok := strings.Cut(option, quietHoursSeparator)
+	if !ok {
+		return nil, nil
+	}
+
+	fromTime, errFrom := time.Parse(timeFormat, from)
+	toTime, errTo := time.Parse(timeFormat, to)
+	if errFrom != nil || errTo != nil {
+		return nil, nil
+	}
+	return &fromTime, &toTime
+}
+
+func onOff(enabled bool) string {
+	if enabled {
+		return btnOn
+	}
+	return btnOff
+}
+
+// nextOption returns the option after current, wrapping around; an unknown
+// current value starts the cycle from the first option.
+func nextOption[T comparable](options []T, current T) T {
+	for i, option := range options {
+		if option == current {
+			return options[(i+1)%len(options)]
+		}
+	}
+	return options[0]
+}
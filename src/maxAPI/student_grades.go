@@ -6,9 +6,11 @@ import (
 	"strings"
 	"time"
 
+	maxbot "github.com/max-messenger/max-bot-api-client-go"
 	"github.com/max-messenger/max-bot-api-client-go/schemes"
 
 	"digitalUniversity/database"
+	"digitalUniversity/grading"
 )
 
 const (
@@ -17,44 +19,56 @@ const (
 	noSubjectsMsgStudent      = "У вашей группы пока нет предметов."
 	gradesListHeader          = "📊 Оценки по предмету **%s**:\n\n"
 	payloadPrefixShowGrades   = "show_grades_"
-	gradeEntryFormat          = "`%s %s` — **%d**\n"
+	gradeEntryFormat          = "`%s %s` — **%s** (%s)\n"
 	statsFooter               = "\n📈 **Статистика:**\n" +
+		"• Шкала: %s\n" +
 		"• Всего оценок: **%d**\n" +
-		"• Средний балл: **%.2f**"
+		"• Средний балл с учётом весов: **%s**"
 )
 
 func (b *Bot) handleShowGradesStart(ctx context.Context, userID int64, callbackID string) error {
-	studentID, err := b.userRepo.GetUserIDByMaxID(userID)
+	_, subjects, err := b.getStudentSubjects(userID)
 	if err != nil {
-		b.logger.Errorf("Failed to get student ID: %v", err)
 		return err
 	}
 
+	if len(subjects) == 0 {
+		return b.answerCallbackWithNotification(ctx, callbackID, noSubjectsMsgStudent)
+	}
+
+	keyboard := b.studentSubjectsKeyboard(subjects, "show_grades_subj_%d")
+	return b.answerWithKeyboard(ctx, callbackID, selectSubjectForGradesMsg, keyboard)
+}
+
+func (b *Bot) getStudentSubjects(maxUserID int64) (int64, []database.Subject, error) {
+	studentID, err := b.userRepo.GetUserIDByMaxID(maxUserID)
+	if err != nil {
+		b.logger.Errorf("Failed to get student ID: %v", err)
+		return 0, nil, err
+	}
+
 	groupID, err := b.userRepo.GetStudentGroupID(studentID)
 	if err != nil {
 		b.logger.Errorf("Failed to get student group ID: %v", err)
-		return err
+		return 0, nil, err
 	}
 
 	subjects, err := b.gradeRepo.GetSubjectsByStudentGroup(groupID)
 	if err != nil {
 		b.logger.Errorf("Failed to get subjects for group %d: %v", groupID, err)
-		return err
+		return 0, nil, err
 	}
 
-	if len(subjects) == 0 {
-		return b.answerCallbackWithNotification(ctx, callbackID, noSubjectsMsgStudent)
-	}
+	return studentID, subjects, nil
+}
 
+func (b *Bot) studentSubjectsKeyboard(subjects []database.Subject, payloadFormat string) *maxbot.Keyboard {
 	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
 	for _, subject := range subjects {
-		buttonText := fmt.Sprintf("%s\n", subject.SubjectName)
-		payload := fmt.Sprintf("show_grades_subj_%d", subject.SubjectID)
-		keyboard.AddRow().AddCallback(buttonText, schemes.DEFAULT, payload)
+		keyboard.AddRow().AddCallback(subject.SubjectName, schemes.DEFAULT, fmt.Sprintf(payloadFormat, subject.SubjectID))
 	}
 	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
-
-	return b.answerWithKeyboard(ctx, callbackID, selectSubjectForGradesMsg, keyboard)
+	return keyboard
 }
 
 func (b *Bot) handleShowGradesCallback(ctx context.Context, userID int64, callbackID, payload string) error {
@@ -84,6 +98,18 @@ func (b *Bot) handleSubjectSelectedForGrades(ctx context.Context, userID int64,
 		return err
 	}
 
+	text, err := b.buildStudentGradesText(studentID, subjectID)
+	if err != nil {
+		return err
+	}
+
+	keyboard := GetStudentKeyboard(b.MaxAPI)
+	return b.answerWithPhotoMarkdown(ctx, callbackID, text, b.gradeTimelineChart(ctx, studentID, subjectID), keyboard)
+}
+
+// buildStudentGradesText renders the grade list of a student for one subject
+// followed by the subject rating.
+func (b *Bot) buildStudentGradesText(studentID, subjectID int64) (string, error) {
 	subjectName, err := b.subjectRepo.GetSubjectName(subjectID)
 	if err != nil {
 		b.logger.Errorf("Failed to get subject name: %v", err)
@@ -93,18 +119,29 @@ func (b *Bot) handleSubjectSelectedForGrades(ctx context.Context, userID int64,
 	grades, err := b.gradeRepo.GetGradesByStudentAndSubject(studentID, subjectID)
 	if err != nil {
 		b.logger.Errorf("Failed to get grades: %v", err)
-		return err
+		return "", err
+	}
+
+	attendance, err := b.attendanceRepo.GetAttendanceByStudentAndSubject(studentID, subjectID)
+	if err != nil {
+		b.logger.Errorf("Failed to get attendance: %v", err)
+		return "", err
 	}
 
+	scale := b.getSubjectScale(subjectID)
+	assessmentTypes := b.getAssessmentTypes(subjectID)
+
 	var text string
 	if len(grades) == 0 {
 		text = fmt.Sprintf(noGradesMsg, subjectName)
 	} else {
-		text = b.formatGradesList(grades, subjectName)
+		text = b.formatGradesList(grades, subjectName, scale, assessmentTypes)
 	}
 
-	keyboard := GetStudentKeyboard(b.MaxAPI)
-	return b.answerWithKeyboardMarkdown(ctx, callbackID, text, keyboard)
+	rating := grading.CalculateRating(scale, b.getRatingRules(subjectID), buildRatingInput(grades, attendance, assessmentTypes))
+	text += "\n\n" + formatRating(rating, scale)
+
+	return text, nil
 }
 
 func (b *Bot) formatGradeDateTime(gradeDate time.Time) (dateStr, timeStr string) {
@@ -114,24 +151,58 @@ func (b *Bot) formatGradeDateTime(gradeDate time.Time) (dateStr, timeStr string)
 	return
 }
 
-func (b *Bot) formatGradesList(grades []database.Grade, subjectName string) string {
+func (b *Bot) formatGradesList(grades []database.Grade, subjectName string, scale grading.Scale, assessmentTypes []database.AssessmentType) string {
 	if len(grades) == 0 {
 		return fmt.Sprintf(noGradesMsg, subjectName)
 	}
 
+	titles := make(map[int64]string, len(assessmentTypes))
+	for _, assessmentType := range assessmentTypes {
+		titles[assessmentType.AssessmentTypeID] = assessmentType.Title
+	}
+
 	var sb strings.Builder
 	fmt.Fprintf(&sb, gradesListHeader, subjectName)
 
-	var sum int
-
 	for _, grade := range grades {
 		dateStr, timeStr := b.formatGradeDateTime(grade.GradeDate)
-		fmt.Fprintf(&sb, gradeEntryFormat, dateStr, timeStr, grade.GradeValue)
-		sum += grade.GradeValue
+
+		title := UnknownAssessment
+		if grade.AssessmentTypeID != nil {
+			if t, ok := titles[*grade.AssessmentTypeID]; ok {
+				title = t
+			}
+		}
+
+		fmt.Fprintf(&sb, gradeEntryFormat, dateStr, timeStr, scale.Label(grade.GradeValue), title)
 	}
 
-	average := float64(sum) / float64(len(grades))
-	fmt.Fprintf(&sb, statsFooter, len(grades), average)
+	average := "—"
+	if avg, ok := grading.WeightedAverage(weightedGradeValues(grades, assessmentTypes)); ok {
+		average = scale.FormatAverage(avg)
+	}
+	fmt.Fprintf(&sb, statsFooter, scale.Title, len(grades), average)
 
 	return sb.String()
 }
+
+// weightedGradeValues pairs every grade with the weight of its assessment type.
+// Grades without a known type count with weight 1.
+func weightedGradeValues(grades []database.Grade, assessmentTypes []database.AssessmentType) []grading.WeightedValue {
+	weights := make(map[int64]float64, len(assessmentTypes))
+	for _, assessmentType := range assessmentTypes {
+		weights[assessmentType.AssessmentTypeID] = assessmentType.Weight
+	}
+
+	values := make([]grading.WeightedValue, 0, len(grades))
+	for _, grade := range grades {
+		weight := 1.0
+		if grade.AssessmentTypeID != nil {
+			if w, ok := weights[*grade.AssessmentTypeID]; ok {
+				weight = w
+			}
+		}
+		values = append(values, grading.WeightedValue{Value: grade.GradeValue, Weight: weight})
+	}
+	return values
+}
@@ -5,7 +5,7 @@ import (
 	"fmt"
 	"strings"
 
-	maxbot "github.com/max-messenger/max-bot-api-client-go"
+	"github.com/jmoiron/sqlx"
 	"github.com/max-messenger/max-bot-api-client-go/schemes"
 
 	"digitalUniversity/database"
@@ -16,18 +16,21 @@ const (
 	selectGroupMsg    = "Выберите группу:"
 	selectScheduleMsg = "Выберите занятие:"
 	selectStudentMsg  = "Выберите студента (страница %d/%d):"
-	selectGradeMsg    = "Выберите оценку для студента **%s**:"
-	gradeSuccessMsg   = "✅ Оценка **%d** успешно выставлена студенту **%s** по предмету **%s**!"
+	selectAssessMsg   = "Выберите тип работы для студента **%s**:"
+	selectGradeMsg    = "Выберите оценку для студента **%s** (%s, шкала: %s):"
+	gradeSuccessMsg   = "✅ Оценка **%s** (%s) успешно выставлена студенту **%s** по предмету **%s**!"
 
 	noGroupsMsg       = "У данного предмета нет групп."
 	noStudentsMsg     = "В группе нет студентов."
 	noSubjectsMsg     = "У вас нет предметов для выставления оценок."
 	noScheduleMsg     = "Нет расписания для данной группы."
 	gradeSaveErrorMsg = "Ошибка при сохранении оценки."
+	invalidGradeMsg   = "Недопустимое значение для шкалы предмета."
 
-	notificationTextTemplate = "📚 **Новая оценка!**\n\nПредмет: **%s**\nОценка: **%d**"
+	notificationTextTemplate = "📚 **Новая оценка!**\n\nПредмет: **%s**\nТип работы: %s\nОценка: **%s**"
 
-	studentsPerPage = 5
+	studentsPerPage    = 5
+	gradeButtonsPerRow = 7
 )
 
 func (b *Bot) handleMarkGradeStart(ctx context.Context, userID int64, callbackID string) error {
@@ -79,6 +82,8 @@ func (b *Bot) handleGradeCallback(ctx context.Context, userID int64, callbackID,
 		return b.handleStudentSelected(ctx, userID, callbackID, payload)
 	case "sch":
 		return b.handleScheduleSelected(ctx, userID, callbackID, payload)
+	case "asm":
+		return b.handleAssessmentSelected(ctx, userID, callbackID, payload)
 	case "val":
 		return b.handleGradeValueSelected(ctx, userID, callbackID, payload)
 	default:
@@ -205,21 +210,53 @@ func (b *Bot) handleScheduleSelected(ctx context.Context, _ int64, callbackID, p
 		studentName = "студенту"
 	}
 
+	subjectID, err := b.gradeRepo.GetSubjectIDByScheduleID(scheduleID)
+	if err != nil {
+		b.logger.Errorf("Failed to get subject_id: %v", err)
+		return err
+	}
+
 	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
-	row := keyboard.AddRow()
-	for grade := 0; grade <= 5; grade++ {
-		payload := fmt.Sprintf("grade_val_%d_%d_%d", scheduleID, studentID, grade)
-		row.AddCallback(fmt.Sprintf("%d", grade), schemes.DEFAULT, payload)
+	for _, assessmentType := range b.getAssessmentTypes(subjectID) {
+		payload := fmt.Sprintf("grade_asm_%d_%d_%d", scheduleID, studentID, assessmentType.AssessmentTypeID)
+		keyboard.AddRow().AddCallback(assessmentType.Title, schemes.DEFAULT, payload)
 	}
 	keyboard.AddRow().AddCallback(btnBackToMenu, schemes.DEFAULT, payloadBackToMenu)
 
-	return b.answerWithKeyboard(ctx, callbackID, fmt.Sprintf(selectGradeMsg, studentName), keyboard)
+	return b.answerWithKeyboard(ctx, callbackID, fmt.Sprintf(selectAssessMsg, studentName), keyboard)
+}
+
+func (b *Bot) handleAssessmentSelected(ctx context.Context, _ int64, callbackID, payload string) error {
+	var scheduleID, studentID, assessmentTypeID int64
+	fmt.Sscanf(payload, "grade_asm_%d_%d_%d", &scheduleID, &studentID, &assessmentTypeID)
+
+	studentName, err := b.gradeRepo.GetStudentNameByID(studentID)
+	if err != nil {
+		b.logger.Errorf("Failed to get student name: %v", err)
+		studentName = "студенту"
+	}
+
+	subjectID, err := b.gradeRepo.GetSubjectIDByScheduleID(scheduleID)
+	if err != nil {
+		b.logger.Errorf("Failed to get subject_id: %v", err)
+		return err
+	}
+
+	scale := b.getSubjectScale(subjectID)
+	assessmentTitle := b.getAssessmentTitle(subjectID, assessmentTypeID)
+
+	keyboard := GetGradeValuesKeyboard(b.MaxAPI, scale, func(value int) string {
+		return fmt.Sprintf("grade_val_%d_%d_%d_%d", scheduleID, studentID, assessmentTypeID, value)
+	})
+
+	text := fmt.Sprintf(selectGradeMsg, studentName, assessmentTitle, scale.Title)
+	return b.answerWithKeyboard(ctx, callbackID, text, keyboard)
 }
 
 func (b *Bot) handleGradeValueSelected(ctx context.Context, userID int64, callbackID, payload string) error {
-	var scheduleID, studentID int64
+	var scheduleID, studentID, assessmentTypeID int64
 	var gradeValue int
-	fmt.Sscanf(payload, "grade_val_%d_%d_%d", &scheduleID, &studentID, &gradeValue)
+	fmt.Sscanf(payload, "grade_val_%d_%d_%d_%d", &scheduleID, &studentID, &assessmentTypeID, &gradeValue)
 
 	teacherID, err := b.userRepo.GetUserIDByMaxID(userID)
 	if err != nil {
@@ -232,11 +269,34 @@ func (b *Bot) handleGradeValueSelected(ctx context.Context, userID int64, callba
 		return err
 	}
 
-	err = b.gradeRepo.CreateGrade(studentID, teacherID, subjectID, scheduleID, gradeValue)
+	scale := b.getSubjectScale(subjectID)
+	if !scale.Contains(gradeValue) {
+		b.logger.Warnf("Grade %d is out of scale %s for subject %d", gradeValue, scale.Name, subjectID)
+		return b.answerCallbackWithNotification(ctx, callbackID, invalidGradeMsg)
+	}
+
+	subjectName, err := b.subjectRepo.GetSubjectName(subjectID)
+	if err != nil {
+		b.logger.Warnf("Failed to get subject name: %v", err)
+		subjectName = "предмету"
+	}
+
+	valueLabel := scale.Label(gradeValue)
+	assessmentTitle := b.getAssessmentTitle(subjectID, assessmentTypeID)
+	notification := gradeNotification(studentID, subjectID, subjectName, assessmentTitle, valueLabel)
+
+	err = b.inTx(func(tx *sqlx.Tx) error {
+		if err := b.gradeRepo.CreateGrade(tx, studentID, teacherID, subjectID, scheduleID, assessmentTypeID, gradeValue); err != nil {
+			return err
+		}
+		_, err := b.enqueueStudentNotification(tx, notification)
+		return err
+	})
 	if err != nil {
 		b.logger.Errorf("Failed to create grade: %v", err)
 		return b.answerCallbackWithNotification(ctx, callbackID, gradeSaveErrorMsg)
 	}
+	go b.checkAlerts(subjectID, studentID)
 
 	studentName, err := b.gradeRepo.GetStudentNameByID(studentID)
 	if err != nil {
@@ -244,45 +304,20 @@ func (b *Bot) handleGradeValueSelected(ctx context.Context, userID int64, callba
 		studentName = "студенту"
 	}
 
-	subjectName, err := b.subjectRepo.GetSubjectName(subjectID)
-	if err != nil {
-		b.logger.Warnf("Failed to get subject name: %v", err)
-		subjectName = "предмету"
-	}
-
-	successText := fmt.Sprintf(gradeSuccessMsg, gradeValue, studentName, subjectName)
+	successText := fmt.Sprintf(gradeSuccessMsg, valueLabel, assessmentTitle, studentName, subjectName)
 
 	keyboard := GetTeacherKeyboard(b.MaxAPI)
 
-	go b.sendGradeNotification(context.Background(), studentID, subjectID, subjectName, gradeValue)
-
 	return b.answerWithKeyboardAndNotification(ctx, callbackID, successText, keyboard, "Оценка выставлена!")
 }
 
-func (b *Bot) sendGradeNotification(ctx context.Context, studentID, subjectID int64, subjectName string, gradeValue int) {
-	studentMaxID, err := b.userRepo.GetUserMaxIDByID(studentID)
-	if err != nil {
-		b.logger.Warnf("Failed to get student max_id for notification: %v", err)
-		return
-	}
-
-	notificationText := fmt.Sprintf(notificationTextTemplate, subjectName, gradeValue)
-
-	keyboard := b.MaxAPI.Messages.NewKeyboardBuilder()
-	payload := fmt.Sprintf("show_grades_subj_%d", subjectID)
-	keyboard.AddRow().AddCallback("📊 Посмотреть все оценки", schemes.POSITIVE, payload)
-
-	msg := maxbot.NewMessage().
-		SetUser(studentMaxID).
-		SetText(notificationText).
-		SetFormat("markdown").
-		AddKeyboard(keyboard)
-
-	_, err = b.MaxAPI.Messages.Send(ctx, msg)
-	if err != nil {
-		b.logger.Warnf("Failed to send grade notification to student %d: %v", studentMaxID, err)
-	} else {
-		b.logger.Infof("Grade notification sent to student %d (max_id: %d)", studentID, studentMaxID)
+func gradeNotification(studentID, subjectID int64, subjectName, assessmentTitle, valueLabel string) database.OutboxNotification {
+	return database.OutboxNotification{
+		UserID:        studentID,
+		Category:      categoryGrades,
+		MessageText:   fmt.Sprintf(notificationTextTemplate, subjectName, assessmentTitle, valueLabel),
+		ButtonText:    "📊 Посмотреть все оценки",
+		ButtonPayload: fmt.Sprintf("show_grades_subj_%d", subjectID),
 	}
 }
 
@@ -0,0 +1,91 @@
+package maxAPI
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/max-messenger/max-bot-api-client-go/schemes"
+)
+
+const (
+	maxUploadsURL = "https://botapi.max.ru/uploads"
+	maxAPIVersion = "1.2.5"
+	uploadTimeout = 30 * time.Second
+)
+
+// uploadNamedFile uploads a file attachment under the given name. The client
+// library sends every upload as "file" without an extension, so calendar
+// apps and spreadsheet editors would not open it; this makes the same two
+// requests with the real file name.
+func (b *Bot) uploadNamedFile(ctx context.Context, name string, data []byte) (*schemes.UploadedInfo, error) {
+	client := &http.Client{Timeout: uploadTimeout}
+
+	query := url.Values{}
+	query.Set("type", string(schemes.FILE))
+	query.Set("access_token", b.apiToken)
+	query.Set("v", maxAPIVersion)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, maxUploadsURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get upload url: %s", resp.Status)
+	}
+
+	var endpoint schemes.UploadEndpoint
+	if err := json.NewDecoder(resp.Body).Decode(&endpoint); err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("data", name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(data); err != nil {
+		return nil, err
+	}
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodPost, endpoint.Url, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	uploadResp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer uploadResp.Body.Close()
+	if uploadResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("upload %s: %s", name, uploadResp.Status)
+	}
+
+	// The token comes with the upload URL; newer API versions return it in
+	// the upload response instead.
+	info := &schemes.UploadedInfo{Token: endpoint.Token}
+	if raw, err := io.ReadAll(uploadResp.Body); err == nil {
+		var uploaded schemes.UploadedInfo
+		if json.Unmarshal(raw, &uploaded) == nil && uploaded.Token != "" {
+			info = &uploaded
+		}
+	}
+	return info, nil
+}
@@ -2,6 +2,7 @@ package maxAPI
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -9,9 +10,12 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/jmoiron/sqlx"
 	maxbot "github.com/max-messenger/max-bot-api-client-go"
 	"github.com/max-messenger/max-bot-api-client-go/schemes"
 
+	"digitalUniversity/database"
+	"digitalUniversity/grading"
 	"digitalUniversity/services"
 )
 
@@ -25,6 +29,9 @@ const (
 	UnknownLessonType  = "Неизвестный тип"
 	UnknownTeacher     = "Неизвестный преподаватель"
 	UnknownGroup       = "Неизвестная группа"
+	UnknownAssessment  = "Без типа"
+
+	journalForbiddenMessage = "Журналы могут загружать только преподаватели."
 )
 
 func (b *Bot) downloadFile(ctx context.Context, fileAtt *schemes.FileAttachment) (string, error) {
@@ -77,7 +84,7 @@ func (b *Bot) saveFile(filePath string, reader io.Reader) error {
 	return err
 }
 
-func (b *Bot) validateAndImportFile(filePath, uploadType string) error {
+func (b *Bot) validateAndImportFile(userID int64, filePath, uploadType string) error {
 	fileType := b.getFileType(uploadType)
 
 	if err := services.ValidateCSVStructure(filePath, fileType); err != nil {
@@ -86,18 +93,54 @@ func (b *Bot) validateAndImportFile(filePath, uploadType string) error {
 
 	importer := services.NewCSVImporter(b.db)
 	switch uploadType {
+	case "grade_journal", "attendance_journal":
+		return b.importTeacherJournal(importer, userID, filePath, uploadType)
 	case "students":
 		return importer.ImportStudents(filePath)
 	case "teachers":
 		return importer.ImportTeachers(filePath)
 	case "schedule":
-		return importer.ImportSchedule(filePath)
+		return b.importSchedule(importer, userID, filePath)
+	case "grading":
+		return importer.ImportGrading(filePath)
+	case "rating":
+		return importer.ImportRatingRules(filePath)
+	case "holidays":
+		return importer.ImportHolidays(filePath)
 	default:
 		b.logger.Warnf(UnknownUploadTypeWarnFmt, uploadType)
 		return fmt.Errorf(UnknownUploadTypeErrFmt, uploadType)
 	}
 }
 
+func (b *Bot) importTeacherJournal(importer *services.CSVImporter, userID int64, filePath, uploadType string) error {
+	userRole, err := b.getUserRole(userID)
+	if err != nil {
+		return err
+	}
+	if userRole != "teacher" {
+		b.logger.Warnf("User %d with role %s tried to upload %s", userID, userRole, uploadType)
+		return errors.New(journalForbiddenMessage)
+	}
+
+	teacherID, err := b.userRepo.GetUserIDByMaxID(userID)
+	if err != nil {
+		return err
+	}
+
+	if uploadType == "grade_journal" {
+		err = importer.ImportGradeJournal(filePath, teacherID)
+	} else {
+		err = importer.ImportAttendanceJournal(filePath, teacherID)
+	}
+	if err != nil {
+		return err
+	}
+
+	go b.checkTeacherAlerts(teacherID)
+	return nil
+}
+
 func (b *Bot) getFileType(uploadType string) services.FileType {
 	switch uploadType {
 	case "students":
@@ -106,11 +149,35 @@ func (b *Bot) getFileType(uploadType string) services.FileType {
 		return services.FileTypeTeachers
 	case "schedule":
 		return services.FileTypeSchedule
+	case "grading":
+		return services.FileTypeGrading
+	case "rating":
+		return services.FileTypeRating
+	case "holidays":
+		return services.FileTypeHolidays
+	case "grade_journal":
+		return services.FileTypeGradeJournal
+	case "attendance_journal":
+		return services.FileTypeAttendanceJournal
 	default:
 		return ""
 	}
 }
 
+// inTx runs fn in a transaction that is committed only if fn succeeds.
+func (b *Bot) inTx(fn func(tx *sqlx.Tx) error) error {
+	tx, err := b.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 func (b *Bot) getUserRole(userID int64) (string, error) {
 	return b.userRepo.GetUserRole(userID)
 }
@@ -125,14 +192,14 @@ func (b *Bot) extractFileAttachments(attachments []any) []*schemes.FileAttachmen
 	return fileAttachments
 }
 
-func (b *Bot) downloadAndProcessFile(ctx context.Context, fileAtt *schemes.FileAttachment, uploadType string) error {
+func (b *Bot) downloadAndProcessFile(ctx context.Context, userID int64, fileAtt *schemes.FileAttachment, uploadType string) error {
 	filePath, err := b.downloadFile(ctx, fileAtt)
 	if err != nil {
 		return err
 	}
 	defer os.Remove(filePath)
 
-	if err := b.validateAndImportFile(filePath, uploadType); err != nil {
+	if err := b.validateAndImportFile(userID, filePath, uploadType); err != nil {
 		return err
 	}
 
@@ -140,8 +207,7 @@ func (b *Bot) downloadAndProcessFile(ctx context.Context, fileAtt *schemes.FileA
 }
 
 func (b *Bot) getNearestDateForWeekday(targetWeekday int16) time.Time {
-	now := time.Now().Local()
-	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	today := b.today()
 
 	goWeekday := time.Weekday(targetWeekday % 7)
 
@@ -189,6 +255,32 @@ func (b *Bot) getGroupName(groupID int64) string {
 	return name
 }
 
+func (b *Bot) getSubjectScale(subjectID int64) grading.Scale {
+	name, err := b.subjectRepo.GetSubjectGradingScale(subjectID)
+	if err != nil {
+		b.logger.Errorf("Failed to get grading scale for subject %d: %v", subjectID, err)
+	}
+	return grading.GetScale(name)
+}
+
+func (b *Bot) getAssessmentTypes(subjectID int64) []database.AssessmentType {
+	types, err := b.assessmentRepo.GetAssessmentTypesForSubject(subjectID)
+	if err != nil {
+		b.logger.Errorf("Failed to get assessment types for subject %d: %v", subjectID, err)
+		return nil
+	}
+	return types
+}
+
+func (b *Bot) getAssessmentTitle(subjectID, assessmentTypeID int64) string {
+	for _, assessmentType := range b.getAssessmentTypes(subjectID) {
+		if assessmentType.AssessmentTypeID == assessmentTypeID {
+			return assessmentType.Title
+		}
+	}
+	return UnknownAssessment
+}
+
 func (b *Bot) answerWithKeyboard(ctx context.Context, callbackID string, text string, keyboard *maxbot.Keyboard) error {
 	messageBody := &schemes.NewMessageBody{
 		Text:        text,
@@ -222,3 +314,38 @@ func (b *Bot) answerWithKeyboardMarkdown(ctx context.Context, callbackID string,
 	_, err := b.MaxAPI.Messages.AnswerOnCallback(ctx, callbackID, answer)
 	return err
 }
+
+// answerWithPhotoMarkdown answers the callback with an image above the text.
+// A nil photo leaves the message text-only.
+func (b *Bot) answerWithPhotoMarkdown(ctx context.Context, callbackID string, text string, photo *schemes.PhotoTokens, keyboard *maxbot.Keyboard) error {
+	attachments := []any{}
+	if photo != nil {
+		attachments = append(attachments, schemes.NewPhotoAttachmentRequest(schemes.PhotoAttachmentRequestPayload{Photos: photo.Photos}))
+	}
+	attachments = append(attachments, schemes.NewInlineKeyboardAttachmentRequest(keyboard.Build()))
+
+	messageBody := &schemes.NewMessageBody{
+		Text:        text,
+		Format:      "markdown",
+		Attachments: attachments,
+	}
+	answer := &schemes.CallbackAnswer{Message: messageBody}
+	_, err := b.MaxAPI.Messages.AnswerOnCallback(ctx, callbackID, answer)
+	return err
+}
+
+// answerWithFileMarkdown answers the callback with an uploaded file attached
+// to the text.
+func (b *Bot) answerWithFileMarkdown(ctx context.Context, callbackID string, text string, file *schemes.UploadedInfo, keyboard *maxbot.Keyboard) error {
+	messageBody := &schemes.NewMessageBody{
+		Text:   text,
+		Format: "markdown",
+		Attachments: []any{
+			schemes.NewFileAttachmentRequest(*file),
+			schemes.NewInlineKeyboardAttachmentRequest(keyboard.Build()),
+		},
+	}
+	answer := &schemes.CallbackAnswer{Message: messageBody}
+	_, err := b.MaxAPI.Messages.AnswerOnCallback(ctx, callbackID, answer)
+	return err
+}
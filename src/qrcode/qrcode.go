@@ -0,0 +1,443 @@
+// Package qrcode renders short texts as QR codes. It supports byte mode with
+// error correction level M and symbol versions 1 to 5, which is enough for
+// check-in codes and links of up to 84 bytes.
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+const (
+	quietZone = 4
+
+	// formatBitsM is the error correction level M in format information.
+	formatBitsM = 0
+)
+
+var ErrTooLong = errors.New("qrcode: text is too long")
+
+// version describes a symbol version at error correction level M. All blocks
+// of the supported versions have the same size.
+type version struct {
+	number      int
+	blocks      int
+	dataPerBlk  int
+	ecPerBlk    int
+	alignCenter int
+	remainder   int
+}
+
+var versions = []version{
+	{number: 1, blocks: 1, dataPerBlk: 16, ecPerBlk: 10},
+	{number: 2, blocks: 1, dataPerBlk: 28, ecPerBlk: 16, alignCenter: 18, remainder: 7},
+	{number: 3, blocks: 1, dataPerBlk: 44, ecPerBlk: 26, alignCenter: 22, remainder: 7},
+	{number: 4, blocks: 2, dataPerBlk: 32, ecPerBlk: 18, alignCenter: 26, remainder: 7},
+	{number: 5, blocks: 2, dataPerBlk: 43, ecPerBlk: 24, alignCenter: 30, remainder: 7},
+}
+
+// Code is an encoded symbol. Modules are indexed as [y][x], true is dark.
+type Code struct {
+	Size    int
+	Modules [][]bool
+
+	function [][]bool
+}
+
+// Encode builds the smallest symbol that holds the text.
+func Encode(text string) (*Code, error) {
+	data := []byte(text)
+
+	var v *version
+	for i := range versions {
+		// Mode indicator, 8-bit length and the data itself.
+		if 4+8+len(data)*8 <= versions[i].blocks*versions[i].dataPerBlk*8 {
+			v = &versions[i]
+			break
+		}
+	}
+	if v == nil || len(data) > 255 {
+		return nil, ErrTooLong
+	}
+
+	codewords := interleave(v, dataCodewords(v, data))
+
+	size := v.number*4 + 17
+	c := &Code{Size: size, Modules: newGrid(size), function: newGrid(size)}
+	c.drawFunctionPatterns(v)
+	c.drawCodewords(codewords, v.remainder)
+
+	bestMask, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask)
+		c.drawFormatBits(mask)
+		if penalty := c.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			bestMask, bestPenalty = mask, penalty
+		}
+		c.applyMask(mask)
+	}
+	c.applyMask(bestMask)
+	c.drawFormatBits(bestMask)
+
+	return c, nil
+}
+
+// PNG renders the text as a black-on-white PNG image with the standard
+// quiet zone. Every module is scale pixels wide.
+func PNG(text string, scale int) ([]byte, error) {
+	c, err := Encode(text)
+	if err != nil {
+		return nil, err
+	}
+
+	side := (c.Size + 2*quietZone) * scale
+	img := image.NewGray(image.Rect(0, 0, side, side))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.Modules[y][x] {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetGray((x+quietZone)*scale+dx, (y+quietZone)*scale+dy, color.Gray{})
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func newGrid(size int) [][]bool {
+	grid := make([][]bool, size)
+	for i := range grid {
+		grid[i] = make([]bool, size)
+	}
+	return grid
+}
+
+// dataCodewords encodes the text in byte mode and pads it to the capacity of
+// the version.
+func dataCodewords(v *version, data []byte) []byte {
+	capacity := v.blocks * v.dataPerBlk * 8
+
+	var bits []bool
+	appendBits := func(value, count int) {
+		for i := count - 1; i >= 0; i-- {
+			bits = append(bits, (value>>i)&1 == 1)
+		}
+	}
+
+	appendBits(0b0100, 4)
+	appendBits(len(data), 8)
+	for _, b := range data {
+		appendBits(int(b), 8)
+	}
+	appendBits(0, min(4, capacity-len(bits)))
+	appendBits(0, (8-len(bits)%8)%8)
+
+	codewords := make([]byte, 0, capacity/8)
+	for i := 0; i < len(bits); i += 8 {
+		var b byte
+		for j := 0; j < 8; j++ {
+			if bits[i+j] {
+				b |= 1 << (7 - j)
+			}
+		}
+		codewords = append(codewords, b)
+	}
+	for pad := byte(0xEC); len(codewords) < capacity/8; pad ^= 0xEC ^ 0x11 {
+		codewords = append(codewords, pad)
+	}
+	return codewords
+}
+
+// interleave splits the data into blocks, adds error correction to each and
+// interleaves the result as the standard requires.
+func interleave(v *version, data []byte) []byte {
+	divisor := reedSolomonDivisor(v.ecPerBlk)
+
+	blocks := make([][]byte, v.blocks)
+	ecBlocks := make([][]byte, v.blocks)
+	for i := range blocks {
+		blocks[i] = data[i*v.dataPerBlk : (i+1)*v.dataPerBlk]
+		ecBlocks[i] = reedSolomonRemainder(blocks[i], divisor)
+	}
+
+	result := make([]byte, 0, v.blocks*(v.dataPerBlk+v.ecPerBlk))
+	for i := 0; i < v.dataPerBlk; i++ {
+		for _, block := range blocks {
+			result = append(result, block[i])
+		}
+	}
+	for i := 0; i < v.ecPerBlk; i++ {
+		for _, block := range ecBlocks {
+			result = append(result, block[i])
+		}
+	}
+	return result
+}
+
+func (c *Code) set(x, y int, dark bool) {
+	c.Modules[y][x] = dark
+	c.function[y][x] = true
+}
+
+func (c *Code) drawFunctionPatterns(v *version) {
+	for i := 0; i < c.Size; i++ {
+		c.set(6, i, i%2 == 0)
+		c.set(i, 6, i%2 == 0)
+	}
+
+	c.drawFinder(3, 3)
+	c.drawFinder(c.Size-4, 3)
+	c.drawFinder(3, c.Size-4)
+
+	if v.alignCenter > 0 {
+		for dy := -2; dy <= 2; dy++ {
+			for dx := -2; dx <= 2; dx++ {
+				c.set(v.alignCenter+dx, v.alignCenter+dy, max(abs(dx), abs(dy)) != 1)
+			}
+		}
+	}
+
+	// Reserve the format areas; the real bits are drawn after masking.
+	c.drawFormatBits(0)
+}
+
+// drawFinder draws a finder pattern with its separator around the center.
+func (c *Code) drawFinder(cx, cy int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			x, y := cx+dx, cy+dy
+			if x < 0 || x >= c.Size || y < 0 || y >= c.Size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			c.set(x, y, dist != 2 && dist != 4)
+		}
+	}
+}
+
+func (c *Code) drawFormatBits(mask int) {
+	data := formatBitsM<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>i)&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		c.set(8, i, bit(i))
+	}
+	c.set(8, 7, bit(6))
+	c.set(8, 8, bit(7))
+	c.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		c.set(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		c.set(c.Size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		c.set(8, c.Size-15+i, bit(i))
+	}
+	c.set(8, c.Size-8, true)
+}
+
+// drawCodewords places the codewords in the zigzag order, two columns at a
+// time from the bottom right corner, skipping function modules.
+func (c *Code) drawCodewords(codewords []byte, remainder int) {
+	total := len(codewords)*8 + remainder
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < c.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if upward {
+					y = c.Size - 1 - vert
+				}
+				if c.function[y][x] || i >= total {
+					continue
+				}
+				if i < len(codewords)*8 {
+					c.Modules[y][x] = (codewords[i>>3]>>(7-i&7))&1 == 1
+				}
+				i++
+			}
+		}
+	}
+}
+
+// applyMask toggles data modules selected by the mask. Applying the same
+// mask twice restores the symbol.
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.function[y][x] {
+				continue
+			}
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert {
+				c.Modules[y][x] = !c.Modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores the symbol by the four rules of the standard; the mask with
+// the lowest score is used.
+func (c *Code) penalty() int {
+	score := 0
+	dark := 0
+
+	line := make([]bool, c.Size)
+	for _, vertical := range []bool{false, true} {
+		for a := 0; a < c.Size; a++ {
+			for b := 0; b < c.Size; b++ {
+				if vertical {
+					line[b] = c.Modules[b][a]
+				} else {
+					line[b] = c.Modules[a][b]
+				}
+			}
+			score += linePenalty(line)
+		}
+	}
+
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.Modules[y][x] {
+				dark++
+			}
+			if x > 0 && y > 0 {
+				m := c.Modules[y][x]
+				if m == c.Modules[y-1][x] && m == c.Modules[y][x-1] && m == c.Modules[y-1][x-1] {
+					score += 3
+				}
+			}
+		}
+	}
+
+	total := c.Size * c.Size
+	score += abs(dark*20-total*10) / total * 10
+	return score
+}
+
+var finderLike = [][]bool{
+	{true, false, true, true, true, false, true, false, false, false, false},
+	{false, false, false, false, true, false, true, true, true, false, true},
+}
+
+func linePenalty(line []bool) int {
+	score := 0
+
+	run := 1
+	for i := 1; i <= len(line); i++ {
+		if i < len(line) && line[i] == line[i-1] {
+			run++
+			continue
+		}
+		if run >= 5 {
+			score += 3 + run - 5
+		}
+		run = 1
+	}
+
+	for i := 0; i+len(finderLike[0]) <= len(line); i++ {
+		for _, pattern := range finderLike {
+			match := true
+			for j, dark := range pattern {
+				if line[i+j] != dark {
+					match = false
+					break
+				}
+			}
+			if match {
+				score += 40
+			}
+		}
+	}
+	return score
+}
+
+func reedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := 0; j < degree; j++ {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < degree {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+func reedSolomonRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, d := range divisor {
+			result[i] ^= gfMultiply(d, factor)
+		}
+	}
+	return result
+}
+
+// gfMultiply multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func gfMultiply(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>i)&1) * int(x)
+	}
+	return byte(z)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,336 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// The decoder below follows ISO/IEC 18004 independently of the encoder, so a
+// symbol that decodes back to its text is laid out the way readers expect.
+
+// specVersions lists the level M block structure and the alignment pattern
+// center of the supported versions.
+var specVersions = map[int]struct {
+	blocks, dataPerBlock, ecPerBlock, alignment int
+}{
+	1: {1, 16, 10, 0},
+	2: {1, 28, 16, 18},
+	3: {1, 44, 26, 22},
+	4: {2, 32, 18, 26},
+	5: {2, 43, 24, 30},
+}
+
+type decoded struct {
+	version int
+	level   int
+	mask    int
+	text    string
+}
+
+func decode(t *testing.T, c *Code) decoded {
+	t.Helper()
+
+	size := len(c.Modules)
+	if size != c.Size || (size-17)%4 != 0 {
+		t.Fatalf("invalid symbol size %d", size)
+	}
+	var d decoded
+	d.version = (size - 17) / 4
+	spec, ok := specVersions[d.version]
+	if !ok {
+		t.Fatalf("unsupported version %d", d.version)
+	}
+	module := func(x, y int) bool { return c.Modules[y][x] }
+
+	for _, corner := range [][2]int{{0, 0}, {size - 7, 0}, {0, size - 7}} {
+		for dy := 0; dy < 7; dy++ {
+			for dx := 0; dx < 7; dx++ {
+				ring := max(abs(dx-3), abs(dy-3))
+				if want := ring != 2; module(corner[0]+dx, corner[1]+dy) != want {
+					t.Fatalf("finder pattern at %v is broken at (%d, %d)", corner, dx, dy)
+				}
+			}
+		}
+	}
+	for i := 8; i < size-8; i++ {
+		if module(i, 6) != (i%2 == 0) || module(6, i) != (i%2 == 0) {
+			t.Fatalf("timing pattern is broken at %d", i)
+		}
+	}
+	if !module(8, size-8) {
+		t.Fatal("dark module is missing")
+	}
+
+	var first, second int
+	firstCopy := [][2]int{{8, 0}, {8, 1}, {8, 2}, {8, 3}, {8, 4}, {8, 5}, {8, 7}, {8, 8}, {7, 8}, {5, 8}, {4, 8}, {3, 8}, {2, 8}, {1, 8}, {0, 8}}
+	for i, p := range firstCopy {
+		if module(p[0], p[1]) {
+			first |= 1 << i
+		}
+	}
+	for i := 0; i < 15; i++ {
+		x, y := size-1-i, 8
+		if i >= 8 {
+			x, y = 8, size-15+i
+		}
+		if module(x, y) {
+			second |= 1 << i
+		}
+	}
+	if first != second {
+		t.Fatalf("format copies differ: %015b and %015b", first, second)
+	}
+	format := -1
+	for data := 0; data < 32; data++ {
+		if formatWord(data) == first {
+			format = data
+		}
+	}
+	if format < 0 {
+		t.Fatalf("invalid format information %015b", first)
+	}
+	d.level, d.mask = format>>3, format&7
+
+	function := func(x, y int) bool {
+		switch {
+		case x < 9 && y < 9, x >= size-8 && y < 9, x < 9 && y >= size-8:
+			return true
+		case x == 6 || y == 6:
+			return true
+		case spec.alignment > 0 && abs(x-spec.alignment) <= 2 && abs(y-spec.alignment) <= 2:
+			return true
+		}
+		return false
+	}
+
+	var bits []bool
+	for right := size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = size - 1 - vert
+				}
+				if !function(x, y) {
+					bits = append(bits, module(x, y) != maskBit(d.mask, y, x))
+				}
+			}
+		}
+	}
+
+	total := spec.blocks * (spec.dataPerBlock + spec.ecPerBlock)
+	if len(bits) < total*8 {
+		t.Fatalf("symbol holds %d bits, want at least %d", len(bits), total*8)
+	}
+	codewords := make([]byte, total)
+	for i := range codewords {
+		for j := 0; j < 8; j++ {
+			if bits[i*8+j] {
+				codewords[i] |= 1 << (7 - j)
+			}
+		}
+	}
+
+	blocks := make([][]byte, spec.blocks)
+	k := 0
+	for i := 0; i < spec.dataPerBlock; i++ {
+		for b := range blocks {
+			blocks[b] = append(blocks[b], codewords[k])
+			k++
+		}
+	}
+	for i := 0; i < spec.ecPerBlock; i++ {
+		for b := range blocks {
+			blocks[b] = append(blocks[b], codewords[k])
+			k++
+		}
+	}
+
+	var data []byte
+	for b, block := range blocks {
+		for i := 0; i < spec.ecPerBlock; i++ {
+			if s := syndrome(block, gfExp[i]); s != 0 {
+				t.Fatalf("block %d: syndrome %d is %d, want 0", b, i, s)
+			}
+		}
+		data = append(data, block[:spec.dataPerBlock]...)
+	}
+
+	if mode := data[0] >> 4; mode != 0b0100 {
+		t.Fatalf("mode = %04b, want byte mode", mode)
+	}
+	length := int(data[0]&0x0F)<<4 | int(data[1]>>4)
+	text := make([]byte, length)
+	for i := range text {
+		text[i] = data[1+i]<<4 | data[2+i]>>4
+	}
+	d.text = string(text)
+	return d
+}
+
+// formatWord returns the masked BCH(15, 5) code of the format data.
+func formatWord(data int) int {
+	const generator = 0b10100110111
+	rem := data << 10
+	for bit := 14; bit >= 10; bit-- {
+		if rem&(1<<bit) != 0 {
+			rem ^= generator << (bit - 10)
+		}
+	}
+	return (data<<10 | rem) ^ 0b101010000010010
+}
+
+// maskBit tells whether the mask inverts the module in the row and column.
+func maskBit(mask, row, col int) bool {
+	switch mask {
+	case 0:
+		return (row+col)%2 == 0
+	case 1:
+		return row%2 == 0
+	case 2:
+		return col%3 == 0
+	case 3:
+		return (row+col)%3 == 0
+	case 4:
+		return (row/2+col/3)%2 == 0
+	case 5:
+		return row*col%2+row*col%3 == 0
+	case 6:
+		return (row*col%2+row*col%3)%2 == 0
+	default:
+		return ((row+col)%2+row*col%3)%2 == 0
+	}
+}
+
+var gfExp, gfLog = func() ([512]byte, [256]byte) {
+	var exp [512]byte
+	var log [256]byte
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = byte(x)
+		log[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11D
+		}
+	}
+	for i := 255; i < 512; i++ {
+		exp[i] = exp[i-255]
+	}
+	return exp, log
+}()
+
+// syndrome evaluates the codeword polynomial, highest degree first, at x.
+func syndrome(block []byte, x byte) byte {
+	var y byte
+	for _, c := range block {
+		if y != 0 && x != 0 {
+			y = gfExp[int(gfLog[y])+int(gfLog[x])]
+		} else {
+			y = 0
+		}
+		y ^= c
+	}
+	return y
+}
+
+func TestEncodeDecodes(t *testing.T) {
+	tests := []struct {
+		length  int
+		version int
+	}{
+		{1, 1}, {14, 1},
+		{15, 2}, {26, 2},
+		{27, 3}, {42, 3},
+		{43, 4}, {62, 4},
+		{63, 5}, {84, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d bytes", tt.length), func(t *testing.T) {
+			text := strings.Repeat("https://max.ru/chk?", 5)[:tt.length]
+			c, err := Encode(text)
+			if err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+
+			d := decode(t, c)
+			if d.version != tt.version {
+				t.Errorf("version = %d, want %d", d.version, tt.version)
+			}
+			if d.level != formatBitsM {
+				t.Errorf("error correction level bits = %02b, want M (%02b)", d.level, formatBitsM)
+			}
+			if d.text != text {
+				t.Errorf("decoded %q, want %q", d.text, text)
+			}
+		})
+	}
+}
+
+func TestEveryMaskDecodes(t *testing.T) {
+	const text = "CHK-2025-0042"
+
+	for mask := 0; mask < 8; mask++ {
+		t.Run(fmt.Sprintf("mask %d", mask), func(t *testing.T) {
+			c, err := Encode(text)
+			if err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			c.applyMask(decode(t, c).mask)
+			c.applyMask(mask)
+			c.drawFormatBits(mask)
+
+			d := decode(t, c)
+			if d.mask != mask {
+				t.Errorf("mask = %d, want %d", d.mask, mask)
+			}
+			if d.text != text {
+				t.Errorf("decoded %q, want %q", d.text, text)
+			}
+		})
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	if _, err := Encode(strings.Repeat("x", 85)); !errors.Is(err, ErrTooLong) {
+		t.Errorf("Encode(85 bytes) error = %v, want ErrTooLong", err)
+	}
+}
+
+func TestPNG(t *testing.T) {
+	const scale = 4
+	data, err := PNG("hello", scale)
+	if err != nil {
+		t.Fatalf("PNG: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode PNG: %v", err)
+	}
+
+	c, _ := Encode("hello")
+	side := (c.Size + 2*quietZone) * scale
+	if b := img.Bounds(); b.Dx() != side || b.Dy() != side {
+		t.Fatalf("image is %dx%d, want %dx%d", b.Dx(), b.Dy(), side, side)
+	}
+
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			r, _, _, _ := img.At((x+quietZone)*scale+scale/2, (y+quietZone)*scale+scale/2).RGBA()
+			if dark := r == 0; dark != c.Modules[y][x] {
+				t.Fatalf("pixel of module (%d, %d) dark = %v, want %v", x, y, dark, c.Modules[y][x])
+			}
+		}
+	}
+	if r, _, _, _ := img.At(0, 0).RGBA(); r == 0 {
+		t.Error("quiet zone is not white")
+	}
+}
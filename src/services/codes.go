@@ -0,0 +1,58 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	inviteCodeLength   = 8
+	inviteCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+	feedTokenBytes = 24
+)
+
+// GenerateInviteCode returns a random one-time code. The alphabet has no
+// characters that are easy to confuse, such as O and 0.
+func GenerateInviteCode() (string, error) {
+	buf := make([]byte, inviteCodeLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	for i, v := range buf {
+		buf[i] = inviteCodeAlphabet[int(v)%len(inviteCodeAlphabet)]
+	}
+	return string(buf), nil
+}
+
+// NormalizeInviteCode upper-cases the text and drops spaces and dashes, then
+// checks that it looks like a code made by GenerateInviteCode.
+func NormalizeInviteCode(text string) (string, bool) {
+	code := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(strings.TrimSpace(text)))
+
+	if len(code) != inviteCodeLength {
+		return "", false
+	}
+	for _, r := range code {
+		if !strings.ContainsRune(inviteCodeAlphabet, r) {
+			return "", false
+		}
+	}
+	return code, true
+}
+
+// GenerateFeedToken returns a random token for a calendar feed link. It is
+// long enough to be unguessable, as the link is the only access check.
+func GenerateFeedToken() (string, error) {
+	buf := make([]byte, feedTokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
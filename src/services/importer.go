@@ -1,13 +1,31 @@
 package services
 
 import (
+	"database/sql"
 	"encoding/csv"
+	"errors"
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/jmoiron/sqlx"
 
 	"digitalUniversity/database"
+	"digitalUniversity/grading"
+)
+
+const (
+	errMsgUnknownSubject        = "Строка %d: предмет %q не найден."
+	errMsgAmbiguousSubject      = "Строка %d: предмет %q ведут несколько преподавателей, настройки нельзя применить однозначно."
+	errMsgUnknownScale          = "Строка %d: неизвестная шкала оценивания %q. Допустимые значения: %s."
+	errMsgUnknownAssessmentType = "Строка %d: неизвестный тип работы %q."
+	errMsgInvalidWeight         = "Строка %d: некорректный вес %q."
+	errMsgScaleMismatch         = "Строка %d: для предмета %q уже указана шкала %q."
+	errMsgInvalidNumber         = "Строка %d: некорректное значение %q в столбце %s."
+	errMsgInvalidPercent        = "Строка %d: значение %q в столбце %s должно быть от 0 до 100."
+	errMsgZeroRatingWeights     = "Строка %d: хотя бы один из весов рейтинга должен быть больше нуля."
+	errMsgEmptyHolidayTitle     = "Строка %d: не указано название праздника."
 )
 
 type CSVImporter struct {
@@ -17,6 +35,11 @@ type CSVImporter struct {
 	subjectRepo    *database.SubjectRepository
 	lessonTypeRepo *database.LessonTypeRepository
 	scheduleRepo   *database.ScheduleRepository
+	assessmentRepo *database.AssessmentTypeRepository
+	ratingRuleRepo *database.RatingRuleRepository
+	gradeRepo      *database.GradeRepository
+	attendanceRepo *database.AttendanceRepository
+	holidayRepo    *database.HolidayRepository
 	db             *sqlx.DB
 }
 
@@ -28,6 +51,11 @@ func NewCSVImporter(db *sqlx.DB) *CSVImporter {
 		subjectRepo:    database.NewSubjectRepository(db),
 		lessonTypeRepo: database.NewLessonTypeRepository(db),
 		scheduleRepo:   database.NewScheduleRepository(db),
+		assessmentRepo: database.NewAssessmentTypeRepository(db),
+		ratingRuleRepo: database.NewRatingRuleRepository(db),
+		gradeRepo:      database.NewGradeRepository(db),
+		attendanceRepo: database.NewAttendanceRepository(db),
+		holidayRepo:    database.NewHolidayRepository(db),
 		db:             db,
 	}
 }
@@ -52,11 +80,6 @@ func (imp *CSVImporter) ImportStudents(filePath string) error {
 	for i := 1; i < len(records); i++ {
 		record := records[i]
 
-		userMaxID, err := strconv.ParseInt(record[0], 10, 64)
-		if err != nil {
-			return err
-		}
-
 		lastName := record[1]
 		firstName := record[2]
 		groupName := record[3]
@@ -66,6 +89,18 @@ func (imp *CSVImporter) ImportStudents(filePath string) error {
 			return err
 		}
 
+		if strings.TrimSpace(record[0]) == "" {
+			if err := imp.importUnclaimedStudent(tx, firstName, lastName, studentRoleID, groupID); err != nil {
+				return err
+			}
+			continue
+		}
+
+		userMaxID, err := strconv.ParseInt(strings.TrimSpace(record[0]), 10, 64)
+		if err != nil {
+			return newValidationError(fmt.Sprintf(errMsgInvalidNumber, i+1, record[0], "User_id"))
+		}
+
 		err = imp.userRepo.CreateOrUpdateStudent(tx, userMaxID, firstName, lastName, studentRoleID, groupID)
 		if err != nil {
 			return err
@@ -75,6 +110,21 @@ func (imp *CSVImporter) ImportStudents(filePath string) error {
 	return tx.Commit()
 }
 
+// importUnclaimedStudent adds a student listed without a Max ID. The student
+// claims the record later with a personal registration code.
+func (imp *CSVImporter) importUnclaimedStudent(tx *sqlx.Tx, firstName, lastName string, roleID, groupID int64) error {
+	studentID, err := imp.userRepo.CreateOrGetUnclaimedStudent(tx, firstName, lastName, roleID, groupID)
+	if err != nil {
+		return err
+	}
+
+	code, err := GenerateInviteCode()
+	if err != nil {
+		return err
+	}
+	return imp.userRepo.SetInviteCode(tx, studentID, code)
+}
+
 func (imp *CSVImporter) ImportTeachers(filePath string) error {
 	records, err := readCSV(filePath)
 	if err != nil {
@@ -106,12 +156,48 @@ func (imp *CSVImporter) ImportTeachers(filePath string) error {
 		if err != nil {
 			return err
 		}
+
+		if len(record) > 3 {
+			if err := imp.setCuratorGroups(tx, userMaxID, record[3], i+1); err != nil {
+				return err
+			}
+		}
 	}
 
 	return tx.Commit()
 }
 
-func (imp *CSVImporter) ImportSchedule(filePath string) error {
+// setCuratorGroups makes the teacher the curator of the groups listed in the
+// optional Curator_groups column, separated by semicolons.
+func (imp *CSVImporter) setCuratorGroups(tx *sqlx.Tx, userMaxID int64, groups string, rowNum int) error {
+	for _, groupName := range strings.Split(groups, ";") {
+		groupName = strings.TrimSpace(groupName)
+		if groupName == "" {
+			continue
+		}
+
+		groupID, err := imp.groupRepo.GetGroupIDByName(tx, groupName)
+		if errors.Is(err, sql.ErrNoRows) {
+			return newValidationError(fmt.Sprintf(errMsgUnknownGroup, rowNum, groupName))
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := imp.groupRepo.SetCurator(tx, groupID, userMaxID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ImportSchedule replaces the timetable of every group listed in the file.
+// Lessons that only changed time, room or teacher keep their IDs, and removed
+// lessons with recorded marks are archived instead of deleted. onChanges, if
+// set, is called inside the import transaction with the changes to groups
+// that already had a timetable.
+func (imp *CSVImporter) ImportSchedule(filePath string, onChanges ScheduleChangeHandler) error {
 	records, err := readCSV(filePath)
 	if err != nil {
 		return err
@@ -128,8 +214,14 @@ func (imp *CSVImporter) ImportSchedule(filePath string) error {
 		return err
 	}
 
+	imported := make(map[int64][]database.ScheduleLesson)
+	var groupIDs []int64
+	var lessons []database.ScheduleLesson
+	var rowNums []int
+
 	for i := 1; i < len(records); i++ {
 		record := records[i]
+		rowNum := i + 1
 
 		subjectName := record[0]
 		typeName := record[1]
@@ -143,8 +235,14 @@ func (imp *CSVImporter) ImportSchedule(filePath string) error {
 			return err
 		}
 
-		startTime := record[7]
-		endTime := record[8]
+		startTime, err := parseLessonTime(rowNum, record[7])
+		if err != nil {
+			return err
+		}
+		endTime, err := parseLessonTime(rowNum, record[8])
+		if err != nil {
+			return err
+		}
 
 		lessonTypeID, err := imp.lessonTypeRepo.CreateOrGetLessonType(tx, typeName)
 		if err != nil {
@@ -166,15 +264,303 @@ func (imp *CSVImporter) ImportSchedule(filePath string) error {
 			return err
 		}
 
-		err = imp.scheduleRepo.CreateSchedule(tx, weekday, startTime, endTime, classroom, subjectID, teacherID, groupID, lessonTypeID)
+		err = imp.subjectRepo.LinkGroupToSubject(tx, groupID, subjectID)
 		if err != nil {
 			return err
 		}
 
-		err = imp.subjectRepo.LinkGroupToSubject(tx, groupID, subjectID)
+		if _, seen := imported[groupID]; !seen {
+			groupIDs = append(groupIDs, groupID)
+		}
+		lesson := database.ScheduleLesson{
+			Schedule: database.Schedule{
+				Weekday:      int16(weekday),
+				StartTime:    startTime,
+				EndTime:      endTime,
+				ClassRoom:    classroom,
+				SubjectID:    subjectID,
+				TeacherID:    teacherID,
+				GroupID:      groupID,
+				LessonTypeID: lessonTypeID,
+			},
+			SubjectName: subjectName,
+			TypeName:    typeName,
+			GroupName:   groupName,
+			TeacherName: teacherFirstName + " " + teacherLastName,
+		}
+		imported[groupID] = append(imported[groupID], lesson)
+		lessons = append(lessons, lesson)
+		rowNums = append(rowNums, rowNum)
+	}
+
+	if err := imp.checkScheduleConflicts(tx, lessons, rowNums, imported); err != nil {
+		return err
+	}
+
+	var changes []ScheduleChange
+	for _, groupID := range groupIDs {
+		current, err := imp.scheduleRepo.GetGroupLessons(tx, groupID)
+		if err != nil {
+			return err
+		}
+
+		groupChanges := diffLessons(current, imported[groupID])
+		if err := imp.applyScheduleChanges(tx, groupChanges); err != nil {
+			return err
+		}
+
+		if len(current) > 0 {
+			changes = append(changes, groupChanges...)
+		}
+	}
+
+	if onChanges != nil && len(changes) > 0 {
+		if err := onChanges(tx, changes); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// checkScheduleConflicts rejects an import whose lessons conflict with each
+// other or with the lessons of groups the file leaves unchanged. Conflicts
+// between unchanged lessons are left to the admin report.
+func (imp *CSVImporter) checkScheduleConflicts(tx *sqlx.Tx, lessons []database.ScheduleLesson, rowNums []int, imported map[int64][]database.ScheduleLesson) error {
+	current, err := imp.scheduleRepo.GetCurrentLessons(tx)
+	if err != nil {
+		return err
+	}
+
+	schedule := lessons
+	for _, lesson := range current {
+		if _, replaced := imported[lesson.GroupID]; !replaced {
+			schedule = append(schedule, lesson)
+		}
+	}
+
+	rows := make(map[*database.ScheduleLesson]int, len(rowNums))
+	for i, rowNum := range rowNums {
+		rows[&schedule[i]] = rowNum
+	}
+
+	var conflicts []ScheduleConflict
+	for _, c := range FindScheduleConflicts(schedule) {
+		_, firstImported := rows[c.First]
+		_, secondImported := rows[c.Second]
+		if firstImported || secondImported {
+			conflicts = append(conflicts, c)
+		}
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+	return importConflictsError(conflicts, rows)
+}
+
+func (imp *CSVImporter) applyScheduleChanges(tx *sqlx.Tx, changes []ScheduleChange) error {
+	for _, change := range changes {
+		var err error
+
+		switch change.Kind {
+		case ScheduleChangeAdded:
+			l := change.After
+			err = imp.scheduleRepo.CreateSchedule(tx, int(l.Weekday), l.StartTime.Format(lessonTimeFormat),
+				l.EndTime.Format(lessonTimeFormat), l.ClassRoom, l.SubjectID, l.TeacherID, l.GroupID, l.LessonTypeID)
+		case ScheduleChangeMoved:
+			l := change.After
+			if l.SubjectID != change.Before.SubjectID {
+				if err := imp.scheduleRepo.SetLessonSubject(tx, l.ScheduleID, l.SubjectID); err != nil {
+					return err
+				}
+			}
+			err = imp.scheduleRepo.UpdateLesson(tx, l.ScheduleID, l.Weekday, l.StartTime.Format(lessonTimeFormat),
+				l.EndTime.Format(lessonTimeFormat), l.ClassRoom, l.TeacherID)
+		case ScheduleChangeRemoved:
+			err = imp.scheduleRepo.RemoveLesson(tx, change.Before.ScheduleID)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subjectIDByName resolves a subject of a configuration file. A name shared
+// by subjects of several teachers is rejected rather than applied to one of
+// them at random.
+func (imp *CSVImporter) subjectIDByName(tx *sqlx.Tx, rowNum int, subjectName string) (int64, error) {
+	subjectIDs, err := imp.subjectRepo.GetSubjectIDsByName(tx, subjectName)
+	if err != nil {
+		return 0, err
+	}
+	switch len(subjectIDs) {
+	case 0:
+		return 0, newValidationError(fmt.Sprintf(errMsgUnknownSubject, rowNum, subjectName))
+	case 1:
+		return subjectIDs[0], nil
+	default:
+		return 0, newValidationError(fmt.Sprintf(errMsgAmbiguousSubject, rowNum, subjectName))
+	}
+}
+
+// ImportGrading applies per-subject grading configuration: the grading scale
+// and the weight of each assessment type. Subjects must already exist.
+func (imp *CSVImporter) ImportGrading(filePath string) error {
+	records, err := readCSV(filePath)
+	if err != nil {
+		return err
+	}
+
+	tx, err := imp.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	scales := make(map[string]string)
+
+	for i := 1; i < len(records); i++ {
+		record := records[i]
+		rowNum := i + 1
+
+		subjectName := strings.TrimSpace(record[0])
+		scaleName := strings.TrimSpace(record[1])
+		typeCode := strings.TrimSpace(record[2])
+		weightStr := strings.TrimSpace(record[3])
+
+		if !grading.IsKnownScale(scaleName) {
+			return newValidationError(fmt.Sprintf(errMsgUnknownScale, rowNum, scaleName, strings.Join(grading.ScaleNames(), ", ")))
+		}
+
+		if prev, ok := scales[subjectName]; ok && prev != scaleName {
+			return newValidationError(fmt.Sprintf(errMsgScaleMismatch, rowNum, subjectName, prev))
+		}
+		scales[subjectName] = scaleName
+
+		subjectID, err := imp.subjectIDByName(tx, rowNum, subjectName)
+		if err != nil {
+			return err
+		}
+
+		if err := imp.subjectRepo.SetSubjectGradingScale(tx, subjectID, scaleName); err != nil {
+			return err
+		}
+
+		if typeCode == "" {
+			continue
+		}
+
+		assessmentTypeID, err := imp.assessmentRepo.GetAssessmentTypeIDByCode(tx, typeCode)
+		if errors.Is(err, sql.ErrNoRows) {
+			return newValidationError(fmt.Sprintf(errMsgUnknownAssessmentType, rowNum, typeCode))
+		}
+		if err != nil {
+			return err
+		}
+
+		weight, err := strconv.ParseFloat(strings.Replace(weightStr, ",", ".", 1), 64)
+		if err != nil || weight < 0 {
+			return newValidationError(fmt.Sprintf(errMsgInvalidWeight, rowNum, weightStr))
+		}
+
+		if err := imp.assessmentRepo.SetSubjectWeight(tx, subjectID, assessmentTypeID, weight); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ImportRatingRules applies per-subject rating rules: weights of the grade and
+// attendance components and the thresholds for exam admission.
+func (imp *CSVImporter) ImportRatingRules(filePath string) error {
+	records, err := readCSV(filePath)
+	if err != nil {
+		return err
+	}
+
+	tx, err := imp.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	columns := records[0]
+
+	for i := 1; i < len(records); i++ {
+		record := records[i]
+		rowNum := i + 1
+
+		subjectName := strings.TrimSpace(record[0])
+		subjectID, err := imp.subjectIDByName(tx, rowNum, subjectName)
 		if err != nil {
 			return err
 		}
+
+		values := make([]float64, 4)
+		for j := range values {
+			raw := strings.TrimSpace(record[j+1])
+			value, err := strconv.ParseFloat(strings.Replace(raw, ",", ".", 1), 64)
+			if err != nil || value < 0 {
+				return newValidationError(fmt.Sprintf(errMsgInvalidNumber, rowNum, raw, columns[j+1]))
+			}
+			if j >= 2 && value > 100 {
+				return newValidationError(fmt.Sprintf(errMsgInvalidPercent, rowNum, raw, columns[j+1]))
+			}
+			values[j] = value
+		}
+
+		if values[0] == 0 && values[1] == 0 {
+			return newValidationError(fmt.Sprintf(errMsgZeroRatingWeights, rowNum))
+		}
+
+		rule := database.RatingRule{
+			SubjectID:            subjectID,
+			GradeWeight:          values[0],
+			AttendanceWeight:     values[1],
+			MinAttendancePercent: values[2],
+			MinRating:            values[3],
+		}
+		if err := imp.ratingRuleRepo.SetRatingRule(tx, rule); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (imp *CSVImporter) ImportHolidays(filePath string) error {
+	records, err := readCSV(filePath)
+	if err != nil {
+		return err
+	}
+
+	tx, err := imp.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i := 1; i < len(records); i++ {
+		record := records[i]
+		rowNum := i + 1
+
+		rawDate := strings.TrimSpace(record[0])
+		date, err := parseJournalDate(rawDate)
+		if err != nil {
+			return newValidationError(fmt.Sprintf(errMsgInvalidDate, rowNum, rawDate))
+		}
+
+		title := strings.TrimSpace(record[1])
+		if title == "" {
+			return newValidationError(fmt.Sprintf(errMsgEmptyHolidayTitle, rowNum))
+		}
+
+		if err := imp.holidayRepo.SetHoliday(tx, date, title); err != nil {
+			return err
+		}
 	}
 
 	return tx.Commit()
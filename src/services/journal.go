@@ -0,0 +1,265 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"digitalUniversity/database"
+	"digitalUniversity/grading"
+)
+
+const (
+	errMsgUnknownGroup      = "Строка %d: группа %q не найдена."
+	errMsgNotTeacherSubject = "Строка %d: предмет %q в группе %q не закреплён за вами."
+	errMsgInvalidDate       = "Строка %d: некорректная дата %q. Используйте формат ДД.ММ.ГГГГ."
+	errMsgInvalidTime       = "Строка %d: некорректное время %q. Используйте формат ЧЧ:ММ."
+	errMsgFutureDate        = "Строка %d: дата %s ещё не наступила."
+	errMsgNoLesson          = "Строка %d: в расписании нет занятия по предмету %q у группы %q на %s%s."
+	errMsgAmbiguousLesson   = "Строка %d: на %s несколько занятий по предмету %q — укажите start_time."
+	errMsgUnknownStudent    = "Строка %d: студент %q не найден в группе %q."
+	errMsgAmbiguousStudent  = "Строка %d: в группе %q несколько студентов %q — укажите имя или Max ID."
+	errMsgInvalidGrade      = "Строка %d: оценка %q не соответствует шкале предмета (%s)."
+	errMsgInvalidStatus     = "Строка %d: некорректный статус %q. Используйте 1/0, +/-, был/не был."
+)
+
+var journalDateLayouts = []string{"02.01.2006", "2006-01-02", "02.01.06"}
+
+var attendanceStatuses = map[string]bool{
+	"1": true, "+": true, "да": true, "был": true, "была": true, "п": true, "present": true,
+	"0": false, "-": false, "нет": false, "не был": false, "не была": false, "н": false, "absent": false,
+}
+
+type journalLesson struct {
+	studentID  int64
+	subjectID  int64
+	scheduleID int64
+	date       time.Time
+}
+
+// ImportGradeJournal imports grades from a teacher's journal. Every row must
+// refer to a subject the teacher leads, a student of the group and an existing
+// lesson on the given date. A grade already given for the same lesson date
+// and assessment type is replaced, so the journal can be uploaded again.
+func (imp *CSVImporter) ImportGradeJournal(filePath string, teacherID int64) error {
+	records, err := readCSV(filePath)
+	if err != nil {
+		return err
+	}
+
+	tx, err := imp.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i := 1; i < len(records); i++ {
+		record := records[i]
+		rowNum := i + 1
+
+		lesson, err := imp.resolveJournalRow(tx, teacherID, rowNum, record)
+		if err != nil {
+			return err
+		}
+
+		var assessmentTypeID *int64
+		if typeCode := strings.TrimSpace(record[5]); typeCode != "" {
+			id, err := imp.assessmentRepo.GetAssessmentTypeIDByCode(tx, typeCode)
+			if errors.Is(err, sql.ErrNoRows) {
+				return newValidationError(fmt.Sprintf(errMsgUnknownAssessmentType, rowNum, typeCode))
+			}
+			if err != nil {
+				return err
+			}
+			assessmentTypeID = &id
+		}
+
+		scaleName, err := imp.subjectRepo.GetSubjectGradingScale(lesson.subjectID)
+		if err != nil {
+			return err
+		}
+		scale := grading.GetScale(scaleName)
+
+		rawValue := strings.TrimSpace(record[6])
+		value, ok := scale.ParseValue(rawValue)
+		if !ok {
+			return newValidationError(fmt.Sprintf(errMsgInvalidGrade, rowNum, rawValue, scale.Title))
+		}
+
+		err = imp.gradeRepo.UpsertGradeForDate(tx, database.Grade{
+			StudentID:        lesson.studentID,
+			TeacherID:        teacherID,
+			SubjectID:        lesson.subjectID,
+			ScheduleID:       lesson.scheduleID,
+			AssessmentTypeID: assessmentTypeID,
+			GradeValue:       value,
+			GradeDate:        lesson.date,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ImportAttendanceJournal imports attendance marks from a teacher's journal.
+// A repeated mark for the same student and lesson date overwrites the earlier one.
+func (imp *CSVImporter) ImportAttendanceJournal(filePath string, teacherID int64) error {
+	records, err := readCSV(filePath)
+	if err != nil {
+		return err
+	}
+
+	tx, err := imp.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i := 1; i < len(records); i++ {
+		record := records[i]
+		rowNum := i + 1
+
+		lesson, err := imp.resolveJournalRow(tx, teacherID, rowNum, record)
+		if err != nil {
+			return err
+		}
+
+		rawStatus := strings.TrimSpace(record[5])
+		attended, ok := attendanceStatuses[strings.ToLower(rawStatus)]
+		if !ok {
+			return newValidationError(fmt.Sprintf(errMsgInvalidStatus, rowNum, rawStatus))
+		}
+
+		err = imp.attendanceRepo.MarkAttendanceForDate(tx, lesson.studentID, lesson.scheduleID, attended, lesson.date)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// resolveJournalRow validates the common journal columns (student, group,
+// subject, date, start time) and resolves them to database identifiers.
+func (imp *CSVImporter) resolveJournalRow(tx *sqlx.Tx, teacherID int64, rowNum int, record []string) (journalLesson, error) {
+	var lesson journalLesson
+
+	student := strings.TrimSpace(record[0])
+	groupName := strings.TrimSpace(record[1])
+	subjectName := strings.TrimSpace(record[2])
+	rawDate := strings.TrimSpace(record[3])
+	startTime := strings.TrimSpace(record[4])
+
+	groupID, err := imp.groupRepo.GetGroupIDByName(tx, groupName)
+	if errors.Is(err, sql.ErrNoRows) {
+		return lesson, newValidationError(fmt.Sprintf(errMsgUnknownGroup, rowNum, groupName))
+	}
+	if err != nil {
+		return lesson, err
+	}
+
+	lesson.subjectID, err = imp.subjectRepo.GetTeacherSubjectIDForGroup(tx, subjectName, teacherID, groupID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return lesson, newValidationError(fmt.Sprintf(errMsgNotTeacherSubject, rowNum, subjectName, groupName))
+	}
+	if err != nil {
+		return lesson, err
+	}
+
+	lesson.date, err = parseJournalDate(rawDate)
+	if err != nil {
+		return lesson, newValidationError(fmt.Sprintf(errMsgInvalidDate, rowNum, rawDate))
+	}
+	if lesson.date.After(time.Now()) {
+		return lesson, newValidationError(fmt.Sprintf(errMsgFutureDate, rowNum, rawDate))
+	}
+
+	if startTime != "" {
+		if _, err := time.Parse("15:04", startTime); err != nil {
+			return lesson, newValidationError(fmt.Sprintf(errMsgInvalidTime, rowNum, startTime))
+		}
+	}
+
+	weekday := int16(lesson.date.Weekday())
+	if weekday == 0 {
+		weekday = 7
+	}
+
+	lessons, err := imp.scheduleRepo.FindLessons(tx, lesson.subjectID, groupID, weekday, startTime)
+	if err != nil {
+		return lesson, err
+	}
+
+	switch {
+	case len(lessons) == 0:
+		at := ""
+		if startTime != "" {
+			at = " в " + startTime
+		}
+		return lesson, newValidationError(fmt.Sprintf(errMsgNoLesson, rowNum, subjectName, groupName, rawDate, at))
+	case len(lessons) > 1:
+		return lesson, newValidationError(fmt.Sprintf(errMsgAmbiguousLesson, rowNum, rawDate, subjectName))
+	}
+	lesson.scheduleID = lessons[0].ScheduleID
+
+	lesson.studentID, err = imp.resolveJournalStudent(tx, rowNum, student, groupID, groupName)
+	if err != nil {
+		return lesson, err
+	}
+
+	return lesson, nil
+}
+
+// resolveJournalStudent accepts either a Max user ID or "Фамилия [Имя]".
+func (imp *CSVImporter) resolveJournalStudent(tx *sqlx.Tx, rowNum int, student string, groupID int64, groupName string) (int64, error) {
+	if userMaxID, err := strconv.ParseInt(student, 10, 64); err == nil {
+		studentID, err := imp.userRepo.GetStudentIDInGroupByMaxID(tx, userMaxID, groupID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, newValidationError(fmt.Sprintf(errMsgUnknownStudent, rowNum, student, groupName))
+		}
+		return studentID, err
+	}
+
+	names := strings.Fields(student)
+	if len(names) == 0 {
+		return 0, newValidationError(fmt.Sprintf(errMsgUnknownStudent, rowNum, student, groupName))
+	}
+
+	firstName := ""
+	if len(names) > 1 {
+		firstName = names[1]
+	}
+
+	studentIDs, err := imp.userRepo.GetStudentIDsInGroupByName(tx, groupID, names[0], firstName)
+	if err != nil {
+		return 0, err
+	}
+
+	switch len(studentIDs) {
+	case 0:
+		return 0, newValidationError(fmt.Sprintf(errMsgUnknownStudent, rowNum, student, groupName))
+	case 1:
+		return studentIDs[0], nil
+	default:
+		return 0, newValidationError(fmt.Sprintf(errMsgAmbiguousStudent, rowNum, groupName, student))
+	}
+}
+
+func parseJournalDate(value string) (time.Time, error) {
+	var lastErr error
+	for _, layout := range journalDateLayouts {
+		date, err := time.ParseInLocation(layout, value, time.Local)
+		if err == nil {
+			return date, nil
+		}
+		lastErr = err
+	}
+	return time.Time{}, lastErr
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"digitalUniversity/database"
+)
+
+const (
+	ScheduleConflictTeacher = "teacher"
+	ScheduleConflictRoom    = "room"
+	ScheduleConflictGroup   = "group"
+
+	conflictTeacherReason = "преподаватель %s ведёт два занятия одновременно"
+	conflictRoomReason    = "в аудитории %s два занятия одновременно"
+	conflictGroupReason   = "у группы %s два занятия одновременно"
+
+	errMsgScheduleConflicts       = "Занятия пересекаются, расписание не загружено:\n\n%s"
+	errMsgScheduleConflictRows    = "Строки %d и %d: %s."
+	errMsgScheduleConflictCurrent = "Строка %d: %s — пересекается с занятием «%s» группы %s, которое остаётся в расписании."
+	errMsgScheduleConflictsMore   = "…и ещё пересечений: %d"
+
+	maxImportConflictLines = 10
+)
+
+// ScheduleConflict is a pair of lessons that overlap in time and share a
+// teacher, a room or a group.
+type ScheduleConflict struct {
+	Kind   string
+	First  *database.ScheduleLesson
+	Second *database.ScheduleLesson
+}
+
+// Reason describes the conflict in a sentence fragment, e.g. "в аудитории
+// А-101 два занятия одновременно".
+func (c ScheduleConflict) Reason() string {
+	switch c.Kind {
+	case ScheduleConflictTeacher:
+		return fmt.Sprintf(conflictTeacherReason, c.First.TeacherName)
+	case ScheduleConflictRoom:
+		return fmt.Sprintf(conflictRoomReason, c.First.ClassRoom)
+	default:
+		return fmt.Sprintf(conflictGroupReason, c.First.GroupName)
+	}
+}
+
+// FindScheduleConflicts returns the conflicting pairs of the lessons. A pair
+// is reported once, by the first matching kind: teacher, room, then group.
+func FindScheduleConflicts(lessons []database.ScheduleLesson) []ScheduleConflict {
+	var conflicts []ScheduleConflict
+	for i := range lessons {
+		for j := i + 1; j < len(lessons); j++ {
+			if kind := lessonConflict(&lessons[i], &lessons[j]); kind != "" {
+				conflicts = append(conflicts, ScheduleConflict{Kind: kind, First: &lessons[i], Second: &lessons[j]})
+			}
+		}
+	}
+	return conflicts
+}
+
+// FindLessonConflicts returns the conflicts of one lesson with the schedule.
+// The lesson itself, matched by ID, is skipped, so it may be a changed copy
+// of a lesson from the schedule.
+func FindLessonConflicts(lesson database.ScheduleLesson, schedule []database.ScheduleLesson) []ScheduleConflict {
+	var conflicts []ScheduleConflict
+	for i := range schedule {
+		other := &schedule[i]
+		if lesson.ScheduleID != 0 && other.ScheduleID == lesson.ScheduleID {
+			continue
+		}
+		if kind := lessonConflict(&lesson, other); kind != "" {
+			conflicts = append(conflicts, ScheduleConflict{Kind: kind, First: &lesson, Second: other})
+		}
+	}
+	return conflicts
+}
+
+// lessonConflict returns the kind of conflict between two lessons or an
+// empty string. A lecture given to several groups at once in one room and a
+// group split into subgroups for the same class are not conflicts.
+func lessonConflict(a, b *database.ScheduleLesson) string {
+	if a.Weekday != b.Weekday || !overlaps(a, b) {
+		return ""
+	}
+
+	sameRoom := a.ClassRoom != "" && strings.EqualFold(strings.TrimSpace(a.ClassRoom), strings.TrimSpace(b.ClassRoom))
+	sameClass := sameSubject(a, b) && a.LessonTypeID == b.LessonTypeID && sameSlot(a, b)
+
+	switch {
+	case a.TeacherID == b.TeacherID:
+		if sameClass && sameRoom && a.GroupID != b.GroupID {
+			return ""
+		}
+		return ScheduleConflictTeacher
+	case sameRoom:
+		return ScheduleConflictRoom
+	case a.GroupID == b.GroupID && !sameClass:
+		return ScheduleConflictGroup
+	default:
+		return ""
+	}
+}
+
+func overlaps(a, b *database.ScheduleLesson) bool {
+	return a.StartTime.Format(lessonTimeFormat) < b.EndTime.Format(lessonTimeFormat) &&
+		b.StartTime.Format(lessonTimeFormat) < a.EndTime.Format(lessonTimeFormat)
+}
+
+func sameSlot(a, b *database.ScheduleLesson) bool {
+	return a.StartTime.Format(lessonTimeFormat) == b.StartTime.Format(lessonTimeFormat) &&
+		a.EndTime.Format(lessonTimeFormat) == b.EndTime.Format(lessonTimeFormat)
+}
+
+// importConflictsError lists the conflicts of an imported schedule with the
+// file rows of its lessons. rows maps an imported lesson to its row; lessons
+// without a row stay in the schedule from before the import. Every conflict
+// involves at least one imported lesson.
+func importConflictsError(conflicts []ScheduleConflict, rows map[*database.ScheduleLesson]int) error {
+	var lines []string
+	for i, c := range conflicts {
+		if i == maxImportConflictLines {
+			lines = append(lines, fmt.Sprintf(errMsgScheduleConflictsMore, len(conflicts)-maxImportConflictLines))
+			break
+		}
+
+		first, firstImported := rows[c.First]
+		second, secondImported := rows[c.Second]
+		switch {
+		case firstImported && secondImported:
+			lines = append(lines, fmt.Sprintf(errMsgScheduleConflictRows, first, second, c.Reason()))
+		case firstImported:
+			lines = append(lines, fmt.Sprintf(errMsgScheduleConflictCurrent, first, c.Reason(), c.Second.SubjectName, c.Second.GroupName))
+		default:
+			lines = append(lines, fmt.Sprintf(errMsgScheduleConflictCurrent, second, c.Reason(), c.First.SubjectName, c.First.GroupName))
+		}
+	}
+	return newValidationError(fmt.Sprintf(errMsgScheduleConflicts, strings.Join(lines, "\n")))
+}
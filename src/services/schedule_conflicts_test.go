@@ -0,0 +1,153 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"digitalUniversity/database"
+)
+
+func conflictLesson(id, groupID, teacherID int64, room, subject, start, end string) database.ScheduleLesson {
+	l := testLesson(id, 1, start, end, room, id*100, teacherID, subject)
+	l.GroupID = groupID
+	return l
+}
+
+func TestLessonConflict(t *testing.T) {
+	base := conflictLesson(1, 1, 7, "А-101", "Математика", "09:00", "10:30")
+
+	otherDay := conflictLesson(2, 2, 7, "А-101", "Физика", "09:00", "10:30")
+	otherDay.Weekday = 2
+
+	tests := []struct {
+		name  string
+		other database.ScheduleLesson
+		want  string
+	}{
+		{
+			name:  "another day",
+			other: otherDay,
+			want:  "",
+		},
+		{
+			name:  "back to back",
+			other: conflictLesson(2, 1, 7, "А-101", "Физика", "10:30", "12:00"),
+			want:  "",
+		},
+		{
+			name:  "teacher in two groups",
+			other: conflictLesson(2, 2, 7, "Б-202", "Математика", "10:00", "11:30"),
+			want:  ScheduleConflictTeacher,
+		},
+		{
+			name:  "lecture for two groups",
+			other: conflictLesson(2, 2, 7, "а-101 ", "Математика", "09:00", "10:30"),
+			want:  "",
+		},
+		{
+			name:  "lecture for two groups in two rooms",
+			other: conflictLesson(2, 2, 7, "Б-202", "Математика", "09:00", "10:30"),
+			want:  ScheduleConflictTeacher,
+		},
+		{
+			name:  "shared room",
+			other: conflictLesson(2, 2, 8, " а-101", "Физика", "10:00", "11:30"),
+			want:  ScheduleConflictRoom,
+		},
+		{
+			name:  "no rooms",
+			other: conflictLesson(2, 2, 8, "", "Физика", "09:00", "10:30"),
+			want:  "",
+		},
+		{
+			name:  "group in two places",
+			other: conflictLesson(2, 1, 8, "Б-202", "Физика", "10:00", "11:30"),
+			want:  ScheduleConflictGroup,
+		},
+		{
+			name:  "subgroups with two teachers",
+			other: conflictLesson(2, 1, 8, "Б-202", "математика", "09:00", "10:30"),
+			want:  "",
+		},
+		{
+			name:  "subgroups at different times",
+			other: conflictLesson(2, 1, 8, "Б-202", "Математика", "09:30", "11:00"),
+			want:  ScheduleConflictGroup,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := base, tt.other
+			if got := lessonConflict(&a, &b); got != tt.want {
+				t.Errorf("lessonConflict() = %q, want %q", got, tt.want)
+			}
+			if got := lessonConflict(&b, &a); got != tt.want {
+				t.Errorf("lessonConflict() swapped = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindScheduleConflicts(t *testing.T) {
+	lessons := []database.ScheduleLesson{
+		conflictLesson(1, 1, 7, "А-101", "Математика", "09:00", "10:30"),
+		conflictLesson(2, 2, 7, "Б-202", "Физика", "09:00", "10:30"),
+		conflictLesson(3, 3, 8, "Б-202", "История", "10:00", "11:30"),
+		conflictLesson(4, 1, 9, "В-303", "Химия", "12:00", "13:30"),
+	}
+
+	conflicts := FindScheduleConflicts(lessons)
+	want := []struct {
+		kind          string
+		first, second int64
+	}{
+		{ScheduleConflictTeacher, 1, 2},
+		{ScheduleConflictRoom, 2, 3},
+	}
+	if len(conflicts) != len(want) {
+		t.Fatalf("got %d conflicts, want %d", len(conflicts), len(want))
+	}
+	for i, c := range conflicts {
+		if c.Kind != want[i].kind || c.First.ScheduleID != want[i].first || c.Second.ScheduleID != want[i].second {
+			t.Errorf("conflict %d: got %s %d–%d, want %s %d–%d", i,
+				c.Kind, c.First.ScheduleID, c.Second.ScheduleID, want[i].kind, want[i].first, want[i].second)
+		}
+	}
+}
+
+func TestFindLessonConflictsSkipsItself(t *testing.T) {
+	schedule := []database.ScheduleLesson{
+		conflictLesson(1, 1, 7, "А-101", "Математика", "09:00", "10:30"),
+		conflictLesson(2, 2, 8, "Б-202", "Физика", "12:00", "13:30"),
+	}
+
+	moved := schedule[0]
+	moved.StartTime, moved.EndTime = schedule[1].StartTime, schedule[1].EndTime
+	moved.ClassRoom = "Б-202"
+
+	conflicts := FindLessonConflicts(moved, schedule)
+	if len(conflicts) != 1 || conflicts[0].Second.ScheduleID != 2 || conflicts[0].Kind != ScheduleConflictRoom {
+		t.Fatalf("got %+v, want one room conflict with lesson 2", conflicts)
+	}
+
+	unchanged := FindLessonConflicts(schedule[0], schedule)
+	if len(unchanged) != 0 {
+		t.Errorf("lesson conflicts with itself: %+v", unchanged)
+	}
+}
+
+func TestImportConflictsError(t *testing.T) {
+	imported := conflictLesson(0, 1, 7, "А-101", "Математика", "09:00", "10:30")
+	imported.TeacherName = "Иванов И."
+	kept := conflictLesson(5, 2, 7, "Б-202", "Физика", "10:00", "11:30")
+	kept.GroupName = "ФИЗ-11"
+
+	conflicts := FindLessonConflicts(imported, []database.ScheduleLesson{kept})
+	err := importConflictsError(conflicts, map[*database.ScheduleLesson]int{conflicts[0].First: 3})
+
+	want := "Строка 3: преподаватель Иванов И. ведёт два занятия одновременно — пересекается с занятием «Физика» группы ФИЗ-11, которое остаётся в расписании."
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("got %v, want it to contain %q", err, want)
+	}
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"digitalUniversity/database"
+)
+
+const (
+	ScheduleChangeAdded   = "added"
+	ScheduleChangeRemoved = "removed"
+	ScheduleChangeMoved   = "moved"
+
+	lessonTimeFormat = "15:04"
+)
+
+// ScheduleChange is a lesson added, removed or moved by a schedule import.
+// Before is nil for added lessons and After is nil for removed ones.
+type ScheduleChange struct {
+	Kind   string
+	Before *database.ScheduleLesson
+	After  *database.ScheduleLesson
+}
+
+// ScheduleChangeHandler receives the changes of a schedule import inside its
+// transaction; an error rolls the import back.
+type ScheduleChangeHandler func(tx *sqlx.Tx, changes []ScheduleChange) error
+
+// diffLessons compares a group's current timetable with the imported one.
+// Identical lessons are matched first; the rest are paired by subject name and
+// lesson type in timetable order, and whatever stays unpaired was added or
+// removed.
+func diffLessons(current, imported []database.ScheduleLesson) []ScheduleChange {
+	imported = slices.Clone(imported)
+	slices.SortStableFunc(imported, compareLessons)
+
+	remaining := make([]*database.ScheduleLesson, len(current))
+	for i := range current {
+		remaining[i] = &current[i]
+	}
+
+	var unmatched []*database.ScheduleLesson
+	for i := range imported {
+		lesson := &imported[i]
+		idx := slices.IndexFunc(remaining, func(old *database.ScheduleLesson) bool {
+			return sameLesson(old, lesson)
+		})
+		if idx < 0 {
+			unmatched = append(unmatched, lesson)
+			continue
+		}
+		remaining = slices.Delete(remaining, idx, idx+1)
+	}
+
+	var changes []ScheduleChange
+	for _, lesson := range unmatched {
+		idx := slices.IndexFunc(remaining, func(old *database.ScheduleLesson) bool {
+			return sameCourse(old, lesson)
+		})
+		if idx < 0 {
+			changes = append(changes, ScheduleChange{Kind: ScheduleChangeAdded, After: lesson})
+			continue
+		}
+
+		old := remaining[idx]
+		remaining = slices.Delete(remaining, idx, idx+1)
+		lesson.ScheduleID = old.ScheduleID
+		changes = append(changes, ScheduleChange{Kind: ScheduleChangeMoved, Before: old, After: lesson})
+	}
+
+	for _, old := range remaining {
+		changes = append(changes, ScheduleChange{Kind: ScheduleChangeRemoved, Before: old})
+	}
+
+	return changes
+}
+
+func sameCourse(a, b *database.ScheduleLesson) bool {
+	return a.GroupID == b.GroupID && a.LessonTypeID == b.LessonTypeID && sameSubject(a, b)
+}
+
+// sameSubject compares subjects by name: subjects belong to a teacher, so a
+// substitute teacher's lesson has another subject ID but is the same course.
+func sameSubject(a, b *database.ScheduleLesson) bool {
+	return strings.EqualFold(strings.TrimSpace(a.SubjectName), strings.TrimSpace(b.SubjectName))
+}
+
+func sameLesson(a, b *database.ScheduleLesson) bool {
+	return sameCourse(a, b) &&
+		a.Weekday == b.Weekday &&
+		a.StartTime.Format(lessonTimeFormat) == b.StartTime.Format(lessonTimeFormat) &&
+		a.EndTime.Format(lessonTimeFormat) == b.EndTime.Format(lessonTimeFormat) &&
+		strings.EqualFold(strings.TrimSpace(a.ClassRoom), strings.TrimSpace(b.ClassRoom)) &&
+		a.SubjectID == b.SubjectID &&
+		a.TeacherID == b.TeacherID
+}
+
+func compareLessons(a, b database.ScheduleLesson) int {
+	if a.Weekday != b.Weekday {
+		return int(a.Weekday) - int(b.Weekday)
+	}
+	return strings.Compare(a.StartTime.Format(lessonTimeFormat), b.StartTime.Format(lessonTimeFormat))
+}
+
+// parseLessonTime accepts lesson times with or without seconds.
+func parseLessonTime(rowNum int, value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{lessonTimeFormat, "15:04:05"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, newValidationError(fmt.Sprintf(errMsgInvalidTime, rowNum, value))
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"digitalUniversity/database"
+)
+
+func testLesson(id int64, weekday int16, start, end, room string, subjectID, teacherID int64, subject string) database.ScheduleLesson {
+	startTime, _ := time.Parse(lessonTimeFormat, start)
+	endTime, _ := time.Parse(lessonTimeFormat, end)
+	return database.ScheduleLesson{
+		Schedule: database.Schedule{
+			ScheduleID:   id,
+			Weekday:      weekday,
+			StartTime:    startTime,
+			EndTime:      endTime,
+			ClassRoom:    room,
+			SubjectID:    subjectID,
+			TeacherID:    teacherID,
+			GroupID:      1,
+			LessonTypeID: 1,
+		},
+		SubjectName: subject,
+	}
+}
+
+func TestDiffLessons(t *testing.T) {
+	maths := testLesson(10, 1, "09:00", "10:30", "101", 100, 7, "Математика")
+	physics := testLesson(11, 2, "10:40", "12:10", "202", 200, 8, "Физика")
+
+	movedMaths := maths
+	movedMaths.ScheduleID = 0
+	movedMaths.Weekday = 3
+
+	substitute := maths
+	substitute.ScheduleID = 0
+	substitute.SubjectID = 300
+	substitute.TeacherID = 9
+
+	otherCase := maths
+	otherCase.ScheduleID = 0
+	otherCase.SubjectName = " математика "
+	otherCase.ClassRoom = "105"
+
+	lab := maths
+	lab.ScheduleID = 0
+	lab.LessonTypeID = 2
+
+	tests := []struct {
+		name     string
+		current  []database.ScheduleLesson
+		imported []database.ScheduleLesson
+		want     []string
+	}{
+		{
+			name:     "unchanged",
+			current:  []database.ScheduleLesson{maths, physics},
+			imported: []database.ScheduleLesson{physics, maths},
+			want:     nil,
+		},
+		{
+			name:     "moved to another day",
+			current:  []database.ScheduleLesson{maths, physics},
+			imported: []database.ScheduleLesson{movedMaths, physics},
+			want:     []string{ScheduleChangeMoved},
+		},
+		{
+			name:     "substitute teacher",
+			current:  []database.ScheduleLesson{maths},
+			imported: []database.ScheduleLesson{substitute},
+			want:     []string{ScheduleChangeMoved},
+		},
+		{
+			name:     "subject name in another case",
+			current:  []database.ScheduleLesson{maths},
+			imported: []database.ScheduleLesson{otherCase},
+			want:     []string{ScheduleChangeMoved},
+		},
+		{
+			name:     "other lesson type",
+			current:  []database.ScheduleLesson{maths},
+			imported: []database.ScheduleLesson{lab},
+			want:     []string{ScheduleChangeAdded, ScheduleChangeRemoved},
+		},
+		{
+			name:     "removed",
+			current:  []database.ScheduleLesson{maths, physics},
+			imported: []database.ScheduleLesson{maths},
+			want:     []string{ScheduleChangeRemoved},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := diffLessons(tt.current, tt.imported)
+			if len(changes) != len(tt.want) {
+				t.Fatalf("got %d changes, want %d: %+v", len(changes), len(tt.want), changes)
+			}
+			for i, change := range changes {
+				if change.Kind != tt.want[i] {
+					t.Errorf("change %d: got %s, want %s", i, change.Kind, tt.want[i])
+				}
+				if change.Kind == ScheduleChangeMoved && change.After.ScheduleID != change.Before.ScheduleID {
+					t.Errorf("change %d: moved lesson got schedule ID %d, want %d",
+						i, change.After.ScheduleID, change.Before.ScheduleID)
+				}
+			}
+		})
+	}
+}
+
+func TestDiffLessonsSubstituteKeepsTeachers(t *testing.T) {
+	maths := testLesson(10, 1, "09:00", "10:30", "101", 100, 7, "Математика")
+	substitute := testLesson(0, 1, "09:00", "10:30", "101", 300, 9, "Математика")
+
+	changes := diffLessons([]database.ScheduleLesson{maths}, []database.ScheduleLesson{substitute})
+	if len(changes) != 1 {
+		t.Fatalf("got %d changes, want 1", len(changes))
+	}
+	change := changes[0]
+	if change.Before.TeacherID != 7 || change.After.TeacherID != 9 {
+		t.Errorf("got teachers %d → %d, want 7 → 9", change.Before.TeacherID, change.After.TeacherID)
+	}
+	if change.After.SubjectID != 300 {
+		t.Errorf("got subject %d, want the substitute's subject 300", change.After.SubjectID)
+	}
+}
@@ -13,6 +13,12 @@ const (
 	FileTypeStudents FileType = "students"
 	FileTypeTeachers FileType = "teachers"
 	FileTypeSchedule FileType = "schedule"
+	FileTypeGrading  FileType = "grading"
+	FileTypeRating   FileType = "rating"
+	FileTypeHolidays FileType = "holidays"
+
+	FileTypeGradeJournal      FileType = "grade_journal"
+	FileTypeAttendanceJournal FileType = "attendance_journal"
 )
 
 const (
@@ -29,6 +35,20 @@ var expectedHeaders = map[FileType][]string{
 		"subject_name", "type_name", "classroom", "group_name",
 		"teacher_last_name", "teacher_first_name", "weekday", "start_time", "end_time",
 	},
+	FileTypeGrading:  {"subject_name", "grading_scale", "assessment_type", "weight"},
+	FileTypeRating:   {"subject_name", "grade_weight", "attendance_weight", "min_attendance_percent", "min_rating"},
+	FileTypeHolidays: {"date", "title"},
+	FileTypeGradeJournal: {
+		"student", "group_name", "subject_name", "date", "start_time", "assessment_type", "value",
+	},
+	FileTypeAttendanceJournal: {
+		"student", "group_name", "subject_name", "date", "start_time", "status",
+	},
+}
+
+// optionalHeaders are trailing columns a file may have after the expected ones.
+var optionalHeaders = map[FileType][]string{
+	FileTypeTeachers: {"Curator_groups"},
 }
 
 type ValidationError struct {
@@ -90,7 +110,8 @@ func validateHeaders(actualHeaders []string, fileType FileType) error {
 		return fmt.Errorf("unknown file type: %s", fileType)
 	}
 
-	if !headersMatch(actualHeaders, expected) {
+	if !headersMatch(actualHeaders, expected) &&
+		!headersMatch(actualHeaders, append(expected[:len(expected):len(expected)], optionalHeaders[fileType]...)) {
 		return newValidationError(
 			fmt.Sprintf(errMsgInvalidStructure, fileType, expected, actualHeaders),
 		)
@@ -0,0 +1,182 @@
+// Package xlsx writes minimal Office Open XML spreadsheets: sheets of text
+// and number cells without styles, enough for reports opened in Excel or
+// LibreOffice.
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const maxSheetNameLen = 31
+
+// Sheet is a named table. Cells may be strings, integers, floats or nil for
+// an empty cell; anything else is written with fmt.Sprint.
+type Sheet struct {
+	Name string
+	Rows [][]any
+}
+
+// Write encodes the sheets as an XLSX workbook.
+func Write(w io.Writer, sheets []Sheet) error {
+	if len(sheets) == 0 {
+		return fmt.Errorf("xlsx: no sheets")
+	}
+
+	zw := zip.NewWriter(w)
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", contentTypes(len(sheets))},
+		{"_rels/.rels", rootRels},
+		{"xl/workbook.xml", workbook(sheets)},
+		{"xl/_rels/workbook.xml.rels", workbookRels(len(sheets))},
+	}
+	for i, sheet := range sheets {
+		files = append(files, struct {
+			name    string
+			content string
+		}{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), worksheet(sheet.Rows)})
+	}
+
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, f.content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// Bytes returns the workbook as a byte slice.
+func Bytes(sheets []Sheet) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := Write(&buf, sheets); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+const rootRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+func contentTypes(sheets int) string {
+	var sb strings.Builder
+	sb.WriteString(xml.Header)
+	sb.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	sb.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	sb.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	sb.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	for i := 1; i <= sheets; i++ {
+		fmt.Fprintf(&sb, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i)
+	}
+	sb.WriteString(`</Types>`)
+	return sb.String()
+}
+
+func workbook(sheets []Sheet) string {
+	var sb strings.Builder
+	sb.WriteString(xml.Header)
+	sb.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	for i, sheet := range sheets {
+		fmt.Fprintf(&sb, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, escape(sheetName(sheet.Name, i)), i+1, i+1)
+	}
+	sb.WriteString(`</sheets></workbook>`)
+	return sb.String()
+}
+
+func workbookRels(sheets int) string {
+	var sb strings.Builder
+	sb.WriteString(xml.Header)
+	sb.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i := 1; i <= sheets; i++ {
+		fmt.Fprintf(&sb, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i, i)
+	}
+	sb.WriteString(`</Relationships>`)
+	return sb.String()
+}
+
+func worksheet(rows [][]any) string {
+	var sb strings.Builder
+	sb.WriteString(xml.Header)
+	sb.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for r, row := range rows {
+		fmt.Fprintf(&sb, `<row r="%d">`, r+1)
+		for c, value := range row {
+			writeCell(&sb, cellRef(c, r), value)
+		}
+		sb.WriteString(`</row>`)
+	}
+	sb.WriteString(`</sheetData></worksheet>`)
+	return sb.String()
+}
+
+func writeCell(sb *strings.Builder, ref string, value any) {
+	var number string
+	switch v := value.(type) {
+	case nil:
+		return
+	case int:
+		number = strconv.Itoa(v)
+	case int64:
+		number = strconv.FormatInt(v, 10)
+	case float64:
+		number = strconv.FormatFloat(v, 'f', -1, 64)
+	case *float64:
+		if v == nil {
+			return
+		}
+		number = strconv.FormatFloat(*v, 'f', -1, 64)
+	case string:
+		fmt.Fprintf(sb, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, escape(v))
+		return
+	default:
+		fmt.Fprintf(sb, `<c r="%s" t="inlineStr"><is><t>%s</t></is></c>`, ref, escape(fmt.Sprint(v)))
+		return
+	}
+	fmt.Fprintf(sb, `<c r="%s"><v>%s</v></c>`, ref, number)
+}
+
+// cellRef converts zero-based column and row numbers to a reference like B3.
+func cellRef(col, row int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name + strconv.Itoa(row+1)
+}
+
+// sheetName drops the characters Excel does not allow in sheet names and
+// trims the name to its length limit.
+func sheetName(name string, index int) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return -1
+		}
+		return r
+	}, name)
+	if runes := []rune(name); len(runes) > maxSheetNameLen {
+		name = string(runes[:maxSheetNameLen])
+	}
+	if strings.TrimSpace(name) == "" {
+		name = fmt.Sprintf("Sheet%d", index+1)
+	}
+	return name
+}
+
+func escape(s string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
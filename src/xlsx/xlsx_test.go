@@ -0,0 +1,124 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// readParts unpacks a workbook into the names and contents of its parts, in
+// archive order, checking that every part is well-formed XML.
+func readParts(t *testing.T, data []byte) string {
+	t.Helper()
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+
+	var sb strings.Builder
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", f.Name, err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("read %s: %v", f.Name, err)
+		}
+
+		dec := xml.NewDecoder(bytes.NewReader(content))
+		for {
+			if _, err := dec.Token(); err != nil {
+				if !errors.Is(err, io.EOF) {
+					t.Errorf("%s is not well-formed: %v", f.Name, err)
+				}
+				break
+			}
+		}
+
+		sb.WriteString("== " + f.Name + " ==\n")
+		sb.Write(content)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func TestWriteGolden(t *testing.T) {
+	score := 4.25
+	sheets := []Sheet{
+		{
+			Name: "Успеваемость",
+			Rows: [][]any{
+				{"Группа", "Студент", "Средний балл", "Пропуски"},
+				{"ИВТ-21", "Иванов <Иван> & Ко", &score, 3},
+				{"ИВТ-21", "  Петров  ", (*float64)(nil), int64(0)},
+				{nil, "Итого", 4.5, true},
+			},
+		},
+		{
+			Name: "Посещаемость: [март/апрель]? слишком длинное название листа",
+			Rows: [][]any{
+				{"A", "B", "C", "D", "E", "F", "G", "H", "I", "J", "K", "L", "M",
+					"N", "O", "P", "Q", "R", "S", "T", "U", "V", "W", "X", "Y", "Z", "AA"},
+			},
+		},
+		{Name: "  "},
+	}
+
+	data, err := Bytes(sheets)
+	if err != nil {
+		t.Fatalf("Bytes: %v", err)
+	}
+	got := readParts(t, data)
+
+	golden := filepath.Join("testdata", "report.golden")
+	if *update {
+		if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("output differs from %s:\n%s", golden, got)
+	}
+}
+
+func TestWriteNoSheets(t *testing.T) {
+	if _, err := Bytes(nil); err == nil {
+		t.Error("Bytes(nil) succeeded, want an error")
+	}
+}
+
+func TestCellRef(t *testing.T) {
+	tests := []struct {
+		col, row int
+		want     string
+	}{
+		{0, 0, "A1"},
+		{25, 1, "Z2"},
+		{26, 2, "AA3"},
+		{51, 9, "AZ10"},
+		{52, 0, "BA1"},
+		{701, 0, "ZZ1"},
+		{702, 0, "AAA1"},
+	}
+	for _, tt := range tests {
+		if got := cellRef(tt.col, tt.row); got != tt.want {
+			t.Errorf("cellRef(%d, %d) = %s, want %s", tt.col, tt.row, got, tt.want)
+		}
+	}
+}